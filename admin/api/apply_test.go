@@ -0,0 +1,131 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countingAPI stages c1 and c2 and counts OnApply calls per config ID.
+func countingAPI(t *testing.T) (*testAPI, map[string]int) {
+	t.Helper()
+	a := newTestAPI(t)
+	pushed := map[string]int{}
+	a.srv.OnApply = func(id, content string) error {
+		pushed[id]++
+		return nil
+	}
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/stage", stageBody("c1", validWSX))
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/stage", stageBody("c2", validWSX))
+	return a, pushed
+}
+
+func TestRepeatedApplyTakesEffectOnce(t *testing.T) {
+	a, pushed := countingAPI(t)
+	first := a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/apply", `{"id":"c1","plan":"canary-100"}`)
+	again := a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/apply", `{"id":"c1","plan":"canary-100"}`)
+	if first.Body.String() != again.Body.String() {
+		t.Errorf("retry answered %s, original %s", again.Body, first.Body)
+	}
+	if pushed["c1"] != 1 || len(a.srv.applied) != 1 {
+		t.Errorf("pushed %v, history %v; want a single apply", pushed, a.srv.applied)
+	}
+}
+
+func TestApplyRunsAgainAfterStateChanges(t *testing.T) {
+	a, pushed := countingAPI(t)
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/apply", `{"id":"c1","plan":"canary-100"}`)
+
+	// A different plan is a different request
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/apply", `{"id":"c1","plan":"canary-50-100"}`)
+	if pushed["c1"] != 2 {
+		t.Errorf("c1 pushed %d times, want 2", pushed["c1"])
+	}
+
+	// Once another config took over, re-applying c1 is a real change
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/apply", `{"id":"c2","plan":"canary-100"}`)
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/apply", `{"id":"c1","plan":"canary-50-100"}`)
+	if pushed["c1"] != 3 || len(a.srv.applied) != 4 {
+		t.Errorf("pushed %v, history %d entries", pushed, len(a.srv.applied))
+	}
+	rec := a.mustDo(t, http.StatusOK, "GET", "/api/v1/config/history", "")
+	if !strings.Contains(rec.Body.String(), `["c1","c1","c2","c1"]`) {
+		t.Errorf("history = %s", rec.Body)
+	}
+}
+
+// applyWithKey sends an apply for id carrying an Idempotency-Key header.
+func (a *testAPI) applyWithKey(id, plan, key string) *httptest.ResponseRecorder {
+	body := `{"id":"` + id + `","plan":"` + plan + `"}`
+	r := httptest.NewRequest("POST", "/api/v1/config/apply", strings.NewReader(body))
+	r.Header.Set("X-OLWSX-Auth", sign(testKey, body))
+	r.Header.Set("Idempotency-Key", key)
+	rec := httptest.NewRecorder()
+	a.mux.ServeHTTP(rec, r)
+	return rec
+}
+
+func TestIdempotencyKeyReplaysFirstApply(t *testing.T) {
+	a, pushed := countingAPI(t)
+	first := a.applyWithKey("c1", "canary-100", "k-1")
+	if first.Code != http.StatusOK || first.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("first apply: %d %s", first.Code, first.Body)
+	}
+	// c2 takes over, so re-running c1 would be a real change; the keyed retry must not run it
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/apply", `{"id":"c2","plan":"canary-100"}`)
+	retry := a.applyWithKey("c1", "canary-100", "k-1")
+	if retry.Code != first.Code || retry.Body.String() != first.Body.String() || retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry: %d %s (replayed %q), original %d %s", retry.Code, retry.Body, retry.Header().Get("Idempotent-Replayed"), first.Code, first.Body)
+	}
+	if pushed["c1"] != 1 || len(a.srv.applied) != 2 {
+		t.Errorf("pushed %v, history %d entries; want c1 applied once", pushed, len(a.srv.applied))
+	}
+
+	// Same key, different plan: refused rather than replayed
+	if rec := a.applyWithKey("c1", "canary-50-100", "k-1"); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("key reused with another plan: status %d", rec.Code)
+	}
+	// Keys are scoped per config ID
+	if rec := a.applyWithKey("c2", "canary-50-100", "k-1"); rec.Code != http.StatusOK || rec.Header().Get("Idempotent-Replayed") != "" || pushed["c2"] != 2 {
+		t.Errorf("same key on c2: status %d, replayed %q, c2 pushed %d", rec.Code, rec.Header().Get("Idempotent-Replayed"), pushed["c2"])
+	}
+	// The body field works like the header
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/apply", `{"id":"c1","plan":"canary-50-100","idempotency_key":"k-2"}`)
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/apply", `{"id":"c2","plan":"canary-100"}`)
+	rec := a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/apply", `{"id":"c1","plan":"canary-50-100","idempotency_key":"k-2"}`)
+	if rec.Header().Get("Idempotent-Replayed") != "true" || pushed["c1"] != 2 {
+		t.Errorf("body key: replayed %q, c1 pushed %d", rec.Header().Get("Idempotent-Replayed"), pushed["c1"])
+	}
+}
+
+func TestIdempotencyKeyExpires(t *testing.T) {
+	a, pushed := countingAPI(t)
+	a.srv.IdempotencyTTL = 20 * time.Millisecond
+	a.applyWithKey("c1", "canary-100", "k")
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/apply", `{"id":"c2","plan":"canary-100"}`)
+	time.Sleep(40 * time.Millisecond)
+	if rec := a.applyWithKey("c1", "canary-100", "k"); rec.Code != http.StatusOK || rec.Header().Get("Idempotent-Replayed") != "" || pushed["c1"] != 2 {
+		t.Errorf("after the TTL: status %d, replayed %q, c1 pushed %d", rec.Code, rec.Header().Get("Idempotent-Replayed"), pushed["c1"])
+	}
+}
+
+func TestIdempotencyPendingAndServerErrors(t *testing.T) {
+	s := NewServer(testKey)
+	if _, replay := s.idemBegin("c1", "k", "canary-100"); replay {
+		t.Fatal("fresh key replayed")
+	}
+	if out, replay := s.idemBegin("c1", "k", "canary-100"); !replay || out.Code != http.StatusConflict {
+		t.Errorf("retry while running: %+v, replay %t; want 409", out, replay)
+	}
+	// A 5xx is forgotten so the retry applies for real
+	s.idemFinish("c1", "k", "canary-100", applyOutcome{http.StatusServiceUnavailable, "shutting down"})
+	if _, replay := s.idemBegin("c1", "k", "canary-100"); replay {
+		t.Error("5xx outcome was replayed")
+	}
+	s.idemFinish("c1", "k", "canary-100", applyOutcome{http.StatusConflict, "not staged"})
+	if out, replay := s.idemBegin("c1", "k", "canary-100"); !replay || out.Code != http.StatusConflict || out.Err != "not staged" {
+		t.Errorf("4xx outcome: %+v, replay %t", out, replay)
+	}
+}
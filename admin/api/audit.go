@@ -0,0 +1,195 @@
+// =============================================================================
+// OLWSX - OverLab Web ServerX
+// File: admin/api/audit.go
+// Role: Append-only audit log of admin config operations (REST and gRPC)
+// Philosophy: One version, the most stable version, first and last.
+// -----------------------------------------------------------------------------
+// Responsibilities:
+// - Record who did which write operation, on what, and with which result.
+// - Optionally persist entries as JSON lines (append + fsync) and reload them.
+// - Serve the log page by page via GET /api/v1/audit.
+// =============================================================================
+
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// AuditEntry is one admin write operation.
+type AuditEntry struct {
+	TsMs   int64  `json:"ts_ms"`
+	API    string `json:"api"` // "rest" or "grpc"
+	Op     string `json:"op"`
+	ID     string `json:"id,omitempty"`
+	Plan   string `json:"plan,omitempty"`
+	Role   string `json:"role,omitempty"`
+	KeyID  string `json:"key_id,omitempty"`
+	Result string `json:"result"` // "ok" or the error
+}
+
+// AuditLog is safe for concurrent use and may be shared by the REST and gRPC servers.
+type AuditLog struct {
+	mu      sync.Mutex
+	path    string // "" = memory only
+	entries []AuditEntry
+}
+
+// NewAuditLog returns an in-memory audit log.
+func NewAuditLog() *AuditLog { return &AuditLog{} }
+
+// OpenAuditLog loads the JSON-lines audit file at path (if any) and appends to it from now on.
+// A torn last line from a crash is cut off so the next entry starts on a line of its own.
+func OpenAuditLog(path string) (*AuditLog, error) {
+	a := &AuditLog{path: path}
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	complete := bytes.LastIndexByte(raw, '\n') + 1
+	for _, line := range bytes.Split(raw[:complete], []byte{'\n'}) {
+		var e AuditEntry
+		if json.Unmarshal(line, &e) == nil {
+			a.entries = append(a.entries, e)
+		}
+	}
+	if complete < len(raw) {
+		if err := os.Truncate(path, int64(complete)); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// Record appends e (stamping TsMs if unset) and persists it before returning.
+func (a *AuditLog) Record(e AuditEntry) error {
+	if e.TsMs == 0 {
+		e.TsMs = nowMs()
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.entries = append(a.entries, e)
+	if a.path == "" {
+		return nil
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(a.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Page returns up to limit entries starting at offset (oldest first) and the total count.
+func (a *AuditLog) Page(offset, limit int) ([]AuditEntry, int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	total := len(a.entries)
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	return append([]AuditEntry(nil), a.entries[offset:end]...), total
+}
+
+// auditResult renders an operation outcome for AuditEntry.Result.
+func auditResult(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return "ok"
+}
+
+// statusRecorder captures the status and (error) body a handler wrote.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	if r.status >= 400 && r.body.Len() < 256 {
+		r.body.Write(p)
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+// Middleware: record every non-GET call of next in the audit log. Must run inside withAuth.
+func (s *Server) withAudit(op string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+		body := readBody(r)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		var target struct{ ID, Plan, To string }
+		_ = json.Unmarshal(body, &target)
+		if target.ID == "" {
+			target.ID = target.To
+		}
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		e := AuditEntry{API: "rest", Op: op, ID: target.ID, Plan: target.Plan, Result: "ok"}
+		if p, ok := PrincipalFrom(r); ok {
+			e.Role, e.KeyID = p.Role, p.KeyID
+		}
+		if rec.status >= 400 {
+			e.Result = strconv.Itoa(rec.status) + " " + strings.TrimSpace(rec.body.String())
+		}
+		_ = s.Audit.Record(e)
+	}
+}
+
+// GET /api/v1/audit?offset=0&limit=100
+func (s *Server) AuditList(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	offset, limit := 0, 100
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 { http.Error(w, "bad offset", http.StatusBadRequest); return }
+		offset = n
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 1000 { http.Error(w, "bad limit", http.StatusBadRequest); return }
+		limit = n
+	}
+	entries, total := s.Audit.Page(offset, limit)
+	writeJSON(w, map[string]interface{}{"total": total, "offset": offset, "entries": entries}, http.StatusOK)
+}
@@ -0,0 +1,185 @@
+// =============================================================================
+// OLWSX - OverLab Web ServerX
+// File: admin/api/canary.go
+// Role: Canary rollout runner for applied configs (REST admin API)
+// Philosophy: One version, the most stable version, first and last.
+// -----------------------------------------------------------------------------
+// Responsibilities:
+// - Parse "canary-10-25-50-100" plans into traffic percentage stages.
+// - Advance stages on a timer or on explicit promote calls.
+// - Roll back to the previous config when the error ratio exceeds the threshold.
+// =============================================================================
+
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Canary rollout states.
+const (
+	CanaryRunning    = "running"
+	CanaryComplete   = "complete"
+	CanaryRolledBack = "rolled_back"
+)
+
+// canaryRun is the rollout of one applied config.
+type canaryRun struct {
+	ID        string `json:"id"`
+	Plan      string `json:"plan"`
+	Stages    []int  `json:"stages"`
+	Stage     int    `json:"stage"`   // index into Stages
+	Percent   int    `json:"percent"` // traffic share currently on the new config
+	State     string `json:"state"`
+	Previous  string `json:"previous,omitempty"` // rollback target; "" = none
+	StageMs   int64  `json:"stage_started_ms"`
+	LastError string `json:"last_error,omitempty"`
+	timer     *time.Timer
+	prev      *appliedConfig
+}
+
+// parsePlan turns "canary-10-25-50-100" into strictly increasing stages ending at 100.
+func parsePlan(plan string) ([]int, error) {
+	rest, ok := strings.CutPrefix(plan, "canary-")
+	if !ok || rest == "" {
+		return nil, fmt.Errorf("plan %q: want canary-<pct>-...-100", plan)
+	}
+	var stages []int
+	for _, f := range strings.Split(rest, "-") {
+		pct, err := strconv.Atoi(f)
+		if err != nil || pct <= 0 || pct > 100 {
+			return nil, fmt.Errorf("plan %q: bad stage %q", plan, f)
+		}
+		if n := len(stages); n > 0 && pct <= stages[n-1] {
+			return nil, fmt.Errorf("plan %q: stages must increase", plan)
+		}
+		stages = append(stages, pct)
+	}
+	if stages[len(stages)-1] != 100 {
+		return nil, fmt.Errorf("plan %q: last stage must be 100", plan)
+	}
+	return stages, nil
+}
+
+// startCanaryLocked begins rolling out id at its first stage; s.mu must be held.
+func (s *Server) startCanaryLocked(id, plan string, stages []int, previous *appliedConfig) {
+	s.stopCanaryLocked()
+	s.canary = &canaryRun{ID: id, Plan: plan, Stages: stages, State: CanaryRunning, prev: previous}
+	if previous != nil {
+		s.canary.Previous = previous.ID
+	}
+	s.enterStageLocked(0)
+}
+
+// enterStageLocked moves the rollout to stage i and arms the timer for the next one.
+func (s *Server) enterStageLocked(i int) {
+	c := s.canary
+	c.Stage, c.Percent, c.StageMs = i, c.Stages[i], nowMs()
+	if s.OnCanary != nil {
+		if err := s.OnCanary(c.ID, c.Percent); err != nil {
+			c.LastError = err.Error()
+		}
+	}
+	if c.Percent == 100 {
+		c.State = CanaryComplete
+		return
+	}
+	if s.CanaryInterval > 0 {
+		c.timer = time.AfterFunc(s.CanaryInterval, func() { s.tickCanary(c) })
+	}
+}
+
+// tickCanary runs at the end of a timed stage: roll back on a bad error ratio, else promote.
+func (s *Server) tickCanary(c *canaryRun) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.canary != c || c.State != CanaryRunning || s.closing {
+		return
+	}
+	if s.ErrorRatio != nil && s.MaxErrorRatio > 0 {
+		if ratio := s.ErrorRatio(); ratio > s.MaxErrorRatio {
+			s.rollbackCanaryLocked(fmt.Sprintf("error ratio %.4f > %.4f", ratio, s.MaxErrorRatio))
+			return
+		}
+	}
+	s.enterStageLocked(c.Stage + 1)
+}
+
+// rollbackCanaryLocked aborts the running rollout and restores the previous config.
+func (s *Server) rollbackCanaryLocked(reason string) {
+	s.withdrawCanaryLocked(reason)
+	c := s.canary
+	if c.prev == nil {
+		return
+	}
+	if s.OnApply != nil {
+		if err := s.OnApply(c.prev.ID, c.prev.Content); err != nil {
+			c.LastError += "; restore failed: " + err.Error()
+			return
+		}
+	}
+	s.applied = append(s.applied, *c.prev)
+	_ = s.saveStateLocked()
+}
+
+// withdrawCanaryLocked stops the rollout and takes all traffic off the canary, recording why;
+// s.mu must be held and s.canary set.
+func (s *Server) withdrawCanaryLocked(reason string) {
+	s.stopCanaryLocked()
+	c := s.canary
+	c.State, c.Percent, c.LastError = CanaryRolledBack, 0, reason
+	if s.OnCanary != nil {
+		if err := s.OnCanary(c.ID, 0); err != nil {
+			c.LastError += "; withdraw failed: " + err.Error()
+		}
+	}
+}
+
+// stopCanaryLocked disarms any pending stage timer; s.mu must be held.
+func (s *Server) stopCanaryLocked() {
+	if s.canary != nil && s.canary.timer != nil {
+		s.canary.timer.Stop()
+	}
+}
+
+var errNoCanary = errors.New("no running canary")
+
+// promoteCanary advances the running rollout by one stage immediately.
+func (s *Server) promoteCanary() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.canary
+	if c == nil || c.State != CanaryRunning {
+		return errNoCanary
+	}
+	s.stopCanaryLocked()
+	s.enterStageLocked(c.Stage + 1)
+	return nil
+}
+
+// GET /api/v1/config/canary/status
+func (s *Server) CanaryStatus(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.canary == nil {
+		writeJSON(w, map[string]string{"state": "idle"}, http.StatusOK)
+		return
+	}
+	writeJSON(w, s.canary, http.StatusOK)
+}
+
+// POST /api/v1/config/canary/promote
+func (s *Server) CanaryPromote(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed); return
+	}
+	if err := s.promoteCanary(); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict); return
+	}
+	s.CanaryStatus(w, r)
+}
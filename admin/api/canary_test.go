@@ -0,0 +1,196 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParsePlan(t *testing.T) {
+	for plan, want := range map[string][]int{
+		"canary-10-25-50-100": {10, 25, 50, 100},
+		"canary-1-100":        {1, 100},
+		"canary-100":          {100},
+	} {
+		if got, err := parsePlan(plan); err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("parsePlan(%q) = %v, %v; want %v", plan, got, err, want)
+		}
+	}
+	for _, plan := range []string{"", "canary-", "bluegreen-100", "canary-10-50", "canary-50-25-100",
+		"canary-10-10-100", "canary-0-100", "canary-10-150", "canary-ten-100", "canary-10--100"} {
+		if _, err := parsePlan(plan); err == nil {
+			t.Errorf("parsePlan(%q) accepted", plan)
+		}
+	}
+}
+
+// canaryAPI is a test API with c1 live and c2 staged; traffic shares and configs pushed
+// through OnApply are recorded.
+type canaryAPI struct {
+	*testAPI
+	mu       sync.Mutex
+	shares   []int
+	pushed []string
+}
+
+func newCanaryAPI(t *testing.T, interval time.Duration, ratio float64) *canaryAPI {
+	c := &canaryAPI{testAPI: newTestAPI(t)}
+	s := c.srv
+	s.CanaryInterval, s.MaxErrorRatio = interval, 0.1
+	s.ErrorRatio = func() float64 { return ratio }
+	c.mustDo(t, http.StatusOK, "POST", "/api/v1/config/stage", stageBody("c1", validWSX))
+	c.mustDo(t, http.StatusOK, "POST", "/api/v1/config/stage", stageBody("c2", validWSX+"\n"))
+	c.mustDo(t, http.StatusOK, "POST", "/api/v1/config/apply", `{"id":"c1","plan":"canary-100"}`)
+	s.OnCanary = func(id string, percent int) error {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.shares = append(c.shares, percent)
+		return nil
+	}
+	s.OnApply = func(id, content string) error {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.pushed = append(c.pushed, id)
+		return nil
+	}
+	t.Cleanup(func() {
+		s.mu.Lock()
+		s.stopCanaryLocked()
+		s.mu.Unlock()
+	})
+	return c
+}
+
+func (c *canaryAPI) status(t *testing.T) canaryRun {
+	t.Helper()
+	var st canaryRun
+	if err := json.Unmarshal(c.mustDo(t, http.StatusOK, "GET", "/api/v1/config/canary/status", "").Body.Bytes(), &st); err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+// waitState polls the status until the rollout reaches state.
+func (c *canaryAPI) waitState(t *testing.T, state string) canaryRun {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		st := c.status(t)
+		if st.State == state {
+			return st
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("canary stuck in %+v, want %s", st, state)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCanaryAdvancesOnPromote(t *testing.T) {
+	c := newCanaryAPI(t, 0, 0)
+	c.mustDo(t, http.StatusOK, "POST", "/api/v1/config/apply", `{"id":"c2","plan":"canary-10-50-100"}`)
+	if st := c.status(t); st.ID != "c2" || st.Percent != 10 || st.State != CanaryRunning || st.Previous != "c1" {
+		t.Fatalf("after apply: %+v", st)
+	}
+	c.mustDo(t, http.StatusOK, "POST", "/api/v1/config/canary/promote", "")
+	if st := c.status(t); st.Stage != 1 || st.Percent != 50 {
+		t.Errorf("after one promote: %+v", st)
+	}
+	c.mustDo(t, http.StatusOK, "POST", "/api/v1/config/canary/promote", "")
+	if st := c.status(t); st.Percent != 100 || st.State != CanaryComplete {
+		t.Errorf("after two promotes: %+v", st)
+	}
+	c.mustDo(t, http.StatusConflict, "POST", "/api/v1/config/canary/promote", "")
+	if !reflect.DeepEqual(c.shares, []int{10, 50, 100}) {
+		t.Errorf("traffic shares = %v", c.shares)
+	}
+}
+
+func TestCanaryAdvancesOnTimer(t *testing.T) {
+	c := newCanaryAPI(t, 10*time.Millisecond, 0)
+	c.mustDo(t, http.StatusOK, "POST", "/api/v1/config/apply", `{"id":"c2","plan":"canary-10-25-50-100"}`)
+	c.waitState(t, CanaryComplete)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !reflect.DeepEqual(c.shares, []int{10, 25, 50, 100}) || !reflect.DeepEqual(c.pushed, []string{"c2"}) {
+		t.Errorf("traffic shares = %v, pushed %v", c.shares, c.pushed)
+	}
+}
+
+func TestCanaryRollsBackOnErrorRatio(t *testing.T) {
+	c := newCanaryAPI(t, 10*time.Millisecond, 0.5)
+	c.mustDo(t, http.StatusOK, "POST", "/api/v1/config/apply", `{"id":"c2","plan":"canary-10-50-100"}`)
+	st := c.waitState(t, CanaryRolledBack)
+	if st.Percent != 0 || st.LastError == "" {
+		t.Errorf("rolled back canary: %+v", st)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !reflect.DeepEqual(c.shares, []int{10, 0}) || !reflect.DeepEqual(c.pushed, []string{"c2", "c1"}) {
+		t.Errorf("traffic shares = %v, pushed %v", c.shares, c.pushed)
+	}
+	if n := len(c.srv.applied); n == 0 || c.srv.applied[n-1].ID != "c1" {
+		t.Errorf("applied log = %v, want c1 pushed last", c.srv.applied)
+	}
+}
+
+func TestManualRollbackWithdrawsCanaryTraffic(t *testing.T) {
+	c := newCanaryAPI(t, 0, 0)
+	c.mustDo(t, http.StatusOK, "POST", "/api/v1/config/apply", `{"id":"c2","plan":"canary-10-50-100"}`)
+	c.mustDo(t, http.StatusOK, "POST", "/api/v1/config/canary/promote", "")
+	c.mustDo(t, http.StatusOK, "POST", "/api/v1/config/rollback", `{"to":"c1"}`)
+	if st := c.status(t); st.State != CanaryRolledBack || st.Percent != 0 {
+		t.Errorf("after manual rollback: %+v", st)
+	}
+	if !reflect.DeepEqual(c.shares, []int{10, 50, 0}) {
+		t.Errorf("traffic shares = %v, want the canary withdrawn", c.shares)
+	}
+}
+
+func TestCanaryWithoutPreviousIsWithdrawn(t *testing.T) {
+	a := newTestAPI(t)
+	s := a.srv
+	s.CanaryInterval, s.MaxErrorRatio = 10*time.Millisecond, 0.1
+	s.ErrorRatio = func() float64 { return 0.5 }
+	var mu sync.Mutex
+	var shares []int
+	s.OnCanary = func(id string, percent int) error {
+		mu.Lock()
+		defer mu.Unlock()
+		shares = append(shares, percent)
+		if percent == 0 {
+			return errors.New("data plane unreachable")
+		}
+		return nil
+	}
+	t.Cleanup(func() {
+		s.mu.Lock()
+		s.stopCanaryLocked()
+		s.mu.Unlock()
+	})
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/stage", stageBody("c1", validWSX))
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/apply", `{"id":"c1","plan":"canary-10-100"}`)
+	st := (&canaryAPI{testAPI: a}).waitState(t, CanaryRolledBack)
+	if st.Percent != 0 || !strings.Contains(st.LastError, "withdraw failed: data plane unreachable") {
+		t.Errorf("rolled back first canary: %+v", st)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(shares, []int{10, 0}) {
+		t.Errorf("traffic shares = %v, want the canary withdrawn", shares)
+	}
+}
+
+func TestApplyRejectsBadPlan(t *testing.T) {
+	a := newTestAPI(t)
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/stage", stageBody("c1", validWSX))
+	a.mustDo(t, http.StatusBadRequest, "POST", "/api/v1/config/apply", `{"id":"c1","plan":"canary-50-10"}`)
+	if rec := a.mustDo(t, http.StatusOK, "GET", "/api/v1/config/canary/status", ""); rec.Body.String() != `{"state":"idle"}`+"\n" {
+		t.Errorf("status after a refused apply = %s", rec.Body)
+	}
+}
@@ -0,0 +1,135 @@
+// =============================================================================
+// OLWSX - OverLab Web ServerX
+// File: admin/api/diff.go
+// Role: Section-level diff of a staged WSX config against the applied one
+// Philosophy: One version, the most stable version, first and last.
+// -----------------------------------------------------------------------------
+// Responsibilities:
+// - Split WSX content into statements (one per line) keyed by what they configure:
+//   route "<prefix>", header "<name>" for "<prefix>", cache "<key>", ratelimit, generation;
+//   waf rules are keyed by their whole text.
+// - Report each section as added, removed or modified; nothing applied = everything added.
+// - Staged order first, then removals in applied order, so output is deterministic.
+// =============================================================================
+
+package admin
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ConfigChange is one changed section. Line is 1-based in the staged config, or in the
+// applied config for removals.
+type ConfigChange struct {
+	Op      string `json:"op"` // added, removed or modified
+	Section string `json:"section"`
+	Line    int    `json:"line"`
+	Old     string `json:"old,omitempty"`
+	New     string `json:"new,omitempty"`
+}
+
+// ConfigDiff compares staged config ID against Base, the active config ("" = none applied).
+type ConfigDiff struct {
+	ID       string         `json:"id"`
+	Base     string         `json:"base"`
+	Added    int            `json:"added"`
+	Removed  int            `json:"removed"`
+	Modified int            `json:"modified"`
+	Changes  []ConfigChange `json:"changes"`
+}
+
+// wsxStatement is one statement in canonical form (comments and spacing dropped).
+type wsxStatement struct {
+	section, text string
+	line          int
+}
+
+// DiffWSX compares staged against base; content that does not lex is refused with ErrInvalidConfig.
+func DiffWSX(id, baseID, base, staged string) (*ConfigDiff, error) {
+	old, issue := wsxStatements(base)
+	if issue != nil {
+		return nil, fmt.Errorf("%w: applied config %s: %s", ErrInvalidConfig, baseID, issue)
+	}
+	cur, issue := wsxStatements(staged)
+	if issue != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, issue)
+	}
+	d := &ConfigDiff{ID: id, Base: baseID, Changes: []ConfigChange{}}
+	byKey := make(map[string]int, len(old))
+	for i, st := range old { byKey[st.section] = i }
+	seen := make([]bool, len(old))
+	for _, st := range cur {
+		i, ok := byKey[st.section]
+		switch {
+		case !ok:
+			d.Added++
+			d.Changes = append(d.Changes, ConfigChange{Op: "added", Section: st.section, Line: st.line, New: st.text})
+		case old[i].text != st.text:
+			d.Modified++
+			d.Changes = append(d.Changes, ConfigChange{Op: "modified", Section: st.section, Line: st.line, Old: old[i].text, New: st.text})
+		}
+		if ok { seen[i] = true }
+	}
+	for i, st := range old {
+		if !seen[i] {
+			d.Removed++
+			d.Changes = append(d.Changes, ConfigChange{Op: "removed", Section: st.section, Line: st.line, Old: st.text})
+		}
+	}
+	return d, nil
+}
+
+// wsxStatements lexes content into statements; a repeated section gets a "#n" suffix so
+// duplicates pair up in order.
+func wsxStatements(content string) ([]wsxStatement, *ConfigIssue) {
+	toks, lexErr := wsxLex(content)
+	if lexErr != nil { return nil, lexErr }
+	var out []wsxStatement
+	count := map[string]int{}
+	for start := 0; start < len(toks); {
+		end := start
+		for end < len(toks) && toks[end].kind != "NL" { end++ }
+		if end > start {
+			st := wsxStatement{section: wsxSection(toks[start:end]), text: wsxText(toks[start:end]), line: toks[start].line}
+			n := count[st.section]
+			count[st.section]++
+			if n > 0 { st.section += "#" + strconv.Itoa(n+1) }
+			out = append(out, st)
+		}
+		start = end + 1
+	}
+	return out, nil
+}
+
+// wsxSection names what a statement configures.
+func wsxSection(st []wsxToken) string {
+	str := func(i int) (string, bool) {
+		if i < len(st) && st[i].kind == "STRING" { return strconv.Quote(st[i].val), true }
+		return "", false
+	}
+	switch st[0].val {
+	case "ratelimit", "generation":
+		return st[0].val
+	case "route":
+		if p, ok := str(1); ok { return "route " + p }
+	case "header":
+		k, ok1 := str(1)
+		p, ok2 := str(5)
+		if ok1 && ok2 { return "header " + k + " for " + p }
+	case "cache":
+		if k, ok := str(3); ok { return "cache " + k }
+	}
+	return wsxText(st)
+}
+
+// wsxText renders tokens canonically: single spaces, strings quoted, flag lists unspaced.
+func wsxText(st []wsxToken) string {
+	var b strings.Builder
+	for i, t := range st {
+		if i > 0 && t.kind != "," && st[i-1].kind != "," { b.WriteByte(' ') }
+		if t.kind == "STRING" { b.WriteString(strconv.Quote(t.val)) } else { b.WriteString(t.val) }
+	}
+	return b.String()
+}
@@ -0,0 +1,116 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// stagedWSX is cleanWSX with one section of each kind changed, one removed and two added.
+const stagedWSX = `# next release
+generation 4
+route "/"   status 200 flags COMP_GZIP,CACHE_L1
+route "/api/" status 200
+waf block_path_contains "/.git"
+waf block_path_contains "/.env"
+ratelimit capacity 100 refill_per_s 10 retry_after_s 1
+cache warmup_l2 key "home" value "<html>" flags CACHE_L2
+cache warmup_l2 key "about" value "<p>" flags CACHE_L2
+`
+
+func TestDiffWSXReportsSectionChanges(t *testing.T) {
+	d, err := DiffWSX("c2", "c1", cleanWSX, stagedWSX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ConfigChange{
+		{Op: "modified", Section: "generation", Line: 2, Old: "generation 3", New: "generation 4"},
+		{Op: "modified", Section: `route "/api/"`, Line: 4, Old: `route "/api/" status 204`, New: `route "/api/" status 200`},
+		{Op: "added", Section: `waf block_path_contains "/.env"`, Line: 6, New: `waf block_path_contains "/.env"`},
+		{Op: "added", Section: `cache "about"`, Line: 9, New: `cache warmup_l2 key "about" value "<p>" flags CACHE_L2`},
+		{Op: "removed", Section: `header "X-Edge" for "/api/"`, Line: 4, Old: `header "X-Edge" : "olwsx" for "/api/"`},
+	}
+	if d.ID != "c2" || d.Base != "c1" || d.Added != 2 || d.Removed != 1 || d.Modified != 2 {
+		t.Errorf("summary %+v", d)
+	}
+	if len(d.Changes) != len(want) {
+		t.Fatalf("changes %+v", d.Changes)
+	}
+	for i, c := range d.Changes {
+		// Comments, spacing and flag-list layout are not changes: route "/" is absent
+		if c.Op != want[i].Op || c.Section != want[i].Section || c.Line != want[i].Line || c.New != want[i].New {
+			t.Errorf("change %d = %+v, want %+v", i, c, want[i])
+		}
+		if want[i].Op != "added" && c.Old == "" {
+			t.Errorf("change %d has no old text", i)
+		}
+	}
+}
+
+func TestDiffWSXAgainstNothingAddsEverything(t *testing.T) {
+	d, err := DiffWSX("c1", "", "", cleanWSX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Added != 7 || d.Removed != 0 || d.Modified != 0 || len(d.Changes) != 7 {
+		t.Errorf("%+v", d)
+	}
+	// Repeated sections pair up in order rather than colliding
+	d, _ = DiffWSX("c2", "c1", "waf block_path_contains \"/a\"\nroute \"/\" status 200\nroute \"/\" status 204", "route \"/\" status 200\nroute \"/\" status 500")
+	if d.Modified != 1 || d.Removed != 1 || d.Changes[0].Section != `route "/"#2` {
+		t.Errorf("duplicates: %+v", d)
+	}
+	if _, err := DiffWSX("c2", "c1", cleanWSX, `route "/ status 200`); !errors.Is(err, ErrInvalidConfig) {
+		t.Errorf("unlexable staged config: %v", err)
+	}
+}
+
+func TestDiffEndpoint(t *testing.T) {
+	a := newTestAPI(t)
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/stage", stageBody("c1", cleanWSX))
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/stage", stageBody("c2", stagedWSX))
+	diff := func(id string) ConfigDiff {
+		var d ConfigDiff
+		rec := a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/diff", `{"id":"`+id+`"}`)
+		if err := json.Unmarshal(rec.Body.Bytes(), &d); err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	if d := diff("c2"); d.Base != "" || d.Added != 8 || d.Removed != 0 {
+		t.Errorf("nothing applied: %+v", d)
+	}
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/apply", `{"id":"c1","plan":"canary-100"}`)
+	if d := diff("c2"); d.Base != "c1" || d.Added != 2 || d.Removed != 1 || d.Modified != 2 {
+		t.Errorf("against c1: %+v", d)
+	}
+	if d := diff("c1"); len(d.Changes) != 0 {
+		t.Errorf("active config against itself: %+v", d.Changes)
+	}
+	a.mustDo(t, http.StatusNotFound, "POST", "/api/v1/config/diff", `{"id":"missing"}`)
+	a.mustDo(t, http.StatusBadRequest, "POST", "/api/v1/config/diff", `{}`)
+}
+
+func TestGRPCDiff(t *testing.T) {
+	svc := NewAdminServer()
+	ctx := context.Background()
+	for id, content := range map[string]string{"c1": cleanWSX, "c2": stagedWSX} {
+		if _, err := svc.StageConfig(ctx, &StageRequest{ID: id, Content: content}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d, err := svc.Diff(ctx, &ConfigID{ID: "c2"}); err != nil || d.Base != "" || d.Removed != 0 {
+		t.Errorf("nothing applied: %+v, %v", d, err)
+	}
+	if _, err := svc.Apply(ctx, &ApplyRequest{ID: "c1", Plan: "canary-100"}); err != nil {
+		t.Fatal(err)
+	}
+	if d, err := svc.Diff(ctx, &ConfigID{ID: "c2"}); err != nil || d.Base != "c1" || d.Added != 2 || d.Removed != 1 || d.Modified != 2 {
+		t.Errorf("against c1: %+v, %v", d, err)
+	}
+	if _, err := svc.Diff(ctx, &ConfigID{ID: "missing"}); err != errNotStaged {
+		t.Errorf("unstaged: %v", err)
+	}
+}
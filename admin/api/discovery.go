@@ -0,0 +1,121 @@
+// =============================================================================
+// OLWSX - OverLab Web ServerX
+// File: admin/api/discovery.go
+// Role: Route table and discovery for the REST admin API
+// Philosophy: One version, the most stable version, first and last.
+// -----------------------------------------------------------------------------
+// Responsibilities:
+// - One table of routes, methods and handlers, bound by Routes.
+// - GET /api/v1/ lists every route with its methods and the role each needs (no auth).
+// - OPTIONS on a route answers 204 with Allow (no auth); undeclared methods get 405.
+// - WithOptionsStar answers "OPTIONS *" with the union of all methods.
+// =============================================================================
+
+package admin
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// apiRoute is one endpoint; GET needs any valid key, other methods an operator key (withAuth).
+type apiRoute struct {
+	Path    string
+	Methods []string
+	h       http.HandlerFunc
+}
+
+var (
+	methodsGet     = []string{http.MethodGet}
+	methodsPost    = []string{http.MethodPost}
+	methodsGetPost = []string{http.MethodGet, http.MethodPost}
+)
+
+func (s *Server) routes() []apiRoute {
+	return []apiRoute{
+		{"/api/v1/snapshot", methodsGet, s.withAuth(s.Snapshot)},
+		{"/api/v1/snapshot/stream", methodsGet, s.withAuth(s.SnapshotStream)},
+		{"/api/v1/snapshot/history", methodsGet, s.withAuth(s.SnapshotHistory)},
+		{"/api/v1/audit", methodsGet, s.withAuth(s.AuditList)},
+		{"/api/v1/lock", methodsGetPost, s.withAuth(s.withAudit("lock", s.Lock))},
+		{"/api/v1/auth/rotate", methodsPost, s.withAuth(s.withAudit("rotate_key", s.RotateKey))},
+		{"/api/v1/config/stage", methodsPost, s.withAuth(s.withAudit("stage", s.withWriteLock(s.StageConfig)))},
+		{"/api/v1/config/dryrun", methodsPost, s.withAuth(s.DryRun)},
+		{"/api/v1/config/diff", methodsPost, s.withAuth(s.Diff)},
+		{"/api/v1/config/apply", methodsPost, s.withAuth(s.withAudit("apply", s.withWriteLock(s.Apply)))},
+		{"/api/v1/config/canary/status", methodsGet, s.withAuth(s.CanaryStatus)},
+		{"/api/v1/config/canary/promote", methodsPost, s.withAuth(s.withAudit("canary_promote", s.withWriteLock(s.CanaryPromote)))},
+		{"/api/v1/config/history", methodsGet, s.withAuth(s.History)},
+		{"/api/v1/config/rollback", methodsPost, s.withAuth(s.withAudit("rollback", s.withWriteLock(s.Rollback)))},
+		{"/api/v1/rate-limit", methodsPost, s.withAuth(s.withAudit("rate_limit", s.withWriteLock(s.SetRateLimit)))},
+	}
+}
+
+// methodRole is the key role a method needs (see withAuth).
+func methodRole(method string) string {
+	if method == http.MethodGet { return RoleReadOnly }
+	return RoleOperator
+}
+
+func allowHeader(methods []string) string {
+	return strings.Join(append(append([]string(nil), methods...), http.MethodOptions), ", ")
+}
+
+// withMethods answers OPTIONS and undeclared methods before authentication.
+func withMethods(rt apiRoute) http.HandlerFunc {
+	allow := allowHeader(rt.Methods)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Allow", allow)
+			w.WriteHeader(http.StatusNoContent); return
+		}
+		for _, m := range rt.Methods {
+			if r.Method == m { rt.h(w, r); return }
+		}
+		w.Header().Set("Allow", allow)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// RouteInfo describes one endpoint in the GET /api/v1/ index.
+type RouteInfo struct {
+	Path    string            `json:"path"`
+	Methods []string          `json:"methods"`
+	Roles   map[string]string `json:"roles"` // method -> required key role
+}
+
+// GET /api/v1/ (no auth)
+func (s *Server) Index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/api/v1/" { http.NotFound(w, r); return }
+	withMethods(apiRoute{Methods: methodsGet, h: func(w http.ResponseWriter, r *http.Request) {
+		rts := s.routes()
+		out := make([]RouteInfo, len(rts))
+		for i, rt := range rts {
+			out[i] = RouteInfo{Path: rt.Path, Methods: rt.Methods, Roles: map[string]string{}}
+			for _, m := range rt.Methods { out[i].Roles[m] = methodRole(m) }
+		}
+		writeJSON(w, map[string]interface{}{"routes": out}, http.StatusOK)
+	}})(w, r)
+}
+
+// WithOptionsStar answers "OPTIONS *" with every method the API serves; net/http only lets
+// it through with http.Server.DisableGeneralOptionsHandler set.
+func (s *Server) WithOptionsStar(next http.Handler) http.Handler {
+	seen := map[string]bool{}
+	var all []string
+	for _, rt := range s.routes() {
+		for _, m := range rt.Methods {
+			if !seen[m] { seen[m] = true; all = append(all, m) }
+		}
+	}
+	sort.Strings(all)
+	allow := allowHeader(all)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions && r.RequestURI == "*" {
+			w.Header().Set("Allow", allow)
+			w.WriteHeader(http.StatusNoContent); return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
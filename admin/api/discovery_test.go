@@ -0,0 +1,80 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIndexListsRoutesWithRoles(t *testing.T) {
+	a := newTestAPI(t)
+	rec := a.doAs("", "GET", "/api/v1/", "") // discovery needs no key
+	if rec.Code != http.StatusOK {
+		t.Fatalf("index: status %d: %s", rec.Code, rec.Body)
+	}
+	var index struct{ Routes []RouteInfo }
+	if err := json.Unmarshal(rec.Body.Bytes(), &index); err != nil {
+		t.Fatal(err)
+	}
+	listed := map[string]RouteInfo{}
+	for _, rt := range index.Routes {
+		listed[rt.Path] = rt
+	}
+	writes := []string{
+		"/api/v1/lock", "/api/v1/auth/rotate", "/api/v1/config/stage", "/api/v1/config/dryrun",
+		"/api/v1/config/diff", "/api/v1/config/apply", "/api/v1/config/canary/promote",
+		"/api/v1/config/rollback", "/api/v1/rate-limit",
+	}
+	for _, path := range writes {
+		if role := listed[path].Roles[http.MethodPost]; role != RoleOperator {
+			t.Errorf("%s POST: role %q, want %q", path, role, RoleOperator)
+		}
+	}
+	for _, path := range []string{"/api/v1/snapshot", "/api/v1/config/history", "/api/v1/lock"} {
+		if role := listed[path].Roles[http.MethodGet]; role != RoleReadOnly {
+			t.Errorf("%s GET: role %q, want %q", path, role, RoleReadOnly)
+		}
+	}
+	// Every listed route is actually served, and nothing the index omits is
+	if len(index.Routes) != len(a.srv.routes()) {
+		t.Errorf("index lists %d routes, server binds %d", len(index.Routes), len(a.srv.routes()))
+	}
+	for _, rt := range index.Routes {
+		if rec := a.doAs("", "OPTIONS", rt.Path, ""); rec.Code != http.StatusNoContent {
+			t.Errorf("OPTIONS %s: status %d", rt.Path, rec.Code)
+		}
+	}
+	if rec := a.doAs("", "GET", "/api/v1/nope", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown path: status %d", rec.Code)
+	}
+}
+
+func TestOptionsAndUndeclaredMethods(t *testing.T) {
+	a := newTestAPI(t)
+	rec := a.doAs("", "OPTIONS", "/api/v1/lock", "")
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Allow") != "GET, POST, OPTIONS" {
+		t.Errorf("OPTIONS /lock: status %d, Allow %q", rec.Code, rec.Header().Get("Allow"))
+	}
+	// An undeclared method is refused before auth, even with an operator key
+	rec = a.do("DELETE", "/api/v1/config/apply", "")
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "POST, OPTIONS" {
+		t.Errorf("DELETE /config/apply: status %d, Allow %q", rec.Code, rec.Header().Get("Allow"))
+	}
+	// OPTIONS reveals nothing beyond the method list: writes still need a key
+	if rec := a.doAs("", "POST", "/api/v1/config/apply", `{"id":"c1"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("unauthenticated apply: status %d", rec.Code)
+	}
+
+	h := a.srv.WithOptionsStar(a.mux)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("OPTIONS", "*", nil))
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Allow") != "GET, POST, OPTIONS" {
+		t.Errorf("OPTIONS *: status %d, Allow %q", rec.Code, rec.Header().Get("Allow"))
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("OPTIONS", "/api/v1/config/apply", nil))
+	if rec.Header().Get("Allow") != "POST, OPTIONS" {
+		t.Errorf("OPTIONS on a route through WithOptionsStar: Allow %q", rec.Header().Get("Allow"))
+	}
+}
@@ -5,9 +5,11 @@
 // Philosophy: One version, the most stable version, first and last.
 // -----------------------------------------------------------------------------
 // Responsibilities:
-// - Fixed protobuf-like service interface (Go-only, no external deps).
-// - Transactional Apply with canary stages; DryRun and Rollback.
-// - Health and Tuning endpoints with deterministic responses.
+// - Fixed service interface and messages, served over gRPC by grpc_transport.go.
+// - Transactional Apply (plan validated, effective at once: canary rollout is REST-only);
+//   DryRun (WSX validation), Diff and Rollback.
+// - Health and Tuning endpoints; snapshots from the edge metrics, live stream and history.
+// - Every write operation is recorded in the audit log (audit.go).
 // =============================================================================
 
 package admin
@@ -15,6 +17,7 @@ package admin
 import (
 	"context"
 	"errors"
+	"fmt"
 	"sync"
 	"time"
 )
@@ -22,67 +25,92 @@ import (
 // Service definition (protobuf-like, frozen)
 type AdminService interface {
 	GetSnapshot(ctx context.Context, in *Empty) (*Snapshot, error)
+	GetSnapshotHistory(ctx context.Context, in *HistoryRequest) (*SnapshotHistoryReply, error) // see snapshot_history.go
 	StageConfig(ctx context.Context, in *StageRequest) (*StageReply, error)
 	DryRun(ctx context.Context, in *ConfigID) (*DryRunReply, error)
+	Diff(ctx context.Context, in *ConfigID) (*ConfigDiff, error) // staged vs. active, see diff.go
 	Apply(ctx context.Context, in *ApplyRequest) (*ApplyReply, error)
 	Rollback(ctx context.Context, in *RollbackRequest) (*RollbackReply, error)
 	SetRateLimit(ctx context.Context, in *RateLimitRequest) (*RateLimitReply, error)
+	WatchSnapshot(in *WatchRequest, stream SnapshotStream) error // server stream, see snapshot_stream.go
 }
 
-// Messages
+// Messages (gRPC-serializable with the JSON codec, see grpc_transport.go)
 type Empty struct{}
-type ConfigID struct{ ID string }
-type StageRequest struct{ ID, Content string }
-type StageReply struct{ Ok bool }
-type DryRunReply struct{ ID, Verdict string; Warnings []string }
-type ApplyRequest struct{ ID, Plan string }
-type ApplyReply struct{ Ok bool; ID, Plan string }
-type RollbackRequest struct{ To string }
-type RollbackReply struct{ Ok bool; To string }
-type RateLimitRequest struct{ RatePerIP int }
-type RateLimitReply struct{ Ok bool; RatePerIP int }
+type ConfigID struct{ ID string `json:"id"` }
+type StageRequest struct{ ID string `json:"id"`; Content string `json:"content"` }
+type StageReply struct{ Ok bool `json:"ok"` }
+type DryRunReply struct{ ID string `json:"id"`; Verdict string `json:"verdict"`; Warnings []string `json:"warnings"`; Errors []string `json:"errors"` }
+type ApplyRequest struct{ ID string `json:"id"`; Plan string `json:"plan"` }
+type ApplyReply struct{ Ok bool `json:"ok"`; ID string `json:"id"`; Plan string `json:"plan"` }
+type RollbackRequest struct{ To string `json:"to,omitempty"`; Index *int `json:"index,omitempty"` } // To: id or "prev"; or Index into the history
+type RollbackReply struct{ Ok bool `json:"ok"`; To string `json:"to"` }
+type RateLimitRequest struct{ RatePerIP int `json:"ratePerIp"` }
+type RateLimitReply struct{ Ok bool `json:"ok"`; RatePerIP int `json:"ratePerIp"` }
 
 type Snapshot struct {
-	TsMs     int64
-	RateRPS  int
-	LatencyP50 int
-	LatencyP90 int
-	LatencyP99 int
-	ErrorRatio float64
-	ActorsRunning int
-	ActorsQuarantined int
-	CacheL1Hit float64
-	CacheL2Hit float64
-	CacheL3Hit float64
+	TsMs     int64 `json:"tsMs"`
+	RateRPS  int `json:"rateRps"`
+	LatencyP50 int `json:"latencyP50"`
+	LatencyP90 int `json:"latencyP90"`
+	LatencyP99 int `json:"latencyP99"`
+	ErrorRatio float64 `json:"errorRatio"`
+	ActorsRunning int `json:"actorsRunning"`
+	ActorsQuarantined int `json:"actorsQuarantined"`
+	CacheL1Hit float64 `json:"cacheL1Hit"`
+	CacheL2Hit float64 `json:"cacheL2Hit"`
+	CacheL3Hit float64 `json:"cacheL3Hit"`
 }
 
+// Errors mapped onto gRPC status codes by the transport.
+var (
+	errBadRequest    = errors.New("bad request")
+	errNotStaged     = errors.New("not staged")
+	errUnknownTarget = errors.New("unknown target")
+)
+
 // Concrete implementation
+// staged, applied and lastApply are guarded by mu: writers (StageConfig, Apply, Rollback) hold
+// it exclusively, readers (DryRun, Diff) share it and copy what they need before unlocking.
+// applied is only ever appended to under the write lock. Exported fields are set before serving.
 type AdminServer struct {
-	mu sync.Mutex
+	mu sync.RWMutex
 	staged map[string]string
 	applied []string
+	lastApply ApplyRequest // most recent successful apply; a retry of it is a no-op
+	Audit *AuditLog // write operations; may be shared with the REST Server
+	OnRateLimit func(ratePerIP int) error // edge limiter bridge; may be shared with the REST Server
+	SnapshotInterval time.Duration // WatchSnapshot push period when the client asks for none; 0 = 1s
+	Stats SnapshotSource // live snapshot values (see snapshot_source.go); nil = zeros
+	Snapshots *SnapshotHistory // GetSnapshotHistory; fills while Snapshots.Sample runs, may be shared with the REST Server
 }
 
 func NewAdminServer() *AdminServer {
 	return &AdminServer{
 		staged: make(map[string]string),
 		applied: make([]string, 0, 16),
+		Audit: NewAuditLog(),
+		Snapshots: NewSnapshotHistory(0),
+	}
+}
+
+// audit records a write operation; the caller's role comes from WithPrincipal on ctx.
+func (s *AdminServer) audit(ctx context.Context, op, id, plan string, err error) {
+	e := AuditEntry{API: "grpc", Op: op, ID: id, Plan: plan, Result: auditResult(err)}
+	if p, ok := PrincipalFromContext(ctx); ok {
+		e.Role, e.KeyID = p.Role, p.KeyID
 	}
+	_ = s.Audit.Record(e)
 }
 
 func (s *AdminServer) GetSnapshot(ctx context.Context, in *Empty) (*Snapshot, error) {
-	return &Snapshot{
-		TsMs: nowMs(),
-		RateRPS: 1800,
-		LatencyP50: 40, LatencyP90: 105, LatencyP99: 270,
-		ErrorRatio: 0.011,
-		ActorsRunning: 1273, ActorsQuarantined: 5,
-		CacheL1Hit: 0.72, CacheL2Hit: 0.63, CacheL3Hit: 0.41,
-	}, nil
+	return s.Stats.snapshot()
 }
 
-func (s *AdminServer) StageConfig(ctx context.Context, in *StageRequest) (*StageReply, error) {
-	if in == nil || in.ID == "" { return nil, errors.New("bad request") }
+func (s *AdminServer) StageConfig(ctx context.Context, in *StageRequest) (out *StageReply, err error) {
+	if in == nil { return nil, errBadRequest }
+	defer func() { s.audit(ctx, "stage", in.ID, "", err) }()
+	if in.ID == "" { return nil, errBadRequest }
 	s.mu.Lock()
 	s.staged[in.ID] = in.Content
 	s.mu.Unlock()
@@ -90,40 +118,96 @@ func (s *AdminServer) StageConfig(ctx context.Context, in *StageRequest) (*Stage
 }
 
 func (s *AdminServer) DryRun(ctx context.Context, in *ConfigID) (*DryRunReply, error) {
-	if in == nil || in.ID == "" { return nil, errors.New("bad request") }
-	s.mu.Lock()
-	_, ok := s.staged[in.ID]
-	s.mu.Unlock()
-	if !ok { return nil, errors.New("not staged") }
-	return &DryRunReply{ID: in.ID, Verdict: "ok", Warnings: []string{}}, nil
+	if in == nil || in.ID == "" { return nil, errBadRequest }
+	s.mu.RLock()
+	content, ok := s.staged[in.ID]
+	s.mu.RUnlock()
+	if !ok { return nil, errNotStaged }
+	errs, warns := ValidateWSX(content)
+	out := &DryRunReply{ID: in.ID, Verdict: "ok", Warnings: []string{}, Errors: []string{}}
+	for _, e := range errs { out.Errors = append(out.Errors, e.String()) }
+	for _, w := range warns { out.Warnings = append(out.Warnings, w.String()) }
+	if len(errs) > 0 { out.Verdict = "invalid" }
+	return out, nil
+}
+
+// Diff compares a staged config with the active one (the staged content of the last applied ID).
+func (s *AdminServer) Diff(ctx context.Context, in *ConfigID) (*ConfigDiff, error) {
+	if in == nil || in.ID == "" { return nil, errBadRequest }
+	s.mu.RLock()
+	content, ok := s.staged[in.ID]
+	var baseID, base string
+	if n := len(s.applied); n > 0 { baseID, base = s.applied[n-1], s.staged[s.applied[n-1]] }
+	s.mu.RUnlock()
+	if !ok { return nil, errNotStaged }
+	return DiffWSX(in.ID, baseID, base, content)
 }
 
-func (s *AdminServer) Apply(ctx context.Context, in *ApplyRequest) (*ApplyReply, error) {
-	if in == nil || in.ID == "" { return nil, errors.New("bad request") }
+// Apply makes a staged config active at once; the plan is validated and recorded but, unlike
+// the REST apply, no canary stages run.
+func (s *AdminServer) Apply(ctx context.Context, in *ApplyRequest) (out *ApplyReply, err error) {
+	if in == nil { return nil, errBadRequest }
 	if in.Plan == "" { in.Plan = "canary-10-25-50-100" }
+	defer func() { s.audit(ctx, "apply", in.ID, in.Plan, err) }()
+	if in.ID == "" { return nil, errBadRequest }
+	if _, err := parsePlan(in.Plan); err != nil { return nil, fmt.Errorf("%w: %v", errBadRequest, err) }
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if _, ok := s.staged[in.ID]; !ok { return nil, errors.New("not staged") }
+	content, ok := s.staged[in.ID]
+	if !ok { return nil, errNotStaged }
+	if errs, _ := ValidateWSX(content); len(errs) > 0 { return nil, fmt.Errorf("%w: %s", ErrInvalidConfig, errs[0]) }
+	// Replay-safe: retrying the apply currently in effect returns the original reply
+	if n := len(s.applied); n > 0 && s.applied[n-1] == in.ID && s.lastApply == *in {
+		return &ApplyReply{Ok: true, ID: in.ID, Plan: in.Plan}, nil
+	}
 	s.applied = append(s.applied, in.ID)
+	s.lastApply = *in
 	return &ApplyReply{Ok: true, ID: in.ID, Plan: in.Plan}, nil
 }
 
-func (s *AdminServer) Rollback(ctx context.Context, in *RollbackRequest) (*RollbackReply, error) {
-	if in == nil || in.To == "" { return nil, errors.New("bad request") }
+// Rollback re-activates an earlier config, resolved like the REST rollback: "prev", a history
+// index, an applied id, or else a staged id.
+func (s *AdminServer) Rollback(ctx context.Context, in *RollbackRequest) (out *RollbackReply, err error) {
+	if in == nil { return nil, errBadRequest }
+	defer func() { s.audit(ctx, "rollback", in.To, "", err) }()
+	if (in.To == "") == (in.Index == nil) { return nil, errBadRequest }
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if _, ok := s.staged[in.To]; !ok { return nil, errors.New("unknown target") }
-	s.applied = append(s.applied, in.To)
-	return &RollbackReply{Ok: true, To: in.To}, nil
+	target, err := s.rollbackTargetLocked(in.To, in.Index)
+	if err != nil { return nil, err }
+	s.applied = append(s.applied, target)
+	return &RollbackReply{Ok: true, To: target}, nil
 }
 
-func (s *AdminServer) SetRateLimit(ctx context.Context, in *RateLimitRequest) (*RateLimitReply, error) {
-	if in == nil || in.RatePerIP <= 0 { return nil, errors.New("bad request") }
-	// In real, signal edge; here echo
-	return &RateLimitReply{Ok: true, RatePerIP: in.RatePerIP}, nil
+// rollbackTargetLocked mirrors Server.rollbackTargetLocked over the id-only history; s.mu must be held.
+func (s *AdminServer) rollbackTargetLocked(to string, index *int) (string, error) {
+	n := len(s.applied)
+	switch {
+	case index != nil:
+		if *index < 0 || *index >= n { return "", errUnknownTarget }
+		return s.applied[*index], nil
+	case to == "prev":
+		if n < 2 { return "", errUnknownTarget }
+		return s.applied[n-2], nil
+	}
+	content, ok := s.staged[to] // every applied id is staged: content lives there
+	if !ok { return "", errUnknownTarget }
+	for _, id := range s.applied {
+		if id == to { return to, nil }
+	}
+	if errs, _ := ValidateWSX(content); len(errs) > 0 {
+		return "", fmt.Errorf("%w: %s", ErrInvalidConfig, errs[0])
+	}
+	return to, nil
 }
 
-func nowMs() int64 { return time.Now().UnixNano() / int64(time.Millisecond) }
+func (s *AdminServer) SetRateLimit(ctx context.Context, in *RateLimitRequest) (out *RateLimitReply, err error) {
+	if in == nil { return nil, errBadRequest }
+	defer func() { s.audit(ctx, "rate_limit", "", "", err) }()
+	if err := validRatePerIP(in.RatePerIP); err != nil { return nil, err }
+	if s.OnRateLimit == nil { return nil, ErrNoRateLimiter }
+	if err := s.OnRateLimit(in.RatePerIP); err != nil { return nil, err }
+	return &RateLimitReply{Ok: true, RatePerIP: in.RatePerIP}, nil
+}
 
-// Example wiring with gRPC framework would bind AdminServer to service registry.
-// Here we keep pure Go interfaces to preserve a frozen ABI at the source level.
\ No newline at end of file
+// The wire binding (gRPC over HTTP/2 with a JSON codec) lives in grpc_transport.go.
\ No newline at end of file
@@ -0,0 +1,168 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// Run with -race: concurrent writers and readers of the staged and applied state.
+func TestAdminServerConcurrentApplyRollbackAndReads(t *testing.T) {
+	svc := NewAdminServer()
+	svc.Snapshots = NewSnapshotHistory(16)
+	ctx := context.Background()
+	ids := []string{"c0", "c1", "c2", "c3"}
+	for _, id := range ids {
+		if _, err := svc.StageConfig(ctx, &StageRequest{ID: id, Content: validWSX}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	staged := map[string]bool{"c0": true, "c1": true, "c2": true, "c3": true}
+
+	const workers, rounds = 8, 200
+	var wg sync.WaitGroup
+	var applies, rollbacks atomic.Int64
+	errs := make(chan string, workers*rounds)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				id := ids[(w+i)%len(ids)]
+				switch i % 6 {
+				case 0:
+					if _, err := svc.Apply(ctx, &ApplyRequest{ID: id, Plan: "canary-100"}); err != nil {
+						errs <- "Apply: " + err.Error()
+					}
+					applies.Add(1)
+				case 1:
+					if _, err := svc.Rollback(ctx, &RollbackRequest{To: id}); err != nil {
+						errs <- "Rollback: " + err.Error()
+					}
+					rollbacks.Add(1)
+				case 2:
+					if _, err := svc.StageConfig(ctx, &StageRequest{ID: "w" + strconv.Itoa(w), Content: validWSX}); err != nil {
+						errs <- "StageConfig: " + err.Error()
+					}
+				case 3:
+					// The base must be a config that was really applied, never a torn read
+					d, err := svc.Diff(ctx, &ConfigID{ID: id})
+					if err != nil {
+						errs <- "Diff: " + err.Error()
+					} else if d.Base != "" && !staged[d.Base] {
+						errs <- "Diff base " + d.Base
+					}
+				case 4:
+					if _, err := svc.DryRun(ctx, &ConfigID{ID: id}); err != nil {
+						errs <- "DryRun: " + err.Error()
+					}
+				case 5:
+					svc.Snapshots.Record(Snapshot{TsMs: int64(i)})
+					if _, err := svc.GetSnapshot(ctx, &Empty{}); err != nil {
+						errs <- "GetSnapshot: " + err.Error()
+					}
+					if _, err := svc.GetSnapshotHistory(ctx, &HistoryRequest{Limit: 8}); err != nil {
+						errs <- "GetSnapshotHistory: " + err.Error()
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for e := range errs {
+		t.Error(e)
+	}
+
+	svc.mu.RLock()
+	defer svc.mu.RUnlock()
+	// Every rollback appends; applies append unless they repeat the apply in effect
+	if n := int64(len(svc.applied)); n < rollbacks.Load() || n > rollbacks.Load()+applies.Load() {
+		t.Errorf("applied history has %d entries after %d rollbacks and %d applies", n, rollbacks.Load(), applies.Load())
+	}
+	for _, id := range svc.applied {
+		if !staged[id] {
+			t.Errorf("applied history holds %q", id)
+		}
+	}
+}
+
+func TestAdminServerApplyRejectsBadPlan(t *testing.T) {
+	svc := NewAdminServer()
+	ctx := context.Background()
+	if _, err := svc.StageConfig(ctx, &StageRequest{ID: "c1", Content: validWSX}); err != nil {
+		t.Fatal(err)
+	}
+	for _, plan := range []string{"garbage", "canary-50", "canary-50-25-100"} {
+		if _, err := svc.Apply(ctx, &ApplyRequest{ID: "c1", Plan: plan}); !errors.Is(err, errBadRequest) {
+			t.Errorf("plan %q: err = %v, want errBadRequest", plan, err)
+		}
+	}
+	if len(svc.applied) != 0 {
+		t.Errorf("refused applies changed history: %v", svc.applied)
+	}
+	out, err := svc.Apply(ctx, &ApplyRequest{ID: "c1"})
+	if err != nil || out.Plan != "canary-10-25-50-100" || len(svc.applied) != 1 {
+		t.Errorf("default plan: reply %+v, err %v, history %v", out, err, svc.applied)
+	}
+}
+
+func TestAdminServerRollbackResolvesHistory(t *testing.T) {
+	svc := NewAdminServer()
+	ctx := context.Background()
+	for _, id := range []string{"c1", "c2", "c3"} {
+		if _, err := svc.StageConfig(ctx, &StageRequest{ID: id, Content: validWSX}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := svc.Apply(ctx, &ApplyRequest{ID: id, Plan: "canary-100"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	active := func() string { return svc.applied[len(svc.applied)-1] }
+	one, past, negative := 1, 99, -1
+	for _, tc := range []struct {
+		in   RollbackRequest
+		want string
+	}{
+		{RollbackRequest{To: "prev"}, "c2"},
+		{RollbackRequest{To: "prev"}, "c3"}, // history is append-only
+		{RollbackRequest{Index: &one}, "c2"},
+		{RollbackRequest{To: "c1"}, "c1"},
+	} {
+		out, err := svc.Rollback(ctx, &tc.in)
+		if err != nil || out.To != tc.want || active() != tc.want {
+			t.Errorf("rollback %+v: reply %+v, err %v, active %s; want %s", tc.in, out, err, active(), tc.want)
+		}
+	}
+
+	if _, err := svc.StageConfig(ctx, &StageRequest{ID: "bad", Content: `route "/" status 999`}); err != nil {
+		t.Fatal(err)
+	}
+	before := len(svc.applied)
+	for _, tc := range []struct {
+		in   RollbackRequest
+		want error
+	}{
+		{RollbackRequest{To: "c9"}, errUnknownTarget},
+		{RollbackRequest{To: "bad"}, ErrInvalidConfig},
+		{RollbackRequest{Index: &past}, errUnknownTarget},
+		{RollbackRequest{Index: &negative}, errUnknownTarget},
+		{RollbackRequest{To: "c1", Index: &one}, errBadRequest},
+		{RollbackRequest{}, errBadRequest},
+	} {
+		if _, err := svc.Rollback(ctx, &tc.in); !errors.Is(err, tc.want) {
+			t.Errorf("rollback %+v: err = %v, want %v", tc.in, err, tc.want)
+		}
+	}
+	if len(svc.applied) != before {
+		t.Errorf("refused rollbacks changed history: %v", svc.applied)
+	}
+
+	fresh := NewAdminServer()
+	if _, err := fresh.Rollback(ctx, &RollbackRequest{To: "prev"}); !errors.Is(err, errUnknownTarget) {
+		t.Errorf("prev with no history: err = %v", err)
+	}
+}
@@ -0,0 +1,254 @@
+// =============================================================================
+// OLWSX - OverLab Web ServerX
+// File: admin/api/grpc_transport.go
+// Role: gRPC wire binding for AdminService (HTTP/2, JSON codec, no external deps)
+// Philosophy: One version, the most stable version, first and last.
+// -----------------------------------------------------------------------------
+// Responsibilities:
+// - Serve /olwsx.admin.v1.AdminService/<Method> unary and server-streaming calls over
+//   h2c or TLS HTTP/2.
+// - Messages use gRPC length-prefixed framing with content-type application/grpc+json,
+//   so stock gRPC clients work with a registered "json" codec.
+// - Auth as REST: metadata "x-olwsx-auth: <hex(hmacSHA256(request message))>";
+//   GetSnapshot/GetSnapshotHistory/DryRun/Diff/WatchSnapshot need any valid key, all other methods an operator key.
+// =============================================================================
+
+package admin
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// GRPCServiceName is the fully qualified gRPC service name.
+const GRPCServiceName = "olwsx.admin.v1.AdminService"
+
+// maxGRPCMessage bounds a single request message.
+const maxGRPCMessage = 4 << 20
+
+// gRPC status codes used by the transport.
+const (
+	grpcOK                 = 0
+	grpcCancelled          = 1
+	grpcUnknown            = 2
+	grpcInvalidArgument    = 3
+	grpcNotFound           = 5
+	grpcPermissionDenied   = 7
+	grpcFailedPrecondition = 9
+	grpcUnimplemented      = 12
+	grpcInternal           = 13
+	grpcUnavailable        = 14
+	grpcUnauthenticated    = 16
+)
+
+// grpcMethod decodes one request message and calls the service: call for unary methods,
+// stream for server-streaming ones (send writes one reply message).
+type grpcMethod struct {
+	write  bool // needs an operator key
+	call   func(ctx context.Context, msg []byte) (interface{}, error)
+	stream func(ctx context.Context, msg []byte, send func(interface{}) error) error
+}
+
+// unary adapts a typed AdminService method to grpcMethod.
+func unary[Req, Resp any](write bool, fn func(context.Context, *Req) (*Resp, error)) grpcMethod {
+	return grpcMethod{write: write, call: func(ctx context.Context, msg []byte) (interface{}, error) {
+		in := new(Req)
+		if len(msg) > 0 {
+			if err := json.Unmarshal(msg, in); err != nil {
+				return nil, errBadRequest
+			}
+		}
+		return fn(ctx, in)
+	}}
+}
+
+// snapshotSender adapts a gRPC response stream to SnapshotStream.
+type snapshotSender struct {
+	ctx  context.Context
+	send func(interface{}) error
+}
+
+func (s snapshotSender) Send(snap *Snapshot) error { return s.send(snap) }
+func (s snapshotSender) Context() context.Context  { return s.ctx }
+
+// GRPCServer serves an AdminService over gRPC; keys and roles come from the REST Server.
+type GRPCServer struct {
+	auth    *Server
+	methods map[string]grpcMethod
+	srv     *http.Server
+}
+
+// NewGRPCServer binds svc on addr (e.g. ":9443"); run it with ListenAndServe (h2c) or
+// ListenAndServeTLS. auth supplies the HMAC key set shared with the REST API.
+func NewGRPCServer(addr string, svc AdminService, auth *Server) *GRPCServer {
+	g := &GRPCServer{auth: auth, methods: map[string]grpcMethod{
+		"GetSnapshot":        unary(false, svc.GetSnapshot),
+		"GetSnapshotHistory": unary(false, svc.GetSnapshotHistory),
+		"StageConfig":        unary(true, svc.StageConfig),
+		"DryRun":             unary(false, svc.DryRun),
+		"Diff":               unary(false, svc.Diff),
+		"Apply":              unary(true, svc.Apply),
+		"Rollback":           unary(true, svc.Rollback),
+		"SetRateLimit":       unary(true, svc.SetRateLimit),
+		"WatchSnapshot": {stream: func(ctx context.Context, msg []byte, send func(interface{}) error) error {
+			in := new(WatchRequest)
+			if len(msg) > 0 {
+				if err := json.Unmarshal(msg, in); err != nil {
+					return errBadRequest
+				}
+			}
+			return svc.WatchSnapshot(in, snapshotSender{ctx: ctx, send: send})
+		}},
+	}}
+	protocols := new(http.Protocols)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+	g.srv = &http.Server{Addr: addr, Handler: g, Protocols: protocols}
+	return g
+}
+
+// ListenAndServe serves cleartext HTTP/2 (h2c) until Shutdown.
+func (g *GRPCServer) ListenAndServe() error { return g.srv.ListenAndServe() }
+
+// ListenAndServeTLS serves HTTP/2 over TLS until Shutdown.
+func (g *GRPCServer) ListenAndServeTLS(certFile, keyFile string) error {
+	return g.srv.ListenAndServeTLS(certFile, keyFile)
+}
+
+// Shutdown stops accepting calls and waits for in-flight ones until ctx expires.
+func (g *GRPCServer) Shutdown(ctx context.Context) error { return g.srv.Shutdown(ctx) }
+
+// ServeHTTP handles one gRPC call.
+func (g *GRPCServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 || r.Method != http.MethodPost {
+		http.Error(w, "gRPC requires HTTP/2 POST", http.StatusHTTPVersionNotSupported)
+		return
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "application/grpc+json" {
+		http.Error(w, "unsupported content-type "+strconv.Quote(ct)+"; use application/grpc+json", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc+json")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+
+	service, name, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	m, ok := g.methods[name]
+	if service != GRPCServiceName || !ok {
+		grpcStatus(w, grpcUnimplemented, "unknown method "+r.URL.Path)
+		return
+	}
+	msg, code, err := readGRPCMessage(r.Body)
+	if err != nil {
+		grpcStatus(w, code, err.Error())
+		return
+	}
+	p, ok := g.auth.verify(msg, r.Header.Get("X-OLWSX-Auth"))
+	if !ok {
+		grpcStatus(w, grpcUnauthenticated, "unauthorized")
+		return
+	}
+	if m.write && p.Role != RoleOperator {
+		grpcStatus(w, grpcPermissionDenied, "forbidden")
+		return
+	}
+	ctx := WithPrincipal(r.Context(), p)
+	if m.stream != nil {
+		err := m.stream(ctx, msg, func(v interface{}) error { return writeGRPCMessage(w, v) })
+		switch {
+		case err == nil:
+			grpcStatus(w, grpcOK, "")
+		case ctx.Err() != nil:
+			grpcStatus(w, grpcCancelled, "client went away")
+		default:
+			grpcStatus(w, grpcCode(err), err.Error())
+		}
+		return
+	}
+	reply, err := m.call(ctx, msg)
+	if err != nil {
+		grpcStatus(w, grpcCode(err), err.Error())
+		return
+	}
+	if err := writeGRPCMessage(w, reply); err != nil {
+		grpcStatus(w, grpcInternal, err.Error())
+		return
+	}
+	grpcStatus(w, grpcOK, "")
+}
+
+// writeGRPCMessage writes v as one length-prefixed message and flushes it to the client.
+func writeGRPCMessage(w http.ResponseWriter, v interface{}) error {
+	out, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	frame := make([]byte, 5, 5+len(out))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(out)))
+	if _, err := w.Write(append(frame, out...)); err != nil {
+		return err
+	}
+	return http.NewResponseController(w).Flush()
+}
+
+// readGRPCMessage reads the single length-prefixed message of a unary call.
+func readGRPCMessage(body io.Reader) ([]byte, int, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(body, hdr[:]); err != nil {
+		return nil, grpcInvalidArgument, errors.New("missing message frame")
+	}
+	if hdr[0] != 0 {
+		return nil, grpcUnimplemented, errors.New("compressed messages not supported")
+	}
+	n := binary.BigEndian.Uint32(hdr[1:])
+	if n > maxGRPCMessage {
+		return nil, grpcInvalidArgument, errors.New("message too large")
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(body, msg); err != nil {
+		return nil, grpcInvalidArgument, errors.New("truncated message")
+	}
+	return msg, grpcOK, nil
+}
+
+// grpcStatus writes the call status as trailers (or trailers-only when nothing was sent).
+func grpcStatus(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if msg != "" {
+		w.Header().Set("Grpc-Message", grpcEncodeMessage(msg))
+	}
+}
+
+// grpcEncodeMessage percent-encodes msg as the gRPC spec requires for grpc-message.
+func grpcEncodeMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c >= ' ' && c <= '~' && c != '%' {
+			b.WriteByte(c)
+		} else {
+			b.WriteString("%" + strings.ToUpper(strconv.FormatInt(int64(c)>>4, 16)+strconv.FormatInt(int64(c)&0xf, 16)))
+		}
+	}
+	return b.String()
+}
+
+// grpcCode maps AdminServer errors onto gRPC status codes.
+func grpcCode(err error) int {
+	switch {
+	case errors.Is(err, errBadRequest):
+		return grpcInvalidArgument
+	case errors.Is(err, ErrInvalidConfig):
+		return grpcFailedPrecondition
+	case errors.Is(err, errNotStaged), errors.Is(err, errUnknownTarget):
+		return grpcNotFound
+	case errors.Is(err, ErrNoRateLimiter), errors.Is(err, ErrShuttingDown), errors.Is(err, ErrSnapshotUnavailable):
+		return grpcUnavailable
+	}
+	return grpcUnknown
+}
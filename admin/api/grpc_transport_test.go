@@ -0,0 +1,133 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// grpcTestServer serves svc over h2c on a loopback port, with keys from a REST Server.
+func grpcTestServer(t *testing.T, svc AdminService) (url string, auth *Server) {
+	t.Helper()
+	auth = NewServer(testKey)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := NewGRPCServer(ln.Addr().String(), svc, auth)
+	go g.srv.Serve(ln)
+	t.Cleanup(func() { g.srv.Close() })
+	return "http://" + ln.Addr().String(), auth
+}
+
+// grpcClient speaks gRPC (HTTP/2 prior knowledge, JSON codec) like a stock client would.
+var grpcClient = func() *http.Client {
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	return &http.Client{Transport: &http.Transport{Protocols: protocols}}
+}()
+
+// grpcResult is a finished call: reply messages plus the grpc-status trailer.
+type grpcResult struct {
+	msgs    [][]byte
+	status  int
+	message string
+}
+
+func grpcCall(ctx context.Context, t *testing.T, base, method, key string, req interface{}) grpcResult {
+	t.Helper()
+	msg, _ := json.Marshal(req)
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	r, _ := http.NewRequestWithContext(ctx, "POST", base+"/"+GRPCServiceName+"/"+method, bytes.NewReader(append(frame, msg...)))
+	r.Header.Set("Content-Type", "application/grpc+json")
+	r.Header.Set("TE", "trailers")
+	if key != "" {
+		r.Header.Set("X-OLWSX-Auth", sign(key, string(msg)))
+	}
+	resp, err := grpcClient.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.ProtoMajor != 2 || resp.Header.Get("Content-Type") != "application/grpc+json" {
+		t.Fatalf("%s: %s, Content-Type %q", method, resp.Proto, resp.Header.Get("Content-Type"))
+	}
+	var out grpcResult
+	for {
+		var hdr [5]byte
+		if _, err := io.ReadFull(resp.Body, hdr[:]); err != nil {
+			break
+		}
+		m := make([]byte, binary.BigEndian.Uint32(hdr[1:]))
+		if _, err := io.ReadFull(resp.Body, m); err != nil {
+			t.Fatalf("%s: truncated reply: %v", method, err)
+		}
+		out.msgs = append(out.msgs, m)
+	}
+	status, message := resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+	if status == "" { // trailers-only response
+		status, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	out.status, _ = strconv.Atoi(status)
+	out.message = message
+	return out
+}
+
+func TestGRPCGetSnapshotAndApply(t *testing.T) {
+	svc := NewAdminServer()
+	svc.Stats = func() (*Snapshot, error) { return &Snapshot{TsMs: 42, RateRPS: 1200, ErrorRatio: 0.01}, nil }
+	url, _ := grpcTestServer(t, svc)
+	ctx := context.Background()
+
+	res := grpcCall(ctx, t, url, "GetSnapshot", testKey, Empty{})
+	var snap Snapshot
+	if res.status != grpcOK || len(res.msgs) != 1 || json.Unmarshal(res.msgs[0], &snap) != nil || snap.RateRPS != 1200 || snap.TsMs != 42 {
+		t.Fatalf("GetSnapshot: %+v", res)
+	}
+
+	if res := grpcCall(ctx, t, url, "StageConfig", testKey, StageRequest{ID: "c1", Content: validWSX}); res.status != grpcOK {
+		t.Fatalf("StageConfig: %+v", res)
+	}
+	res = grpcCall(ctx, t, url, "Apply", testKey, ApplyRequest{ID: "c1", Plan: "canary-100"})
+	var reply ApplyReply
+	if res.status != grpcOK || len(res.msgs) != 1 || json.Unmarshal(res.msgs[0], &reply) != nil || !reply.Ok || reply.ID != "c1" {
+		t.Fatalf("Apply: %+v", res)
+	}
+	if len(svc.applied) != 1 || svc.applied[0] != "c1" {
+		t.Errorf("applied = %v", svc.applied)
+	}
+	if res := grpcCall(ctx, t, url, "Apply", testKey, ApplyRequest{ID: "missing"}); res.status != grpcNotFound || res.message != "not staged" {
+		t.Errorf("Apply of an unstaged config: %+v", res)
+	}
+}
+
+func TestGRPCAuthMatchesREST(t *testing.T) {
+	url, auth := grpcTestServer(t, NewAdminServer())
+	if err := auth.AddKey("read-only-dashboard-key", RoleReadOnly); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for _, tc := range []struct {
+		key, method string
+		req         interface{}
+		want        int
+	}{
+		{"", "GetSnapshot", Empty{}, grpcUnauthenticated},
+		{"wrong-key", "GetSnapshot", Empty{}, grpcUnauthenticated},
+		{"read-only-dashboard-key", "GetSnapshot", Empty{}, grpcOK},
+		{"read-only-dashboard-key", "StageConfig", StageRequest{ID: "c1", Content: validWSX}, grpcPermissionDenied},
+		{"read-only-dashboard-key", "Apply", ApplyRequest{ID: "c1"}, grpcPermissionDenied},
+		{testKey, "NoSuchMethod", Empty{}, grpcUnimplemented},
+	} {
+		if res := grpcCall(ctx, t, url, tc.method, tc.key, tc.req); res.status != tc.want {
+			t.Errorf("%s with %q: status %d (%s), want %d", tc.method, tc.key, res.status, res.message, tc.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// =============================================================================
+// OLWSX - OverLab Web ServerX
+// File: admin/api/idempotency.go
+// Role: Idempotency keys for the REST config apply
+// Philosophy: One version, the most stable version, first and last.
+// -----------------------------------------------------------------------------
+// Responsibilities:
+// - Remember the outcome of an apply under its Idempotency-Key, scoped per config ID.
+// - Replay that outcome for retries within IdempotencyTTL instead of re-applying.
+// - Refuse a key reused with a different plan, and a retry racing the original.
+// =============================================================================
+
+package admin
+
+import (
+	"net/http"
+	"time"
+)
+
+// DefaultIdempotencyTTL applies when Server.IdempotencyTTL is zero.
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// idemKey scopes an Idempotency-Key to one config ID.
+type idemKey struct{ ID, Key string }
+
+// applyOutcome is the response of one apply: 200 with the applied JSON, or an error status and text.
+type applyOutcome struct {
+	Code int
+	Err  string
+}
+
+// idemEntry is a remembered apply; pending while the original request is still running.
+type idemEntry struct {
+	plan    string
+	pending bool
+	outcome applyOutcome
+	expires time.Time
+}
+
+func (s *Server) idemTTL() time.Duration {
+	if s.IdempotencyTTL > 0 { return s.IdempotencyTTL }
+	return DefaultIdempotencyTTL
+}
+
+// idemBegin claims (id, key) for a new apply of plan. If the key is known it returns the
+// response to send instead: the remembered outcome, 422 for a different plan, or 409 while
+// the original is still running.
+func (s *Server) idemBegin(id, key, plan string) (applyOutcome, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, e := range s.idem {
+		if !e.pending && now.After(e.expires) { delete(s.idem, k) }
+	}
+	if e, ok := s.idem[idemKey{id, key}]; ok {
+		switch {
+		case e.plan != plan:
+			return applyOutcome{http.StatusUnprocessableEntity, "idempotency key reused with a different request"}, true
+		case e.pending:
+			return applyOutcome{http.StatusConflict, "apply with this idempotency key in progress"}, true
+		}
+		return e.outcome, true
+	}
+	if s.idem == nil { s.idem = make(map[idemKey]idemEntry) }
+	s.idem[idemKey{id, key}] = idemEntry{plan: plan, pending: true}
+	return applyOutcome{}, false
+}
+
+// idemFinish records the outcome for replay; server-side failures (5xx) are forgotten so a
+// retry runs the apply again.
+func (s *Server) idemFinish(id, key, plan string, out applyOutcome) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if out.Code >= 500 {
+		delete(s.idem, idemKey{id, key})
+		return
+	}
+	s.idem[idemKey{id, key}] = idemEntry{plan: plan, outcome: out, expires: time.Now().Add(s.idemTTL())}
+}
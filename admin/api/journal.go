@@ -0,0 +1,130 @@
+// =============================================================================
+// OLWSX - OverLab Web ServerX
+// File: admin/api/journal.go
+// Role: Apply journal (crash-consistent config apply for the REST admin API)
+// Philosophy: One version, the most stable version, first and last.
+// -----------------------------------------------------------------------------
+// Responsibilities:
+// - Record an apply or rollback intent on disk before any side effect runs.
+// - Roll an interrupted apply forward on restart so state is never half-applied, restarting
+//   its canary rollout.
+// - Let the shutdown path wait for in-progress applies to finish.
+// =============================================================================
+
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// ErrShuttingDown is returned for applies attempted after Shutdown began.
+var ErrShuttingDown = errors.New("shutting down")
+
+// journalEntry is the apply or rollback intent; Content is kept so recovery doesn't depend on
+// staging. Seq is the history length before the commit, so recovery can tell whether the
+// state file already holds it. Rollbacks carry no Plan.
+type journalEntry struct {
+	ID      string `json:"id"`
+	Plan    string `json:"plan,omitempty"`
+	Content string `json:"content"`
+	Seq     int    `json:"seq"`
+	// Previous is the config active before an apply, the canary's rollback target.
+	Previous *appliedConfig `json:"previous,omitempty"`
+}
+
+// EnableJournal turns on the apply journal at path and recovers any apply or rollback
+// interrupted by a previous crash or SIGTERM by rolling it forward; an interrupted apply's
+// canary rollout restarts from its first stage, so set the canary hooks before calling it.
+func (s *Server) EnableJournal(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.journalPath = path
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var e journalEntry
+	if err := json.Unmarshal(raw, &e); err != nil || e.ID == "" {
+		// Torn write of the intent itself: nothing was applied yet, discard it.
+		return os.Remove(path)
+	}
+	// Crashed after the state was saved but before the journal was removed: already recorded.
+	if recorded := len(s.applied) > e.Seq && s.applied[e.Seq].ID == e.ID; !recorded {
+		if _, ok := s.configStaging[e.ID]; !ok {
+			s.configStaging[e.ID] = e.Content
+		}
+		if err := s.commitLocked(e); err != nil {
+			return err
+		}
+		if err := s.saveStateLocked(); err != nil {
+			return err
+		}
+	}
+	if e.Plan != "" {
+		// The rollout never got past its start: run it again rather than leave the config at 100%
+		stages, err := parsePlan(e.Plan)
+		if err != nil {
+			return err
+		}
+		s.startCanaryLocked(e.ID, e.Plan, stages, e.Previous)
+	}
+	return os.Remove(path)
+}
+
+// Shutdown refuses new applies and rollbacks and waits for in-progress ones to reach a consistent state.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closing = true
+	s.stopCanaryLocked()
+	s.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		s.applying.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// writeJournal durably records e.
+func writeJournal(path string, e journalEntry) error {
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, raw)
+}
+
+// writeFileAtomic replaces path with raw via temp file + fsync + rename (mode 0600).
+func writeFileAtomic(path string, raw []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
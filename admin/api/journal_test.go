@@ -0,0 +1,262 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// durableServer is a Server with state and journal files under dir.
+func durableServer(t *testing.T, dir string, onApply func(id, content string) error) *Server {
+	t.Helper()
+	s := NewServer(testKey)
+	s.OnApply = onApply
+	if err := s.EnableStore(filepath.Join(dir, "state.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.EnableJournal(filepath.Join(dir, "apply.journal")); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestInterruptedApplyRollsForwardOnRestart(t *testing.T) {
+	dir := t.TempDir()
+	entered, unblock, finished := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	s := durableServer(t, dir, func(id, content string) error {
+		close(entered)
+		<-unblock // the process dies here, mid-apply
+		return nil
+	})
+	s.configStaging["c1"] = validWSX
+	go func() {
+		defer close(finished)
+		s.applyTx("c1", "canary-100")
+	}()
+	<-entered
+	// Let the stranded apply finish before TempDir is removed
+	defer func() {
+		close(unblock)
+		<-finished
+	}()
+
+	var pushed []string
+	restarted := durableServer(t, dir, func(id, content string) error {
+		pushed = append(pushed, id+"="+content)
+		return nil
+	})
+	if len(pushed) != 1 || pushed[0] != "c1="+validWSX {
+		t.Errorf("recovery pushed %v, want the interrupted apply", pushed)
+	}
+	if n := len(restarted.applied); n != 1 || restarted.applied[0].ID != "c1" {
+		t.Errorf("applied after recovery = %v", restarted.applied)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "apply.journal")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("journal left behind: %v", err)
+	}
+
+	// The recovered state is durable: another restart neither loses nor repeats it
+	pushed = nil
+	again := durableServer(t, dir, func(id, content string) error {
+		pushed = append(pushed, id)
+		return nil
+	})
+	if len(pushed) != 0 || len(again.applied) != 1 {
+		t.Errorf("second restart pushed %v, applied %v", pushed, again.applied)
+	}
+}
+
+func TestJournalOfSavedApplyIsNotRepeated(t *testing.T) {
+	dir := t.TempDir()
+	s := durableServer(t, dir, nil)
+	s.configStaging["c1"] = validWSX
+	if err := s.applyTx("c1", "canary-100"); err != nil {
+		t.Fatal(err)
+	}
+	// The process dies after saving the state but before removing the journal
+	e := journalEntry{ID: "c1", Plan: "canary-100", Content: validWSX}
+	if err := writeJournal(filepath.Join(dir, "apply.journal"), e); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := durableServer(t, dir, func(id, content string) error {
+		t.Errorf("saved apply pushed again: %s", id)
+		return nil
+	})
+	if n := len(restarted.applied); n != 1 || restarted.applied[0].ID != "c1" {
+		t.Errorf("applied after recovery = %v", restarted.applied)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "apply.journal")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("journal left behind: %v", err)
+	}
+}
+
+func TestInterruptedRollbackRollsForwardOnRestart(t *testing.T) {
+	dir := t.TempDir()
+	s := durableServer(t, dir, nil)
+	for _, id := range []string{"c1", "c2"} {
+		s.configStaging[id] = validWSX
+		if err := s.applyTx(id, "canary-100"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entered, unblock, finished := make(chan struct{}), make(chan struct{}), make(chan struct{})
+	s.OnApply = func(id, content string) error {
+		close(entered)
+		<-unblock // the process dies here, mid-rollback
+		return nil
+	}
+	a := serveAPI(s)
+	go func() {
+		defer close(finished)
+		a.do("POST", "/api/v1/config/rollback", `{"to":"prev"}`)
+	}()
+	<-entered
+	defer func() {
+		close(unblock)
+		<-finished
+	}()
+
+	var pushed []string
+	restarted := durableServer(t, dir, func(id, content string) error {
+		pushed = append(pushed, id)
+		return nil
+	})
+	ids := make([]string, len(restarted.applied))
+	for i, e := range restarted.applied {
+		ids[i] = e.ID
+	}
+	if len(pushed) != 1 || pushed[0] != "c1" || strings.Join(ids, ",") != "c1,c2,c1" {
+		t.Errorf("recovery pushed %v, history %v; want the rollback to c1 rolled forward", pushed, ids)
+	}
+	again := durableServer(t, dir, func(id, content string) error {
+		t.Errorf("second restart pushed %s", id)
+		return nil
+	})
+	if len(again.applied) != 3 {
+		t.Errorf("second restart history %v", again.applied)
+	}
+}
+
+func TestRollbackRefusedAfterShutdown(t *testing.T) {
+	a, pushed := historyAPI(t)
+	if err := a.srv.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	a.mustDo(t, http.StatusServiceUnavailable, "POST", "/api/v1/config/rollback", `{"to":"prev"}`)
+	if len(*pushed) != 0 || len(a.srv.applied) != 3 {
+		t.Errorf("rollback after Shutdown: pushed %v, history %d", *pushed, len(a.srv.applied))
+	}
+}
+
+func TestInterruptedCanaryApplyRestartsRollout(t *testing.T) {
+	dir := t.TempDir()
+	s := durableServer(t, dir, nil)
+	s.configStaging["c1"] = validWSX
+	if err := s.applyTx("c1", "canary-100"); err != nil {
+		t.Fatal(err)
+	}
+	// The process dies pushing c2, which was to roll out 10% -> 100% with c1 as fallback
+	s.configStaging["c2"] = validWSX + "\n"
+	e := journalEntry{ID: "c2", Plan: "canary-10-100", Content: validWSX + "\n", Seq: 1, Previous: &appliedConfig{ID: "c1", Content: validWSX}}
+	if err := writeJournal(filepath.Join(dir, "apply.journal"), e); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := NewServer(testKey)
+	var shares []int
+	restarted.OnCanary = func(id string, percent int) error {
+		shares = append(shares, percent)
+		return nil
+	}
+	if err := restarted.EnableStore(filepath.Join(dir, "state.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := restarted.EnableJournal(filepath.Join(dir, "apply.journal")); err != nil {
+		t.Fatal(err)
+	}
+	c := restarted.canary
+	if c == nil || c.ID != "c2" || c.State != CanaryRunning || c.Percent != 10 || c.Previous != "c1" {
+		t.Fatalf("canary after recovery = %+v, want c2 running at 10%% with c1 as fallback", c)
+	}
+	if len(shares) != 1 || shares[0] != 10 {
+		t.Errorf("traffic shares = %v", shares)
+	}
+	// The restored rollout can still fall back to the previous config
+	restarted.mu.Lock()
+	restarted.rollbackCanaryLocked("test")
+	restarted.mu.Unlock()
+	if n := len(restarted.applied); restarted.applied[n-1].ID != "c1" {
+		t.Errorf("rollback after recovery: history %v", restarted.applied)
+	}
+}
+
+func TestTornJournalIsDiscarded(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "apply.journal"), []byte(`{"id":"c1","pla`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s := durableServer(t, dir, func(id, content string) error {
+		t.Errorf("torn intent applied: %s", id)
+		return nil
+	})
+	if len(s.applied) != 0 {
+		t.Errorf("applied = %v", s.applied)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "apply.journal")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("torn journal left behind: %v", err)
+	}
+}
+
+func TestRefusedApplyRollsBackCleanly(t *testing.T) {
+	dir := t.TempDir()
+	s := durableServer(t, dir, func(id, content string) error { return errors.New("data plane refused") })
+	s.configStaging["c1"] = validWSX
+	if err := s.applyTx("c1", "canary-100"); err == nil {
+		t.Fatal("refused apply reported success")
+	}
+	restarted := durableServer(t, dir, func(id, content string) error {
+		t.Errorf("refused apply rolled forward: %s", id)
+		return nil
+	})
+	if len(restarted.applied) != 0 {
+		t.Errorf("applied = %v", restarted.applied)
+	}
+}
+
+func TestShutdownWaitsForApplyInProgress(t *testing.T) {
+	entered, unblock := make(chan struct{}), make(chan struct{})
+	a := newTestAPI(t)
+	a.srv.OnApply = func(id, content string) error {
+		close(entered)
+		<-unblock
+		return nil
+	}
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/stage", stageBody("c1", validWSX))
+	applied := make(chan int, 1)
+	go func() { applied <- a.do("POST", "/api/v1/config/apply", `{"id":"c1","plan":"canary-100"}`).Code }()
+	<-entered
+
+	done := make(chan error, 1)
+	go func() { done <- a.srv.Shutdown(context.Background()) }()
+	select {
+	case err := <-done:
+		t.Fatalf("Shutdown returned mid-apply: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(unblock)
+	if err := <-done; err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+	if code := <-applied; code != http.StatusOK {
+		t.Errorf("in-progress apply: status %d", code)
+	}
+	if rec := a.do("POST", "/api/v1/config/apply", `{"id":"c1","plan":"canary-50-100"}`); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("apply after Shutdown: status %d, want 503", rec.Code)
+	}
+}
@@ -0,0 +1,198 @@
+// =============================================================================
+// OLWSX - OverLab Web ServerX
+// File: admin/api/keys.go
+// Role: HMAC key set with runtime rotation for the REST admin API
+// Philosophy: One version, the most stable version, first and last.
+// -----------------------------------------------------------------------------
+// Responsibilities:
+// - Multiple concurrently valid HMAC keys identified by fingerprint.
+// - Rotation with an overlap window before retired keys stop verifying.
+// - Optional on-disk persistence of the key set (atomic rewrite, 0600).
+// - Key roles: read-only keys may only read; operator keys may also write.
+// =============================================================================
+
+package admin
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"time"
+)
+
+// DefaultKeyOverlap keeps a rotated-out key valid long enough for in-flight tooling.
+const DefaultKeyOverlap = 5 * time.Minute
+
+// Key roles. Read-only keys are limited to GET endpoints.
+const (
+	RoleReadOnly = "read-only"
+	RoleOperator = "operator"
+)
+
+type authKey struct {
+	Key      []byte    `json:"key"`
+	RetireAt time.Time `json:"retire_at,omitempty"` // zero = active
+	Role     string    `json:"role,omitempty"`      // "" = operator (key files predating roles)
+}
+
+func (k authKey) role() string {
+	if k.Role == "" {
+		return RoleOperator
+	}
+	return k.Role
+}
+
+func validRole(role string) bool { return role == RoleReadOnly || role == RoleOperator }
+
+// keyID is a non-secret fingerprint used to name keys in rotation requests and replies.
+func keyID(k []byte) string {
+	sum := sha256.Sum256(k)
+	return hex.EncodeToString(sum[:4])
+}
+
+// EnableKeyStore persists the key set at path, loading it if the file exists.
+func (s *Server) EnableKeyStore(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keysPath = path
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s.saveKeysLocked()
+	}
+	if err != nil {
+		return err
+	}
+	var keys []authKey
+	if err := json.Unmarshal(raw, &keys); err != nil {
+		return err
+	}
+	if len(keys) > 0 {
+		s.keys = keys
+	}
+	return nil
+}
+
+func (s *Server) saveKeysLocked() error {
+	if s.keysPath == "" {
+		return nil
+	}
+	raw, err := json.Marshal(s.keys)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.keysPath, raw)
+}
+
+// AddKey registers an extra active key with the given role (e.g. read-only keys from startup config).
+func (s *Server) AddKey(key, role string) error {
+	if !validRole(role) {
+		return errors.New("unknown role")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := keyID([]byte(key))
+	for _, k := range s.keys {
+		if keyID(k.Key) == id {
+			return errors.New("key already present")
+		}
+	}
+	prev := s.keys
+	s.keys = append(s.keys[:len(s.keys):len(s.keys)], authKey{Key: []byte(key), Role: role})
+	if err := s.saveKeysLocked(); err != nil {
+		s.keys = prev
+		return err
+	}
+	return nil
+}
+
+// verify finds the key that made sig among keys that are active or still inside their overlap window.
+func (s *Server) verify(body []byte, sig string) (Principal, bool) {
+	now := time.Now()
+	s.mu.Lock()
+	keys := s.keys
+	s.mu.Unlock()
+	var p Principal
+	ok := false
+	for _, k := range keys {
+		if !k.RetireAt.IsZero() && now.After(k.RetireAt) {
+			continue
+		}
+		m := hmac.New(sha256.New, k.Key)
+		m.Write(body)
+		if subtleEq(hex.EncodeToString(m.Sum(nil)), sig) && !ok {
+			p, ok = Principal{KeyID: keyID(k.Key), Role: k.role()}, true
+		}
+	}
+	return p, ok
+}
+
+// rotateKey adds newKey with role and schedules retirement of retire (a key id, or all other keys
+// of the same role if empty).
+func (s *Server) rotateKey(newKey []byte, role, retire string, overlap time.Duration) (string, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	retireAt := now.Add(overlap)
+	newID := keyID(newKey)
+	keys := make([]authKey, 0, len(s.keys)+1)
+	found := retire == ""
+	for _, k := range s.keys {
+		if !k.RetireAt.IsZero() && now.After(k.RetireAt) {
+			continue // drop fully retired keys
+		}
+		id := keyID(k.Key)
+		if id == newID {
+			return "", time.Time{}, errors.New("key already present")
+		}
+		if (retire == "" && k.role() == role) || id == retire {
+			if k.RetireAt.IsZero() || k.RetireAt.After(retireAt) {
+				k.RetireAt = retireAt
+			}
+			found = true
+		}
+		keys = append(keys, k)
+	}
+	if !found {
+		return "", time.Time{}, errors.New("unknown key id")
+	}
+	keys = append(keys, authKey{Key: newKey, Role: role})
+	prev := s.keys
+	s.keys = keys
+	if err := s.saveKeysLocked(); err != nil {
+		s.keys = prev // not durable: neither the new key nor the retirements take effect
+		return "", time.Time{}, err
+	}
+	return newID, retireAt, nil
+}
+
+// POST /api/v1/auth/rotate body: {"new_key":"...","role":"operator","retire":"<key-id, empty = all others of role>","overlap_s":300}
+func (s *Server) RotateKey(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		NewKey   string `json:"new_key"`
+		Role     string `json:"role"`
+		Retire   string `json:"retire"`
+		OverlapS int    `json:"overlap_s"`
+	}
+	if err := json.Unmarshal(readBody(r), &req); err != nil || len(req.NewKey) < 16 || req.OverlapS < 0 {
+		http.Error(w, "bad request", http.StatusBadRequest); return
+	}
+	if req.Role == "" {
+		req.Role = RoleOperator
+	}
+	if !validRole(req.Role) {
+		http.Error(w, "bad role", http.StatusBadRequest); return
+	}
+	overlap := DefaultKeyOverlap
+	if req.OverlapS > 0 {
+		overlap = time.Duration(req.OverlapS) * time.Second
+	}
+	id, retireAt, err := s.rotateKey([]byte(req.NewKey), req.Role, req.Retire, overlap)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict); return
+	}
+	writeJSON(w, map[string]interface{}{"ok": "rotated", "key_id": id, "role": req.Role, "retire_at_ms": retireAt.UnixNano() / int64(time.Millisecond)}, http.StatusOK)
+}
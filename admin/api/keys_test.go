@@ -0,0 +1,87 @@
+package admin
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const newTestKey = "rotated-operator-key"
+
+func TestRotateKeyKeepsOldKeyDuringOverlap(t *testing.T) {
+	a := newTestAPI(t)
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/auth/rotate", `{"new_key":"`+newTestKey+`","overlap_s":60}`)
+	for _, key := range []string{testKey, newTestKey} {
+		if rec := a.doAs(key, "GET", "/api/v1/config/history", ""); rec.Code != http.StatusOK {
+			t.Errorf("key %s during overlap: status %d", keyID([]byte(key)), rec.Code)
+		}
+	}
+	if rec := a.doAs("not-a-key", "GET", "/api/v1/config/history", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("unknown key: status %d", rec.Code)
+	}
+	// Rotation needs an operator key
+	if err := a.srv.AddKey("read-only-tooling-key", RoleReadOnly); err != nil {
+		t.Fatal(err)
+	}
+	if rec := a.doAs("read-only-tooling-key", "POST", "/api/v1/auth/rotate", `{"new_key":"another-long-key-1234"}`); rec.Code != http.StatusForbidden {
+		t.Errorf("rotation with a read-only key: status %d", rec.Code)
+	}
+}
+
+func TestRetiredKeyStopsWorkingAfterOverlap(t *testing.T) {
+	a := newTestAPI(t)
+	if _, _, err := a.srv.rotateKey([]byte(newTestKey), RoleOperator, keyID([]byte(testKey)), 30*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	a.mustDo(t, http.StatusOK, "GET", "/api/v1/config/history", "")
+	time.Sleep(50 * time.Millisecond)
+	if rec := a.do("GET", "/api/v1/config/history", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("retired key after overlap: status %d", rec.Code)
+	}
+	if rec := a.doAs(newTestKey, "GET", "/api/v1/config/history", ""); rec.Code != http.StatusOK {
+		t.Errorf("new key: status %d", rec.Code)
+	}
+	if _, _, err := a.srv.rotateKey([]byte("third-operator-key"), RoleOperator, "deadbeef", time.Minute); err == nil {
+		t.Error("retiring an unknown key id succeeded")
+	}
+}
+
+func TestRotatedKeysArePersisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	a := newTestAPI(t)
+	if err := a.srv.EnableKeyStore(path); err != nil {
+		t.Fatal(err)
+	}
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/auth/rotate", `{"new_key":"`+newTestKey+`","overlap_s":60}`)
+
+	restarted := serveAPI(NewServer("bootstrap-key-from-flags"))
+	if err := restarted.srv.EnableKeyStore(path); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{testKey, newTestKey} {
+		if rec := restarted.doAs(key, "GET", "/api/v1/config/history", ""); rec.Code != http.StatusOK {
+			t.Errorf("key %s after restart: status %d", keyID([]byte(key)), rec.Code)
+		}
+	}
+}
+
+func TestFailedKeyPersistLeavesKeysUnchanged(t *testing.T) {
+	a := newTestAPI(t)
+	if err := a.srv.EnableKeyStore(filepath.Join(t.TempDir(), "keys.json")); err != nil {
+		t.Fatal(err)
+	}
+	a.srv.keysPath = filepath.Join(t.TempDir(), "missing", "keys.json") // every save now fails
+	a.mustDo(t, http.StatusConflict, "POST", "/api/v1/auth/rotate", `{"new_key":"`+newTestKey+`","overlap_s":60}`)
+	if rec := a.doAs(newTestKey, "GET", "/api/v1/config/history", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("unsaved new key: status %d", rec.Code)
+	}
+	if err := a.srv.AddKey("read-only-key-0123", RoleReadOnly); err == nil {
+		t.Error("AddKey reported success without persisting")
+	}
+	a.srv.mu.Lock()
+	defer a.srv.mu.Unlock()
+	if len(a.srv.keys) != 1 || !a.srv.keys[0].RetireAt.IsZero() {
+		t.Errorf("keys after failed saves = %+v, want the old key alone and unretired", a.srv.keys)
+	}
+}
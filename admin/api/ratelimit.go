@@ -0,0 +1,56 @@
+// =============================================================================
+// OLWSX - OverLab Web ServerX
+// File: admin/api/ratelimit.go
+// Role: Bridge from the admin rate-limit endpoints to the edge limiter
+// Philosophy: One version, the most stable version, first and last.
+// -----------------------------------------------------------------------------
+// Responsibilities:
+// - Validate requested per-IP rates before they reach the data plane.
+// - Map a rate onto the edge token bucket (capacity = rate, refill = rate/2, as translator.rb).
+// - Push it to the edge admin listener (POST /ratelimit, loopback only).
+// =============================================================================
+
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// MaxRatePerIP is the largest per-IP rate accepted by SetRateLimit (REST and gRPC).
+const MaxRatePerIP = 100000
+
+// ErrNoRateLimiter is returned when no OnRateLimit hook is wired to the edge.
+var ErrNoRateLimiter = errors.New("rate limit bridge not configured")
+
+// validRatePerIP rejects rates that would disable or break the limiter.
+func validRatePerIP(rate int) error {
+	if rate <= 0 || rate > MaxRatePerIP {
+		return fmt.Errorf("%w: rate_per_ip %d out of range 1..%d", errBadRequest, rate, MaxRatePerIP)
+	}
+	return nil
+}
+
+// EdgeRateLimiter returns an OnRateLimit hook that retunes the edge at adminURL
+// (e.g. "http://127.0.0.1:9090").
+func EdgeRateLimiter(adminURL string) func(ratePerIP int) error {
+	client := &http.Client{Timeout: 3 * time.Second}
+	return func(rate int) error {
+		refill := rate / 2
+		if refill < 1 { refill = 1 }
+		body, _ := json.Marshal(map[string]int{"capacity": rate, "refill_per_s": refill})
+		resp, err := client.Post(adminURL+"/ratelimit", "application/json", bytes.NewReader(body))
+		if err != nil { return fmt.Errorf("edge rate limit: %w", err) }
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+			return fmt.Errorf("edge rate limit: %s: %s", resp.Status, bytes.TrimSpace(msg))
+		}
+		return nil
+	}
+}
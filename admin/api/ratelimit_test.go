@@ -0,0 +1,68 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeEdge is the edge admin /ratelimit endpoint, recording what it was sent.
+func fakeEdge(t *testing.T, status int) (url string, got *[]map[string]int) {
+	var reqs []map[string]int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]int
+		if r.URL.Path != "/ratelimit" || json.NewDecoder(r.Body).Decode(&body) != nil {
+			t.Errorf("edge got %s %s", r.Method, r.URL.Path)
+		}
+		reqs = append(reqs, body)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, &reqs
+}
+
+func TestRESTRateLimitReachesEdge(t *testing.T) {
+	url, sent := fakeEdge(t, http.StatusOK)
+	a := newTestAPI(t)
+	a.srv.OnRateLimit = EdgeRateLimiter(url)
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/rate-limit", `{"rate_per_ip":80}`)
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/rate-limit", `{"rate_per_ip":1}`)
+	if len(*sent) != 2 || (*sent)[0]["capacity"] != 80 || (*sent)[0]["refill_per_s"] != 40 ||
+		(*sent)[1]["capacity"] != 1 || (*sent)[1]["refill_per_s"] != 1 {
+		t.Errorf("edge received %v", *sent)
+	}
+
+	for _, body := range []string{`{"rate_per_ip":0}`, `{"rate_per_ip":-3}`, `{"rate_per_ip":100001}`, `{"rate_per_ip":"x"}`} {
+		a.mustDo(t, http.StatusBadRequest, "POST", "/api/v1/rate-limit", body)
+	}
+	if len(*sent) != 2 {
+		t.Errorf("invalid rates reached the edge: %v", *sent)
+	}
+}
+
+func TestRateLimitBridgeFailures(t *testing.T) {
+	url, _ := fakeEdge(t, http.StatusUnprocessableEntity)
+	a := newTestAPI(t)
+	a.mustDo(t, http.StatusServiceUnavailable, "POST", "/api/v1/rate-limit", `{"rate_per_ip":80}`)
+	a.srv.OnRateLimit = EdgeRateLimiter(url)
+	a.mustDo(t, http.StatusBadGateway, "POST", "/api/v1/rate-limit", `{"rate_per_ip":80}`)
+}
+
+func TestGRPCRateLimitReachesEdge(t *testing.T) {
+	url, sent := fakeEdge(t, http.StatusOK)
+	s := NewAdminServer()
+	s.OnRateLimit = EdgeRateLimiter(url)
+	out, err := s.SetRateLimit(context.Background(), &RateLimitRequest{RatePerIP: 60})
+	if err != nil || !out.Ok || out.RatePerIP != 60 {
+		t.Fatalf("SetRateLimit = %+v, %v", out, err)
+	}
+	if len(*sent) != 1 || (*sent)[0]["capacity"] != 60 || (*sent)[0]["refill_per_s"] != 30 {
+		t.Errorf("edge received %v", *sent)
+	}
+	if _, err := s.SetRateLimit(context.Background(), &RateLimitRequest{RatePerIP: 0}); !errors.Is(err, errBadRequest) {
+		t.Errorf("rate 0: err = %v", err)
+	}
+}
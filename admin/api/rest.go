@@ -5,60 +5,155 @@
 // Philosophy: One version, the most stable version, first and last.
 // -----------------------------------------------------------------------------
 // Responsibilities:
-// - Read-only endpoints for snapshots; write endpoints for staged config ops.
-// - Deterministic auth via HMAC key; roles: read-only, operator.
-// - Transactional apply with dry-run and rollback plan IDs.
+// - Read-only endpoints for snapshots and their history; write endpoints for staged config ops.
+// - Deterministic auth via HMAC keys; roles: read-only (GET), operator (all).
+// - Unauthenticated discovery: GET /api/v1/ index and OPTIONS (discovery.go).
+// - Transactional apply with dry-run, diff (diff.go) and rollback plan IDs; canary stages in canary.go.
+// - Optional durable staging/applied state (store.go).
 // =============================================================================
 
 package admin
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
-	"strings"
+	"os"
 	"sync"
 	"time"
 )
 
 type Server struct {
 	mu       sync.Mutex
-	hmacKey  []byte
+	keys     []authKey              // valid HMAC keys (see keys.go)
+	keysPath string                 // "" = key set not persisted
 	configStaging map[string]string // id -> content
-	applied   []string              // applied staging ids
+	applied   []appliedConfig       // apply/rollback history, oldest first; last = active
+	locked    bool                  // read-only mode: config writes refused with 423
+	statePath string                // "" = staged/applied state kept in memory only (see store.go)
+
+	// OnApply pushes a config to the data plane; it must be idempotent (journal recovery may rerun it).
+	OnApply     func(id, content string) error
+	journalPath string         // "" disables the apply journal
+	applying    sync.WaitGroup // in-progress applies, awaited by Shutdown
+	closing     bool
+	lastApply   applyKey // most recent successful apply; a retry of it is a no-op
+
+	// Canary rollout (see canary.go). OnCanary shifts traffic share for id; CanaryInterval = 0
+	// advances only on promote calls; a stage ending with ErrorRatio() > MaxErrorRatio rolls back.
+	OnCanary       func(id string, percent int) error
+	CanaryInterval time.Duration
+	ErrorRatio     func() float64
+	MaxErrorRatio  float64
+	canary         *canaryRun
+
+	// Audit records every write operation (see audit.go); it may be shared with AdminServer.
+	Audit *AuditLog
+
+	// OnRateLimit applies a per-IP rate to the edge limiter (see EdgeRateLimiter in ratelimit.go).
+	OnRateLimit func(ratePerIP int) error
+
+	// SnapshotInterval is the /api/v1/snapshot/stream push period when the client asks for none; 0 = 1s.
+	SnapshotInterval time.Duration
+	// Stats supplies live snapshot values (see EdgeSnapshotSource); nil = zeros.
+	Stats SnapshotSource
+	// Snapshots backs /api/v1/snapshot/history; it fills while Snapshots.Sample runs and may be
+	// shared with AdminServer.
+	Snapshots *SnapshotHistory
+
+	// IdempotencyTTL is how long an apply outcome is replayed for its Idempotency-Key (see
+	// idempotency.go); 0 = DefaultIdempotencyTTL.
+	IdempotencyTTL time.Duration
+	idem           map[idemKey]idemEntry
 }
 
+// appliedConfig is one entry of the apply history; Content is kept so rollback works after
+// the staging entry is gone.
+type appliedConfig struct {
+	ID      string `json:"id"`
+	Content string `json:"content"`
+}
+
+// applyKey identifies an apply for replay-safe retries.
+type applyKey struct{ ID, Plan string }
+
 func NewServer(hmacKey string) *Server {
 	return &Server{
-		hmacKey: []byte(hmacKey),
+		keys: []authKey{{Key: []byte(hmacKey)}},
 		configStaging: make(map[string]string),
-		applied: make([]string, 0, 16),
+		applied: make([]appliedConfig, 0, 16),
+		Audit: NewAuditLog(),
+		Snapshots: NewSnapshotHistory(0),
 	}
 }
 
-// Middleware: HMAC auth header "X-OLWSX-Auth: <hex(hmacSHA256(body))>"
+// Principal is the authenticated caller of a request, carried in its context for auditing.
+type Principal struct {
+	KeyID string `json:"key_id"`
+	Role  string `json:"role"`
+}
+
+type principalCtxKey struct{}
+
+// PrincipalFrom returns the caller authenticated by withAuth.
+func PrincipalFrom(r *http.Request) (Principal, bool) { return PrincipalFromContext(r.Context()) }
+
+// WithPrincipal attaches an authenticated caller to ctx (e.g. from a gRPC auth interceptor).
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalCtxKey{}, p)
+}
+
+// PrincipalFromContext returns the caller attached by withAuth or WithPrincipal.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalCtxKey{}).(Principal)
+	return p, ok
+}
+
+// Middleware: HMAC auth header "X-OLWSX-Auth: <hex(hmacSHA256(body))>" (empty body for GET).
+// GET needs any valid key; every other method needs an operator key (403 for read-only).
 func (s *Server) withAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			body := readBody(r)
-			sig := r.Header.Get("X-OLWSX-Auth")
-			if !s.verify(body, sig) {
-				http.Error(w, "unauthorized", http.StatusUnauthorized)
-				return
-			}
+		body := readBody(r)
+		p, ok := s.verify(body, r.Header.Get("X-OLWSX-Auth"))
+		if !ok {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodGet && p.Role != RoleOperator {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body)) // handlers read the body again
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), p)))
+	}
+}
+
+// Middleware: refuse config writes with 423 while the read-only lock is engaged.
+func (s *Server) withWriteLock(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && s.isLocked() {
+			http.Error(w, "locked", http.StatusLocked)
+			return
 		}
 		next.ServeHTTP(w, r)
 	}
 }
 
-func (s *Server) verify(body []byte, sig string) bool {
-	m := hmac.New(sha256.New, s.hmacKey)
-	m.Write(body)
-	want := hex.EncodeToString(m.Sum(nil))
-	return subtleEq(want, sig)
+func (s *Server) isLocked() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.locked
+}
+
+// SetLocked engages or releases the read-only lock (e.g. from startup config).
+func (s *Server) SetLocked(locked bool) {
+	s.mu.Lock()
+	s.locked = locked
+	s.mu.Unlock()
 }
 
 func subtleEq(a, b string) bool {
@@ -70,25 +165,17 @@ func subtleEq(a, b string) bool {
 
 func readBody(r *http.Request) []byte {
 	defer r.Body.Close()
-	buf := new(strings.Builder)
-	_, _ = buf.ReadFrom(r.Body)
-	return []byte(buf.String())
+	body, _ := io.ReadAll(r.Body)
+	return body
 }
 
 // --- Endpoints ---
 
 // GET /api/v1/snapshot
 func (s *Server) Snapshot(w http.ResponseWriter, r *http.Request) {
-	resp := map[string]interface{}{
-		"ts_ms": nowMs(),
-		"traffic": map[string]interface{}{
-			"rate_rps": 1800, "latency_ms": map[string]int{"p50": 40, "p90": 105, "p99": 270},
-			"error_ratio": 0.011,
-		},
-		"actors": map[string]int{"running": 1273, "quarantined": 5},
-		"cache": map[string]interface{}{"l1_hit": 0.72, "l2_hit": 0.63, "l3_hit": 0.41},
-	}
-	writeJSON(w, resp, http.StatusOK)
+	snap, err := s.Stats.snapshot()
+	if err != nil { http.Error(w, err.Error(), http.StatusBadGateway); return }
+	writeJSON(w, restSnapshot(snap), http.StatusOK)
 }
 
 // POST /api/v1/config/stage  body: {"id":"cfg-2025-11-08-1","content":"...wsx..."}
@@ -98,71 +185,292 @@ func (s *Server) StageConfig(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "bad request", http.StatusBadRequest); return
 	}
 	s.mu.Lock()
+	prev, existed := s.configStaging[req.ID]
 	s.configStaging[req.ID] = req.Content
+	if err := s.saveStateLocked(); err != nil {
+		if existed { s.configStaging[req.ID] = prev } else { delete(s.configStaging, req.ID) }
+		s.mu.Unlock()
+		http.Error(w, "persist failed", http.StatusInternalServerError); return
+	}
 	s.mu.Unlock()
 	writeJSON(w, map[string]string{"ok":"staged","id":req.ID}, http.StatusOK)
 }
 
 // POST /api/v1/config/dryrun  body: {"id":"..."}
+// Verdict is "ok" (warnings allowed) or "invalid"; invalid configs are refused by Apply.
 func (s *Server) DryRun(w http.ResponseWriter, r *http.Request) {
 	var req struct{ ID string }
 	if err := json.Unmarshal(readBody(r), &req); err != nil || req.ID == "" {
 		http.Error(w, "bad request", http.StatusBadRequest); return
 	}
 	s.mu.Lock()
-	_, ok := s.configStaging[req.ID]
+	content, ok := s.configStaging[req.ID]
 	s.mu.Unlock()
 	if !ok { http.Error(w, "not staged", http.StatusNotFound); return }
-	// Fixed dry-run verdict (schema check simulated)
-	writeJSON(w, map[string]interface{}{"id":req.ID,"verdict":"ok","warnings":[]}, http.StatusOK)
+	errs, warns := ValidateWSX(content)
+	verdict := "ok"
+	if len(errs) > 0 { verdict = "invalid" }
+	if errs == nil { errs = []ConfigIssue{} }
+	if warns == nil { warns = []ConfigIssue{} }
+	writeJSON(w, map[string]interface{}{"id":req.ID,"verdict":verdict,"errors":errs,"warnings":warns}, http.StatusOK)
+}
+
+// POST /api/v1/config/diff  body: {"id":"..."}
+// Sections the staged config adds, removes or modifies relative to the active one (see diff.go).
+func (s *Server) Diff(w http.ResponseWriter, r *http.Request) {
+	var req struct{ ID string }
+	if err := json.Unmarshal(readBody(r), &req); err != nil || req.ID == "" {
+		http.Error(w, "bad request", http.StatusBadRequest); return
+	}
+	s.mu.Lock()
+	content, ok := s.configStaging[req.ID]
+	var base appliedConfig
+	if n := len(s.applied); n > 0 { base = s.applied[n-1] }
+	s.mu.Unlock()
+	if !ok { http.Error(w, "not staged", http.StatusNotFound); return }
+	d, err := DiffWSX(req.ID, base.ID, base.Content, content)
+	if err != nil { http.Error(w, err.Error(), http.StatusUnprocessableEntity); return }
+	writeJSON(w, d, http.StatusOK)
 }
 
 // POST /api/v1/config/apply  body: {"id":"...","plan":"canary-10-25-50-100"}
+// An Idempotency-Key header (or "idempotency_key" field) makes retries replay the first outcome.
 func (s *Server) Apply(w http.ResponseWriter, r *http.Request) {
-	var req struct{ ID, Plan string }
+	var req struct {
+		ID, Plan       string
+		IdempotencyKey string `json:"idempotency_key"`
+	}
 	if err := json.Unmarshal(readBody(r), &req); err != nil || req.ID == "" {
 		http.Error(w, "bad request", http.StatusBadRequest); return
 	}
 	if req.Plan == "" { req.Plan = "canary-10-25-50-100" }
+	if _, err := parsePlan(req.Plan); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest); return
+	}
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" { key = req.IdempotencyKey }
+	if key != "" {
+		if out, replay := s.idemBegin(req.ID, key, req.Plan); replay {
+			w.Header().Set("Idempotent-Replayed", "true")
+			writeApply(w, req.ID, req.Plan, out); return
+		}
+	}
+	out := applyOutcome{Code: http.StatusOK}
 	if err := s.applyTx(req.ID, req.Plan); err != nil {
-		http.Error(w, err.Error(), http.StatusConflict); return
+		out = applyOutcome{http.StatusConflict, err.Error()}
+		if errors.Is(err, ErrShuttingDown) { out.Code = http.StatusServiceUnavailable }
+		if errors.Is(err, ErrInvalidConfig) { out.Code = http.StatusUnprocessableEntity }
 	}
-	writeJSON(w, map[string]string{"ok":"applied","id":req.ID,"plan":req.Plan}, http.StatusOK)
+	if key != "" { s.idemFinish(req.ID, key, req.Plan, out) }
+	writeApply(w, req.ID, req.Plan, out)
 }
 
-// POST /api/v1/config/rollback body: {"to":"<staging-id-or-prev>"}
+// writeApply renders an apply outcome; replays render identically to the original.
+func writeApply(w http.ResponseWriter, id, plan string, out applyOutcome) {
+	if out.Code != http.StatusOK {
+		http.Error(w, out.Err, out.Code); return
+	}
+	writeJSON(w, map[string]string{"ok":"applied","id":id,"plan":plan}, http.StatusOK)
+}
+
+// applyTx records a staged config as applied; unknown ids are refused.
+// With a journal, the intent is written first so a crash mid-apply is rolled forward on restart.
+func (s *Server) applyTx(id, plan string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return ErrShuttingDown
+	}
+	if s.isReplayLocked(id, plan) {
+		return nil // retried apply: already in effect, report the original success
+	}
+	content, ok := s.configStaging[id]
+	if !ok {
+		return errors.New("not staged")
+	}
+	if errs, _ := ValidateWSX(content); len(errs) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidConfig, errs[0])
+	}
+	stages, err := parsePlan(plan)
+	if err != nil {
+		return err
+	}
+	var previous *appliedConfig
+	if n := len(s.applied); n > 0 {
+		prev := s.applied[n-1]
+		previous = &prev
+	}
+	if err := s.commitTxLocked(journalEntry{ID: id, Plan: plan, Content: content, Previous: previous}); err != nil {
+		return err
+	}
+	s.startCanaryLocked(id, plan, stages, previous)
+	return s.endTxLocked()
+}
+
+// errPersist wraps a state-file write failure after the data plane took a config.
+var errPersist = errors.New("persist failed")
+
+// commitTxLocked pushes e and appends it to the history as one transaction, shared by apply
+// and rollback. With a journal, the intent is written first and kept until endTxLocked, so a
+// crash mid-commit is rolled forward on restart; s.mu must be held.
+func (s *Server) commitTxLocked(e journalEntry) error {
+	if s.closing {
+		return ErrShuttingDown
+	}
+	s.applying.Add(1)
+	defer s.applying.Done()
+	e.Seq = len(s.applied)
+	if s.journalPath != "" {
+		if err := writeJournal(s.journalPath, e); err != nil {
+			return err
+		}
+	}
+	if err := s.commitLocked(e); err != nil {
+		if s.journalPath != "" {
+			_ = os.Remove(s.journalPath) // data plane refused it: clean rollback
+		}
+		return err
+	}
+	if err := s.saveStateLocked(); err != nil {
+		// journal kept: the commit is rolled forward and recorded on restart
+		return fmt.Errorf("%w: %v", errPersist, err)
+	}
+	return nil
+}
+
+// endTxLocked drops the journal of a transaction that is durably recorded; s.mu must be held.
+func (s *Server) endTxLocked() error {
+	if s.journalPath != "" {
+		return os.Remove(s.journalPath)
+	}
+	return nil
+}
+
+// commitLocked runs the apply side effect and records it; s.mu must be held.
+func (s *Server) commitLocked(e journalEntry) error {
+	if s.OnApply != nil {
+		if err := s.OnApply(e.ID, e.Content); err != nil {
+			return err
+		}
+	}
+	s.applied = append(s.applied, appliedConfig{ID: e.ID, Content: e.Content})
+	if e.Plan != "" { // rollbacks carry no plan and leave the last apply as it was
+		s.lastApply = applyKey{ID: e.ID, Plan: e.Plan}
+	}
+	return nil
+}
+
+// isReplayLocked reports whether (id, plan) is the apply currently in effect; s.mu must be held.
+// A rollback in between changes the active entry, so re-applying afterwards runs again.
+func (s *Server) isReplayLocked(id, plan string) bool {
+	n := len(s.applied)
+	return n > 0 && s.applied[n-1].ID == id && s.lastApply == applyKey{ID: id, Plan: plan}
+}
+
+// POST /api/v1/config/rollback body: {"to":"<applied-or-staged-id | prev>"} or {"index": <history index>}
+// Targets resolve against the apply history first, so pruned staging entries can still be restored.
+// The push is journaled and refused after Shutdown exactly like an apply (see commitTxLocked).
 func (s *Server) Rollback(w http.ResponseWriter, r *http.Request) {
-	var req struct{ To string }
-	if err := json.Unmarshal(readBody(r), &req); err != nil || req.To == "" {
+	var req struct {
+		To    string
+		Index *int
+	}
+	if err := json.Unmarshal(readBody(r), &req); err != nil || (req.To == "") == (req.Index == nil) {
 		http.Error(w, "bad request", http.StatusBadRequest); return
 	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if _, ok := s.configStaging[req.To]; !ok {
-		http.Error(w, "unknown target", http.StatusNotFound); return
+	target, err := s.rollbackTargetLocked(req.To, req.Index)
+	if errors.Is(err, ErrInvalidConfig) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity); return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound); return
+	}
+	if err := s.commitTxLocked(journalEntry{ID: target.ID, Content: target.Content}); err != nil {
+		code := http.StatusConflict
+		if errors.Is(err, ErrShuttingDown) { code = http.StatusServiceUnavailable }
+		if errors.Is(err, errPersist) { code = http.StatusInternalServerError }
+		http.Error(w, err.Error(), code); return
+	}
+	if s.canary != nil && s.canary.State == CanaryRunning {
+		s.withdrawCanaryLocked("manual rollback to " + target.ID)
+	}
+	if err := s.endTxLocked(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError); return
+	}
+	writeJSON(w, map[string]string{"ok":"rolled_back","to":target.ID}, http.StatusOK)
+}
+
+// rollbackTargetLocked resolves "prev" (the entry before the active one), a history index,
+// the latest history entry with id, or else a staged id, which was never applied and so gets
+// the validation Apply runs; s.mu must be held.
+func (s *Server) rollbackTargetLocked(to string, index *int) (appliedConfig, error) {
+	n := len(s.applied)
+	switch {
+	case index != nil:
+		if *index < 0 || *index >= n { return appliedConfig{}, errUnknownTarget }
+		return s.applied[*index], nil
+	case to == "prev":
+		if n < 2 { return appliedConfig{}, errUnknownTarget }
+		return s.applied[n-2], nil
+	}
+	for i := n - 1; i >= 0; i-- {
+		if s.applied[i].ID == to { return s.applied[i], nil }
+	}
+	content, ok := s.configStaging[to]
+	if !ok { return appliedConfig{}, errUnknownTarget }
+	if errs, _ := ValidateWSX(content); len(errs) > 0 {
+		return appliedConfig{}, fmt.Errorf("%w: %s", ErrInvalidConfig, errs[0])
 	}
-	s.applied = append(s.applied, req.To)
-	writeJSON(w, map[string]string{"ok":"rolled_back","to":req.To}, http.StatusOK)
+	return appliedConfig{ID: to, Content: content}, nil
+}
+
+// GET /api/v1/config/history
+func (s *Server) History(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, len(s.applied))
+	for i, a := range s.applied { ids[i] = a.ID }
+	writeJSON(w, map[string]interface{}{"history": ids}, http.StatusOK)
 }
 
 // POST /api/v1/rate-limit body: {"rate_per_ip": 80}
 func (s *Server) SetRateLimit(w http.ResponseWriter, r *http.Request) {
-	var req struct{ RatePerIP int }
-	if err := json.Unmarshal(readBody(r), &req); err != nil || req.RatePerIP <= 0 {
+	var req struct{ RatePerIP int `json:"rate_per_ip"` }
+	if err := json.Unmarshal(readBody(r), &req); err != nil {
 		http.Error(w, "bad request", http.StatusBadRequest); return
 	}
-	// In production, signal to edge; here we just echo
+	if err := validRatePerIP(req.RatePerIP); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest); return
+	}
+	if s.OnRateLimit == nil {
+		http.Error(w, ErrNoRateLimiter.Error(), http.StatusServiceUnavailable); return
+	}
+	if err := s.OnRateLimit(req.RatePerIP); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway); return
+	}
 	writeJSON(w, map[string]int{"rate_per_ip": req.RatePerIP}, http.StatusOK)
 }
 
-// Boot bindings
+// GET /api/v1/lock ; POST /api/v1/lock body: {"locked": true}
+func (s *Server) Lock(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		writeJSON(w, map[string]bool{"locked": s.isLocked()}, http.StatusOK)
+		return
+	}
+	var req struct{ Locked bool }
+	if err := json.Unmarshal(readBody(r), &req); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest); return
+	}
+	s.SetLocked(req.Locked)
+	writeJSON(w, map[string]bool{"locked": req.Locked}, http.StatusOK)
+}
+
+// Boot bindings (route table in discovery.go)
 func (s *Server) Routes(mux *http.ServeMux) {
-	mux.HandleFunc("/api/v1/snapshot", s.Snapshot)
-	mux.HandleFunc("/api/v1/config/stage", s.withAuth(s.StageConfig))
-	mux.HandleFunc("/api/v1/config/dryrun", s.withAuth(s.DryRun))
-	mux.HandleFunc("/api/v1/config/apply", s.withAuth(s.Apply))
-	mux.HandleFunc("/api/v1/config/rollback", s.withAuth(s.Rollback))
-	mux.HandleFunc("/api/v1/rate-limit", s.withAuth(s.SetRateLimit))
+	for _, rt := range s.routes() { mux.HandleFunc(rt.Path, withMethods(rt)) }
+	mux.HandleFunc("/api/v1/", s.Index)
 }
 
 func writeJSON(w http.ResponseWriter, v interface{}, code int) {
@@ -178,5 +486,6 @@ func nowMs() int64 { return time.Now().UnixNano() / int64(time.Millisecond) }
 //   srv := NewServer("supersecretkey")
 //   mux := http.NewServeMux()
 //   srv.Routes(mux)
-//   http.ListenAndServe(":8081", mux)
+//   hs := &http.Server{Addr: ":8081", Handler: srv.WithOptionsStar(mux), DisableGeneralOptionsHandler: true}
+//   hs.ListenAndServe()
 // }
\ No newline at end of file
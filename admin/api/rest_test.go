@@ -0,0 +1,150 @@
+package admin
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testKey = "test-operator-key"
+
+// validWSX passes ValidateWSX (warnings only).
+const validWSX = `route "/" status 200`
+
+// testAPI serves a Server's routes through an httptest mux.
+type testAPI struct {
+	srv *Server
+	mux *http.ServeMux
+}
+
+func newTestAPI(t *testing.T) *testAPI {
+	return serveAPI(NewServer(testKey))
+}
+
+func serveAPI(s *Server) *testAPI {
+	a := &testAPI{srv: s, mux: http.NewServeMux()}
+	s.Routes(a.mux)
+	return a
+}
+
+// stageBody is a stage request for content.
+func stageBody(id, content string) string {
+	raw, _ := json.Marshal(map[string]string{"id": id, "content": content})
+	return string(raw)
+}
+
+func sign(key, body string) string {
+	m := hmac.New(sha256.New, []byte(key))
+	m.Write([]byte(body))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// doAs sends a request signed with key; "" sends it unsigned.
+func (a *testAPI) doAs(key, method, path, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if key != "" {
+		r.Header.Set("X-OLWSX-Auth", sign(key, body))
+	}
+	rec := httptest.NewRecorder()
+	a.mux.ServeHTTP(rec, r)
+	return rec
+}
+
+// do sends a request signed with the operator key.
+func (a *testAPI) do(method, path, body string) *httptest.ResponseRecorder {
+	return a.doAs(testKey, method, path, body)
+}
+
+func (a *testAPI) mustDo(t *testing.T, want int, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := a.do(method, path, body)
+	if rec.Code != want {
+		t.Fatalf("%s %s: status %d, want %d: %s", method, path, rec.Code, want, rec.Body)
+	}
+	return rec
+}
+
+func TestReadOnlyLockRefusesWritesAndServesReads(t *testing.T) {
+	a := newTestAPI(t)
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/stage", stageBody("c1", validWSX))
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/lock", `{"locked":true}`)
+
+	for _, w := range []struct{ path, body string }{
+		{"/api/v1/config/stage", `{"id":"c2","content":"x"}`},
+		{"/api/v1/config/apply", `{"id":"c1"}`},
+		{"/api/v1/config/rollback", `{"to":"c1"}`},
+		{"/api/v1/rate-limit", `{"rate_per_ip":80}`},
+	} {
+		if rec := a.do("POST", w.path, w.body); rec.Code != http.StatusLocked {
+			t.Errorf("POST %s while locked: status %d, want 423", w.path, rec.Code)
+		}
+	}
+	a.mustDo(t, http.StatusOK, "GET", "/api/v1/snapshot", "")
+	a.mustDo(t, http.StatusOK, "GET", "/api/v1/config/history", "")
+	if rec := a.mustDo(t, http.StatusOK, "GET", "/api/v1/lock", ""); !strings.Contains(rec.Body.String(), `"locked":true`) {
+		t.Errorf("lock status = %s", rec.Body)
+	}
+	// Reads that take a POST body are not config writes
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/dryrun", `{"id":"c1"}`)
+
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/lock", `{"locked":false}`)
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/apply", `{"id":"c1"}`)
+}
+
+func TestReadOnlyKeyCanReadButNotWrite(t *testing.T) {
+	const roKey = "read-only-dashboard-key"
+	a := newTestAPI(t)
+	if err := a.srv.AddKey(roKey, RoleReadOnly); err != nil {
+		t.Fatal(err)
+	}
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/stage", stageBody("c1", validWSX))
+
+	for _, path := range []string{"/api/v1/snapshot", "/api/v1/config/history"} {
+		if rec := a.doAs(roKey, "GET", path, ""); rec.Code != http.StatusOK {
+			t.Errorf("read-only GET %s: status %d", path, rec.Code)
+		}
+	}
+	for _, w := range []struct{ path, body string }{
+		{"/api/v1/config/stage", stageBody("c2", validWSX)},
+		{"/api/v1/config/apply", `{"id":"c1"}`},
+		{"/api/v1/config/rollback", `{"to":"c1"}`},
+		{"/api/v1/rate-limit", `{"rate_per_ip":80}`},
+	} {
+		if rec := a.doAs(roKey, "POST", w.path, w.body); rec.Code != http.StatusForbidden {
+			t.Errorf("read-only POST %s: status %d, want 403", w.path, rec.Code)
+		}
+	}
+	if len(a.srv.applied) != 0 {
+		t.Errorf("read-only apply took effect: %v", a.srv.applied)
+	}
+	if rec := a.doAs("not-a-key", "GET", "/api/v1/snapshot", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("unknown key: status %d", rec.Code)
+	}
+	if rec := a.doAs("", "GET", "/api/v1/snapshot", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("unsigned: status %d", rec.Code)
+	}
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/apply", `{"id":"c1"}`)
+}
+
+func TestAuthAttachesPrincipal(t *testing.T) {
+	s := NewServer(testKey)
+	if err := s.AddKey("read-only-dashboard-key", RoleReadOnly); err != nil {
+		t.Fatal(err)
+	}
+	var got Principal
+	h := s.withAuth(func(w http.ResponseWriter, r *http.Request) { got, _ = PrincipalFrom(r) })
+	for key, role := range map[string]string{testKey: RoleOperator, "read-only-dashboard-key": RoleReadOnly} {
+		got = Principal{}
+		r := httptest.NewRequest("GET", "/api/v1/snapshot", nil)
+		r.Header.Set("X-OLWSX-Auth", sign(key, ""))
+		h(httptest.NewRecorder(), r)
+		if got.Role != role || got.KeyID != keyID([]byte(key)) {
+			t.Errorf("principal for %s key = %+v", role, got)
+		}
+	}
+}
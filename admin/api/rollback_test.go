@@ -0,0 +1,101 @@
+package admin
+
+import (
+	"net/http"
+	"testing"
+)
+
+// historyAPI applies c1, c2 and c3 in turn, each with distinct content; OnApply pushes are recorded.
+func historyAPI(t *testing.T) (*testAPI, *[]string) {
+	a := newTestAPI(t)
+	var pushed []string
+	a.srv.OnApply = func(id, content string) error {
+		pushed = append(pushed, id+"="+content)
+		return nil
+	}
+	for _, id := range []string{"c1", "c2", "c3"} {
+		a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/stage", stageBody(id, `route "/`+id+`" status 200`))
+		a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/apply", `{"id":"`+id+`","plan":"canary-100"}`)
+	}
+	pushed = nil
+	return a, &pushed
+}
+
+func (a *testAPI) active() appliedConfig {
+	a.srv.mu.Lock()
+	defer a.srv.mu.Unlock()
+	return a.srv.applied[len(a.srv.applied)-1]
+}
+
+func TestRollbackToPrevious(t *testing.T) {
+	a, pushed := historyAPI(t)
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/rollback", `{"to":"prev"}`)
+	if got := a.active(); got.ID != "c2" || got.Content != `route "/c2" status 200` {
+		t.Errorf("active after rollback to prev = %+v", got)
+	}
+	if len(*pushed) != 1 || (*pushed)[0] != `c2=route "/c2" status 200` {
+		t.Errorf("pushed %v", *pushed)
+	}
+	// History is append-only: prev is now the entry before the restored one
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/rollback", `{"to":"prev"}`)
+	if got := a.active(); got.ID != "c3" {
+		t.Errorf("second rollback to prev = %+v", got)
+	}
+}
+
+func TestRollbackToArbitraryPastConfig(t *testing.T) {
+	a, pushed := historyAPI(t)
+	// c1's staging entry is gone; its applied content is still in the history
+	a.srv.mu.Lock()
+	delete(a.srv.configStaging, "c1")
+	a.srv.mu.Unlock()
+
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/rollback", `{"to":"c1"}`)
+	if got := a.active(); got.ID != "c1" || got.Content != `route "/c1" status 200` {
+		t.Errorf("active after rollback to c1 = %+v", got)
+	}
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/rollback", `{"index":1}`)
+	if got := a.active(); got.ID != "c2" {
+		t.Errorf("active after rollback to index 1 = %+v", got)
+	}
+	if len(*pushed) != 2 || len(a.srv.applied) != 5 {
+		t.Errorf("pushed %v, history %d entries", *pushed, len(a.srv.applied))
+	}
+}
+
+func TestRollbackRejectsUnknownTargets(t *testing.T) {
+	a, pushed := historyAPI(t)
+	for body, want := range map[string]int{
+		`{"to":"c9"}`:           http.StatusNotFound,
+		`{"index":3}`:           http.StatusNotFound,
+		`{"index":-1}`:          http.StatusNotFound,
+		`{"to":"c1","index":0}`: http.StatusBadRequest,
+		`{}`:                    http.StatusBadRequest,
+	} {
+		a.mustDo(t, want, "POST", "/api/v1/config/rollback", body)
+	}
+	if len(*pushed) != 0 || len(a.srv.applied) != 3 {
+		t.Errorf("refused rollbacks changed state: pushed %v, history %d", *pushed, len(a.srv.applied))
+	}
+
+	fresh := newTestAPI(t)
+	fresh.mustDo(t, http.StatusOK, "POST", "/api/v1/config/stage", stageBody("c1", validWSX))
+	fresh.mustDo(t, http.StatusOK, "POST", "/api/v1/config/apply", `{"id":"c1"}`)
+	fresh.mustDo(t, http.StatusNotFound, "POST", "/api/v1/config/rollback", `{"to":"prev"}`)
+}
+
+func TestRollbackValidatesNeverAppliedTargets(t *testing.T) {
+	a, pushed := historyAPI(t)
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/stage", stageBody("bad", `route "/" status 999`))
+	a.mustDo(t, http.StatusUnprocessableEntity, "POST", "/api/v1/config/apply", `{"id":"bad","plan":"canary-100"}`)
+	a.mustDo(t, http.StatusUnprocessableEntity, "POST", "/api/v1/config/rollback", `{"to":"bad"}`)
+	if len(*pushed) != 0 || a.active().ID != "c3" {
+		t.Errorf("invalid config pushed through rollback: pushed %v, active %+v", *pushed, a.active())
+	}
+
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/stage", stageBody("good", validWSX))
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/rollback", `{"to":"good"}`)
+	if got := a.active(); got.ID != "good" {
+		t.Errorf("active after rollback to a valid staged config = %+v", got)
+	}
+}
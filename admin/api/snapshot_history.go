@@ -0,0 +1,121 @@
+// =============================================================================
+// OLWSX - OverLab Web ServerX
+// File: admin/api/snapshot_history.go
+// Role: Bounded history of sampled snapshots (trend data for canary decisions)
+// Philosophy: One version, the most stable version, first and last.
+// -----------------------------------------------------------------------------
+// Responsibilities:
+// - Keep the most recent snapshots in a fixed-capacity ring; the oldest is overwritten.
+// - Sample a SnapshotSource at a fixed interval while Sample runs.
+// - Serve the last N via GET /api/v1/snapshot/history and AdminServer.GetSnapshotHistory.
+// =============================================================================
+
+package admin
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Snapshot history defaults: 720 samples 10s apart cover the last two hours.
+const (
+	DefaultHistoryCapacity = 720
+	DefaultHistoryInterval = 10 * time.Second
+	defaultHistoryLimit    = 60
+)
+
+// HistoryRequest asks for the last Limit snapshots (0 = 60).
+type HistoryRequest struct{ Limit int `json:"limit"` }
+
+// SnapshotHistoryReply lists snapshots oldest first.
+type SnapshotHistoryReply struct {
+	Capacity  int        `json:"capacity"`
+	Snapshots []Snapshot `json:"snapshots"`
+}
+
+// SnapshotHistory is safe for concurrent use and may be shared by the REST and gRPC servers.
+type SnapshotHistory struct {
+	mu   sync.Mutex
+	ring []Snapshot
+	next int // slot the next sample goes into
+	n    int // samples held, up to len(ring)
+}
+
+// NewSnapshotHistory keeps up to capacity snapshots (<= 0 = DefaultHistoryCapacity).
+func NewSnapshotHistory(capacity int) *SnapshotHistory {
+	if capacity <= 0 { capacity = DefaultHistoryCapacity }
+	return &SnapshotHistory{ring: make([]Snapshot, capacity)}
+}
+
+// Record appends snap, overwriting the oldest sample once full.
+func (h *SnapshotHistory) Record(snap Snapshot) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.ring[h.next] = snap
+	h.next = (h.next + 1) % len(h.ring)
+	if h.n < len(h.ring) { h.n++ }
+}
+
+// Last returns up to limit of the newest snapshots, oldest first.
+func (h *SnapshotHistory) Last(limit int) []Snapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if limit > h.n { limit = h.n }
+	out := make([]Snapshot, 0, limit)
+	for i := limit; i > 0; i-- {
+		out = append(out, h.ring[(h.next-i+len(h.ring))%len(h.ring)])
+	}
+	return out
+}
+
+// Capacity is the most snapshots the history holds.
+func (h *SnapshotHistory) Capacity() int { return len(h.ring) }
+
+// Sample records a snapshot from src now and then every interval (<= 0 =
+// DefaultHistoryInterval) until ctx ends, skipping failed reads; run it in its own goroutine
+// for the server's lifetime.
+func (h *SnapshotHistory) Sample(ctx context.Context, interval time.Duration, src SnapshotSource) {
+	if interval <= 0 { interval = DefaultHistoryInterval }
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if snap, err := src.snapshot(); err == nil { h.Record(*snap) }
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// historyLimit resolves a requested count: 0 = default, capped at the capacity.
+func (h *SnapshotHistory) historyLimit(limit int) int {
+	if limit == 0 { limit = defaultHistoryLimit }
+	if limit > h.Capacity() { limit = h.Capacity() }
+	return limit
+}
+
+func (h *SnapshotHistory) reply(limit int) *SnapshotHistoryReply {
+	return &SnapshotHistoryReply{Capacity: h.Capacity(), Snapshots: h.Last(h.historyLimit(limit))}
+}
+
+// GetSnapshotHistory returns the last in.Limit sampled snapshots.
+func (s *AdminServer) GetSnapshotHistory(ctx context.Context, in *HistoryRequest) (*SnapshotHistoryReply, error) {
+	if in == nil { in = &HistoryRequest{} }
+	if in.Limit < 0 { return nil, errBadRequest }
+	return s.Snapshots.reply(in.Limit), nil
+}
+
+// GET /api/v1/snapshot/history?limit=60
+func (s *Server) SnapshotHistory(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 { http.Error(w, "bad limit", http.StatusBadRequest); return }
+		limit = n
+	}
+	writeJSON(w, s.Snapshots.reply(limit), http.StatusOK)
+}
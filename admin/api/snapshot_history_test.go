@@ -0,0 +1,113 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// tsOf lists the snapshots' timestamps.
+func tsOf(snaps []Snapshot) []int64 {
+	out := make([]int64, len(snaps))
+	for i, s := range snaps {
+		out[i] = s.TsMs
+	}
+	return out
+}
+
+func equalTs(got []Snapshot, want ...int64) bool { return slices.Equal(tsOf(got), want) }
+
+func TestSnapshotHistoryKeepsNewestInOrder(t *testing.T) {
+	h := NewSnapshotHistory(3)
+	if got := h.Last(10); len(got) != 0 {
+		t.Errorf("empty history returned %v", tsOf(got))
+	}
+	h.Record(Snapshot{TsMs: 1})
+	h.Record(Snapshot{TsMs: 2})
+	if got := h.Last(10); !equalTs(got, 1, 2) {
+		t.Errorf("partly filled: %v", tsOf(got))
+	}
+	for ts := int64(3); ts <= 7; ts++ {
+		h.Record(Snapshot{TsMs: ts})
+	}
+	if got := h.Last(10); !equalTs(got, 5, 6, 7) {
+		t.Errorf("after wrapping: %v, want the newest 3 oldest first", tsOf(got))
+	}
+	if got := h.Last(2); !equalTs(got, 6, 7) {
+		t.Errorf("Last(2) = %v", tsOf(got))
+	}
+	if NewSnapshotHistory(0).Capacity() != DefaultHistoryCapacity {
+		t.Error("default capacity not applied")
+	}
+}
+
+func TestSnapshotHistorySamplesSource(t *testing.T) {
+	h := NewSnapshotHistory(4)
+	var n atomic.Int64
+	src := SnapshotSource(func() (*Snapshot, error) {
+		i := n.Add(1)
+		if i == 2 {
+			return nil, ErrSnapshotUnavailable // skipped, not recorded as zeros
+		}
+		return &Snapshot{TsMs: i}, nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { h.Sample(ctx, 5*time.Millisecond, src); close(done) }()
+	for deadline := time.Now().Add(time.Second); len(h.Last(4)) < 4 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+	got := h.Last(4)
+	if len(got) != 4 {
+		t.Fatalf("history holds %d samples", len(got))
+	}
+	for i, s := range got {
+		if s.TsMs == 2 || (i > 0 && s.TsMs <= got[i-1].TsMs) {
+			t.Errorf("samples %v", tsOf(got))
+			break
+		}
+	}
+}
+
+func TestSnapshotHistoryEndpoints(t *testing.T) {
+	a := newTestAPI(t)
+	a.srv.Snapshots = NewSnapshotHistory(5)
+	for ts := int64(1); ts <= 8; ts++ {
+		a.srv.Snapshots.Record(Snapshot{TsMs: ts, RateRPS: int(ts) * 10})
+	}
+	get := func(query string) SnapshotHistoryReply {
+		var reply SnapshotHistoryReply
+		rec := a.mustDo(t, http.StatusOK, "GET", "/api/v1/snapshot/history"+query, "")
+		if err := json.Unmarshal(rec.Body.Bytes(), &reply); err != nil {
+			t.Fatal(err)
+		}
+		return reply
+	}
+	if r := get("?limit=2"); r.Capacity != 5 || !equalTs(r.Snapshots, 7, 8) || r.Snapshots[1].RateRPS != 80 {
+		t.Errorf("limit=2: %+v", r)
+	}
+	if r := get("?limit=100"); !equalTs(r.Snapshots, 4, 5, 6, 7, 8) {
+		t.Errorf("limit above capacity: %v", tsOf(r.Snapshots))
+	}
+	if r := get(""); len(r.Snapshots) != 5 {
+		t.Errorf("default limit: %v", tsOf(r.Snapshots))
+	}
+	for _, bad := range []string{"?limit=0", "?limit=-1", "?limit=x"} {
+		a.mustDo(t, http.StatusBadRequest, "GET", "/api/v1/snapshot/history"+bad, "")
+	}
+
+	svc := NewAdminServer()
+	svc.Snapshots = a.srv.Snapshots // shared with REST
+	if r, err := svc.GetSnapshotHistory(context.Background(), &HistoryRequest{Limit: 3}); err != nil || !equalTs(r.Snapshots, 6, 7, 8) {
+		t.Errorf("gRPC limit 3: %+v, %v", r, err)
+	}
+	if _, err := svc.GetSnapshotHistory(context.Background(), &HistoryRequest{Limit: -1}); err != errBadRequest {
+		t.Errorf("gRPC negative limit: %v", err)
+	}
+}
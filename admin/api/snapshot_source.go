@@ -0,0 +1,89 @@
+// =============================================================================
+// OLWSX - OverLab Web ServerX
+// File: admin/api/snapshot_source.go
+// Role: Live snapshot values from the edge metrics (REST, gRPC, streams, history)
+// Philosophy: One version, the most stable version, first and last.
+// -----------------------------------------------------------------------------
+// Responsibilities:
+// - Fetch the edge traffic summary (GET /snapshot on the edge admin listener, computed
+//   from its metrics registry: request rate, latency quantiles, 5xx ratio).
+// - Convert between the REST snapshot shape and the gRPC Snapshot message.
+// - Report zeros, not made-up numbers, when no source is wired.
+// =============================================================================
+
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ErrSnapshotUnavailable is returned when the snapshot source cannot be read.
+var ErrSnapshotUnavailable = errors.New("snapshot source unavailable")
+
+// SnapshotSource returns the current snapshot; see EdgeSnapshotSource.
+type SnapshotSource func() (*Snapshot, error)
+
+// snapshot calls src; a nil source reports zeros at the current time.
+func (src SnapshotSource) snapshot() (*Snapshot, error) {
+	if src == nil { return &Snapshot{TsMs: nowMs()}, nil }
+	return src()
+}
+
+// snapshotJSON is the REST form of a Snapshot, also served by the edge at /snapshot
+// (which leaves out actors and cache, unknown to the edge).
+type snapshotJSON struct {
+	TsMs    int64 `json:"ts_ms"`
+	Traffic struct {
+		RateRPS    int            `json:"rate_rps"`
+		LatencyMs  map[string]int `json:"latency_ms"`
+		ErrorRatio float64        `json:"error_ratio"`
+	} `json:"traffic"`
+	Actors map[string]int     `json:"actors"`
+	Cache  map[string]float64 `json:"cache"`
+}
+
+func (j *snapshotJSON) snapshot() *Snapshot {
+	return &Snapshot{
+		TsMs: j.TsMs,
+		RateRPS: j.Traffic.RateRPS,
+		LatencyP50: j.Traffic.LatencyMs["p50"], LatencyP90: j.Traffic.LatencyMs["p90"], LatencyP99: j.Traffic.LatencyMs["p99"],
+		ErrorRatio: j.Traffic.ErrorRatio,
+		ActorsRunning: j.Actors["running"], ActorsQuarantined: j.Actors["quarantined"],
+		CacheL1Hit: j.Cache["l1_hit"], CacheL2Hit: j.Cache["l2_hit"], CacheL3Hit: j.Cache["l3_hit"],
+	}
+}
+
+func restSnapshot(s *Snapshot) *snapshotJSON {
+	j := &snapshotJSON{TsMs: s.TsMs}
+	j.Traffic.RateRPS = s.RateRPS
+	j.Traffic.LatencyMs = map[string]int{"p50": s.LatencyP50, "p90": s.LatencyP90, "p99": s.LatencyP99}
+	j.Traffic.ErrorRatio = s.ErrorRatio
+	j.Actors = map[string]int{"running": s.ActorsRunning, "quarantined": s.ActorsQuarantined}
+	j.Cache = map[string]float64{"l1_hit": s.CacheL1Hit, "l2_hit": s.CacheL2Hit, "l3_hit": s.CacheL3Hit}
+	return j
+}
+
+// EdgeSnapshotSource returns a SnapshotSource reading the edge at adminURL
+// (e.g. "http://127.0.0.1:9090"). Values cover the edge's latest one-second sample window,
+// so the REST snapshot, WatchSnapshot, the streams and the history sampler can all share it.
+func EdgeSnapshotSource(adminURL string) SnapshotSource {
+	client := &http.Client{Timeout: 3 * time.Second}
+	return func() (*Snapshot, error) {
+		resp, err := client.Get(adminURL + "/snapshot")
+		if err != nil { return nil, fmt.Errorf("%w: %v", ErrSnapshotUnavailable, err) }
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%w: edge answered %s", ErrSnapshotUnavailable, resp.Status)
+		}
+		var j snapshotJSON
+		if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&j); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSnapshotUnavailable, err)
+		}
+		return j.snapshot(), nil
+	}
+}
@@ -0,0 +1,81 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// edgeSnapshot is a body as served by the edge's GET /snapshot.
+const edgeSnapshot = `{"ts_ms":1700000000000,"traffic":{"rate_rps":120,"latency_ms":{"p50":12,"p90":48,"p99":230},"error_ratio":0.05}}`
+
+// fakeEdgeSnapshot serves body with status at /snapshot.
+func fakeEdgeSnapshot(t *testing.T, status int, body string) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/snapshot" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestEdgeSnapshotSourceReadsLiveValues(t *testing.T) {
+	snap, err := EdgeSnapshotSource(fakeEdgeSnapshot(t, http.StatusOK, edgeSnapshot))()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Snapshot{TsMs: 1700000000000, RateRPS: 120, LatencyP50: 12, LatencyP90: 48, LatencyP99: 230, ErrorRatio: 0.05}
+	if *snap != want {
+		t.Errorf("snapshot %+v, want %+v", *snap, want)
+	}
+
+	for name, url := range map[string]string{
+		"error status": fakeEdgeSnapshot(t, http.StatusInternalServerError, "boom"),
+		"bad body":     fakeEdgeSnapshot(t, http.StatusOK, "{"),
+		"unreachable":  "http://127.0.0.1:1",
+	} {
+		if _, err := EdgeSnapshotSource(url)(); !errors.Is(err, ErrSnapshotUnavailable) {
+			t.Errorf("%s: %v, want ErrSnapshotUnavailable", name, err)
+		}
+	}
+}
+
+func TestSnapshotEndpointsKeepTheirShape(t *testing.T) {
+	a := newTestAPI(t)
+	a.srv.Stats = EdgeSnapshotSource(fakeEdgeSnapshot(t, http.StatusOK, edgeSnapshot))
+	rec := a.mustDo(t, http.StatusOK, "GET", "/api/v1/snapshot", "")
+	var got snapshotJSON
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Traffic.RateRPS != 120 || got.Traffic.LatencyMs["p99"] != 230 || got.Traffic.ErrorRatio != 0.05 {
+		t.Errorf("traffic %+v", got.Traffic)
+	}
+	// Figures the edge does not know read zero, but the keys stay
+	if v, ok := got.Actors["running"]; !ok || v != 0 {
+		t.Errorf("actors %v", got.Actors)
+	}
+	if v, ok := got.Cache["l1_hit"]; !ok || v != 0 {
+		t.Errorf("cache %v", got.Cache)
+	}
+
+	a.srv.Stats = EdgeSnapshotSource(fakeEdgeSnapshot(t, http.StatusServiceUnavailable, ""))
+	a.mustDo(t, http.StatusBadGateway, "GET", "/api/v1/snapshot", "")
+
+	svc := NewAdminServer()
+	if snap, err := svc.GetSnapshot(context.Background(), &Empty{}); err != nil || snap.RateRPS != 0 || snap.TsMs == 0 {
+		t.Errorf("no source: %+v, %v; want zeros at the current time", snap, err)
+	}
+	svc.Stats = a.srv.Stats
+	if _, err := svc.GetSnapshot(context.Background(), &Empty{}); !errors.Is(err, ErrSnapshotUnavailable) {
+		t.Errorf("gRPC with the edge down: %v", err)
+	}
+}
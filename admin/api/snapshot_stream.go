@@ -0,0 +1,118 @@
+// =============================================================================
+// OLWSX - OverLab Web ServerX
+// File: admin/api/snapshot_stream.go
+// Role: Live snapshot feed (gRPC server stream and admin WebSocket)
+// Philosophy: One version, the most stable version, first and last.
+// -----------------------------------------------------------------------------
+// Responsibilities:
+// - Push a Snapshot immediately and then every interval until the client leaves.
+// - gRPC: AdminServer.WatchSnapshot; REST: GET /api/v1/snapshot/stream (WebSocket).
+// - Clamp client-requested intervals so one watcher cannot busy-loop the server.
+// =============================================================================
+
+package admin
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Snapshot push period bounds.
+const (
+	defaultSnapshotInterval = time.Second
+	minSnapshotInterval     = 100 * time.Millisecond
+	maxSnapshotInterval     = time.Minute
+)
+
+// WatchRequest asks for a snapshot every IntervalMs (0 = server default).
+type WatchRequest struct{ IntervalMs int `json:"intervalMs"` }
+
+// SnapshotStream is the server side of a WatchSnapshot call.
+type SnapshotStream interface {
+	Send(*Snapshot) error
+	Context() context.Context // done when the client disconnects
+}
+
+// snapshotInterval resolves the push period from a client request and the server default.
+func snapshotInterval(requestedMs int, def time.Duration) time.Duration {
+	d := def
+	if requestedMs > 0 {
+		d = time.Duration(requestedMs) * time.Millisecond
+	}
+	if d <= 0 {
+		d = defaultSnapshotInterval
+	}
+	if d < minSnapshotInterval {
+		d = minSnapshotInterval
+	}
+	if d > maxSnapshotInterval {
+		d = maxSnapshotInterval
+	}
+	return d
+}
+
+// streamSnapshots sends a snapshot now and then every interval until ctx ends or send fails;
+// ticks where src cannot be read are skipped.
+func streamSnapshots(ctx context.Context, interval time.Duration, src SnapshotSource, send func(*Snapshot) error) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if snap, err := src.snapshot(); err == nil {
+			if err := send(snap); err != nil {
+				return err
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// WatchSnapshot streams snapshots until the client cancels.
+func (s *AdminServer) WatchSnapshot(in *WatchRequest, stream SnapshotStream) error {
+	if in == nil { in = &WatchRequest{} }
+	return streamSnapshots(stream.Context(), snapshotInterval(in.IntervalMs, s.SnapshotInterval), s.Stats, stream.Send)
+}
+
+var snapshotUpgrader = websocket.Upgrader{
+	// Callers authenticate with the HMAC header (withAuth), which browsers cannot forge cross-site.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// GET /api/v1/snapshot/stream?interval_ms=1000 (WebSocket; one JSON Snapshot per text message)
+func (s *Server) SnapshotStream(w http.ResponseWriter, r *http.Request) {
+	ms := 0
+	if v := r.URL.Query().Get("interval_ms"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 { http.Error(w, "bad interval_ms", http.StatusBadRequest); return }
+		ms = n
+	}
+	interval := snapshotInterval(ms, s.SnapshotInterval)
+	conn, err := snapshotUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // Upgrade already replied
+	}
+	defer conn.Close()
+
+	// The client sends nothing; reading surfaces its close frame or a dropped connection.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	_ = streamSnapshots(ctx, interval, s.Stats, func(snap *Snapshot) error {
+		_ = conn.SetWriteDeadline(time.Now().Add(interval + 5*time.Second))
+		return conn.WriteJSON(snap)
+	})
+}
@@ -0,0 +1,129 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// countingStats is a SnapshotSource numbering its snapshots through RateRPS.
+func countingStats(n *atomic.Int64) SnapshotSource {
+	return func() (*Snapshot, error) {
+		return &Snapshot{TsMs: nowMs(), RateRPS: int(n.Add(1))}, nil
+	}
+}
+
+// waitQuiet reports whether n stops changing, i.e. the stream stopped polling the source.
+func waitQuiet(n *atomic.Int64, interval time.Duration) bool {
+	for i := 0; i < 20; i++ {
+		before := n.Load()
+		time.Sleep(3 * interval)
+		if n.Load() == before {
+			return true
+		}
+	}
+	return false
+}
+
+// fakeSnapshotStream cancels its context after want snapshots.
+type fakeSnapshotStream struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	want   int
+	got    []*Snapshot
+}
+
+func (f *fakeSnapshotStream) Context() context.Context { return f.ctx }
+
+func (f *fakeSnapshotStream) Send(s *Snapshot) error {
+	f.got = append(f.got, s)
+	if len(f.got) == f.want {
+		f.cancel()
+	}
+	return nil
+}
+
+func TestWatchSnapshotStreamsUntilCancelled(t *testing.T) {
+	var n atomic.Int64
+	s := NewAdminServer()
+	s.Stats = countingStats(&n)
+	stream := &fakeSnapshotStream{want: 3}
+	stream.ctx, stream.cancel = context.WithCancel(context.Background())
+
+	done := make(chan error, 1)
+	go func() { done <- s.WatchSnapshot(&WatchRequest{IntervalMs: 1}, stream) }()
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("WatchSnapshot = %v, want context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("WatchSnapshot did not end after the client went away")
+	}
+	if len(stream.got) != 3 || stream.got[0].RateRPS != 1 || stream.got[2].RateRPS != 3 {
+		t.Errorf("received %d snapshots", len(stream.got))
+	}
+}
+
+func TestSnapshotWebSocketStreamsUntilDisconnect(t *testing.T) {
+	var n atomic.Int64
+	a := newTestAPI(t)
+	a.srv.Stats = countingStats(&n)
+	srv := httptest.NewServer(a.mux)
+	defer srv.Close()
+
+	hdr := http.Header{"X-OLWSX-Auth": {sign(testKey, "")}}
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/v1/snapshot/stream?interval_ms=100"
+	conn, resp, err := websocket.DefaultDialer.Dial(url, hdr)
+	if err != nil {
+		t.Fatalf("dial: %v (%v)", err, resp)
+	}
+	start := time.Now()
+	var last int
+	for i := 0; i < 3; i++ {
+		var snap Snapshot
+		if err := conn.ReadJSON(&snap); err != nil {
+			t.Fatal(err)
+		}
+		if snap.RateRPS <= last || snap.TsMs == 0 {
+			t.Errorf("snapshot %d: %+v after %d", i, snap, last)
+		}
+		last = snap.RateRPS
+	}
+	// The first snapshot is immediate, then one per interval
+	if took := time.Since(start); took < 150*time.Millisecond {
+		t.Errorf("3 snapshots in %v with a 100ms interval", took)
+	}
+	conn.Close()
+	if !waitQuiet(&n, 100*time.Millisecond) {
+		t.Error("server kept streaming after the client disconnected")
+	}
+
+	if _, resp, err := websocket.DefaultDialer.Dial(url, nil); err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("unsigned stream: %v", err)
+	}
+}
+
+func TestSnapshotIntervalIsClamped(t *testing.T) {
+	for _, tc := range []struct {
+		ms   int
+		def  time.Duration
+		want time.Duration
+	}{
+		{0, 0, defaultSnapshotInterval},
+		{0, 2 * time.Second, 2 * time.Second},
+		{500, 2 * time.Second, 500 * time.Millisecond},
+		{1, 0, minSnapshotInterval},
+		{int(time.Hour / time.Millisecond), 0, maxSnapshotInterval},
+	} {
+		if got := snapshotInterval(tc.ms, tc.def); got != tc.want {
+			t.Errorf("snapshotInterval(%d, %v) = %v, want %v", tc.ms, tc.def, got, tc.want)
+		}
+	}
+}
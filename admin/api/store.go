@@ -0,0 +1,69 @@
+// =============================================================================
+// OLWSX - OverLab Web ServerX
+// File: admin/api/store.go
+// Role: Durable config state for the REST admin API
+// Philosophy: One version, the most stable version, first and last.
+// -----------------------------------------------------------------------------
+// Responsibilities:
+// - Persist staged configs, the applied log and the last apply across restarts.
+// - Rewrite the state file atomically (temp + fsync + rename) under the server lock.
+// - Keep the audit log (audit.go) next to the state file.
+// =============================================================================
+
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+)
+
+// storedState is the on-disk form of the config-management state.
+type storedState struct {
+	Staged    map[string]string `json:"staged"`
+	Applied   []appliedConfig   `json:"applied"`
+	LastApply applyKey          `json:"last_apply"`
+}
+
+// EnableStore persists staged and applied configs at path, loading them if the file exists;
+// the audit log is kept alongside in path + ".audit". Call it before EnableJournal so a
+// rolled-forward apply lands on the loaded state.
+func (s *Server) EnableStore(path string) error {
+	audit, err := OpenAuditLog(path + ".audit")
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Audit = audit
+	s.statePath = path
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s.saveStateLocked()
+	}
+	if err != nil {
+		return err
+	}
+	var st storedState
+	if err := json.Unmarshal(raw, &st); err != nil {
+		return err
+	}
+	for id, content := range st.Staged {
+		s.configStaging[id] = content
+	}
+	s.applied = append(s.applied[:0], st.Applied...)
+	s.lastApply = st.LastApply
+	return nil
+}
+
+// saveStateLocked rewrites the state file; s.mu must be held.
+func (s *Server) saveStateLocked() error {
+	if s.statePath == "" {
+		return nil
+	}
+	raw, err := json.Marshal(storedState{Staged: s.configStaging, Applied: s.applied, LastApply: s.lastApply})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.statePath, raw)
+}
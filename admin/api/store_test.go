@@ -0,0 +1,78 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// storedAPI is a test API whose state is persisted at path.
+func storedAPI(t *testing.T, path string) *testAPI {
+	t.Helper()
+	s := NewServer(testKey)
+	if err := s.EnableStore(path); err != nil {
+		t.Fatal(err)
+	}
+	return serveAPI(s)
+}
+
+func TestStagedConfigsSurviveRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	a := storedAPI(t, path)
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/stage", stageBody("c1", validWSX))
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/stage", stageBody("c2", validWSX+"\n"))
+	a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/apply", `{"id":"c1"}`)
+
+	b := storedAPI(t, path)
+	if got := b.srv.configStaging; got["c1"] != validWSX || got["c2"] != validWSX+"\n" {
+		t.Errorf("staged after restart = %v", got)
+	}
+	if len(b.srv.applied) != 1 || b.srv.applied[0].ID != "c1" || b.srv.lastApply != a.srv.lastApply {
+		t.Errorf("applied after restart = %v, last %v", b.srv.applied, b.srv.lastApply)
+	}
+	// The restored history is usable: rollback finds c1
+	b.mustDo(t, http.StatusOK, "POST", "/api/v1/config/apply", `{"id":"c2"}`)
+	b.mustDo(t, http.StatusOK, "POST", "/api/v1/config/rollback", `{"to":"c1"}`)
+}
+
+func TestConcurrentWritesKeepStateFileValid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	a := storedAPI(t, path)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			if rec := a.do("POST", "/api/v1/config/stage", stageBody(id, validWSX)); rec.Code != http.StatusOK {
+				t.Errorf("stage %s: status %d", id, rec.Code)
+			}
+			a.do("POST", "/api/v1/config/apply", fmt.Sprintf(`{"id":%q}`, id))
+		}(fmt.Sprintf("c%02d", i))
+	}
+	wg.Wait()
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var st storedState
+	if err := json.Unmarshal(raw, &st); err != nil {
+		t.Fatalf("state file corrupt: %v\n%s", err, raw)
+	}
+	if len(st.Staged) != 20 {
+		t.Errorf("state file has %d staged configs, want 20", len(st.Staged))
+	}
+	if matches, _ := filepath.Glob(filepath.Join(filepath.Dir(path), ".tmp-*")); len(matches) != 0 {
+		t.Errorf("temp files left behind: %v", matches)
+	}
+	b := storedAPI(t, path)
+	if !reflect.DeepEqual(b.srv.configStaging, a.srv.configStaging) || !reflect.DeepEqual(b.srv.applied, a.srv.applied) {
+		t.Errorf("restart diverged: %d staged / %d applied, want %d / %d",
+			len(b.srv.configStaging), len(b.srv.applied), len(a.srv.configStaging), len(a.srv.applied))
+	}
+}
@@ -0,0 +1,499 @@
+// =============================================================================
+// OLWSX - OverLab Web ServerX
+// File: admin/api/wsx.go
+// Role: WSX config validation for DryRun/Apply (mirror of config/wsx.rb)
+// Philosophy: One version, the most stable version, first and last.
+// -----------------------------------------------------------------------------
+// Responsibilities:
+// - Tokenize and parse staged .wsx content with the grammar of config/wsx.rb.
+// - Enforce the same structural limits and flag names as the WSX validator.
+// - Report positioned errors (refuse apply) and warnings (advisory).
+// =============================================================================
+
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidConfig is returned when applying a config that fails validation.
+var ErrInvalidConfig = errors.New("invalid config")
+
+// WSX limits and flag names (config/wsx.rb LIMITS and FLAGS).
+const (
+	wsxMaxRouteBytes  = 65536
+	wsxMaxHeaderBytes = 2 * 1024 * 1024
+	wsxMaxBodyBytes   = 64 * 1024 * 1024
+	wsxMaxKeyBytes    = 65536
+)
+
+var wsxFlags = map[string]bool{
+	"COMP_NONE": true, "COMP_GZIP": true, "COMP_ZSTD": true, "COMP_BROTLI": true,
+	"CACHE_MISS": true, "CACHE_L1": true, "CACHE_L2": true, "CACHE_L3": true,
+	"SEC_OK": true, "SEC_WAF": true, "SEC_RATELIM": true,
+}
+
+// ConfigIssue is one validation finding; Line/Col are 1-based (0 = whole config).
+type ConfigIssue struct {
+	Line    int    `json:"line"`
+	Col     int    `json:"col"`
+	Message string `json:"message"`
+}
+
+func (i ConfigIssue) String() string {
+	if i.Line == 0 {
+		return i.Message
+	}
+	return fmt.Sprintf("line %d, col %d: %s", i.Line, i.Col, i.Message)
+}
+
+// ValidateWSX checks content and returns hard errors and warnings. A lexer or parser error
+// stops validation, as in wsx.rb.
+func ValidateWSX(content string) (errs, warns []ConfigIssue) {
+	toks, lexErr := wsxLex(content)
+	if lexErr != nil {
+		return []ConfigIssue{*lexErr}, nil
+	}
+	p := &wsxParser{toks: toks}
+	if err := p.parse(); err != nil {
+		return []ConfigIssue{*err}, nil
+	}
+	at := func(t wsxToken, format string, a ...interface{}) ConfigIssue {
+		return ConfigIssue{Line: t.line, Col: t.col, Message: fmt.Sprintf(format, a...)}
+	}
+
+	if len(p.routes) == 0 {
+		errs = append(errs, ConfigIssue{Message: "no routes defined"})
+	}
+	seen := map[string]bool{}
+	for _, r := range p.routes {
+		if len(r.prefix) > wsxMaxRouteBytes {
+			errs = append(errs, at(r.at, "route prefix too long"))
+		}
+		if !strings.HasPrefix(r.prefix, "/") {
+			warns = append(warns, at(r.at, "route prefix %q does not start with /", r.prefix))
+		}
+		if seen[r.prefix] {
+			warns = append(warns, at(r.at, "duplicate route %q; the first one wins", r.prefix))
+		}
+		seen[r.prefix] = true
+		if r.hasStatus && (r.status < 100 || r.status > 599) {
+			errs = append(errs, at(r.at, "status %d out of range 100-599", r.status))
+		}
+		if r.hasBody && !r.hasStatus {
+			warns = append(warns, at(r.at, "route %q has a static body but no status", r.prefix))
+		}
+		if len(r.body) > wsxMaxBodyBytes {
+			errs = append(errs, at(r.at, "static body too large"))
+		}
+		errs = append(errs, checkFlags(r.flags)...)
+	}
+	headerBytes := map[string]int{}
+	for _, h := range p.headers {
+		if h.key == "" {
+			errs = append(errs, at(h.at, "header key empty"))
+		}
+		if h.value == "" {
+			errs = append(errs, at(h.at, "header value empty"))
+		}
+		if !seen[h.prefix] {
+			warns = append(warns, at(h.at, "header for %q matches no route", h.prefix))
+		}
+		headerBytes[h.prefix] += len(h.key) + len(h.value) + 4
+		if headerBytes[h.prefix] > wsxMaxHeaderBytes {
+			errs = append(errs, at(h.at, "headers too large for prefix %q", h.prefix))
+		}
+	}
+	for _, w := range p.waf {
+		if len(w.value) > wsxMaxRouteBytes {
+			errs = append(errs, at(w.at, "WAF value too long"))
+		}
+	}
+	if rl := p.ratelimit; rl != nil {
+		if rl.capacity <= 0 {
+			errs = append(errs, at(rl.at, "invalid ratelimit capacity"))
+		}
+		if rl.refill <= 0 {
+			errs = append(errs, at(rl.at, "invalid ratelimit refill_per_s"))
+		}
+		if rl.capacity > 0 && rl.refill > rl.capacity {
+			warns = append(warns, at(rl.at, "refill_per_s %d exceeds capacity %d", rl.refill, rl.capacity))
+		}
+	} else {
+		warns = append(warns, ConfigIssue{Message: "no ratelimit statement; edge defaults apply"})
+	}
+	for _, c := range p.cache {
+		if len(c.key) > wsxMaxKeyBytes {
+			errs = append(errs, at(c.at, "cache key too long"))
+		}
+		errs = append(errs, checkFlags(c.flags)...)
+	}
+	if !p.hasGeneration {
+		warns = append(warns, ConfigIssue{Message: "no generation statement; 0 is assumed"})
+	}
+	return errs, warns
+}
+
+func checkFlags(flags []wsxToken) (errs []ConfigIssue) {
+	for _, f := range flags {
+		if !wsxFlags[f.val] {
+			errs = append(errs, ConfigIssue{Line: f.line, Col: f.col, Message: "unknown flag " + f.val})
+		}
+	}
+	return errs
+}
+
+// --- Lexer ---
+
+type wsxToken struct {
+	kind      string // NL, STRING, IDENT, INT, ":", ",", "<", ">", EOF
+	val       string
+	line, col int
+}
+
+func wsxLex(t string) ([]wsxToken, *ConfigIssue) {
+	var toks []wsxToken
+	line, col := 1, 1
+	fail := func(msg string) *ConfigIssue { return &ConfigIssue{Line: line, Col: col, Message: msg} }
+	for i := 0; i < len(t); {
+		ch := t[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\r':
+			i, col = i+1, col+1
+		case ch == '\n':
+			toks = append(toks, wsxToken{kind: "NL", line: line, col: col})
+			i, line, col = i+1, line+1, 1
+		case ch == '#':
+			for i < len(t) && t[i] != '\n' {
+				i, col = i+1, col+1
+			}
+		case ch == '"':
+			sl, sc := line, col
+			i, col = i+1, col+1
+			var b strings.Builder
+			closed := false
+			for i < len(t) && !closed {
+				c := t[i]
+				switch c {
+				case '"':
+					closed = true
+				case '\\':
+					if i+1 >= len(t) {
+						return nil, fail("unfinished escape")
+					}
+					switch t[i+1] {
+					case 'n':
+						b.WriteByte('\n')
+					case 'r':
+						b.WriteByte('\r')
+					case 't':
+						b.WriteByte('\t')
+					case '"', '\\':
+						b.WriteByte(t[i+1])
+					default:
+						return nil, fail(fmt.Sprintf("unsupported escape \\%c", t[i+1]))
+					}
+					i, col = i+1, col+1
+				default:
+					b.WriteByte(c)
+				}
+				i, col = i+1, col+1
+			}
+			if !closed {
+				return nil, fail("unterminated string literal")
+			}
+			toks = append(toks, wsxToken{kind: "STRING", val: b.String(), line: sl, col: sc})
+		case ch == ':' || ch == ',' || ch == '<' || ch == '>':
+			toks = append(toks, wsxToken{kind: string(ch), val: string(ch), line: line, col: col})
+			i, col = i+1, col+1
+		case isAlpha(ch):
+			start, sc := i, col
+			for i < len(t) && (isAlpha(t[i]) || isDigit(t[i]) || strings.IndexByte("/.-", t[i]) >= 0) {
+				i, col = i+1, col+1
+			}
+			toks = append(toks, wsxToken{kind: "IDENT", val: t[start:i], line: line, col: sc})
+		case isDigit(ch):
+			start, sc := i, col
+			for i < len(t) && isDigit(t[i]) {
+				i, col = i+1, col+1
+			}
+			toks = append(toks, wsxToken{kind: "INT", val: t[start:i], line: line, col: sc})
+		default:
+			return nil, fail(fmt.Sprintf("unexpected character %q", ch))
+		}
+	}
+	return toks, nil
+}
+
+func isAlpha(c byte) bool { return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') }
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+// --- Parser ---
+
+type wsxRoute struct {
+	at                 wsxToken
+	prefix, body       string
+	status             int
+	hasStatus, hasBody bool
+	flags              []wsxToken
+}
+
+type wsxHeader struct {
+	at                 wsxToken
+	key, value, prefix string
+}
+
+type wsxWAF struct {
+	at    wsxToken
+	value string
+}
+
+type wsxRateLimit struct {
+	at             wsxToken
+	capacity, refill int
+}
+
+type wsxCache struct {
+	at    wsxToken
+	key   string
+	flags []wsxToken
+}
+
+type wsxParser struct {
+	toks []wsxToken
+	pos  int
+
+	routes        []wsxRoute
+	headers       []wsxHeader
+	waf           []wsxWAF
+	ratelimit     *wsxRateLimit
+	cache         []wsxCache
+	hasGeneration bool
+}
+
+func (p *wsxParser) peek() wsxToken {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return wsxToken{kind: "EOF"}
+}
+
+func (p *wsxParser) next() wsxToken {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *wsxParser) expect(kind, val string) (wsxToken, *ConfigIssue) {
+	t := p.next()
+	if t.kind != kind || (val != "" && t.val != val) {
+		want := kind
+		if val != "" {
+			want += " " + val
+		}
+		return t, &ConfigIssue{Line: t.line, Col: t.col, Message: fmt.Sprintf("expected %s, got %s %q", want, t.kind, t.val)}
+	}
+	return t, nil
+}
+
+func (p *wsxParser) expectInt() (int, *ConfigIssue) {
+	t, err := p.expect("INT", "")
+	if err != nil {
+		return 0, err
+	}
+	n, convErr := strconv.Atoi(t.val)
+	if convErr != nil {
+		return 0, &ConfigIssue{Line: t.line, Col: t.col, Message: "integer out of range"}
+	}
+	return n, nil
+}
+
+func (p *wsxParser) parse() *ConfigIssue {
+	for p.peek().kind != "EOF" {
+		t := p.peek()
+		if t.kind == "NL" {
+			p.next()
+			continue
+		}
+		if t.kind != "IDENT" {
+			return &ConfigIssue{Line: t.line, Col: t.col, Message: "unexpected token " + t.kind}
+		}
+		var err *ConfigIssue
+		switch t.val {
+		case "route":
+			err = p.parseRoute()
+		case "header":
+			err = p.parseHeader()
+		case "waf":
+			err = p.parseWAF()
+		case "ratelimit":
+			err = p.parseRateLimit()
+		case "cache":
+			err = p.parseCache()
+		case "generation":
+			p.next()
+			_, err = p.expectInt()
+			p.hasGeneration = true
+		default:
+			return &ConfigIssue{Line: t.line, Col: t.col, Message: fmt.Sprintf("unknown statement %q", t.val)}
+		}
+		if err != nil {
+			return err
+		}
+		for p.peek().kind == "NL" {
+			p.next()
+		}
+	}
+	return nil
+}
+
+func (p *wsxParser) parseRoute() *ConfigIssue {
+	r := wsxRoute{at: p.next()}
+	prefix, err := p.expect("STRING", "")
+	if err != nil {
+		return err
+	}
+	r.prefix = prefix.val
+	for p.peek().kind == "IDENT" {
+		switch p.peek().val {
+		case "status":
+			p.next()
+			if r.status, err = p.expectInt(); err != nil {
+				return err
+			}
+			r.hasStatus = true
+		case "body":
+			p.next()
+			body, err := p.expect("STRING", "")
+			if err != nil {
+				return err
+			}
+			r.body, r.hasBody = body.val, true
+		case "flags":
+			p.next()
+			if r.flags, err = p.parseFlags(); err != nil {
+				return err
+			}
+		default:
+			p.routes = append(p.routes, r)
+			return nil
+		}
+	}
+	p.routes = append(p.routes, r)
+	return nil
+}
+
+func (p *wsxParser) parseFlags() ([]wsxToken, *ConfigIssue) {
+	var list []wsxToken
+	for {
+		t, err := p.expect("IDENT", "")
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+		if p.peek().kind != "," {
+			return list, nil
+		}
+		p.next()
+	}
+}
+
+func (p *wsxParser) parseHeader() *ConfigIssue {
+	h := wsxHeader{at: p.next()}
+	key, err := p.expect("STRING", "")
+	if err != nil {
+		return err
+	}
+	if _, err := p.expect(":", ""); err != nil {
+		return err
+	}
+	val, err := p.expect("STRING", "")
+	if err != nil {
+		return err
+	}
+	if _, err := p.expect("IDENT", "for"); err != nil {
+		return err
+	}
+	prefix, err := p.expect("STRING", "")
+	if err != nil {
+		return err
+	}
+	h.key, h.value, h.prefix = key.val, val.val, prefix.val
+	p.headers = append(p.headers, h)
+	return nil
+}
+
+func (p *wsxParser) parseWAF() *ConfigIssue {
+	at := p.next()
+	kind, err := p.expect("IDENT", "")
+	if err != nil {
+		return err
+	}
+	if kind.val != "block_path_contains" && kind.val != "block_useragent_contains" {
+		return &ConfigIssue{Line: kind.line, Col: kind.col, Message: fmt.Sprintf("unknown WAF rule %q", kind.val)}
+	}
+	val, err := p.expect("STRING", "")
+	if err != nil {
+		return err
+	}
+	p.waf = append(p.waf, wsxWAF{at: at, value: val.val})
+	return nil
+}
+
+func (p *wsxParser) parseRateLimit() *ConfigIssue {
+	rl := &wsxRateLimit{at: p.next()}
+	var err *ConfigIssue
+	if _, err = p.expect("IDENT", "capacity"); err != nil {
+		return err
+	}
+	if rl.capacity, err = p.expectInt(); err != nil {
+		return err
+	}
+	if _, err = p.expect("IDENT", "refill_per_s"); err != nil {
+		return err
+	}
+	if rl.refill, err = p.expectInt(); err != nil {
+		return err
+	}
+	if _, err = p.expect("IDENT", "retry_after_s"); err != nil {
+		return err
+	}
+	if _, err = p.expectInt(); err != nil {
+		return err
+	}
+	p.ratelimit = rl
+	return nil
+}
+
+func (p *wsxParser) parseCache() *ConfigIssue {
+	c := wsxCache{at: p.next()}
+	var err *ConfigIssue
+	if _, err = p.expect("IDENT", "warmup_l2"); err != nil {
+		return err
+	}
+	if _, err = p.expect("IDENT", "key"); err != nil {
+		return err
+	}
+	key, err := p.expect("STRING", "")
+	if err != nil {
+		return err
+	}
+	c.key = key.val
+	if _, err = p.expect("IDENT", "value"); err != nil {
+		return err
+	}
+	if _, err = p.expect("STRING", ""); err != nil {
+		return err
+	}
+	if t := p.peek(); t.kind == "IDENT" && t.val == "flags" {
+		p.next()
+		if c.flags, err = p.parseFlags(); err != nil {
+			return err
+		}
+	}
+	p.cache = append(p.cache, c)
+	return nil
+}
@@ -0,0 +1,102 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const cleanWSX = `generation 3
+route "/" status 200 flags COMP_GZIP, CACHE_L1
+route "/api/" status 204
+header "X-Edge": "olwsx" for "/api/"
+waf block_path_contains "/.git"
+ratelimit capacity 100 refill_per_s 10 retry_after_s 1
+cache warmup_l2 key "home" value "<html>" flags CACHE_L2
+`
+
+func TestValidateWSX(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		content string
+		errs    []string // substrings of the expected errors, in order
+		warns   []string
+	}{
+		{"clean", cleanWSX, nil, nil},
+		{"warnings only", `route "api" body "x"
+route "api" status 200
+header "X-A": "1" for "/missing"
+ratelimit capacity 10 refill_per_s 20 retry_after_s 1`, nil, []string{
+			`"api" does not start with /`, `static body but no status`,
+			`"api" does not start with /`, `duplicate route "api"`,
+			`"/missing" matches no route`, "refill_per_s 20 exceeds capacity 10",
+			"no generation statement",
+		}},
+		{"semantic errors", `generation 1
+route "/" status 700 flags COMP_LZ4
+ratelimit capacity 0 refill_per_s 0 retry_after_s 1`, []string{
+			"line 2, col 1: status 700 out of range", "line 2, col 28: unknown flag COMP_LZ4",
+			"invalid ratelimit capacity", "invalid ratelimit refill_per_s",
+		}, nil},
+		{"no routes", "generation 1\nratelimit capacity 1 refill_per_s 1 retry_after_s 1", []string{"no routes defined"}, nil},
+		{"unknown statement", "route \"/\" status 200\nlisten 80", []string{`line 2, col 1: unknown statement "listen"`}, nil},
+		{"syntax error", `header "X-A" "1" for "/"`, []string{"line 1"}, nil},
+		{"unknown WAF rule", `waf block_everything "x"`, []string{`unknown WAF rule "block_everything"`}, nil},
+	} {
+		errs, warns := ValidateWSX(tc.content)
+		matchIssues(t, tc.name+" errors", errs, tc.errs)
+		matchIssues(t, tc.name+" warnings", warns, tc.warns)
+	}
+}
+
+func matchIssues(t *testing.T, what string, got []ConfigIssue, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("%s: got %v, want %d issues %q", what, got, len(want), want)
+		return
+	}
+	for i := range want {
+		if !strings.Contains(got[i].String(), want[i]) {
+			t.Errorf("%s[%d] = %q, want it to contain %q", what, i, got[i], want[i])
+		}
+	}
+}
+
+func TestDryRunVerdicts(t *testing.T) {
+	a := newTestAPI(t)
+	for id, content := range map[string]string{
+		"clean":   cleanWSX,
+		"warned":  validWSX,
+		"invalid": `route "/" status 999`,
+	} {
+		a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/stage", stageBody(id, content))
+	}
+	for _, tc := range []struct {
+		id, verdict string
+		errs, warns int
+		applyStatus int
+	}{
+		{"clean", "ok", 0, 0, http.StatusOK},
+		{"warned", "ok", 0, 2, http.StatusOK},
+		{"invalid", "invalid", 1, 2, http.StatusUnprocessableEntity},
+	} {
+		var got struct {
+			Verdict  string        `json:"verdict"`
+			Errors   []ConfigIssue `json:"errors"`
+			Warnings []ConfigIssue `json:"warnings"`
+		}
+		rec := a.mustDo(t, http.StatusOK, "POST", "/api/v1/config/dryrun", `{"id":"`+tc.id+`"}`)
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || got.Errors == nil || got.Warnings == nil {
+			t.Fatalf("%s: %s (%v)", tc.id, rec.Body, err)
+		}
+		if got.Verdict != tc.verdict || len(got.Errors) != tc.errs || len(got.Warnings) != tc.warns {
+			t.Errorf("%s: %s", tc.id, rec.Body)
+		}
+		a.mustDo(t, tc.applyStatus, "POST", "/api/v1/config/apply", `{"id":"`+tc.id+`"}`)
+	}
+	a.mustDo(t, http.StatusNotFound, "POST", "/api/v1/config/dryrun", `{"id":"missing"}`)
+	if n := len(a.srv.applied); n != 2 || a.srv.applied[n-1].ID != "warned" {
+		t.Errorf("applied = %v; the invalid config must not be applied", a.srv.applied)
+	}
+}
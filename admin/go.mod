@@ -0,0 +1,7 @@
+module olwsx/admin
+
+go 1.24.4
+
+require github.com/gorilla/websocket v1.5.1
+
+require golang.org/x/net v0.25.0 // indirect
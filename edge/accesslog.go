@@ -0,0 +1,102 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Scratch buffers for JSON access log lines; encoding appends typed fields directly, no reflection.
+var accessLogBufs = sync.Pool{New: func() any { b := make([]byte, 0, 512); return &b }}
+
+// writeAccessLogJSON writes {"ts",...,"trace_id","span_id","request_id","actor_span"} plus a newline to accessSink.
+func writeAccessLogJSON(method, path, transport string, status, bodyLen int, hints uint32, wafRule string, dur time.Duration, remote, ua string, traceID, spanID uint64, requestID, actorSpan string) {
+	bp := accessLogBufs.Get().(*[]byte)
+	b := (*bp)[:0]
+	b = append(b, `{"ts":"`...)
+	b = time.Now().UTC().AppendFormat(b, time.RFC3339Nano)
+	b = append(b, `","method":`...)
+	b = appendJSONString(b, method)
+	b = append(b, `,"path":`...)
+	b = appendJSONString(b, path)
+	b = append(b, `,"proto":`...)
+	b = appendJSONString(b, transport)
+	b = append(b, `,"status":`...)
+	b = strconv.AppendInt(b, int64(status), 10)
+	b = append(b, `,"bytes":`...)
+	b = strconv.AppendInt(b, int64(bodyLen), 10)
+	b = append(b, `,"hints":`...)
+	b = strconv.AppendUint(b, uint64(hints), 10)
+	if wafRule != "" {
+		b = append(b, `,"waf_rule":`...)
+		b = appendJSONString(b, wafRule)
+	}
+	b = append(b, `,"duration_ms":`...)
+	b = strconv.AppendFloat(b, float64(dur)/float64(time.Millisecond), 'f', 3, 64)
+	b = append(b, `,"remote":`...)
+	b = appendJSONString(b, remote)
+	b = append(b, `,"ua":`...)
+	b = appendJSONString(b, ua)
+	b = append(b, `,"trace_id":"`...)
+	b = appendHex16(b, traceID)
+	b = append(b, `","span_id":"`...)
+	b = appendHex16(b, spanID)
+	b = append(b, '"')
+	if requestID != "" {
+		b = append(b, `,"request_id":`...)
+		b = appendJSONString(b, requestID)
+	}
+	if actorSpan != "" {
+		b = append(b, `,"actor_span":`...)
+		b = appendJSONString(b, actorSpan)
+	}
+	b = append(b, "}\n"...)
+	_, _ = accessSink.Writer().Write(b) // one write per line keeps concurrent lines whole
+	*bp = b
+	accessLogBufs.Put(bp)
+}
+
+// appendHex16 appends v as 16 lowercase hex digits (same form as the X-Trace-ID header).
+func appendHex16(b []byte, v uint64) []byte {
+	const digits = "0123456789abcdef"
+	for shift := 60; shift >= 0; shift -= 4 {
+		b = append(b, digits[(v>>uint(shift))&0xf])
+	}
+	return b
+}
+
+// appendJSONString appends s as a JSON string literal; invalid UTF-8 becomes U+FFFD.
+func appendJSONString(b []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	b = append(b, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				b = append(b, '\\', c)
+			case c == '\n':
+				b = append(b, '\\', 'n')
+			case c == '\r':
+				b = append(b, '\\', 'r')
+			case c == '\t':
+				b = append(b, '\\', 't')
+			case c < 0x20 || c == 0x7f:
+				b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			default:
+				b = append(b, c)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, "\uFFFD"...)
+		} else {
+			b = append(b, s[i:i+size]...)
+		}
+		i += size
+	}
+	return append(b, '"')
+}
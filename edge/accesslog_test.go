@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	edgehttp "olwsx/edge/http"
+	"olwsx/edge/logging"
+	"olwsx/edge/wire"
+)
+
+// withConfig runs the test against a modified copy of the defaults.
+func withConfig(t *testing.T, edit func(*Config)) {
+	t.Helper()
+	prev := conf()
+	c := DefaultConfig()
+	edit(c)
+	activeConfig.Store(c)
+	t.Cleanup(func() { activeConfig.Store(prev) })
+}
+
+// captureAccess points accessSink at a buffer for the test.
+func captureAccess(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := accessSink
+	accessSink = log.New(&buf, "", 0)
+	t.Cleanup(func() { accessSink = prev })
+	return &buf
+}
+
+func TestAccessLogIgnoresLogLevelInBothFormats(t *testing.T) {
+	prev := logging.Default()
+	logging.SetDefault(logging.New(io.Discard, logging.LevelError))
+	t.Cleanup(func() { logging.SetDefault(prev) })
+
+	for _, format := range []string{"text", "json"} {
+		t.Run(format, func(t *testing.T) {
+			withConfig(t, func(c *Config) { c.AccessLogFormat = format; c.MetricsEnabled = false })
+			buf := captureAccess(t)
+			AccessLog("GET", "/a", "h1", 200, 2, 0, "", time.Millisecond, "192.0.2.1", "ua", 0xabc, 0xdef, "", "")
+			line := buf.String()
+			want := "trace=0000000000000abc"
+			if format == "json" {
+				want = `"trace_id":"0000000000000abc"`
+			}
+			if strings.Count(line, "\n") != 1 || !strings.Contains(line, want) {
+				t.Errorf("access sink got %q, want one line containing %s", line, want)
+			}
+		})
+	}
+}
+
+func TestAccessLogDisabledWritesNothing(t *testing.T) {
+	withConfig(t, func(c *Config) { c.AccessLogEnabled = false; c.MetricsEnabled = false })
+	buf := captureAccess(t)
+	AccessLog("GET", "/a", "h1", 500, 0, 0, "", 0, "192.0.2.1", "", 1, 2, "", "")
+	if buf.Len() != 0 {
+		t.Errorf("disabled access log wrote %q", buf)
+	}
+}
+
+func TestAccessSampleAlwaysKeepsErrorsAndFlaggedRequests(t *testing.T) {
+	withConfig(t, func(c *Config) { c.AccessLogSample = 1000 })
+	accessSeq.Store(0)
+	for _, tc := range []struct {
+		status int
+		hints  uint32
+		want   bool
+	}{
+		{500, 0, true},
+		{429, 0, true},
+		{304, 0, true},
+		{101, 0, true},
+		{200, wire.HintRateLimited, true},
+		{200, wire.HintWAFBlocked, true},
+		{200, wire.HintChallenged, false},
+		{200, 0, false},
+	} {
+		if got := sampleAccess(tc.status, tc.hints); got != tc.want {
+			t.Errorf("sampleAccess(%d, %#x) = %v, want %v", tc.status, tc.hints, got, tc.want)
+		}
+	}
+}
+
+func TestAccessLogJSONFieldsAreTyped(t *testing.T) {
+	withConfig(t, func(c *Config) { c.AccessLogFormat = "json"; c.MetricsEnabled = false })
+	buf := captureAccess(t)
+	AccessLog("POST", "/a \"b\"\n\x01é", "h2", 403, 17, wire.HintWAFBlocked, "942100", 1500*time.Microsecond,
+		"192.0.2.1", `curl/8 "x"`, 0xabc, 0xdef, "rid-1", "actor-9")
+	AccessLog("GET", "/", "h1", 200, 0, 0, "", 0, "192.0.2.1", "", 1, 2, "", "")
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines:\n%s", len(lines), buf)
+	}
+	var full map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &full); err != nil {
+		t.Fatalf("invalid JSON %q: %v", lines[0], err)
+	}
+	for key, want := range map[string]interface{}{
+		"method":      "POST",
+		"path":        "/a \"b\"\n\x01é",
+		"proto":       "h2",
+		"status":      float64(403),
+		"bytes":       float64(17),
+		"hints":       float64(wire.HintWAFBlocked),
+		"waf_rule":    "942100",
+		"duration_ms": 1.5,
+		"remote":      "192.0.2.1",
+		"ua":          `curl/8 "x"`,
+		"trace_id":    "0000000000000abc",
+		"span_id":     "0000000000000def",
+		"request_id":  "rid-1",
+		"actor_span":  "actor-9",
+	} {
+		if got := full[key]; got != want {
+			t.Errorf("%s = %#v (%T), want %#v", key, got, got, want)
+		}
+	}
+	if ts, _ := full["ts"].(string); ts == "" {
+		t.Error("ts missing")
+	} else if _, err := time.Parse(time.RFC3339Nano, ts); err != nil {
+		t.Errorf("ts %q: %v", ts, err)
+	}
+
+	// Optional fields are omitted rather than written empty
+	var bare map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &bare); err != nil {
+		t.Fatalf("invalid JSON %q: %v", lines[1], err)
+	}
+	for _, key := range []string{"waf_rule", "request_id", "actor_span"} {
+		if _, ok := bare[key]; ok {
+			t.Errorf("%s present on a plain request", key)
+		}
+	}
+}
+
+func TestAccessLogSamplesSuccessesButKeepsErrors(t *testing.T) {
+	withConfig(t, func(c *Config) { c.AccessLogSample = 10; c.MetricsEnabled = false })
+	accessSeq.Store(0)
+	buf := captureAccess(t)
+	for i := 0; i < 1000; i++ {
+		AccessLog("GET", "/ok", "h1", 200, 0, 0, "", 0, "192.0.2.1", "", 1, 2, "", "")
+	}
+	for _, status := range []int{301, 404, 429, 502} {
+		AccessLog("GET", "/miss", "h1", status, 0, 0, "", 0, "192.0.2.1", "", 1, 2, "", "")
+	}
+	AccessLog("GET", "/blocked", "h1", 200, 0, wire.HintWAFBlocked, "942100", 0, "192.0.2.1", "", 1, 2, "", "")
+
+	out := buf.String()
+	if n := strings.Count(out, `path="/ok"`); n != 100 {
+		t.Errorf("logged %d of 1000 successes, want 1 in 10", n)
+	}
+	if n := strings.Count(out, `path="/miss"`); n != 4 {
+		t.Errorf("logged %d lines for 3 errors and a redirect, want all 4", n)
+	}
+	if !strings.Contains(out, `path="/blocked"`) {
+		t.Error("WAF-blocked request not logged")
+	}
+
+	// A sample rate of 0 or 1 logs everything
+	withConfig(t, func(c *Config) { c.AccessLogSample = 1; c.MetricsEnabled = false })
+	buf.Reset()
+	for i := 0; i < 5; i++ {
+		AccessLog("GET", "/ok", "h1", 200, 0, 0, "", 0, "192.0.2.1", "", 1, 2, "", "")
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 5 {
+		t.Errorf("unsampled: %d lines, want 5", n)
+	}
+}
+
+func TestAccessLogTraceMatchesEnvelopeAndResponse(t *testing.T) {
+	withConfig(t, func(c *Config) { c.AccessLogFormat = "json"; c.MetricsEnabled = false })
+	buf := captureAccess(t)
+
+	// An actor that reports the IDs it received in the envelope and names its own span
+	ln, err := net.Listen("unix", filepath.Join(t.TempDir(), "actor.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	ids := make(chan [2]uint64, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for i := 0; i < 4; i++ { // method, path, headers, body
+			var n [4]byte
+			io.ReadFull(conn, n[:])
+			io.CopyN(io.Discard, conn, int64(binary.LittleEndian.Uint32(n[:])))
+		}
+		var tail [8 + 8 + 4]byte
+		io.ReadFull(conn, tail[:])
+		ids <- [2]uint64{binary.LittleEndian.Uint64(tail[:8]), binary.LittleEndian.Uint64(tail[8:16])}
+		conn.Write(wire.WriteResponse(200, edgehttp.ActorSpanHeader+": actor-span-7\r\n", []byte("ok"), 0))
+	}()
+	useActor(t, &fakeActor{ln: ln})
+
+	h := edgehttp.Handler(edgehttp.Limits{HeaderBytes: 64 << 10, BodyBytes: 1 << 10}, edgehttp.Options{},
+		nil, nil, nil, coreCall, newIDs, AccessLog, MetricReject, MetricError)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/traced", nil))
+	sent := <-ids
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &line); err != nil {
+		t.Fatalf("access line %q: %v", buf, err)
+	}
+	trace := fmt.Sprintf("%016x", sent[0])
+	if line["trace_id"] != trace || rec.Header().Get("X-Trace-ID") != trace {
+		t.Errorf("envelope trace %s, logged %v, X-Trace-ID %q", trace, line["trace_id"], rec.Header().Get("X-Trace-ID"))
+	}
+	if span := fmt.Sprintf("%016x", sent[1]); line["span_id"] != span {
+		t.Errorf("envelope span %s, logged %v", span, line["span_id"])
+	}
+	if line["actor_span"] != "actor-span-7" || rec.Header().Get(edgehttp.ActorSpanHeader) != "actor-span-7" {
+		t.Errorf("actor span logged %v, relayed %q", line["actor_span"], rec.Header().Get(edgehttp.ActorSpanHeader))
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	admin "olwsx/edge/admin"
+)
+
+// actorEndpoint tracks health of one Actor Manager address.
+type actorEndpoint struct {
+	network  string
+	addr     string
+	failedAt time.Time
+}
+
+// actorEndpoints dials Actor Manager endpoints in configured order, skipping recently failed ones.
+// The framed protocol is identical over unix and tcp; tcp may additionally run over TLS.
+type actorEndpoints struct {
+	mu       sync.Mutex
+	eps      []*actorEndpoint
+	cooldown time.Duration
+	timeout  time.Duration
+	tlsCfg   *tls.Config // applied to tcp endpoints only; nil = plaintext
+}
+
+// actors and actorConns are built by main from the loaded config.
+var actors *actorEndpoints
+
+func newActorEndpoints(list []ActorEndpoint, cooldown, timeout time.Duration, tlsCfg *tls.Config) *actorEndpoints {
+	s := &actorEndpoints{cooldown: cooldown, timeout: timeout, tlsCfg: tlsCfg}
+	for _, e := range list {
+		if e.Address == "" {
+			continue
+		}
+		network := e.Network
+		if network == "" {
+			network = "unix"
+		}
+		s.eps = append(s.eps, &actorEndpoint{network: network, addr: e.Address})
+	}
+	return s
+}
+
+// setTLS enables TLS for tcp endpoints; must be called before serving.
+func (s *actorEndpoints) setTLS(cfg *tls.Config) {
+	s.mu.Lock()
+	s.tlsCfg = cfg
+	s.mu.Unlock()
+}
+
+func (ep *actorEndpoint) String() string { return ep.network + ":" + ep.addr }
+
+// order returns healthy endpoints first, then those still cooling down as a last resort.
+func (s *actorEndpoints) order() []*actorEndpoint {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	healthy := make([]*actorEndpoint, 0, len(s.eps))
+	var cooling []*actorEndpoint
+	for _, ep := range s.eps {
+		if !ep.failedAt.IsZero() && now.Sub(ep.failedAt) < s.cooldown {
+			cooling = append(cooling, ep)
+			continue
+		}
+		healthy = append(healthy, ep)
+	}
+	return append(healthy, cooling...)
+}
+
+func (s *actorEndpoints) markFailed(ep *actorEndpoint) {
+	s.mu.Lock()
+	ep.failedAt = time.Now()
+	s.mu.Unlock()
+}
+
+func (s *actorEndpoints) markOK(ep *actorEndpoint) {
+	s.mu.Lock()
+	ep.failedAt = time.Time{}
+	s.mu.Unlock()
+}
+
+// dial connects to the first reachable endpoint.
+func (s *actorEndpoints) dial() (net.Conn, *actorEndpoint, error) {
+	eps := s.order()
+	if len(eps) == 0 {
+		return nil, nil, errors.New("no actor endpoints configured")
+	}
+	s.mu.Lock()
+	tlsCfg := s.tlsCfg
+	s.mu.Unlock()
+	var lastErr error
+	for _, ep := range eps {
+		conn, err := s.dialOne(ep, tlsCfg)
+		if err == nil {
+			return conn, ep, nil
+		}
+		s.markFailed(ep)
+		lastErr = fmt.Errorf("%s: %w", ep, err)
+	}
+	return nil, nil, lastErr
+}
+
+// probe reports whether any endpoint accepts a connection, without touching failure cooldowns.
+func (s *actorEndpoints) probe(ctx context.Context) error {
+	s.mu.Lock()
+	tlsCfg := s.tlsCfg
+	s.mu.Unlock()
+	if len(s.eps) == 0 {
+		return errors.New("no actor endpoints configured")
+	}
+	var lastErr error
+	for _, ep := range s.eps {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		conn, err := s.dialOne(ep, tlsCfg)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		lastErr = fmt.Errorf("%s: %w", ep, err)
+	}
+	return lastErr
+}
+
+func (s *actorEndpoints) dialOne(ep *actorEndpoint, tlsCfg *tls.Config) (net.Conn, error) {
+	d := &net.Dialer{Timeout: s.timeout}
+	switch ep.network {
+	case "unix":
+		return d.Dial("unix", ep.addr)
+	case "tcp", "tcp4", "tcp6":
+		if tlsCfg != nil {
+			return tls.DialWithDialer(d, ep.network, ep.addr, tlsCfg)
+		}
+		return d.Dial(ep.network, ep.addr)
+	default:
+		return nil, fmt.Errorf("unsupported actor network %q", ep.network)
+	}
+}
+
+// actorPool caps concurrent actor connections and keeps reusable ones idle.
+// coreCall returns a connection as reusable after a fully decoded framed response;
+// bare responses are read to EOF, so those connections are closed.
+type actorPool struct {
+	eps     *actorEndpoints
+	slots   chan struct{}
+	wait    time.Duration
+	maxIdle int
+
+	mu   sync.Mutex
+	idle []pooledConn
+
+	borrows    atomic.Uint64
+	reuses     atomic.Uint64
+	dialErrors atomic.Uint64
+	waitErrors atomic.Uint64
+	active     atomic.Int64
+	waitHist   *admin.Histogram
+}
+
+type pooledConn struct {
+	conn net.Conn
+	ep   *actorEndpoint
+}
+
+var actorConns *actorPool
+
+func newActorPool(eps *actorEndpoints, size, maxIdle int, wait time.Duration) *actorPool {
+	if size <= 0 {
+		size = 1
+	}
+	return &actorPool{
+		eps:      eps,
+		slots:    make(chan struct{}, size),
+		wait:     wait,
+		maxIdle:  maxIdle,
+		waitHist: admin.NewHistogram([]float64{0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1}),
+	}
+}
+
+// get borrows a connection, waiting up to p.wait for a free slot.
+func (p *actorPool) get() (net.Conn, *actorEndpoint, error) {
+	start := time.Now()
+	timer := time.NewTimer(p.wait)
+	defer timer.Stop()
+	select {
+	case p.slots <- struct{}{}:
+	case <-timer.C:
+		p.waitErrors.Add(1)
+		return nil, nil, errors.New("actor pool exhausted")
+	}
+	p.waitHist.Observe(time.Since(start).Seconds())
+	p.borrows.Add(1)
+
+	// Newest idle connection first; ones the Actor Manager closed while idle are discarded
+	for {
+		p.mu.Lock()
+		n := len(p.idle)
+		if n == 0 {
+			p.mu.Unlock()
+			break
+		}
+		pc := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		if !idleAlive(pc.conn) {
+			_ = pc.conn.Close()
+			continue
+		}
+		p.reuses.Add(1)
+		p.active.Add(1)
+		return pc.conn, pc.ep, nil
+	}
+
+	conn, ep, err := p.eps.dial()
+	if err != nil {
+		p.dialErrors.Add(1)
+		<-p.slots
+		return nil, nil, err
+	}
+	p.active.Add(1)
+	return conn, ep, nil
+}
+
+// put returns a borrowed connection; non-reusable ones are closed.
+func (p *actorPool) put(conn net.Conn, ep *actorEndpoint, reusable bool) {
+	p.active.Add(-1)
+	if reusable {
+		p.mu.Lock()
+		if len(p.idle) < p.maxIdle {
+			p.idle = append(p.idle, pooledConn{conn: conn, ep: ep})
+			conn = nil
+		}
+		p.mu.Unlock()
+	}
+	if conn != nil {
+		_ = conn.Close()
+	}
+	<-p.slots
+}
+
+// writeMetrics is registered as an admin collector.
+func (p *actorPool) writeMetrics(w io.Writer) {
+	p.mu.Lock()
+	idle := len(p.idle)
+	p.mu.Unlock()
+	fmt.Fprintln(w, "# HELP olwsx_edge_actor_pool_size configured actor connection pool size")
+	fmt.Fprintln(w, "# TYPE olwsx_edge_actor_pool_size gauge")
+	fmt.Fprintf(w, "olwsx_edge_actor_pool_size %d\n", cap(p.slots))
+	fmt.Fprintln(w, "# HELP olwsx_edge_actor_pool_conns actor connections by state")
+	fmt.Fprintln(w, "# TYPE olwsx_edge_actor_pool_conns gauge")
+	fmt.Fprintf(w, "olwsx_edge_actor_pool_conns{state=\"active\"} %d\n", p.active.Load())
+	fmt.Fprintf(w, "olwsx_edge_actor_pool_conns{state=\"idle\"} %d\n", idle)
+	fmt.Fprintln(w, "# HELP olwsx_edge_actor_pool_borrows_total connections borrowed from the pool")
+	fmt.Fprintln(w, "# TYPE olwsx_edge_actor_pool_borrows_total counter")
+	fmt.Fprintf(w, "olwsx_edge_actor_pool_borrows_total %d\n", p.borrows.Load())
+	fmt.Fprintln(w, "# HELP olwsx_edge_actor_pool_reuses_total borrows served by an idle connection")
+	fmt.Fprintln(w, "# TYPE olwsx_edge_actor_pool_reuses_total counter")
+	fmt.Fprintf(w, "olwsx_edge_actor_pool_reuses_total %d\n", p.reuses.Load())
+	fmt.Fprintln(w, "# HELP olwsx_edge_actor_pool_errors_total pool failures by kind")
+	fmt.Fprintln(w, "# TYPE olwsx_edge_actor_pool_errors_total counter")
+	fmt.Fprintf(w, "olwsx_edge_actor_pool_errors_total{kind=\"dial\"} %d\n", p.dialErrors.Load())
+	fmt.Fprintf(w, "olwsx_edge_actor_pool_errors_total{kind=\"wait_timeout\"} %d\n", p.waitErrors.Load())
+	fmt.Fprintln(w, "# HELP olwsx_edge_actor_pool_wait_seconds time spent waiting for a pool slot")
+	fmt.Fprintln(w, "# TYPE olwsx_edge_actor_pool_wait_seconds histogram")
+	p.waitHist.WritePrometheus(w, "olwsx_edge_actor_pool_wait_seconds", "")
+}
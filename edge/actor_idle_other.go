@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "net"
+
+// idleAlive cannot peek at the socket on this platform; idle connections are assumed healthy.
+func idleAlive(conn net.Conn) bool { return true }
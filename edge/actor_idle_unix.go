@@ -0,0 +1,34 @@
+//go:build unix
+
+package main
+
+import (
+	"crypto/tls"
+	"net"
+	"syscall"
+)
+
+// idleAlive reports whether an idle actor connection is still usable: a non-blocking peek finds
+// nothing to read on a healthy socket, while a closed one reports EOF (and stray bytes mean the
+// stream is out of step with the requests).
+func idleAlive(conn net.Conn) bool {
+	if tc, ok := conn.(*tls.Conn); ok {
+		conn = tc.NetConn()
+	}
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return true
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return false
+	}
+	alive := false
+	err = raw.Read(func(fd uintptr) bool {
+		var b [1]byte
+		_, _, rerr := syscall.Recvfrom(int(fd), b[:], syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+		alive = rerr == syscall.EAGAIN || rerr == syscall.EWOULDBLOCK
+		return true
+	})
+	return err == nil && alive
+}
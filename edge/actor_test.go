@@ -0,0 +1,338 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	edgehttp "olwsx/edge/http"
+	edgetls "olwsx/edge/tls"
+	"olwsx/edge/wire"
+)
+
+// fakeActor serves actor envelopes on a unix socket. Framed responses keep the connection open
+// for the next request; bare responses are written and the connection closed. closeAfter > 0
+// closes a connection after that many framed responses.
+type fakeActor struct {
+	ln         net.Listener
+	accepts    atomic.Int64
+	framed     bool
+	closeAfter int
+}
+
+func startFakeActor(t *testing.T, framed bool, closeAfter int) *fakeActor {
+	t.Helper()
+	ln, err := net.Listen("unix", filepath.Join(t.TempDir(), "actor.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serveFakeActor(t, ln, framed, closeAfter)
+}
+
+// serveFakeActor runs a fake actor on ln, which may be any stream listener.
+func serveFakeActor(t *testing.T, ln net.Listener, framed bool, closeAfter int) *fakeActor {
+	t.Helper()
+	a := &fakeActor{ln: ln, framed: framed, closeAfter: closeAfter}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			a.accepts.Add(1)
+			go a.serve(conn)
+		}
+	}()
+	return a
+}
+
+func (a *fakeActor) serve(conn net.Conn) {
+	defer conn.Close()
+	for n := 1; ; n++ {
+		path, err := readEnvelopePath(conn)
+		if err != nil {
+			return
+		}
+		resp := wire.WriteResponse(200, "Content-Type: text/plain\r\n", []byte("ok "+path), 0)
+		if !a.framed {
+			conn.Write(resp[len(wire.ResponseMagic)+5:])
+			return
+		}
+		if _, err := conn.Write(resp); err != nil {
+			return
+		}
+		if a.closeAfter > 0 && n >= a.closeAfter {
+			return
+		}
+	}
+}
+
+// readEnvelopePath consumes one request envelope and returns its path.
+func readEnvelopePath(r io.Reader) (string, error) {
+	var fields [4][]byte
+	for i := range fields {
+		var n [4]byte
+		if _, err := io.ReadFull(r, n[:]); err != nil {
+			return "", err
+		}
+		fields[i] = make([]byte, binary.LittleEndian.Uint32(n[:]))
+		if _, err := io.ReadFull(r, fields[i]); err != nil {
+			return "", err
+		}
+	}
+	var ids [8 + 8 + 4]byte
+	if _, err := io.ReadFull(r, ids[:]); err != nil {
+		return "", err
+	}
+	return string(fields[1]), nil
+}
+
+// useActor points coreCall at a, restoring the previous endpoints and pool afterwards.
+func useActor(t *testing.T, a *fakeActor) {
+	t.Helper()
+	prevActors, prevConns := actors, actorConns
+	addr := a.ln.Addr()
+	actors = newActorEndpoints([]ActorEndpoint{{Network: addr.Network(), Address: addr.String()}}, time.Second, time.Second, nil)
+	actorConns = newActorPool(actors, 4, 4, time.Second)
+	t.Cleanup(func() { actors, actorConns = prevActors, prevConns })
+}
+
+func callActor(t *testing.T, path string) {
+	t.Helper()
+	resp, code := coreCall("GET", path, "", nil, 1, 2, 0)
+	if code != 0 {
+		t.Fatalf("coreCall(%s) code = %d", path, code)
+	}
+	if got := string(resp.Body); got != "ok "+path {
+		t.Fatalf("coreCall(%s) body = %q", path, got)
+	}
+}
+
+func TestCoreCallReusesFramedConnections(t *testing.T) {
+	a := startFakeActor(t, true, 0)
+	useActor(t, a)
+	for _, p := range []string{"/a", "/b", "/c"} {
+		callActor(t, p)
+	}
+	if n := a.accepts.Load(); n != 1 {
+		t.Errorf("actor accepted %d connections, want 1", n)
+	}
+	if n := actorConns.reuses.Load(); n != 2 {
+		t.Errorf("pool reuses = %d, want 2", n)
+	}
+	if n := actorConns.active.Load(); n != 0 {
+		t.Errorf("active conns = %d after calls, want 0", n)
+	}
+}
+
+func TestCoreCallClosesBareConnections(t *testing.T) {
+	a := startFakeActor(t, false, 0)
+	useActor(t, a)
+	for _, p := range []string{"/a", "/b"} {
+		callActor(t, p)
+	}
+	if n := a.accepts.Load(); n != 2 {
+		t.Errorf("actor accepted %d connections, want 2", n)
+	}
+	if n := actorConns.reuses.Load(); n != 0 {
+		t.Errorf("pool reuses = %d, want 0", n)
+	}
+}
+
+func TestActorPoolDiscardsClosedIdleConnections(t *testing.T) {
+	a := startFakeActor(t, true, 1) // actor hangs up after every response
+	useActor(t, a)
+	callActor(t, "/a")
+	time.Sleep(50 * time.Millisecond) // let the close reach the idle conn
+	callActor(t, "/b")
+	if n := a.accepts.Load(); n != 2 {
+		t.Errorf("actor accepted %d connections, want 2", n)
+	}
+	if n := actorConns.reuses.Load(); n != 0 {
+		t.Errorf("pool reuses = %d, want 0 (closed conn must not be reused)", n)
+	}
+}
+
+func TestCoreCallFailsOverToNextEndpoint(t *testing.T) {
+	a := startFakeActor(t, true, 0)
+	dead := filepath.Join(t.TempDir(), "dead.sock") // nothing listens here
+	useActor(t, a)
+	actors = newActorEndpoints([]ActorEndpoint{{Network: "unix", Address: dead}, {Network: "unix", Address: a.ln.Addr().String()}},
+		time.Minute, time.Second, nil)
+	actorConns = newActorPool(actors, 4, 0, time.Second)
+
+	callActor(t, "/a")
+	if n := a.accepts.Load(); n != 1 {
+		t.Fatalf("second endpoint accepted %d connections, want 1", n)
+	}
+	// The refused endpoint cools down behind the healthy one
+	if order := actors.order(); order[0].addr != a.ln.Addr().String() || order[1].addr != dead {
+		t.Errorf("order after failure = %v", order)
+	}
+	callActor(t, "/b")
+}
+
+func TestCoreCallFailsWhenNoEndpointAnswers(t *testing.T) {
+	a := startFakeActor(t, true, 0)
+	useActor(t, a)
+	actors = newActorEndpoints([]ActorEndpoint{{Network: "unix", Address: filepath.Join(t.TempDir(), "dead.sock")}},
+		time.Minute, time.Second, nil)
+	actorConns = newActorPool(actors, 4, 0, time.Second)
+	if _, code := coreCall("GET", "/", "", nil, 1, 2, 0); code == 0 {
+		t.Error("coreCall succeeded with no reachable endpoint")
+	}
+}
+
+func TestCoreCallOverTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := serveFakeActor(t, ln, true, 0)
+	useActor(t, a)
+	callActor(t, "/a")
+	callActor(t, "/b")
+	if n := a.accepts.Load(); n != 1 {
+		t.Errorf("actor accepted %d connections, want 1", n)
+	}
+}
+
+func TestCoreCallOverTLS(t *testing.T) {
+	cert, err := edgetls.LoadOrSelfSign("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := edgetls.ListenTLS("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := serveFakeActor(t, ln, true, 0)
+	useActor(t, a)
+	actors.setTLS(&tls.Config{InsecureSkipVerify: true}) // self-signed test cert
+	callActor(t, "/a")
+
+	// A plaintext client cannot talk to the TLS actor
+	actors.setTLS(nil)
+	actorConns = newActorPool(actors, 4, 0, time.Second)
+	if _, code := coreCall("GET", "/b", "", nil, 1, 2, 0); code == 0 {
+		t.Error("plaintext call to a TLS actor succeeded")
+	}
+}
+
+func TestActorPoolMetricsTrackBorrowsAndErrors(t *testing.T) {
+	a := startFakeActor(t, true, 0)
+	useActor(t, a)
+	actorConns = newActorPool(actors, 1, 1, 20*time.Millisecond)
+	callActor(t, "/a")
+	callActor(t, "/b")
+
+	// The only slot is held, so the next borrow times out
+	conn, ep, err := actorConns.get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := actorConns.get(); err == nil {
+		t.Fatal("borrow from an exhausted pool succeeded")
+	}
+	actorConns.put(conn, ep, true)
+	var live strings.Builder
+	actorConns.writeMetrics(&live)
+	for _, want := range []string{
+		"olwsx_edge_actor_pool_size 1",
+		"olwsx_edge_actor_pool_borrows_total 3",
+		"olwsx_edge_actor_pool_reuses_total 2",
+		`olwsx_edge_actor_pool_conns{state="active"} 0`,
+		`olwsx_edge_actor_pool_conns{state="idle"} 1`,
+		`olwsx_edge_actor_pool_errors_total{kind="wait_timeout"} 1`,
+		`olwsx_edge_actor_pool_errors_total{kind="dial"} 0`,
+		"olwsx_edge_actor_pool_wait_seconds_count 3",
+	} {
+		if !strings.Contains(live.String(), want+"\n") {
+			t.Errorf("metrics missing %q:\n%s", want, live.String())
+		}
+	}
+
+	// A dead endpoint counts as a dial error and frees the slot
+	actorConns = newActorPool(newActorEndpoints([]ActorEndpoint{{Network: "unix", Address: filepath.Join(t.TempDir(), "dead.sock")}},
+		time.Second, time.Second, nil), 1, 1, 20*time.Millisecond)
+	if _, _, err := actorConns.get(); err == nil {
+		t.Fatal("dial to a dead endpoint succeeded")
+	}
+	var dead strings.Builder
+	actorConns.writeMetrics(&dead)
+	for _, want := range []string{
+		`olwsx_edge_actor_pool_errors_total{kind="dial"} 1`,
+		`olwsx_edge_actor_pool_conns{state="active"} 0`,
+	} {
+		if !strings.Contains(dead.String(), want+"\n") {
+			t.Errorf("metrics after dial failure missing %q", want)
+		}
+	}
+}
+
+func TestCoreCallReportsVersionMismatch(t *testing.T) {
+	ln, err := net.Listen("unix", filepath.Join(t.TempDir(), "actor.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	var accepts atomic.Int64
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepts.Add(1)
+			go func() {
+				defer conn.Close()
+				for {
+					if _, err := readEnvelopePath(conn); err != nil {
+						return
+					}
+					resp := wire.WriteResponse(200, "", []byte("from the future"), 0)
+					resp[len(wire.ResponseMagic)] = wire.ResponseVersion + 1
+					if _, err := conn.Write(resp); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	useActor(t, &fakeActor{ln: ln})
+
+	for i := 0; i < 2; i++ {
+		if _, code := coreCall("GET", "/", "", nil, 1, 2, 0); code != edgehttp.CoreVersionMismatch {
+			t.Fatalf("call %d: code = %d, want CoreVersionMismatch", i, code)
+		}
+	}
+	// The stream position is unknown after a rejected frame, so the connection is not reused;
+	// the endpoint itself is healthy and stays in rotation
+	if n := accepts.Load(); n != 2 {
+		t.Errorf("accepts = %d, want a fresh connection per call", n)
+	}
+}
+
+func TestCoreCallReadsLargeResponses(t *testing.T) {
+	withConfig(t, func(c *Config) { c.ActorMaxResponse = 4 << 20 })
+	a := startFakeActor(t, true, 0)
+	useActor(t, a)
+	// The fake actor echoes the path, so a long path makes a response past the old 1MB cap
+	callActor(t, "/"+strings.Repeat("x", 2<<20))
+	callActor(t, "/small") // and the connection is still in step afterwards
+	if n := a.accepts.Load(); n != 1 {
+		t.Errorf("actor accepted %d connections, want 1", n)
+	}
+
+	withConfig(t, func(c *Config) { c.ActorMaxResponse = 1 << 10 })
+	if _, code := coreCall("GET", "/"+strings.Repeat("x", 2<<10), "", nil, 1, 2, 0); code != 5 {
+		t.Errorf("response over actor_max_response: code %d, want 5", code)
+	}
+}
@@ -1,21 +1,68 @@
 package admin
 
 import (
-	"log"
+	"context"
 	"net/http"
+	"strings"
+
+	"olwsx/edge/logging"
 )
 
-// ListenAndServe starts a minimal admin server providing health and metrics endpoints.
-func ListenAndServe(addr string, health http.HandlerFunc, metrics http.HandlerFunc) {
+// Server is the minimal admin server providing health and metrics endpoints.
+type Server struct {
+	srv       *http.Server
+	mux       *http.ServeMux
+	onRequest func(route string)
+}
+
+// NewServer builds the admin server on addr; run it with ListenAndServe.
+func NewServer(addr string, health http.HandlerFunc, metrics http.HandlerFunc) *Server {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", health)
 	mux.HandleFunc("/metrics", metrics)
-	s := &http.Server{
-		Addr:    addr,
-		Handler: mux,
+	s := &Server{mux: mux}
+	s.srv = &http.Server{
+		Addr: addr,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if s.onRequest != nil {
+				_, pattern := mux.Handler(r)
+				s.onRequest(routeName(pattern))
+			}
+			mux.ServeHTTP(w, r)
+		}),
+	}
+	return s
+}
+
+// OnRequest installs a hook called with each request's route name ("health", "waf_reload",
+// ...; "not_found" when no endpoint matches); call it before ListenAndServe.
+func (s *Server) OnRequest(fn func(route string)) {
+	s.onRequest = fn
+}
+
+// routeName turns a mux pattern into a metric-friendly name: "/waf/reload" -> "waf_reload".
+func routeName(pattern string) string {
+	name := strings.ReplaceAll(strings.Trim(pattern, "/"), "/", "_")
+	if name == "" {
+		return "not_found"
 	}
-	log.Printf("Admin server on %s", addr)
-	if err := s.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Printf("admin server error: %v", err)
+	return name
+}
+
+// Handle registers an extra admin endpoint; call it before ListenAndServe.
+func (s *Server) Handle(pattern string, h http.HandlerFunc) {
+	s.mux.HandleFunc(pattern, h)
+}
+
+// ListenAndServe blocks until the server stops; unexpected errors are logged.
+func (s *Server) ListenAndServe() {
+	logging.Info("Admin server on %s", s.srv.Addr)
+	if err := s.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logging.Error("admin server error: %v", err)
 	}
-}
\ No newline at end of file
+}
+
+// Shutdown stops the admin server, waiting for in-flight scrapes until ctx expires.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
@@ -0,0 +1,36 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestOnRequestReportsRouteNames(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	s := NewServer(":0", ok, ok)
+	s.Handle("/waf/reload", ok)
+	s.Handle("/ready", ok)
+	var routes []string
+	s.OnRequest(func(route string) { routes = append(routes, route) })
+
+	paths := map[string]string{
+		"/health":     "health",
+		"/metrics":    "metrics",
+		"/ready":      "ready",
+		"/waf/reload": "waf_reload",
+		"/nope":       "not_found",
+		"/":           "not_found",
+	}
+	for path, want := range paths {
+		routes = routes[:0]
+		rec := httptest.NewRecorder()
+		s.srv.Handler.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if len(routes) != 1 || routes[0] != want {
+			t.Errorf("%s: reported %v, want [%s]", path, routes, want)
+		}
+		if want == "not_found" && rec.Code != http.StatusNotFound {
+			t.Errorf("%s: status %d", path, rec.Code)
+		}
+	}
+}
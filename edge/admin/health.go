@@ -5,7 +5,7 @@ import (
 	"net/http"
 )
 
-// HealthHandler returns OK for liveness/readiness checks.
+// HealthHandler returns OK as a pure liveness probe; readiness is Readiness.
 func HealthHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/plain")
 	fmt.Fprintln(w, "OK")
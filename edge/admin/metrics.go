@@ -2,14 +2,122 @@ package admin
 
 import (
 	"fmt"
+	"io"
 	"net/http"
+	"sync"
 )
 
-// MetricsHandler exposes simple placeholder metrics; integrate Prometheus exporter in production.
+// Collector appends Prometheus text exposition lines for a subsystem (e.g. actor pool).
+type Collector func(w io.Writer)
+
+var (
+	collectorsMu sync.Mutex
+	collectors   []Collector
+)
+
+// RegisterCollector adds c to the /metrics output.
+func RegisterCollector(c Collector) {
+	collectorsMu.Lock()
+	collectors = append(collectors, c)
+	collectorsMu.Unlock()
+}
+
+// MetricsHandler exposes the Default registry plus registered collectors.
 func MetricsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
-	fmt.Fprintln(w, "# HELP olwsx_edge_requests_total total requests processed")
-	fmt.Fprintln(w, "# TYPE olwsx_edge_requests_total counter")
-	// In real deployment, counters would be tracked and exposed here.
-	fmt.Fprintln(w, "olwsx_edge_requests_total 0")
-}
\ No newline at end of file
+	Default.WritePrometheus(w)
+
+	collectorsMu.Lock()
+	cs := append([]Collector(nil), collectors...)
+	collectorsMu.Unlock()
+	for _, c := range cs {
+		c(w)
+	}
+}
+
+// Histogram is a fixed-bucket, concurrency-safe histogram rendered in Prometheus format.
+type Histogram struct {
+	mu      sync.Mutex
+	bounds  []float64 // upper bounds, ascending
+	buckets []uint64  // non-cumulative counts; last slot is +Inf
+	sum     float64
+	count   uint64
+}
+
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{
+		bounds:  bounds,
+		buckets: make([]uint64, len(bounds)+1),
+	}
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := 0
+	for i < len(h.bounds) && v > h.bounds[i] {
+		i++
+	}
+	h.mu.Lock()
+	h.buckets[i]++
+	h.sum += v
+	h.count++
+	h.mu.Unlock()
+}
+
+// WritePrometheus renders _bucket/_sum/_count series; labels is either empty or `k="v",...`.
+func (h *Histogram) WritePrometheus(w io.Writer, name, labels string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sep := ""
+	if labels != "" {
+		sep = ","
+	}
+	var cum uint64
+	for i, b := range h.bounds {
+		cum += h.buckets[i]
+		fmt.Fprintf(w, "%s_bucket{%s%sle=\"%g\"} %d\n", name, labels, sep, b, cum)
+	}
+	cum += h.buckets[len(h.bounds)]
+	fmt.Fprintf(w, "%s_bucket{%s%sle=\"+Inf\"} %d\n", name, labels, sep, cum)
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s_sum%s %g\n", name, labels, h.sum)
+	fmt.Fprintf(w, "%s_count%s %d\n", name, labels, h.count)
+}
+
+// Counts returns a copy of the non-cumulative bucket counts (last slot +Inf).
+func (h *Histogram) Counts() []uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]uint64(nil), h.buckets...)
+}
+
+// BucketQuantile estimates the q-quantile (0..1) of non-cumulative bucket counts by linear
+// interpolation inside the bucket holding it, as Prometheus histogram_quantile does; the +Inf
+// bucket reports the highest bound. It returns 0 when there are no observations.
+func BucketQuantile(bounds []float64, buckets []uint64, q float64) float64 {
+	var total uint64
+	for _, b := range buckets {
+		total += b
+	}
+	if total == 0 || len(bounds) == 0 {
+		return 0
+	}
+	rank := q * float64(total)
+	var cum uint64
+	for i, b := range buckets {
+		if b == 0 || float64(cum+b) < rank {
+			cum += b
+			continue
+		}
+		if i == len(bounds) {
+			return bounds[len(bounds)-1]
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = bounds[i-1]
+		}
+		return lower + (bounds[i]-lower)*(rank-float64(cum))/float64(b)
+	}
+	return bounds[len(bounds)-1]
+}
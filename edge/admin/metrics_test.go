@@ -0,0 +1,84 @@
+package admin
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestHistogramBucketsAreCumulative(t *testing.T) {
+	h := NewHistogram([]float64{0.1, 0.5, 1})
+	for _, v := range []float64{0.05, 0.1, 0.3, 0.7, 0.9, 2} {
+		h.Observe(v)
+	}
+	if got := h.Counts(); len(got) != 4 || got[0] != 2 || got[1] != 1 || got[2] != 2 || got[3] != 1 {
+		t.Errorf("Counts() = %v, want [2 1 2 1]", got)
+	}
+
+	var b strings.Builder
+	h.WritePrometheus(&b, "lat_seconds", `route="/a"`)
+	want := `lat_seconds_bucket{route="/a",le="0.1"} 2
+lat_seconds_bucket{route="/a",le="0.5"} 3
+lat_seconds_bucket{route="/a",le="1"} 5
+lat_seconds_bucket{route="/a",le="+Inf"} 6
+lat_seconds_sum{route="/a"} 4.05
+lat_seconds_count{route="/a"} 6
+`
+	if b.String() != want {
+		t.Errorf("exposition:\n%s\nwant:\n%s", b.String(), want)
+	}
+
+	b.Reset()
+	NewHistogram([]float64{1}).WritePrometheus(&b, "empty", "")
+	if want := "empty_bucket{le=\"1\"} 0\nempty_bucket{le=\"+Inf\"} 0\nempty_sum 0\nempty_count 0\n"; b.String() != want {
+		t.Errorf("unlabeled exposition:\n%s", b.String())
+	}
+}
+
+func TestRegistryHistogramSeries(t *testing.T) {
+	r := NewRegistry()
+	bounds := []float64{0.01, 0.1}
+	r.Histogram("d_seconds", "d", bounds, "class", "2xx").Observe(0.005)
+	r.Histogram("d_seconds", "d", bounds, "class", "5xx").Observe(0.05)
+	r.Histogram("d_seconds", "d", bounds, "class", "5xx").Observe(1)
+
+	if got := r.HistogramCounts("d_seconds", bounds); len(got) != 3 || got[0] != 1 || got[1] != 1 || got[2] != 1 {
+		t.Errorf("HistogramCounts = %v", got)
+	}
+	if got := r.HistogramCounts("missing", bounds); got != nil {
+		t.Errorf("HistogramCounts(missing) = %v", got)
+	}
+
+	var b strings.Builder
+	r.WritePrometheus(&b)
+	for _, want := range []string{
+		"# TYPE d_seconds histogram\n",
+		`d_seconds_bucket{class="5xx",le="0.1"} 1` + "\n",
+		`d_seconds_bucket{class="5xx",le="+Inf"} 2` + "\n",
+		`d_seconds_count{class="2xx"} 1` + "\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("exposition missing %q:\n%s", want, b.String())
+		}
+	}
+}
+
+func TestBucketQuantileInterpolates(t *testing.T) {
+	bounds := []float64{0.1, 0.5, 1}
+	for _, tc := range []struct {
+		buckets []uint64
+		q, want float64
+	}{
+		{[]uint64{0, 0, 0, 0}, 0.5, 0},
+		{[]uint64{10, 0, 0, 0}, 0.5, 0.05},    // halfway through [0, 0.1]
+		{[]uint64{5, 5, 0, 0}, 0.5, 0.1},      // the rank ends exactly at a bound
+		{[]uint64{5, 5, 0, 0}, 0.9, 0.42},     // 4 of 5 into [0.1, 0.5]
+		{[]uint64{0, 0, 10, 0}, 0.99, 0.995},  // skips empty buckets
+		{[]uint64{1, 0, 0, 9}, 0.9, 1},        // +Inf reports the highest bound
+		{[]uint64{100, 0, 0, 0}, 0.01, 0.001}, // low quantiles stay inside the first bucket
+	} {
+		if got := BucketQuantile(bounds, tc.buckets, tc.q); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("BucketQuantile(%v, %v) = %v, want %v", tc.buckets, tc.q, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package admin
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+)
+
+// RateLimitSetter applies a new per-IP token bucket (capacity, refill per second) to the edge limiter.
+type RateLimitSetter func(capacity, refillPerSec int) error
+
+// RateLimitHandler lets the control plane retune the edge rate limiter at runtime.
+// POST body: {"capacity": 80, "refill_per_s": 40}; only loopback callers are accepted since the
+// admin listener is unauthenticated (the admin API relays authenticated requests from the same host).
+func RateLimitHandler(set RateLimitSetter) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !fromLoopback(r) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		var req struct {
+			Capacity   int `json:"capacity"`
+			RefillPerS int `json:"refill_per_s"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&req); err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if err := set(req.Capacity, req.RefillPerS); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(req)
+	}
+}
+
+// fromLoopback guards control endpoints: the admin listener itself is unauthenticated.
+func fromLoopback(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	ip := net.ParseIP(host)
+	return err == nil && ip != nil && ip.IsLoopback()
+}
+
+// ReloadHandler runs reload on POST from loopback callers, answering 422 with its error
+// (the previous state stays active) or 204.
+func ReloadHandler(reload func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !fromLoopback(r) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err := reload(); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
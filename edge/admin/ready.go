@@ -0,0 +1,79 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReadyCheck reports whether one dependency is usable; it should honor ctx.
+type ReadyCheck func(ctx context.Context) error
+
+// Readiness serves /ready: 200 when every check passes, else 503, with a JSON body
+// {"ready": bool, "draining": bool, "components": {name: "ok" | error}}.
+// Unlike /health (liveness), /ready tells load balancers whether to send traffic; once
+// draining it answers 503 at once so they stop routing while in-flight requests finish.
+type Readiness struct {
+	checks   map[string]ReadyCheck
+	timeout  time.Duration // bound on each probe round
+	draining atomic.Bool
+}
+
+func NewReadiness(checks map[string]ReadyCheck, timeout time.Duration) *Readiness {
+	return &Readiness{checks: checks, timeout: timeout}
+}
+
+// SetDraining marks the edge as shutting down; /ready reports 503 from then on.
+func (rd *Readiness) SetDraining() { rd.draining.Store(true) }
+
+// Draining reports whether SetDraining was called.
+func (rd *Readiness) Draining() bool { return rd.draining.Load() }
+
+func (rd *Readiness) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	draining := rd.Draining()
+	components := make(map[string]string, len(rd.checks))
+	ready := !draining
+	if !draining {
+		ready = rd.probe(r.Context(), components)
+	}
+	code := http.StatusOK
+	if !ready {
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"ready": ready, "draining": draining, "components": components})
+}
+
+// probe runs every check concurrently and records each result in components.
+func (rd *Readiness) probe(ctx context.Context, components map[string]string) bool {
+	ctx, cancel := context.WithTimeout(ctx, rd.timeout)
+	defer cancel()
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		ready = true
+	)
+	for name, check := range rd.checks {
+		wg.Add(1)
+		go func(name string, check ReadyCheck) {
+			defer wg.Done()
+			status := "ok"
+			if err := check(ctx); err != nil {
+				status = err.Error()
+			}
+			mu.Lock()
+			components[name] = status
+			if status != "ok" {
+				ready = false
+			}
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+	return ready
+}
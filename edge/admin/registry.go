@@ -0,0 +1,181 @@
+package admin
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Counter is a monotonically increasing metric series.
+type Counter struct{ v atomic.Uint64 }
+
+func (c *Counter) Inc()          { c.v.Add(1) }
+func (c *Counter) Add(n uint64)  { c.v.Add(n) }
+func (c *Counter) Value() uint64 { return c.v.Load() }
+
+// Gauge is a metric series that can go up and down.
+type Gauge struct{ v atomic.Int64 }
+
+func (g *Gauge) Set(n int64)  { g.v.Store(n) }
+func (g *Gauge) Add(n int64)  { g.v.Add(n) }
+func (g *Gauge) Value() int64 { return g.v.Load() }
+
+// family is one metric name with its HELP/TYPE and labeled series.
+type family struct {
+	help, kind string
+	series     map[string]interface{} // rendered labels -> *Counter, *Gauge or *Histogram
+}
+
+// Registry holds counters, gauges and histograms and renders them in Prometheus text format.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: map[string]*family{}}
+}
+
+// Default is the registry rendered by MetricsHandler.
+var Default = NewRegistry()
+
+// Counter returns the counter for name and label pairs (k1, v1, k2, v2, ...), creating it on first use.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	return r.series(name, help, "counter", labels, func() interface{} { return new(Counter) }).(*Counter)
+}
+
+// Gauge returns the gauge for name and label pairs, creating it on first use.
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	return r.series(name, help, "gauge", labels, func() interface{} { return new(Gauge) }).(*Gauge)
+}
+
+// Histogram returns the histogram for name and label pairs, creating it with bounds on first use.
+func (r *Registry) Histogram(name, help string, bounds []float64, labels ...string) *Histogram {
+	return r.series(name, help, "histogram", labels, func() interface{} { return NewHistogram(bounds) }).(*Histogram)
+}
+
+func (r *Registry) series(name, help, kind string, labels []string, mk func() interface{}) interface{} {
+	if len(labels)%2 != 0 {
+		panic("admin: odd label list for " + name)
+	}
+	key := renderLabels(labels)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{help: help, kind: kind, series: map[string]interface{}{}}
+		r.families[name] = f
+	} else if f.kind != kind {
+		panic("admin: " + name + " registered as " + f.kind)
+	}
+	s, ok := f.series[key]
+	if !ok {
+		s = mk()
+		f.series[key] = s
+	}
+	return s
+}
+
+// CounterSum adds up the counters of family name whose labels include every given pair
+// (none = all series); 0 if the family does not exist.
+func (r *Registry) CounterSum(name string, labels ...string) uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, ok := r.families[name]
+	if !ok || f.kind != "counter" {
+		return 0
+	}
+	var sum uint64
+	for key, s := range f.series {
+		if hasLabels(key, labels) {
+			sum += s.(*Counter).Value()
+		}
+	}
+	return sum
+}
+
+// HistogramCounts merges the bucket counts of every series of histogram family name; series
+// with other bounds are skipped. It returns nil counts if the family does not exist.
+func (r *Registry) HistogramCounts(name string, bounds []float64) []uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, ok := r.families[name]
+	if !ok || f.kind != "histogram" {
+		return nil
+	}
+	merged := make([]uint64, len(bounds)+1)
+	for _, s := range f.series {
+		h := s.(*Histogram)
+		if len(h.bounds) != len(bounds) {
+			continue
+		}
+		for i, c := range h.Counts() {
+			merged[i] += c
+		}
+	}
+	return merged
+}
+
+// hasLabels reports whether rendered labels key contains every pair of labels.
+func hasLabels(key string, labels []string) bool {
+	for i := 0; i+1 < len(labels); i += 2 {
+		pair := renderLabels(labels[i : i+2])
+		if !strings.Contains(key, pair[1:len(pair)-1]) {
+			return false
+		}
+	}
+	return true
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// renderLabels formats label pairs as `{k="v",...}` with escaped values ("" for none).
+func renderLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", labels[i], labelEscaper.Replace(labels[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// WritePrometheus renders every family (sorted by name, series by labels).
+func (r *Registry) WritePrometheus(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := r.families[name]
+		fmt.Fprintf(w, "# HELP %s %s\n", name, f.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", name, f.kind)
+		keys := make([]string, 0, len(f.series))
+		for k := range f.series {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			switch s := f.series[k].(type) {
+			case *Counter:
+				fmt.Fprintf(w, "%s%s %d\n", name, k, s.Value())
+			case *Gauge:
+				fmt.Fprintf(w, "%s%s %d\n", name, k, s.Value())
+			case *Histogram:
+				s.WritePrometheus(w, name, strings.TrimSuffix(strings.TrimPrefix(k, "{"), "}"))
+			}
+		}
+	}
+}
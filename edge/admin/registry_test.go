@@ -0,0 +1,69 @@
+package admin
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistryRendersPrometheusText(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("b_total", "b events", "reason", "x").Add(3)
+	r.Counter("b_total", "b events", "reason", `q"uo\te`).Inc()
+	r.Counter("a_total", "a events").Inc()
+	r.Gauge("c_open", "open things", "state", "idle").Set(5)
+	r.Gauge("c_open", "open things", "state", "idle").Add(-2)
+
+	var b strings.Builder
+	r.WritePrometheus(&b)
+	want := `# HELP a_total a events
+# TYPE a_total counter
+a_total 1
+# HELP b_total b events
+# TYPE b_total counter
+b_total{reason="q\"uo\\te"} 1
+b_total{reason="x"} 3
+# HELP c_open open things
+# TYPE c_open gauge
+c_open{state="idle"} 3
+`
+	if b.String() != want {
+		t.Errorf("exposition:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestRegistryReturnsTheSameSeries(t *testing.T) {
+	r := NewRegistry()
+	c := r.Counter("x_total", "x", "k", "v")
+	if r.Counter("x_total", "x", "k", "v") != c || r.Counter("x_total", "x", "k", "w") == c {
+		t.Error("series identity depends on more than name and labels")
+	}
+	r.Counter("x_total", "x", "k", "w", "class", "2xx").Add(4)
+	c.Add(2)
+	if got := r.CounterSum("x_total"); got != 6 {
+		t.Errorf("CounterSum() = %d", got)
+	}
+	if got := r.CounterSum("x_total", "class", "2xx"); got != 4 {
+		t.Errorf("CounterSum(class=2xx) = %d", got)
+	}
+	if got := r.CounterSum("missing_total"); got != 0 {
+		t.Errorf("CounterSum(missing) = %d", got)
+	}
+}
+
+func TestRegistryRejectsMisuse(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("x_total", "x")
+	for name, f := range map[string]func(){
+		"kind change": func() { r.Gauge("x_total", "x") },
+		"odd labels":  func() { r.Counter("y_total", "y", "k") },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s did not panic", name)
+				}
+			}()
+			f()
+		}()
+	}
+}
@@ -0,0 +1,52 @@
+package admin
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// RuntimeCollector reports goroutines, heap, GC and file descriptor usage. It samples on
+// each scrape only (ReadMemStats briefly stops the world), so register it once via RegisterCollector.
+func RuntimeCollector(w io.Writer) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	gc := debug.GCStats{PauseQuantiles: make([]time.Duration, 5)} // min, 25%, 50%, 75%, max
+	debug.ReadGCStats(&gc)
+
+	fmt.Fprintln(w, "# HELP go_goroutines number of goroutines that currently exist")
+	fmt.Fprintln(w, "# TYPE go_goroutines gauge")
+	fmt.Fprintf(w, "go_goroutines %d\n", runtime.NumGoroutine())
+	fmt.Fprintln(w, "# HELP go_memstats_heap_alloc_bytes heap bytes allocated and still in use")
+	fmt.Fprintln(w, "# TYPE go_memstats_heap_alloc_bytes gauge")
+	fmt.Fprintf(w, "go_memstats_heap_alloc_bytes %d\n", ms.HeapAlloc)
+	fmt.Fprintln(w, "# HELP go_memstats_heap_inuse_bytes heap bytes in in-use spans")
+	fmt.Fprintln(w, "# TYPE go_memstats_heap_inuse_bytes gauge")
+	fmt.Fprintf(w, "go_memstats_heap_inuse_bytes %d\n", ms.HeapInuse)
+	fmt.Fprintln(w, "# HELP go_memstats_heap_objects number of allocated heap objects")
+	fmt.Fprintln(w, "# TYPE go_memstats_heap_objects gauge")
+	fmt.Fprintf(w, "go_memstats_heap_objects %d\n", ms.HeapObjects)
+	fmt.Fprintln(w, "# HELP go_memstats_sys_bytes bytes obtained from the OS")
+	fmt.Fprintln(w, "# TYPE go_memstats_sys_bytes gauge")
+	fmt.Fprintf(w, "go_memstats_sys_bytes %d\n", ms.Sys)
+	fmt.Fprintln(w, "# HELP go_memstats_alloc_bytes_total cumulative heap bytes allocated")
+	fmt.Fprintln(w, "# TYPE go_memstats_alloc_bytes_total counter")
+	fmt.Fprintf(w, "go_memstats_alloc_bytes_total %d\n", ms.TotalAlloc)
+	fmt.Fprintln(w, "# HELP go_gc_duration_seconds GC stop-the-world pause durations")
+	fmt.Fprintln(w, "# TYPE go_gc_duration_seconds summary")
+	for i, q := range []string{"0", "0.25", "0.5", "0.75", "1"} {
+		fmt.Fprintf(w, "go_gc_duration_seconds{quantile=\"%s\"} %g\n", q, gc.PauseQuantiles[i].Seconds())
+	}
+	fmt.Fprintf(w, "go_gc_duration_seconds_sum %g\n", gc.PauseTotal.Seconds())
+	fmt.Fprintf(w, "go_gc_duration_seconds_count %d\n", gc.NumGC)
+
+	// Open file descriptors where /proc is available (Linux)
+	if fds, err := os.ReadDir("/proc/self/fd"); err == nil {
+		fmt.Fprintln(w, "# HELP process_open_fds number of open file descriptors")
+		fmt.Fprintln(w, "# TYPE process_open_fds gauge")
+		fmt.Fprintf(w, "process_open_fds %d\n", len(fds))
+	}
+}
@@ -0,0 +1,72 @@
+package admin
+
+import (
+	"bufio"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// scrapeRuntime parses RuntimeCollector output into series -> value.
+func scrapeRuntime(t *testing.T) map[string]float64 {
+	t.Helper()
+	var b strings.Builder
+	RuntimeCollector(&b)
+	out := map[string]float64{}
+	sc := bufio.NewScanner(strings.NewReader(b.String()))
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		v, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			t.Fatalf("unparseable sample %q", line)
+		}
+		out[line[:i]] = v
+	}
+	return out
+}
+
+var sink [][]byte
+
+func TestRuntimeCollectorReflectsAllocations(t *testing.T) {
+	before := scrapeRuntime(t)
+	for _, name := range []string{
+		"go_goroutines", "go_memstats_heap_alloc_bytes", "go_memstats_heap_inuse_bytes", "go_memstats_heap_objects",
+		"go_memstats_sys_bytes", "go_memstats_alloc_bytes_total", `go_gc_duration_seconds{quantile="0.5"}`,
+		"go_gc_duration_seconds_sum", "go_gc_duration_seconds_count",
+	} {
+		if _, ok := before[name]; !ok {
+			t.Errorf("missing %s", name)
+		}
+	}
+	if runtime.GOOS == "linux" && before["process_open_fds"] < 3 {
+		t.Errorf("process_open_fds = %v", before["process_open_fds"])
+	}
+
+	for i := 0; i < 64; i++ {
+		sink = append(sink, make([]byte, 64<<10))
+	}
+	done := make(chan struct{})
+	go func() { <-done }()
+	during := scrapeRuntime(t)
+	close(done)
+	if got := during["go_memstats_alloc_bytes_total"] - before["go_memstats_alloc_bytes_total"]; got < 4<<20 {
+		t.Errorf("alloc_bytes_total grew by %v after a 4MiB allocation", got)
+	}
+	if during["go_memstats_heap_alloc_bytes"] < 4<<20 {
+		t.Errorf("heap_alloc_bytes = %v while holding 4MiB", during["go_memstats_heap_alloc_bytes"])
+	}
+	if during["go_goroutines"] <= before["go_goroutines"] {
+		t.Errorf("goroutines %v -> %v after starting one", before["go_goroutines"], during["go_goroutines"])
+	}
+
+	sink = nil
+	runtime.GC()
+	if after := scrapeRuntime(t); after["go_gc_duration_seconds_count"] <= during["go_gc_duration_seconds_count"] {
+		t.Errorf("gc count %v -> %v after a forced GC", during["go_gc_duration_seconds_count"], after["go_gc_duration_seconds_count"])
+	}
+}
@@ -0,0 +1,35 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Snapshot is the live traffic summary served at /snapshot, in the shape of the admin API's
+// GET /api/v1/snapshot (which polls it). Actor and cache figures are not known to the edge and
+// are left to the Actor Manager.
+type Snapshot struct {
+	TsMs    int64        `json:"ts_ms"`
+	Traffic TrafficStats `json:"traffic"`
+}
+
+// TrafficStats covers the most recently sampled window.
+type TrafficStats struct {
+	RateRPS    int            `json:"rate_rps"`
+	LatencyMs  map[string]int `json:"latency_ms"`  // p50, p90, p99
+	ErrorRatio float64        `json:"error_ratio"` // 5xx share of responses
+}
+
+// SnapshotHandler serves snap() as JSON on GET.
+func SnapshotHandler(snap func() Snapshot) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(snap())
+	}
+}
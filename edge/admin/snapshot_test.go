@@ -0,0 +1,39 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSnapshotHandlerServesJSON(t *testing.T) {
+	h := SnapshotHandler(func() Snapshot {
+		return Snapshot{TsMs: 42, Traffic: TrafficStats{RateRPS: 7, LatencyMs: map[string]int{"p50": 3}, ErrorRatio: 0.25}}
+	})
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest("GET", "/snapshot", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("status %d, headers %v", rec.Code, rec.Header())
+	}
+	var got struct {
+		TsMs    int64 `json:"ts_ms"`
+		Traffic struct {
+			RateRPS    int            `json:"rate_rps"`
+			LatencyMs  map[string]int `json:"latency_ms"`
+			ErrorRatio float64        `json:"error_ratio"`
+		} `json:"traffic"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.TsMs != 42 || got.Traffic.RateRPS != 7 || got.Traffic.LatencyMs["p50"] != 3 || got.Traffic.ErrorRatio != 0.25 {
+		t.Errorf("body %s", rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	h(rec, httptest.NewRequest("POST", "/snapshot", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET" {
+		t.Errorf("POST: status %d, Allow %q", rec.Code, rec.Header().Get("Allow"))
+	}
+}
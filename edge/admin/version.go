@@ -0,0 +1,97 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// Build identification, normally stamped at link time:
+//
+//	go build -ldflags "-X olwsx/edge/admin.Version=1.4.0 -X olwsx/edge/admin.Commit=$(git rev-parse HEAD) -X olwsx/edge/admin.BuildTime=$(date -u +%FT%TZ)"
+//
+// Whatever is left empty is filled from the binary's embedded build info (module version, VCS stamp).
+var (
+	Version   string
+	Commit    string
+	BuildTime string
+)
+
+// BuildInfo identifies the running edge binary; served at /version.
+type BuildInfo struct {
+	Version   string `json:"version"`    // "devel" when neither ldflags nor a module version say otherwise
+	Commit    string `json:"commit"`     // VCS revision, "+dirty" appended for modified trees; "" = unknown
+	BuildTime string `json:"build_time"` // RFC 3339; "" = unknown
+	GoVersion string `json:"go_version"`
+}
+
+var (
+	buildOnce sync.Once
+	buildInfo BuildInfo
+)
+
+// Build returns the build info, resolved once from the ldflags variables and debug.ReadBuildInfo.
+func Build() BuildInfo {
+	buildOnce.Do(func() {
+		buildInfo = BuildInfo{Version: Version, Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+		if bi, ok := debug.ReadBuildInfo(); ok {
+			if buildInfo.Version == "" && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+				buildInfo.Version = bi.Main.Version
+			}
+			if bi.GoVersion != "" {
+				buildInfo.GoVersion = bi.GoVersion
+			}
+			var dirty bool
+			for _, s := range bi.Settings {
+				switch s.Key {
+				case "vcs.revision":
+					if buildInfo.Commit == "" {
+						buildInfo.Commit = s.Value
+					}
+				case "vcs.time":
+					if buildInfo.BuildTime == "" {
+						buildInfo.BuildTime = s.Value
+					}
+				case "vcs.modified":
+					dirty = s.Value == "true"
+				}
+			}
+			if dirty && Commit == "" && buildInfo.Commit != "" {
+				buildInfo.Commit += "+dirty"
+			}
+		}
+		if buildInfo.Version == "" {
+			buildInfo.Version = "devel"
+		}
+	})
+	return buildInfo
+}
+
+// String is the compact form used in the X-Olwsx-Version header, e.g. "1.4.0 (3f2a9c1d8e0b)".
+func (b BuildInfo) String() string {
+	if b.Commit == "" {
+		return b.Version
+	}
+	c := b.Commit
+	if i := strings.IndexByte(c, '+'); i > 12 {
+		c = c[:12] + c[i:]
+	} else if i < 0 && len(c) > 12 {
+		c = c[:12]
+	}
+	return b.Version + " (" + c + ")"
+}
+
+// VersionHandler serves Build() as JSON on GET.
+func VersionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(Build())
+}
@@ -0,0 +1,56 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+)
+
+func TestVersionHandlerServesBuildInfo(t *testing.T) {
+	rec := httptest.NewRecorder()
+	VersionHandler(rec, httptest.NewRequest("GET", "/version", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("status %d, headers %v", rec.Code, rec.Header())
+	}
+	var got map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("body %s: %v", rec.Body, err)
+	}
+	for _, key := range []string{"version", "commit", "build_time", "go_version"} {
+		if _, ok := got[key]; !ok {
+			t.Errorf("%s missing from %s", key, rec.Body)
+		}
+	}
+	// A test binary has no ldflags stamp or module version
+	if got["version"] != "devel" || got["go_version"] != runtime.Version() {
+		t.Errorf("body %s", rec.Body)
+	}
+	if b := Build(); got["version"] != b.Version || got["commit"] != b.Commit || got["build_time"] != b.BuildTime {
+		t.Errorf("body %s, Build() %+v", rec.Body, b)
+	}
+
+	rec = httptest.NewRecorder()
+	VersionHandler(rec, httptest.NewRequest("POST", "/version", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET" {
+		t.Errorf("POST: status %d, Allow %q", rec.Code, rec.Header().Get("Allow"))
+	}
+}
+
+func TestBuildInfoStringShortensCommit(t *testing.T) {
+	for _, tc := range []struct {
+		b    BuildInfo
+		want string
+	}{
+		{BuildInfo{Version: "1.4.0", Commit: "3f2a9c1d8e0b7a6c5d4e3f2a1b0c9d8e7f6a5b4c"}, "1.4.0 (3f2a9c1d8e0b)"},
+		{BuildInfo{Version: "1.4.0", Commit: "3f2a9c1d8e0b7a6c5d4e3f2a1b0c9d8e7f6a5b4c+dirty"}, "1.4.0 (3f2a9c1d8e0b+dirty)"},
+		{BuildInfo{Version: "1.4.0", Commit: "3f2a9c1"}, "1.4.0 (3f2a9c1)"},
+		{BuildInfo{Version: "devel", Commit: "3f2a9c1+dirty"}, "devel (3f2a9c1+dirty)"},
+		{BuildInfo{Version: "devel"}, "devel"},
+	} {
+		if got := tc.b.String(); got != tc.want {
+			t.Errorf("%+v.String() = %q, want %q", tc.b, got, tc.want)
+		}
+	}
+}
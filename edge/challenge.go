@@ -1,22 +1,242 @@
 package main
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/binary"
+	"encoding/json"
+	"math/bits"
+	"net"
+	"net/http"
+	"sync"
 	"time"
+
+	edgehttp "olwsx/edge/http"
 )
 
-// Proof-of-work lite: deterministic hash requirement based on current time window to avoid replay.
-func Challenge(remote string) bool {
-	if !EnableChallenge {
+// Proof-of-work challenge. With EnableChallenge, the dispatcher answers a client without a
+// clearance with 403 and a puzzle (flagging the request HintChallenged); GET ChallengePath
+// issues one too. A puzzle is a signed nonce and a difficulty in leading zero bits. The client
+// finds a counter such that sha256(nonce || counter as 8 big-endian bytes) has at least that
+// many leading zero bits and POSTs {nonce, solution}; a valid solution earns a signed clearance
+// cookie bound to the client IP, and cleared clients are forwarded until the cookie expires.
+// Puzzles and cookies are stateless: both carry their window/expiry under an HMAC that also
+// covers the client IP, so neither a solved puzzle nor a cookie can be replayed elsewhere.
+
+const (
+	clearanceCookie = "olwsx_clearance"
+	puzzleRandBytes = 16
+	macBytes        = 16 // truncated HMAC-SHA256
+	puzzleBytes     = 8 + puzzleRandBytes + 1 + macBytes
+	clearanceBytes  = 8 + macBytes
+)
+
+// challengeKey is derived on first use, after main has loaded the config.
+var challengeKey = sync.OnceValue(newChallengeKey)
+
+// newChallengeKey uses ChallengeSecret so a fleet of edges honours each other's cookies; empty
+// means a random per-process key (cookies do not survive a restart).
+func newChallengeKey() []byte {
+	if secret := conf().ChallengeSecret; secret != "" {
+		return []byte(secret)
+	}
+	k := make([]byte, 32)
+	if _, err := rand.Read(k); err != nil {
+		panic("challenge key: " + err.Error())
+	}
+	return k
+}
+
+func challengeMAC(domain string, msg []byte) []byte {
+	m := hmac.New(sha256.New, challengeKey())
+	m.Write([]byte(domain))
+	m.Write(msg)
+	return m.Sum(nil)[:macBytes]
+}
+
+var b64 = base64.RawURLEncoding
+
+// Puzzle is the issuance response.
+type Puzzle struct {
+	Nonce      string `json:"nonce"`
+	Difficulty int    `json:"difficulty"` // required leading zero bits
+	ExpiresIn  int    `json:"expires_in"` // seconds the nonce stays solvable
+	Path       string `json:"path"`       // where to POST the solution
+}
+
+// IssuePuzzle returns a fresh puzzle for clientIP at the current difficulty for the window now falls in.
+func IssuePuzzle(now time.Time, clientIP string) Puzzle {
+	difficulty := int(currentDifficulty.Load())
+	window := challengeWindow(now)
+	var raw [puzzleBytes]byte
+	binary.BigEndian.PutUint64(raw[:8], window)
+	_, _ = rand.Read(raw[8 : 8+puzzleRandBytes])
+	raw[8+puzzleRandBytes] = byte(difficulty)
+	copy(raw[puzzleBytes-macBytes:], ipBoundMAC("puzzle", raw[:puzzleBytes-macBytes], clientIP))
+	// Solvable until the last window VerifyChallenge still accepts has passed
+	last := time.Unix(int64((window+1+uint64(conf().ChallengeWindowTolerance))*windowSeconds()), 0)
+	return Puzzle{
+		Nonce:      b64.EncodeToString(raw[:]),
+		Difficulty: difficulty,
+		ExpiresIn:  int(last.Sub(now) / time.Second),
+		Path:       conf().ChallengePath,
+	}
+}
+
+// VerifyChallenge reports whether a puzzle issued in window is still solvable at now: it must be
+// the current window or one of the previous ChallengeWindowTolerance windows (clock skew);
+// anything older is rejected as a replay, anything later was not issued by a synced edge.
+func VerifyChallenge(window uint64, now time.Time) bool {
+	cur := challengeWindow(now)
+	return window <= cur && cur-window <= uint64(conf().ChallengeWindowTolerance)
+}
+
+// VerifySolution reports whether solution solves an authentic nonce issued to clientIP, still
+// inside its window tolerance, at the difficulty it was issued with.
+func VerifySolution(nonce string, solution uint64, clientIP string, now time.Time) bool {
+	raw, err := b64.DecodeString(nonce)
+	if err != nil || len(raw) != puzzleBytes {
+		return false
+	}
+	body := raw[:puzzleBytes-macBytes]
+	if subtle.ConstantTimeCompare(raw[puzzleBytes-macBytes:], ipBoundMAC("puzzle", body, clientIP)) != 1 {
+		return false
+	}
+	if !VerifyChallenge(binary.BigEndian.Uint64(body[:8]), now) {
+		return false
+	}
+	return solves(raw, solution, int(body[8+puzzleRandBytes]))
+}
+
+func windowSeconds() uint64 {
+	return max(uint64(conf().ChallengeWindow/time.Second), 1)
+}
+
+// challengeWindow returns the ChallengeWindow-sized bucket t falls in.
+func challengeWindow(t time.Time) uint64 {
+	return uint64(t.Unix()) / windowSeconds()
+}
+
+// solves checks sha256(nonce || solution) has at least difficulty leading zero bits.
+func solves(nonce []byte, solution uint64, difficulty int) bool {
+	h := sha256.New()
+	h.Write(nonce)
+	var ctr [8]byte
+	binary.BigEndian.PutUint64(ctr[:], solution)
+	h.Write(ctr[:])
+	return leadingZeroBits(h.Sum(nil)) >= difficulty
+}
+
+func leadingZeroBits(sum []byte) int {
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+// ipBoundMAC signs msg together with the client IP, so a puzzle or cookie lifted from one
+// client is worthless from another address.
+func ipBoundMAC(domain string, msg []byte, clientIP string) []byte {
+	msg = append([]byte(nil), msg...)
+	if ip := net.ParseIP(clientIP); ip != nil {
+		msg = append(msg, ip.To16()...)
+	}
+	return challengeMAC(domain, msg)
+}
+
+// clearance mints a cookie value for clientIP valid until now+ChallengeClearanceTTL.
+func clearance(now time.Time, clientIP string) string {
+	var raw [clearanceBytes]byte
+	binary.BigEndian.PutUint64(raw[:8], uint64(now.Add(conf().ChallengeClearanceTTL).Unix()))
+	copy(raw[8:], ipBoundMAC("clearance", raw[:8], clientIP))
+	return b64.EncodeToString(raw[:])
+}
+
+// clearedAt reports whether r carries an authentic clearance for clientIP unexpired at now.
+func clearedAt(r *http.Request, clientIP string, now time.Time) bool {
+	c, err := r.Cookie(clearanceCookie)
+	if err != nil {
 		return false
 	}
-	// Windowed nonce: second bucket
-	sec := uint64(time.Now().Unix())
-	var nonce [16]byte
-	binary.LittleEndian.PutUint64(nonce[:8], sec)
-	binary.LittleEndian.PutUint64(nonce[8:], uint64(len(remote)))
-	h := sha256.Sum256(nonce[:])
-	// Require low difficulty (first byte == 0). Can be adjusted if needed.
-	return h[0] == 0
-}
\ No newline at end of file
+	raw, err := b64.DecodeString(c.Value)
+	if err != nil || len(raw) != clearanceBytes {
+		return false
+	}
+	if subtle.ConstantTimeCompare(raw[8:], ipBoundMAC("clearance", raw[:8], clientIP)) != 1 {
+		return false
+	}
+	return now.Unix() < int64(binary.BigEndian.Uint64(raw[:8]))
+}
+
+// Cleared is the dispatcher's clearance hook: cleared clients skip Challenge until expiry.
+func Cleared(r *http.Request, clientIP string) bool {
+	return clearedAt(r, clientIP, time.Now())
+}
+
+// Challenge is the dispatcher's hook for clients without a clearance: with the challenge enabled
+// it issues a fresh puzzle for clientIP, which the dispatcher sends back instead of forwarding the request.
+func Challenge(r *http.Request, clientIP string) (puzzle []byte, issued bool) {
+	if !conf().EnableChallenge || conf().ChallengePath == "" {
+		return nil, false
+	}
+	puzzle, _ = json.Marshal(IssuePuzzle(time.Now(), clientIP))
+	return puzzle, true
+}
+
+// ChallengeEndpoint serves puzzle issuance (GET) and verification (POST) on ChallengePath ahead
+// of the dispatcher; other requests pass to next. Puzzles and clearances are bound to the client
+// IP as resolved through trustedProxies, matching what the dispatcher issues and checks.
+func ChallengeEndpoint(next http.Handler, trustedProxies []*net.IPNet) http.Handler {
+	path := conf().ChallengePath
+	if !conf().EnableChallenge || path == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		client := edgehttp.ClientIP(r, trustedProxies)
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(IssuePuzzle(time.Now(), client))
+		case http.MethodPost:
+			var in struct {
+				Nonce    string `json:"nonce"`
+				Solution uint64 `json:"solution"`
+			}
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1024)).Decode(&in); err != nil {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			now := time.Now()
+			if !VerifySolution(in.Nonce, in.Solution, client, now) {
+				MetricReject("challenge_failed", 0)
+				http.Error(w, "invalid solution", http.StatusForbidden)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     clearanceCookie,
+				Value:    clearance(now, client),
+				Path:     "/",
+				MaxAge:   int(conf().ChallengeClearanceTTL / time.Second),
+				Secure:   true,
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+
+	admin "olwsx/edge/admin"
+	"olwsx/edge/logging"
+)
+
+// currentDifficulty is the difficulty new puzzles are issued at; adaptive mode moves it between
+// ChallengeDifficulty and ChallengeMaxDifficulty.
+var currentDifficulty atomic.Int32
+
+func init() { setDifficulty(conf().ChallengeDifficulty) }
+
+func setDifficulty(d int) {
+	currentDifficulty.Store(int32(d))
+	admin.Default.Gauge("olwsx_edge_challenge_difficulty", "leading zero bits required by new challenge puzzles").Set(int64(d))
+}
+
+// nextDifficulty is one adaptive step: escalate while either signal is over its mark, relax
+// only once both are under half of it, hold in between.
+func nextDifficulty(cur int, rps, errRatio float64) int {
+	c := conf()
+	switch {
+	case rps > c.ChallengeRPSHigh || errRatio > c.ChallengeErrorRatioHigh:
+		return min(cur+c.ChallengeDifficultyStep, c.ChallengeMaxDifficulty)
+	case rps < c.ChallengeRPSHigh/2 && errRatio < c.ChallengeErrorRatioHigh/2:
+		return max(cur-c.ChallengeDifficultyStep, c.ChallengeDifficulty)
+	}
+	return cur
+}
+
+// loadSampler turns the request and 5xx counters into per-interval RPS and error ratio.
+type loadSampler struct {
+	requests, errors uint64
+	at               time.Time
+}
+
+func (s *loadSampler) sample(now time.Time) (rps, errRatio float64) {
+	req := requestsTotal.Value()
+	errs := admin.Default.Counter("olwsx_edge_responses_total", "responses by status class", "class", "5xx").Value()
+	if secs := now.Sub(s.at).Seconds(); !s.at.IsZero() && secs > 0 {
+		rps = float64(req-s.requests) / secs
+		if n := req - s.requests; n > 0 {
+			errRatio = float64(errs-s.errors) / float64(n)
+		}
+	}
+	s.requests, s.errors, s.at = req, errs, now
+	return rps, errRatio
+}
+
+// adaptChallenge re-tunes the puzzle difficulty every ChallengeAdaptInterval for the life of
+// the process.
+func adaptChallenge() {
+	var s loadSampler
+	s.sample(time.Now())
+	t := time.NewTicker(conf().ChallengeAdaptInterval)
+	defer t.Stop()
+	for now := range t.C {
+		rps, errRatio := s.sample(now)
+		cur := int(currentDifficulty.Load())
+		if next := nextDifficulty(cur, rps, errRatio); next != cur {
+			setDifficulty(next)
+			logging.Info("challenge difficulty %d -> %d bits (rps=%.0f error_ratio=%.3f)", cur, next, rps, errRatio)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"olwsx/edge/admin"
+)
+
+// simulate records n requests, failures of them with a 5xx, through the real metric hooks.
+func simulate(n, failures int) {
+	for i := 0; i < n; i++ {
+		status := 200
+		if i < failures {
+			status = 503
+		}
+		AccessLog("GET", "/", "h1", status, 0, 0, "", 0, "192.0.2.1", "", 1, 2, "", "")
+	}
+}
+
+func TestDifficultyEscalatesUnderLoadAndRelaxes(t *testing.T) {
+	withConfig(t, func(c *Config) {
+		c.AccessLogEnabled = false
+		c.ChallengeDifficulty, c.ChallengeMaxDifficulty, c.ChallengeDifficultyStep = 8, 14, 4
+		c.ChallengeRPSHigh, c.ChallengeErrorRatioHigh = 100, 0.2
+	})
+	withDifficulty(t, 8)
+	var s loadSampler
+	now := time.Now()
+	s.sample(now)
+
+	// step simulates one second of traffic and applies one adaptive step
+	step := func(n, failures int) int {
+		simulate(n, failures)
+		now = now.Add(time.Second)
+		rps, errRatio := s.sample(now)
+		setDifficulty(nextDifficulty(int(currentDifficulty.Load()), rps, errRatio))
+		return int(currentDifficulty.Load())
+	}
+	for i, tc := range []struct {
+		n, failures, want int
+		why               string
+	}{
+		{150, 0, 12, "rps over the mark escalates"},
+		{150, 0, 14, "capped at the maximum"},
+		{150, 0, 14, "stays at the maximum"},
+		{70, 0, 14, "between half and the mark holds"},
+		{40, 0, 10, "under half relaxes"},
+		{40, 20, 14, "error ratio over the mark escalates even at low rps"},
+		{40, 0, 10, "relaxes again"},
+		{10, 0, 8, "never below the configured base"},
+		{10, 0, 8, "stays at the base"},
+	} {
+		if got := step(tc.n, tc.failures); got != tc.want {
+			t.Fatalf("step %d (%s): difficulty %d, want %d", i, tc.why, got, tc.want)
+		}
+	}
+	if g := admin.Default.Gauge("olwsx_edge_challenge_difficulty", "leading zero bits required by new challenge puzzles").Value(); g != 8 {
+		t.Errorf("difficulty gauge = %d", g)
+	}
+	if p := IssuePuzzle(now, "192.0.2.1"); p.Difficulty != 8 {
+		t.Errorf("puzzle difficulty = %d", p.Difficulty)
+	}
+}
+
+func TestLoadSamplerRates(t *testing.T) {
+	withConfig(t, func(c *Config) { c.AccessLogEnabled = false })
+	var s loadSampler
+	now := time.Now()
+	if rps, ratio := s.sample(now); rps != 0 || ratio != 0 {
+		t.Errorf("first sample = %v, %v; want zeros", rps, ratio)
+	}
+	simulate(40, 10)
+	if rps, ratio := s.sample(now.Add(2 * time.Second)); rps != 20 || ratio != 0.25 {
+		t.Errorf("sample = %v rps, %v errors; want 20, 0.25", rps, ratio)
+	}
+	if rps, ratio := s.sample(now.Add(3 * time.Second)); rps != 0 || ratio != 0 {
+		t.Errorf("idle sample = %v, %v", rps, ratio)
+	}
+}
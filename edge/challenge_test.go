@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	edgehttp "olwsx/edge/http"
+	"olwsx/edge/wire"
+)
+
+// withDifficulty issues puzzles at d bits for the test.
+func withDifficulty(t *testing.T, d int) {
+	t.Helper()
+	prev := int(currentDifficulty.Load())
+	setDifficulty(d)
+	t.Cleanup(func() { setDifficulty(prev) })
+}
+
+// solve brute-forces a solution for p.
+func solve(t *testing.T, p Puzzle) uint64 {
+	t.Helper()
+	raw, err := base64.RawURLEncoding.DecodeString(p.Nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n := uint64(0); ; n++ {
+		if solves(raw, n, p.Difficulty) {
+			return n
+		}
+	}
+}
+
+// challengeEdge is the dispatcher with the real challenge hooks behind ChallengeEndpoint; the
+// actor records the hints of every forwarded request.
+func challengeEdge(hints *[]uint32) http.Handler {
+	h := edgehttp.Handler(edgehttp.Limits{HeaderBytes: 64 << 10, BodyBytes: 1 << 20},
+		edgehttp.Options{Cleared: Cleared}, nil, nil, Challenge,
+		func(method, path, headers string, body []byte, traceID, spanID uint64, h uint32) (edgehttp.CoreResp, int) {
+			*hints = append(*hints, h)
+			return edgehttp.CoreResp{Status: 200, Body: []byte("ok")}, 0
+		},
+		func() (uint64, uint64) { return 1, 2 }, nil, func(string, uint64) {}, func(string, uint64) {})
+	return ChallengeEndpoint(h, nil)
+}
+
+func TestChallengeIssuedOnlyToUnclearedClients(t *testing.T) {
+	withConfig(t, func(c *Config) { c.EnableChallenge = true })
+	withDifficulty(t, 8)
+	var hints []uint32
+	edge := challengeEdge(&hints)
+
+	rec := httptest.NewRecorder()
+	edge.ServeHTTP(rec, httptest.NewRequest("GET", "/page", nil))
+	var p Puzzle
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); rec.Code != http.StatusForbidden || err != nil {
+		t.Fatalf("uncleared client: status %d, body %q", rec.Code, rec.Body)
+	}
+	if len(hints) != 0 {
+		t.Fatalf("challenged request reached the actor")
+	}
+	if p.Difficulty != 8 || p.Path != conf().ChallengePath {
+		t.Errorf("puzzle = %+v", p)
+	}
+
+	rec = httptest.NewRecorder()
+	edge.ServeHTTP(rec, httptest.NewRequest("POST", conf().ChallengePath,
+		strings.NewReader(fmt.Sprintf(`{"nonce":%q,"solution":%d}`, p.Nonce, solve(t, p)))))
+	cookies := rec.Result().Cookies()
+	if rec.Code != http.StatusNoContent || len(cookies) != 1 {
+		t.Fatalf("solution: status %d, cookies %v", rec.Code, cookies)
+	}
+
+	r := httptest.NewRequest("GET", "/page", nil)
+	r.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	edge.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK || len(hints) != 1 || hints[0]&wire.HintChallenged != 0 {
+		t.Errorf("cleared client: status %d, actor hints %v", rec.Code, hints)
+	}
+
+	// The clearance is bound to the address it was earned from
+	r = httptest.NewRequest("GET", "/page", nil)
+	r.RemoteAddr = "198.51.100.1:1234"
+	r.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	edge.ServeHTTP(rec, r)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("clearance reused from another address: status %d", rec.Code)
+	}
+}
+
+func TestChallengeDisabledForwardsWithoutHint(t *testing.T) {
+	var hints []uint32
+	rec := httptest.NewRecorder()
+	challengeEdge(&hints).ServeHTTP(rec, httptest.NewRequest("GET", "/page", nil))
+	if rec.Code != http.StatusOK || len(hints) != 1 || hints[0] != 0 {
+		t.Errorf("status %d, actor hints %v", rec.Code, hints)
+	}
+}
+
+func TestVerifySolutionAcceptsPreviousWindowsWithinTolerance(t *testing.T) {
+	withConfig(t, func(c *Config) { c.ChallengeWindow = 10 * time.Second; c.ChallengeWindowTolerance = 1 })
+	withDifficulty(t, 4)
+	issued := time.Unix(1_700_000_000, 0) // a window boundary
+	p := IssuePuzzle(issued, "192.0.2.1")
+	if p.ExpiresIn != 20 {
+		t.Errorf("ExpiresIn = %d, want 20", p.ExpiresIn)
+	}
+	n := solve(t, p)
+	for _, tc := range []struct {
+		after time.Duration
+		want  bool
+	}{
+		{-time.Second, false},     // earlier window: not issued yet
+		{0, true},                 // current window
+		{15 * time.Second, true},  // previous window, within tolerance
+		{20 * time.Second, false}, // two windows back: replay
+		{time.Hour, false},
+	} {
+		if got := VerifySolution(p.Nonce, n, "192.0.2.1", issued.Add(tc.after)); got != tc.want {
+			t.Errorf("%v after issue: VerifySolution = %v, want %v", tc.after, got, tc.want)
+		}
+	}
+
+	withConfig(t, func(c *Config) { c.ChallengeWindow = 10 * time.Second; c.ChallengeWindowTolerance = 0 })
+	if VerifySolution(p.Nonce, n, "192.0.2.1", issued.Add(15*time.Second)) {
+		t.Error("previous window accepted with zero tolerance")
+	}
+}
+
+func TestVerifySolutionRejectsWrongAndTamperedSolutions(t *testing.T) {
+	withDifficulty(t, 12)
+	now := time.Now()
+	p := IssuePuzzle(now, "192.0.2.1")
+	n := solve(t, p)
+	if !VerifySolution(p.Nonce, n, "192.0.2.1", now) {
+		t.Fatal("valid solution rejected")
+	}
+	raw, _ := base64.RawURLEncoding.DecodeString(p.Nonce)
+	wrong := n + 1
+	for solves(raw, wrong, p.Difficulty) {
+		wrong++
+	}
+	if VerifySolution(p.Nonce, wrong, "192.0.2.1", now) {
+		t.Error("wrong solution accepted")
+	}
+	raw[8+puzzleRandBytes] = 0 // claim difficulty 0
+	if VerifySolution(base64.RawURLEncoding.EncodeToString(raw), wrong, "192.0.2.1", now) {
+		t.Error("tampered difficulty accepted")
+	}
+}
+
+func TestSolvedPuzzleCannotBeReplayedFromAnotherIP(t *testing.T) {
+	withConfig(t, func(c *Config) { c.EnableChallenge = true })
+	withDifficulty(t, 8)
+	var hints []uint32
+	edge := challengeEdge(&hints)
+	get := httptest.NewRequest("GET", conf().ChallengePath, nil)
+	get.RemoteAddr = "192.0.2.1:1234"
+	rec := httptest.NewRecorder()
+	edge.ServeHTTP(rec, get)
+	var p Puzzle
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	body := fmt.Sprintf(`{"nonce":%q,"solution":%d}`, p.Nonce, solve(t, p))
+
+	for _, tc := range []struct {
+		remote string
+		want   int
+	}{
+		{"192.0.2.1:1234", http.StatusNoContent},
+		{"198.51.100.7:4321", http.StatusForbidden}, // the same solution shared with another client
+		{"203.0.113.9:5678", http.StatusForbidden},
+	} {
+		post := httptest.NewRequest("POST", conf().ChallengePath, strings.NewReader(body))
+		post.RemoteAddr = tc.remote
+		rec := httptest.NewRecorder()
+		edge.ServeHTTP(rec, post)
+		if rec.Code != tc.want || (tc.want != http.StatusNoContent && len(rec.Result().Cookies()) != 0) {
+			t.Errorf("solution from %s: status %d, cookies %v; want %d", tc.remote, rec.Code, rec.Result().Cookies(), tc.want)
+		}
+	}
+}
+
+func TestExpiredOrTamperedClearanceIsRechallenged(t *testing.T) {
+	withConfig(t, func(c *Config) { c.EnableChallenge = true; c.ChallengeClearanceTTL = time.Minute })
+	const client = "192.0.2.1" // httptest.NewRequest's RemoteAddr
+	now := time.Now()
+	valid := clearance(now, client)
+	withCookie := func(v string) *http.Request {
+		r := httptest.NewRequest("GET", "/page", nil)
+		r.AddCookie(&http.Cookie{Name: clearanceCookie, Value: v})
+		return r
+	}
+	if !clearedAt(withCookie(valid), client, now.Add(59*time.Second)) {
+		t.Fatal("fresh clearance rejected")
+	}
+	if clearedAt(withCookie(valid), client, now.Add(61*time.Second)) {
+		t.Error("clearance accepted after ChallengeClearanceTTL")
+	}
+
+	raw, _ := base64.RawURLEncoding.DecodeString(valid)
+	flip := func(i int) string {
+		b := append([]byte(nil), raw...)
+		b[i] ^= 1
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	for name, v := range map[string]string{
+		"extended expiry": flip(7),
+		"forged MAC":      flip(len(raw) - 1),
+		"truncated":       valid[:len(valid)-4],
+		"not base64":      "!!" + valid[2:],
+		"empty":           "",
+	} {
+		if clearedAt(withCookie(v), client, now) {
+			t.Errorf("%s cookie accepted", name)
+		}
+	}
+
+	// Through the dispatcher, a stale cookie earns a fresh puzzle instead of the actor
+	withDifficulty(t, 4)
+	var hints []uint32
+	stale := clearance(now.Add(-2*time.Minute), client)
+	rec := httptest.NewRecorder()
+	challengeEdge(&hints).ServeHTTP(rec, withCookie(stale))
+	if rec.Code != http.StatusForbidden || len(hints) != 0 {
+		t.Errorf("expired clearance: status %d, actor calls %d", rec.Code, len(hints))
+	}
+	rec = httptest.NewRecorder()
+	challengeEdge(&hints).ServeHTTP(rec, withCookie(flip(len(raw)-1)))
+	if rec.Code != http.StatusForbidden || len(hints) != 0 {
+		t.Errorf("tampered clearance: status %d, actor calls %d", rec.Code, len(hints))
+	}
+}
@@ -2,42 +2,192 @@ package main
 
 import "time"
 
-// Immutable defaults (can be staged via external config if needed).
-const (
-	// Limits
-	MaxHeaderBytes = 2 * 1024 * 1024  // 2MB
-	MaxBodyBytes   = 64 * 1024 * 1024 // 64MB
-
-	// Timeouts
-	ReadTimeout     = 10 * time.Second
-	WriteTimeout    = 30 * time.Second
-	IdleTimeout     = 60 * time.Second
-	ReadHeaderTO    = 5 * time.Second
-	ShutdownTimeout = 20 * time.Second
-
-	// TLS
-	TLSMinVersion13 = true
-
-	// Transports
-	EnableHTTP3     = true
-	TLSListenAddr   = ":8443"
-	WSListenAddr    = ":8080"
-	AdminListenAddr = ":9090"
-
-	// Actor IPC (Unix domain socket path)
-	ActorManagerSocket = "/run/olwsx/actor_manager.sock"
-
-	// Rate limiting
-	BucketCapacity   = 60 // tokens
-	RefillPerSecond  = 30 // tokens per second
-	RetryAfterSecond = 1  // seconds
-
-	// Observability
-	AccessLogEnabled = true
-	MetricsEnabled   = true
-	TracingEnabled   = true
-
-	// WAF/Challenge toggles
-	EnableWAF       = true
-	EnableChallenge = true
-)
\ No newline at end of file
+// DefaultConfig returns the compiled-in defaults. Config (config_load.go) declares each setting
+// once; its json tags name the file keys and OLWSX_* variables LoadConfig overlays on these.
+func DefaultConfig() *Config {
+	c := &Config{
+		// Limits
+		MaxHeaderBytes:      2 * 1024 * 1024,  // 2MB
+		MaxHeaderValueBytes: 16 * 1024,        // 16KB
+		MaxBodyBytes:        64 * 1024 * 1024, // 64MB
+
+		// Timeouts
+		ReadTimeout:     10 * time.Second,
+		WriteTimeout:    30 * time.Second,
+		IdleTimeout:     60 * time.Second,
+		ReadHeaderTO:    5 * time.Second,
+		ShutdownTimeout: 20 * time.Second,
+		DrainTimeout:    5 * time.Second,
+
+		// TLS
+		TLSMinVersion13: true,
+
+		// Transports
+		EnableHTTP3:     true,
+		AltSvcMaxAge:    24 * time.Hour,
+		AltSvcH3Addr:    "",
+		TLSListenAddr:   ":8443",
+		WSListenAddr:    ":8080",
+		AdminListenAddr: ":9090",
+		EnableH2C:       false,
+		H2CListenAddr:   ":8081",
+		ListenMaxConns:  10000,
+		TCPKeepAlive:    30 * time.Second,
+		MaxConnsPerIP:   256,
+
+		// HTTP/3 transport tuning; 0 = quic-go default
+		QUICMaxIncomingStreams:  100,
+		QUICMaxIdleTimeout:      30 * time.Second,
+		QUICInitialStreamWindow: 512 << 10,
+		QUICMaxStreamWindow:     6 << 20,
+		QUICInitialConnWindow:   768 << 10,
+		QUICMaxConnWindow:       15 << 20,
+		QUICEnableDatagrams:     false,
+
+		// WebSocket
+		WSCheckOrigin:     true,
+		WSPingInterval:    30 * time.Second,
+		WSPongWait:        75 * time.Second,
+		WSMaxMessageBytes: 1 * 1024 * 1024, // 1MB
+		WSWriteTimeout:    10 * time.Second,
+		WSCompression:     true,
+		WSCompressionLvl:  1,
+		WSJSONErrors:      true,
+		WSMaxConns:        10000,
+		WSHubQueue:        64,
+		WSAuthRequired:    false,
+		WSAuthSecret:      "",
+		WSAuthClearance:   true,
+
+		// Server-Sent Events (/sse on the WebSocket listener)
+		SSEPollInterval: 500 * time.Millisecond,
+		SSEKeepalive:    15 * time.Second,
+
+		// Actor IPC
+		ActorManagerSocket: "/run/olwsx/actor_manager.sock",
+		ActorFailCooldown:  5 * time.Second,
+		ActorDialTimeout:   2 * time.Second,
+		ActorMaxInFlight:   1024,
+		ActorMaxPerClient:  32,
+		ActorPoolSize:      1024,
+		ActorPoolMaxIdle:   64,
+		ActorMaxResponse:   64 << 20,
+
+		// Actor IPC over TCP
+		ActorTLS:           false,
+		ActorTLSServerName: "",
+		ActorTLSCAFile:     "",
+
+		// Rate limiting
+		BucketCapacity:   60,
+		RefillPerSecond:  30,
+		RetryAfterSecond: 1,
+
+		// Response compression
+		CompressResponses: true,
+		CompressMinBytes:  1024,
+		CompressLevel:     5,
+		DecompressBodies:  true,
+		EnableETags:       true,
+
+		// Actor Set-Cookie hardening
+		CookieSecure:   false,
+		CookieHttpOnly: false,
+		CookieSameSite: "",
+
+		// Debug request body logging
+		BodyLogEnabled:  false,
+		BodyLogMaxBytes: 2048,
+
+		// Edge error bodies
+		NegotiateErrors: false,
+
+		// Stale responses
+		StaleCacheEntries: 1024,
+		StaleCacheTTL:     5 * time.Minute,
+
+		// CORS (origins/methods/headers below)
+		CORSEnabled:          false,
+		CORSAllowCredentials: false,
+		CORSMaxAgeSeconds:    600,
+
+		// Health probe fast path
+		HealthCheckPath: "/healthz",
+
+		// Admin /ready
+		ReadyCheckTimeout: 2 * time.Second,
+		ReadyDrainDelay:   5 * time.Second,
+
+		// Observability
+		LogLevel:         "info",
+		AccessLogEnabled: true,
+		AccessLogFormat:  "text",
+		AccessLogSample:  1,
+		MetricsEnabled:   true,
+		RequestIDHeader:  "X-Request-ID",
+		VersionHeader:    false,
+
+		// Access log file sink
+		AccessLogFile:     "",
+		AccessLogMaxBytes: 100 << 20,
+		AccessLogMaxAge:   24 * time.Hour,
+		AccessLogMaxFiles: 7,
+		AccessLogCompress: true,
+
+		// WAF/Challenge toggles
+		EnableWAF:       true,
+		EnableChallenge: false,
+
+		// WAF ruleset and budgets
+		WAFRulesFile:           "",
+		WAFMaxInspectBytes:     8192,
+		WAFTimeBudget:          2 * time.Millisecond,
+		WAFInspectBody:         true,
+		WAFMaxBodyInspectBytes: 64 << 10,
+
+		// Geo rules
+		GeoIPDatabase: "",
+
+		// Proof-of-work challenge
+		ChallengePath:            "/.well-known/olwsx/challenge",
+		ChallengeDifficulty:      16,
+		ChallengeClearanceTTL:    30 * time.Minute,
+		ChallengeSecret:          "",
+		ChallengeWindow:          1 * time.Minute,
+		ChallengeWindowTolerance: 1,
+		ChallengeAdaptive:        false,
+		ChallengeAdaptInterval:   10 * time.Second,
+		ChallengeMaxDifficulty:   24,
+		ChallengeDifficultyStep:  2,
+		ChallengeRPSHigh:         5000.0,
+		ChallengeErrorRatioHigh:  0.05,
+
+		// Lists and maps
+		PathBodyLimits:      map[string]int{},
+		AllowedMethods:      []string{"GET", "HEAD", "POST", "PUT", "DELETE", "PATCH", "OPTIONS"},
+		PathAllowedMethods:  map[string][]string{},
+		CookiePolicyExempt:  []string{},
+		BodyLogSources:      []string{},
+		BodyLogRedactFields: []string{"password", "token", "secret", "authorization", "api_key", "card_number"},
+		CORSAllowedOrigins:  []string{},
+		CORSAllowedMethods:  []string{"GET", "HEAD", "POST", "PUT", "DELETE", "PATCH"},
+		CORSAllowedHeaders:  []string{},
+		CORSExposedHeaders:  []string{"X-Trace-ID", "X-Request-ID"},
+		LatencyBuckets:      []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		HealthCheckSources:  []string{},
+		SecurityAllowlist:   []string{},
+		TrustedProxies:      []string{},
+		GeoAllowCountries:   []string{},
+		GeoDenyCountries:    []string{},
+		WSAllowedOrigins:    []string{},
+	}
+	// Actor Manager endpoints tried in order; by default just the socket
+	c.ActorManagerEndpoints = []ActorEndpoint{{Network: "unix", Address: c.ActorManagerSocket}}
+	return c
+}
+
+// ActorEndpoint is one Actor Manager address; Network is "unix" or "tcp".
+type ActorEndpoint struct {
+	Network string `json:"network"`
+	Address string `json:"address"`
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Config is the edge's runtime configuration and the only place a setting is declared: its json
+// tag is the file key and, upper-cased behind EnvPrefix, the environment variable. Defaults are
+// in DefaultConfig (config.go); LoadConfig overlays a JSON file and then OLWSX_* variables.
+type Config struct {
+	// Limits
+	MaxHeaderBytes      int `json:"max_header_bytes"`
+	MaxHeaderValueBytes int `json:"max_header_value_bytes"` // per single header value
+	MaxBodyBytes        int `json:"max_body_bytes"`
+
+	// Timeouts
+	ReadTimeout     time.Duration `json:"read_timeout"`
+	WriteTimeout    time.Duration `json:"write_timeout"`
+	IdleTimeout     time.Duration `json:"idle_timeout"`
+	ReadHeaderTO    time.Duration `json:"read_header_to"`
+	ShutdownTimeout time.Duration `json:"shutdown_timeout"` // in-flight request completion deadline
+	DrainTimeout    time.Duration `json:"drain_timeout"`    // window for idle keep-alive connections to close before forced close
+
+	// TLS
+	TLSMinVersion13 bool `json:"tls_min_version_13"`
+
+	// Transports
+	EnableHTTP3     bool          `json:"enable_http3"`
+	AltSvcMaxAge    time.Duration `json:"alt_svc_max_age"` // Alt-Svc lifetime of the h3 advertisement on h1/h2 responses
+	AltSvcH3Addr    string        `json:"alt_svc_h3_addr"` // address advertised for h3; "" = TLSListenAddr
+	TLSListenAddr   string        `json:"tls_listen_addr"`
+	WSListenAddr    string        `json:"ws_listen_addr"`
+	AdminListenAddr string        `json:"admin_listen_addr"`
+	EnableH2C       bool          `json:"enable_h2c"` // plaintext HTTP/1.1 + h2c listener for TLS-terminating sidecars
+	H2CListenAddr   string        `json:"h2c_listen_addr"`
+	ListenMaxConns  int           `json:"listen_max_conns"` // concurrent TCP connections per h1/h2/h2c listener; 0 = unlimited
+	TCPKeepAlive    time.Duration `json:"tcp_keep_alive"`   // keep-alive probe interval on accepted connections; 0 = off
+	MaxConnsPerIP   int           `json:"max_conns_per_ip"` // concurrent connections per peer IP across h1/h2/h2c listeners; 0 = unlimited
+
+	// HTTP/3 transport tuning; 0 = quic-go default
+	QUICMaxIncomingStreams  int64         `json:"quic_max_incoming_streams"`
+	QUICMaxIdleTimeout      time.Duration `json:"quic_max_idle_timeout"`
+	QUICInitialStreamWindow uint64        `json:"quic_initial_stream_window"`
+	QUICMaxStreamWindow     uint64        `json:"quic_max_stream_window"`
+	QUICInitialConnWindow   uint64        `json:"quic_initial_conn_window"`
+	QUICMaxConnWindow       uint64        `json:"quic_max_conn_window"`
+	QUICEnableDatagrams     bool          `json:"quic_enable_datagrams"`
+
+	// WebSocket
+	WSCheckOrigin     bool          `json:"ws_check_origin"` // same-origin unless WSAllowedOrigins is set
+	WSPingInterval    time.Duration `json:"ws_ping_interval"`
+	WSPongWait        time.Duration `json:"ws_pong_wait"`         // reap connections silent for this long
+	WSMaxMessageBytes int64         `json:"ws_max_message_bytes"` // per inbound message
+	WSWriteTimeout    time.Duration `json:"ws_write_timeout"`     // per outbound message; 0 = no deadline
+	WSCompression     bool          `json:"ws_compression"`       // negotiate permessage-deflate when the client offers it
+	WSCompressionLvl  int           `json:"ws_compression_lvl"`   // flate level for outbound frames (1 = fastest)
+	WSJSONErrors      bool          `json:"ws_json_errors"`       // rejected upgrades get a JSON error envelope
+	WSMaxConns        int           `json:"ws_max_conns"`         // concurrent WebSocket connections and SSE streams; 0 = unlimited
+	WSHubQueue        int           `json:"ws_hub_queue"`         // queued broadcasts per subscriber; 0 = pub/sub off
+	WSAuthRequired    bool          `json:"ws_auth_required"`     // upgrades and SSE streams need a token or challenge clearance
+	WSAuthSecret      string        `json:"ws_auth_secret"`       // HMAC key for WebSocket tokens
+	WSAuthClearance   bool          `json:"ws_auth_clearance"`    // accept the challenge clearance cookie
+
+	// Server-Sent Events (/sse on the WebSocket listener)
+	SSEPollInterval time.Duration `json:"sse_poll_interval"`
+	SSEKeepalive    time.Duration `json:"sse_keepalive"`
+
+	// Actor IPC (Unix domain socket path is the default transport)
+	ActorManagerSocket string        `json:"actor_manager_socket"`
+	ActorFailCooldown  time.Duration `json:"actor_fail_cooldown"` // skip a failed endpoint for this long
+	ActorDialTimeout   time.Duration `json:"actor_dial_timeout"`
+	ActorMaxInFlight   int           `json:"actor_max_in_flight"`  // concurrent actor calls before shedding with 503
+	ActorMaxPerClient  int           `json:"actor_max_per_client"` // concurrent actor calls per client IP before 429
+	ActorPoolSize      int           `json:"actor_pool_size"`      // open actor connections (borrowers wait up to ActorDialTimeout)
+	ActorPoolMaxIdle   int           `json:"actor_pool_max_idle"`
+	ActorMaxResponse   int           `json:"actor_max_response"` // largest actor response payload accepted (bytes)
+
+	// Actor IPC over TCP: optional TLS (CA file empty = system roots)
+	ActorTLS           bool   `json:"actor_tls"`
+	ActorTLSServerName string `json:"actor_tls_server_name"`
+	ActorTLSCAFile     string `json:"actor_tls_ca_file"`
+
+	// Rate limiting
+	BucketCapacity   int `json:"bucket_capacity"`    // tokens
+	RefillPerSecond  int `json:"refill_per_second"`  // tokens per second
+	RetryAfterSecond int `json:"retry_after_second"` // seconds
+
+	// Response compression (br/gzip by Accept-Encoding) for text-like bodies
+	CompressResponses bool `json:"compress_responses"`
+	CompressMinBytes  int  `json:"compress_min_bytes"`
+	CompressLevel     int  `json:"compress_level"`
+	DecompressBodies  bool `json:"decompress_bodies"` // inflate gzip/deflate request bodies before forwarding
+	EnableETags       bool `json:"enable_etags"`      // ETag/304 handling and If-Match preflight on writes
+
+	// Actor Set-Cookie hardening: missing attributes are added, present ones kept ("" SameSite = leave alone)
+	CookieSecure   bool   `json:"cookie_secure"`
+	CookieHttpOnly bool   `json:"cookie_http_only"`
+	CookieSameSite string `json:"cookie_same_site"`
+
+	// Debug request body logging (redacted prefix, BodyLogSources only); keep off in production
+	BodyLogEnabled  bool `json:"body_log_enabled"`
+	BodyLogMaxBytes int  `json:"body_log_max_bytes"`
+
+	// Edge error bodies: false = plain text, true = JSON/HTML by Accept (with trace id)
+	NegotiateErrors bool `json:"negotiate_errors"`
+
+	// Stale responses for actor-marked GETs served (Warning: 110) while the actor is unavailable; 0 entries disables
+	StaleCacheEntries int           `json:"stale_cache_entries"`
+	StaleCacheTTL     time.Duration `json:"stale_cache_ttl"`
+
+	// CORS (origins/methods/headers below)
+	CORSEnabled          bool `json:"cors_enabled"`
+	CORSAllowCredentials bool `json:"cors_allow_credentials"`
+	CORSMaxAgeSeconds    int  `json:"cors_max_age_seconds"`
+
+	// Load-balancer health probe answered at the edge (bypasses WAF/rate/challenge/actor); "" disables
+	HealthCheckPath string `json:"health_check_path"`
+
+	// Admin /ready dependency checks (actor reachability) must finish within this
+	ReadyCheckTimeout time.Duration `json:"ready_check_timeout"`
+	// After SIGTERM, /ready answers 503 for this long before listeners start closing (LB deregistration)
+	ReadyDrainDelay time.Duration `json:"ready_drain_delay"`
+
+	// Observability
+	LogLevel         string `json:"log_level"` // debug, info, warn or error; errors are always logged, access lines are not leveled
+	AccessLogEnabled bool   `json:"access_log_enabled"`
+	AccessLogFormat  string `json:"access_log_format"` // "text" (key=value) or "json" (one object per line)
+	AccessLogSample  int    `json:"access_log_sample"` // log 1 in N 2xx responses; other statuses, rate-limited and WAF-flagged requests always logged
+	MetricsEnabled   bool   `json:"metrics_enabled"`
+	RequestIDHeader  string `json:"request_id_header"` // accepted (if well-formed) or generated, forwarded, echoed and logged; "" = off
+	VersionHeader    bool   `json:"version_header"`    // X-Olwsx-Version (build, see admin/version.go) on every response; /version is always served
+
+	// Access log file sink for both formats; "" = stderr. Rotated by size or age, oldest pruned
+	AccessLogFile     string        `json:"access_log_file"`
+	AccessLogMaxBytes int64         `json:"access_log_max_bytes"`
+	AccessLogMaxAge   time.Duration `json:"access_log_max_age"`
+	AccessLogMaxFiles int           `json:"access_log_max_files"`
+	AccessLogCompress bool          `json:"access_log_compress"`
+
+	// WAF/Challenge toggles
+	EnableWAF       bool `json:"enable_waf"`
+	EnableChallenge bool `json:"enable_challenge"` // answer uncleared clients with a puzzle instead of forwarding them
+
+	// JSON WAF ruleset (path_regex, ua_contains, headers) replacing the built-in rules; "" = built-ins
+	WAFRulesFile string `json:"waf_rules_file"`
+	// Inputs (URI, UA, header values) are truncated to WAFMaxInspectBytes before matching; rule
+	// evaluation exceeding WAFTimeBudget blocks the request (reject reason waf_timeout)
+	WAFMaxInspectBytes int           `json:"waf_max_inspect_bytes"`
+	WAFTimeBudget      time.Duration `json:"waf_time_budget"`
+	// Textual request bodies are scanned (first WAFMaxBodyInspectBytes) against the body rules
+	WAFInspectBody         bool `json:"waf_inspect_body"`
+	WAFMaxBodyInspectBytes int  `json:"waf_max_body_inspect_bytes"`
+
+	// MaxMind country database (.mmdb) for GeoAllowCountries/GeoDenyCountries; "" = geo rules off
+	GeoIPDatabase string `json:"geoip_database"`
+
+	// Proof-of-work challenge: puzzles are issued (GET) and solved (POST) at ChallengePath; a
+	// solution needs ChallengeDifficulty leading zero bits and earns a clearance cookie.
+	// ChallengeSecret keys puzzles and cookies; "" = random per process.
+	ChallengePath         string        `json:"challenge_path"`
+	ChallengeDifficulty   int           `json:"challenge_difficulty"`
+	ChallengeClearanceTTL time.Duration `json:"challenge_clearance_ttl"`
+	ChallengeSecret       string        `json:"challenge_secret"`
+	// Puzzles belong to a ChallengeWindow-sized time bucket; solutions for up to
+	// ChallengeWindowTolerance previous windows are accepted (clock skew), older ones are replays
+	ChallengeWindow          time.Duration `json:"challenge_window"`
+	ChallengeWindowTolerance int           `json:"challenge_window_tolerance"`
+	// Adaptive mode re-evaluates every ChallengeAdaptInterval: RPS or 5xx ratio above the high
+	// marks raises difficulty by ChallengeDifficultyStep (up to ChallengeMaxDifficulty); once both
+	// fall below half the marks it steps back down towards ChallengeDifficulty.
+	ChallengeAdaptive       bool          `json:"challenge_adaptive"`
+	ChallengeAdaptInterval  time.Duration `json:"challenge_adapt_interval"`
+	ChallengeMaxDifficulty  int           `json:"challenge_max_difficulty"`
+	ChallengeDifficultyStep int           `json:"challenge_difficulty_step"`
+	ChallengeRPSHigh        float64       `json:"challenge_rps_high"`
+	ChallengeErrorRatioHigh float64       `json:"challenge_error_ratio_high"`
+
+	// Per-path body caps overriding MaxBodyBytes, e.g. {"/upload/": 512 << 20}; longest prefix wins
+	PathBodyLimits map[string]int `json:"path_body_limits"`
+
+	// Methods forwarded to the actor; anything else is answered 405 with an Allow header
+	AllowedMethods []string `json:"allowed_methods"`
+
+	// Per-path method overrides of AllowedMethods, e.g. {"/static/": {"GET", "HEAD"}}; longest prefix wins
+	PathAllowedMethods map[string][]string `json:"path_allowed_methods"`
+
+	// Cookie names exempt from Set-Cookie hardening (e.g. cookies read by client-side scripts)
+	CookiePolicyExempt []string `json:"cookie_policy_exempt"`
+
+	// Clients whose request bodies may be logged when BodyLogEnabled; empty = nobody
+	BodyLogSources []string `json:"body_log_sources"`
+
+	// Body fields masked in logged JSON/form bodies (case-insensitive)
+	BodyLogRedactFields []string `json:"body_log_redact_fields"`
+
+	// CORS policy lists; CORSAllowedHeaders empty = reflect the preflight's request headers
+	CORSAllowedOrigins []string `json:"cors_allowed_origins"`
+	CORSAllowedMethods []string `json:"cors_allowed_methods"`
+	CORSAllowedHeaders []string `json:"cors_allowed_headers"`
+	CORSExposedHeaders []string `json:"cors_exposed_headers"`
+
+	// Upper bounds (seconds) of the olwsx_edge_request_duration_seconds histogram buckets
+	LatencyBuckets []float64 `json:"latency_buckets"`
+
+	// Sources allowed to use the HealthCheckPath fast path; empty = any client
+	HealthCheckSources []string `json:"health_check_sources"`
+
+	// Clients that bypass the WAF, rate limiting and challenges (e.g. internal callers, health checkers)
+	SecurityAllowlist []string `json:"security_allowlist"`
+
+	// Proxies whose X-Forwarded-For is trusted when resolving the client IP for SecurityAllowlist
+	TrustedProxies []string `json:"trusted_proxies"`
+
+	// Country rules (ISO 3166-1 alpha-2) checked against GeoIPDatabase; deny wins, a non-empty allow
+	// list admits only its countries. Unknown countries and lookup failures are let through
+	GeoAllowCountries []string `json:"geo_allow_countries"`
+	GeoDenyCountries  []string `json:"geo_deny_countries"`
+
+	// WebSocket origins allowed to upgrade: exact ("https://app.example.com") or "https://*.example.com"
+	WSAllowedOrigins []string `json:"ws_allowed_origins"`
+
+	// Actor Manager endpoints tried in order; later entries are failover targets
+	ActorManagerEndpoints []ActorEndpoint `json:"actor_manager_endpoints"`
+}
+
+// EnvPrefix prefixes the environment variable of each Config field: read_timeout is
+// OLWSX_READ_TIMEOUT.
+const EnvPrefix = "OLWSX_"
+
+// activeConfig holds the running configuration; it starts at the defaults so package code can
+// read it before main has loaded a file.
+var activeConfig = func() *atomic.Pointer[Config] {
+	p := new(atomic.Pointer[Config])
+	p.Store(DefaultConfig())
+	return p
+}()
+
+// conf returns the running configuration; treat it as read-only.
+func conf() *Config { return activeConfig.Load() }
+
+// LoadConfig builds a Config from the defaults, the JSON file at path ("" = none) and then
+// environment variables (lookup is os.LookupEnv in production), and validates it.
+// Durations are written as Go duration strings ("10s"); lists in the environment are
+// comma-separated, maps and endpoint lists are JSON.
+func LoadConfig(path string, lookup func(string) (string, bool)) (*Config, error) {
+	c := DefaultConfig()
+	set := map[string]bool{}
+	if path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("config: %w", err)
+		}
+		if err := c.overlayJSON(raw, set); err != nil {
+			return nil, fmt.Errorf("config %s: %w", path, err)
+		}
+	}
+	if err := c.overlayEnv(lookup, set); err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	// Endpoints follow a relocated socket unless they were configured themselves
+	if !set["actor_manager_endpoints"] {
+		c.ActorManagerEndpoints = []ActorEndpoint{{Network: "unix", Address: c.ActorManagerSocket}}
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// fields maps json keys to the addressable fields of c.
+func (c *Config) fields() map[string]reflect.Value {
+	v := reflect.ValueOf(c).Elem()
+	out := make(map[string]reflect.Value, v.NumField())
+	for i := 0; i < v.NumField(); i++ {
+		if key := v.Type().Field(i).Tag.Get("json"); key != "" {
+			out[key] = v.Field(i)
+		}
+	}
+	return out
+}
+
+// overlayJSON applies the keys present in raw; unknown keys are an error so typos surface.
+func (c *Config) overlayJSON(raw []byte, set map[string]bool) error {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return err
+	}
+	fields := c.fields()
+	for key, val := range doc {
+		f, ok := fields[key]
+		if !ok {
+			return fmt.Errorf("unknown key %q", key)
+		}
+		if f.Type() == durationType {
+			var s string
+			if err := json.Unmarshal(val, &s); err != nil {
+				return fmt.Errorf("%s: want a duration string like \"10s\"", key)
+			}
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			f.SetInt(int64(d))
+		} else {
+			f.Set(reflect.Zero(f.Type())) // replace lists and maps rather than merging into the defaults
+			if err := json.Unmarshal(val, f.Addr().Interface()); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		}
+		set[key] = true
+	}
+	return nil
+}
+
+// overlayEnv applies OLWSX_* variables.
+func (c *Config) overlayEnv(lookup func(string) (string, bool), set map[string]bool) error {
+	if lookup == nil {
+		return nil
+	}
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ { // declaration order, so the first bad variable is reported
+		key, f := v.Type().Field(i).Tag.Get("json"), v.Field(i)
+		name := EnvPrefix + strings.ToUpper(key)
+		s, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		if err := setFromString(f, s); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		set[key] = true
+	}
+	return nil
+}
+
+func setFromString(f reflect.Value, s string) error {
+	if f.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		f.SetInt(int64(d))
+		return nil
+	}
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	case reflect.Slice:
+		if k := f.Type().Elem().Kind(); k == reflect.String || k == reflect.Float64 {
+			items := reflect.MakeSlice(f.Type(), 0, 4)
+			for _, part := range strings.Split(s, ",") {
+				if part = strings.TrimSpace(part); part == "" {
+					continue
+				}
+				item := reflect.New(f.Type().Elem()).Elem()
+				if err := setFromString(item, part); err != nil {
+					return err
+				}
+				items = reflect.Append(items, item)
+			}
+			f.Set(items)
+			return nil
+		}
+		fallthrough
+	default:
+		f.Set(reflect.Zero(f.Type()))
+		return json.Unmarshal([]byte(s), f.Addr().Interface())
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"syscall"
+
+	"olwsx/edge/logging"
+)
+
+// hotReloadable lists the Config fields (json keys) that take effect without a restart:
+// everything here is read through conf() at use time or pushed by applyConfig. Listeners,
+// server timeouts (net/http reads them unsynchronized), pools and anything captured at
+// startup need a restart, so a reload touching them is rejected as a whole.
+var hotReloadable = map[string]bool{
+	"bucket_capacity": true, "refill_per_second": true,
+	"enable_waf": true, "waf_rules_file": true, "waf_max_inspect_bytes": true, "waf_time_budget": true,
+	"waf_inspect_body": true, "waf_max_body_inspect_bytes": true,
+	"challenge_difficulty": true, "challenge_max_difficulty": true, "challenge_difficulty_step": true,
+	"challenge_rps_high": true, "challenge_error_ratio_high": true,
+	"challenge_window": true, "challenge_window_tolerance": true, "challenge_clearance_ttl": true,
+	"log_level": true, "access_log_enabled": true, "access_log_format": true, "access_log_sample": true,
+	"metrics_enabled": true, "shutdown_timeout": true, "ready_drain_delay": true,
+}
+
+// changedFields returns the json keys whose values differ between a and b, in field order.
+func changedFields(a, b *Config) []string {
+	va, vb := reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem()
+	var out []string
+	for i := 0; i < va.NumField(); i++ {
+		if !reflect.DeepEqual(va.Field(i).Interface(), vb.Field(i).Interface()) {
+			out = append(out, va.Type().Field(i).Tag.Get("json"))
+		}
+	}
+	return out
+}
+
+// ReloadConfig re-reads path and the environment and swaps in the result if only
+// hot-reloadable fields changed. It returns the changed fields; on error the running config
+// is untouched.
+func ReloadConfig(path string, lookup func(string) (string, bool)) ([]string, error) {
+	next, err := LoadConfig(path, lookup)
+	if err != nil {
+		return nil, err
+	}
+	cur := conf()
+	changed := changedFields(cur, next)
+	var restart []string
+	for _, key := range changed {
+		if !hotReloadable[key] {
+			restart = append(restart, key)
+		}
+	}
+	if len(restart) > 0 {
+		return nil, fmt.Errorf("restart required for: %s", strings.Join(restart, ", "))
+	}
+	if err := applyConfig(cur, next); err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+// applyConfig pushes next into the components that cache settings, then makes it current.
+// Fallible steps run first so a failure leaves everything as it was.
+func applyConfig(cur, next *Config) error {
+	level, err := logging.ParseLevel(next.LogLevel)
+	if err != nil {
+		return err
+	}
+	rules := activeWAF.Load()
+	if next.WAFRulesFile != "" {
+		raw, err := os.ReadFile(next.WAFRulesFile)
+		if err != nil {
+			return err
+		}
+		if rules, err = ParseWAFRules(raw); err != nil {
+			return err
+		}
+	} else if cur.WAFRulesFile != "" {
+		rules = defaultWAFRules
+	}
+	if err := SetRateLimit(next.BucketCapacity, next.RefillPerSecond); err != nil {
+		return err
+	}
+	activeWAF.Store(rules)
+	if l, ok := logging.Default().(interface{ SetLevel(logging.Level) }); ok {
+		l.SetLevel(level)
+	}
+	if next.ChallengeDifficulty != cur.ChallengeDifficulty {
+		setDifficulty(next.ChallengeDifficulty)
+	}
+	activeConfig.Store(next)
+	return nil
+}
+
+// reloadOnSIGHUP reloads the config (and with it the WAF rules) on every SIGHUP, logging
+// what changed; a rejected reload keeps the running config.
+func reloadOnSIGHUP(path string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		changed, err := ReloadConfig(path, os.LookupEnv)
+		if err != nil {
+			logging.Error("config reload: %v (keeping previous config)", err)
+			continue
+		}
+		if len(changed) == 0 {
+			logging.Info("config reloaded: no changes")
+			continue
+		}
+		logging.Info("config reloaded: changed %s", strings.Join(changed, ", "))
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"olwsx/edge/logging"
+)
+
+// loadActive loads path as the running config for the test.
+func loadActive(t *testing.T, path string) {
+	t.Helper()
+	c, err := LoadConfig(path, envMap(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	withConfig(t, func(*Config) {})
+	activeConfig.Store(c)
+}
+
+func TestSIGHUPUpdatesRateLimit(t *testing.T) {
+	path := writeConfig(t, `{"bucket_capacity": 3, "refill_per_second": 1}`)
+	loadActive(t, path)
+	withRateLimit(t, 3, 1)
+	go reloadOnSIGHUP(path)
+	time.Sleep(20 * time.Millisecond) // let signal.Notify register before the signal is sent
+
+	if err := os.WriteFile(path, []byte(`{"bucket_capacity": 5, "refill_per_second": 1}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if capacity, _ := RateLimit(); capacity == 5 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("rate limit not updated after SIGHUP")
+		}
+	}
+	if conf().BucketCapacity != 5 {
+		t.Errorf("active config capacity = %d", conf().BucketCapacity)
+	}
+	if got := allowed("198.51.100.9", 10); got != 5 {
+		t.Errorf("reloaded capacity 5 allowed %d requests", got)
+	}
+}
+
+func TestReloadRejectsRestartOnlyChanges(t *testing.T) {
+	path := writeConfig(t, `{"ws_listen_addr": ":7000", "log_level": "info"}`)
+	loadActive(t, path)
+	prevLog := logging.Default()
+	logging.SetDefault(logging.New(io.Discard, logging.LevelInfo)) // the reload retunes the default logger
+	t.Cleanup(func() { logging.SetDefault(prevLog) })
+	before := conf()
+
+	os.WriteFile(path, []byte(`{"ws_listen_addr": ":7001", "log_level": "debug"}`), 0o600)
+	if _, err := ReloadConfig(path, envMap(nil)); err == nil || !strings.Contains(err.Error(), "ws_listen_addr") {
+		t.Errorf("listen address change: err = %v", err)
+	}
+	if conf() != before {
+		t.Error("rejected reload replaced the running config")
+	}
+
+	os.WriteFile(path, []byte(`{"ws_listen_addr": ":7000", "log_level": "debug", "enable_waf": false}`), 0o600)
+	changed, err := ReloadConfig(path, envMap(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(changed, ",") != "log_level,enable_waf" {
+		t.Errorf("changed = %v", changed)
+	}
+	if conf().EnableWAF || conf().LogLevel != "debug" {
+		t.Errorf("hot-reloadable fields not applied: enable_waf=%v log_level=%s", conf().EnableWAF, conf().LogLevel)
+	}
+
+	os.WriteFile(path, []byte(`{"ws_listen_addr": ":7000", "log_level": "loud"}`), 0o600)
+	if _, err := ReloadConfig(path, envMap(nil)); err == nil {
+		t.Error("invalid log level accepted")
+	}
+	if conf().LogLevel != "debug" {
+		t.Errorf("failed reload changed log_level to %s", conf().LogLevel)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// envMap is a lookup over a fixed environment.
+func envMap(env map[string]string) func(string) (string, bool) {
+	return func(k string) (string, bool) { v, ok := env[k]; return v, ok }
+}
+
+func writeConfig(t *testing.T, doc string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "edge.json")
+	if err := os.WriteFile(path, []byte(doc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCookieHardeningIsOffByDefault(t *testing.T) {
+	c, err := LoadConfig("", envMap(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.CookieSecure || c.CookieHttpOnly || c.CookieSameSite != "" {
+		t.Errorf("defaults Secure=%v HttpOnly=%v SameSite=%q, want all off", c.CookieSecure, c.CookieHttpOnly, c.CookieSameSite)
+	}
+
+	c, err = LoadConfig(writeConfig(t, `{"cookie_secure": true, "cookie_same_site": "Strict"}`),
+		envMap(map[string]string{EnvPrefix + "COOKIE_HTTP_ONLY": "true"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.CookieSecure || !c.CookieHttpOnly || c.CookieSameSite != "Strict" {
+		t.Errorf("opted in Secure=%v HttpOnly=%v SameSite=%q", c.CookieSecure, c.CookieHttpOnly, c.CookieSameSite)
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := writeConfig(t, `{"read_timeout": "7s", "ws_listen_addr": ":7000", "enable_h2c": true, "allowed_methods": ["GET"]}`)
+	c, err := LoadConfig(path, envMap(map[string]string{
+		EnvPrefix + "WS_LISTEN_ADDR":     ":7001",
+		EnvPrefix + "GEOIP_DATABASE":     "/data/geo.mmdb",
+		EnvPrefix + "RETRY_AFTER_SECOND": "3",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ReadTimeout != 7*time.Second || !c.EnableH2C || len(c.AllowedMethods) != 1 {
+		t.Errorf("file values not applied: read_timeout=%s enable_h2c=%v allowed_methods=%v", c.ReadTimeout, c.EnableH2C, c.AllowedMethods)
+	}
+	if c.WSListenAddr != ":7001" || c.GeoIPDatabase != "/data/geo.mmdb" || c.RetryAfterSecond != 3 {
+		t.Errorf("environment not applied over the file: %s %q %d", c.WSListenAddr, c.GeoIPDatabase, c.RetryAfterSecond)
+	}
+	if c.WriteTimeout != DefaultConfig().WriteTimeout {
+		t.Errorf("unset write_timeout = %s, want the default", c.WriteTimeout)
+	}
+}
+
+func TestLoadConfigRejectsUnknownAndInvalidValues(t *testing.T) {
+	for doc, want := range map[string]string{
+		`{"enable_h2_c": true}`:         `unknown key "enable_h2_c"`,
+		`{"read_timeout": 5}`:           "duration string",
+		`{"retry_after_second": 0}`:     "retry_after_second",
+		`{"challenge_window": "500ms"}`: "challenge_window",
+	} {
+		_, err := LoadConfig(writeConfig(t, doc), envMap(nil))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err = %v, want mention of %q", doc, err, want)
+		}
+	}
+}
+
+func TestConfigKeysAreSnakeCaseWords(t *testing.T) {
+	word := regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]{2,})*$`)
+	for key := range DefaultConfig().fields() {
+		if !word.MatchString(key) {
+			t.Errorf("config key %q splits a word or acronym", key)
+		}
+	}
+	for _, key := range []string{"enable_h2c", "h2c_listen_addr", "ws_json_errors", "actor_tls_ca_file", "enable_etags", "geoip_database", "tls_min_version_13"} {
+		if _, ok := DefaultConfig().fields()[key]; !ok {
+			t.Errorf("missing config key %q", key)
+		}
+	}
+}
+
+func TestDefaultConfigIsValid(t *testing.T) {
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAltSvcOnlyWithHTTP3(t *testing.T) {
+	c := DefaultConfig()
+	c.TLSListenAddr, c.AltSvcMaxAge = "0.0.0.0:8443", time.Hour
+	if got := altSvcFor(c); got != `h3=":8443"; ma=3600` {
+		t.Errorf("enabled: %q", got)
+	}
+	c.AltSvcH3Addr = ":443"
+	if got := altSvcFor(c); got != `h3=":443"; ma=3600` {
+		t.Errorf("override: %q", got)
+	}
+	c.EnableHTTP3 = false
+	if got := altSvcFor(c); got != "" {
+		t.Errorf("disabled: %q", got)
+	}
+}
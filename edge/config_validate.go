@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	edgehttp "olwsx/edge/http"
+	"olwsx/edge/logging"
+	edgequic "olwsx/edge/quic"
+)
+
+// Validate checks ranges and cross-field relationships and reports every problem at once
+// (errors.Join), so an operator fixes a config file in one pass. main runs it, through
+// LoadConfig, before binding any listener.
+func (c *Config) Validate() error {
+	var errs []error
+	bad := func(format string, args ...any) { errs = append(errs, fmt.Errorf(format, args...)) }
+
+	// Durations: none may be negative; these must be positive
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if f := v.Field(i); f.Type() == durationType && f.Int() < 0 {
+			bad("%s must not be negative", v.Type().Field(i).Tag.Get("json"))
+		}
+	}
+	for _, d := range []struct {
+		key string
+		val int64
+	}{
+		{"read_timeout", int64(c.ReadTimeout)}, {"write_timeout", int64(c.WriteTimeout)},
+		{"idle_timeout", int64(c.IdleTimeout)}, {"read_header_to", int64(c.ReadHeaderTO)},
+		{"shutdown_timeout", int64(c.ShutdownTimeout)}, {"actor_dial_timeout", int64(c.ActorDialTimeout)},
+		{"ws_ping_interval", int64(c.WSPingInterval)}, {"ws_pong_wait", int64(c.WSPongWait)},
+		{"sse_poll_interval", int64(c.SSEPollInterval)}, {"sse_keepalive", int64(c.SSEKeepalive)},
+		{"ready_check_timeout", int64(c.ReadyCheckTimeout)},
+		{"challenge_clearance_ttl", int64(c.ChallengeClearanceTTL)},
+	} {
+		if d.val == 0 {
+			bad("%s must be positive", d.key)
+		}
+	}
+	if c.ReadHeaderTO > c.ReadTimeout {
+		bad("read_header_to (%s) exceeds read_timeout (%s)", c.ReadHeaderTO, c.ReadTimeout)
+	}
+	if c.WSPongWait <= c.WSPingInterval {
+		bad("ws_pong_wait (%s) must exceed ws_ping_interval (%s)", c.WSPongWait, c.WSPingInterval)
+	}
+	if c.ChallengeAdaptive && c.ChallengeAdaptInterval <= 0 {
+		bad("challenge_adapt_interval must be positive when challenge_adaptive is set")
+	}
+
+	// Listen addresses
+	addrs := []struct{ key, addr string }{
+		{"tls_listen_addr", c.TLSListenAddr}, {"ws_listen_addr", c.WSListenAddr}, {"admin_listen_addr", c.AdminListenAddr},
+	}
+	if c.EnableH2C {
+		addrs = append(addrs, struct{ key, addr string }{"h2c_listen_addr", c.H2CListenAddr})
+	}
+	if c.AltSvcH3Addr != "" {
+		addrs = append(addrs, struct{ key, addr string }{"alt_svc_h3_addr", c.AltSvcH3Addr})
+	}
+	seen := map[string]string{}
+	for _, a := range addrs {
+		if err := validHostPort(a.addr); err != nil {
+			bad("%s %q: %v", a.key, a.addr, err)
+			continue
+		}
+		if other, dup := seen[a.addr]; dup && a.key != "alt_svc_h3_addr" {
+			bad("%s and %s both listen on %s", other, a.key, a.addr)
+		}
+		seen[a.addr] = a.key
+	}
+
+	// Sizes and limits
+	if c.MaxHeaderBytes <= 0 || c.MaxHeaderValueBytes <= 0 || c.MaxBodyBytes <= 0 {
+		bad("max_header_bytes, max_header_value_bytes and max_body_bytes must be positive")
+	}
+	if c.MaxHeaderValueBytes > c.MaxHeaderBytes {
+		bad("max_header_value_bytes (%d) exceeds max_header_bytes (%d)", c.MaxHeaderValueBytes, c.MaxHeaderBytes)
+	}
+	if c.MaxHeaderBytes >= c.MaxBodyBytes {
+		bad("max_header_bytes (%d) should be below max_body_bytes (%d)", c.MaxHeaderBytes, c.MaxBodyBytes)
+	}
+	for prefix, n := range c.PathBodyLimits {
+		if n <= 0 {
+			bad("path_body_limits[%q] must be positive", prefix)
+		}
+	}
+	if err := validRateLimit(c.BucketCapacity, c.RefillPerSecond); err != nil {
+		bad("rate limit: %v", err)
+	}
+	if c.RetryAfterSecond < 1 {
+		bad("retry_after_second must be at least 1")
+	}
+	if c.ActorMaxInFlight < 0 || c.ActorMaxPerClient < 0 || c.StaleCacheEntries < 0 {
+		bad("actor_max_in_flight, actor_max_per_client and stale_cache_entries must not be negative")
+	}
+	if c.ActorPoolSize <= 0 || c.ActorPoolMaxIdle < 0 || c.ActorPoolMaxIdle > c.ActorPoolSize {
+		bad("actor pool: need actor_pool_size > 0 and 0 <= actor_pool_max_idle <= actor_pool_size")
+	}
+	if c.ListenMaxConns < 0 || c.MaxConnsPerIP < 0 {
+		bad("listen_max_conns and max_conns_per_ip must not be negative")
+	}
+	if c.ActorMaxResponse <= 0 {
+		bad("actor_max_response must be positive")
+	}
+	if c.WSMaxMessageBytes <= 0 {
+		bad("ws_max_message_bytes must be positive")
+	}
+	if c.WSMaxConns < 0 || c.WSHubQueue < 0 {
+		bad("ws_max_conns and ws_hub_queue must not be negative")
+	}
+	if c.WSAuthRequired && c.WSAuthSecret == "" && !(c.WSAuthClearance && c.EnableChallenge) {
+		bad("ws_auth_required: set ws_auth_secret or enable ws_auth_clearance with the challenge")
+	}
+	if c.CompressLevel < 0 || c.CompressLevel > 11 {
+		bad("compress_level %d out of range 0..11", c.CompressLevel)
+	}
+	if c.WSCompressionLvl < -2 || c.WSCompressionLvl > 9 {
+		bad("ws_compression_lvl %d out of range -2..9", c.WSCompressionLvl)
+	}
+	if c.WAFMaxInspectBytes < 0 || c.WAFMaxBodyInspectBytes < 0 {
+		bad("waf inspect limits must not be negative")
+	}
+
+	// Enumerations
+	if _, err := logging.ParseLevel(c.LogLevel); err != nil {
+		bad("log_level: %v", err)
+	}
+	if c.AccessLogFormat != "text" && c.AccessLogFormat != "json" {
+		bad("access_log_format %q: want text or json", c.AccessLogFormat)
+	}
+	if strings.ContainsAny(c.RequestIDHeader, " \t\r\n:") {
+		bad("request_id_header %q is not a valid header name", c.RequestIDHeader)
+	}
+	if c.AccessLogSample < 1 {
+		bad("access_log_sample must be at least 1")
+	}
+	switch c.CookieSameSite {
+	case "", "Lax", "Strict", "None":
+	default:
+		bad("cookie_same_site %q: want Lax, Strict, None or empty", c.CookieSameSite)
+	}
+	if c.CookieSameSite == "None" && !c.CookieSecure {
+		bad("cookie_same_site None requires cookie_secure")
+	}
+
+	// Challenge
+	if c.ChallengeDifficulty < 0 || c.ChallengeDifficulty > c.ChallengeMaxDifficulty || c.ChallengeMaxDifficulty > 32 {
+		bad("challenge difficulty: need 0 <= challenge_difficulty <= challenge_max_difficulty <= 32")
+	}
+	if c.ChallengeWindow < time.Second || c.ChallengeWindowTolerance < 0 {
+		bad("challenge_window must be at least 1s and challenge_window_tolerance non-negative")
+	}
+	if c.ChallengeAdaptive && (c.ChallengeDifficultyStep <= 0 || c.ChallengeRPSHigh <= 0 || c.ChallengeErrorRatioHigh <= 0) {
+		bad("adaptive challenge needs positive challenge_difficulty_step, challenge_rps_high and challenge_error_ratio_high")
+	}
+
+	// Networks, endpoints, buckets
+	for _, l := range []struct {
+		key  string
+		list []string
+	}{
+		{"security_allowlist", c.SecurityAllowlist}, {"trusted_proxies", c.TrustedProxies},
+		{"body_log_sources", c.BodyLogSources}, {"health_check_sources", c.HealthCheckSources},
+	} {
+		if _, err := edgehttp.ParseCIDRs(l.list); err != nil {
+			bad("%s: %v", l.key, err)
+		}
+	}
+	for _, cc := range append(append([]string(nil), c.GeoAllowCountries...), c.GeoDenyCountries...) {
+		if len(cc) != 2 {
+			bad("geo country %q: want an ISO 3166-1 alpha-2 code", cc)
+		}
+	}
+	if len(c.ActorManagerEndpoints) == 0 {
+		bad("actor_manager_endpoints must not be empty")
+	}
+	for i, ep := range c.ActorManagerEndpoints {
+		switch {
+		case ep.Network != "unix" && ep.Network != "tcp":
+			bad("actor_manager_endpoints[%d]: network %q: want unix or tcp", i, ep.Network)
+		case ep.Address == "":
+			bad("actor_manager_endpoints[%d]: empty address", i)
+		case ep.Network == "tcp":
+			if err := validHostPort(ep.Address); err != nil {
+				bad("actor_manager_endpoints[%d] %q: %v", i, ep.Address, err)
+			}
+		}
+	}
+	for i := range c.LatencyBuckets {
+		if c.LatencyBuckets[i] <= 0 || (i > 0 && c.LatencyBuckets[i] <= c.LatencyBuckets[i-1]) {
+			bad("latency_buckets must be positive and strictly increasing")
+			break
+		}
+	}
+	if c.EnableHTTP3 {
+		if err := c.quicTransport().Validate(); err != nil {
+			bad("%v", err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// quicTransport is the HTTP/3 tuning derived from c.
+func (c *Config) quicTransport() edgequic.Transport {
+	return edgequic.Transport{
+		MaxIncomingStreams:      c.QUICMaxIncomingStreams,
+		MaxIdleTimeout:          c.QUICMaxIdleTimeout,
+		InitialStreamWindow:     c.QUICInitialStreamWindow,
+		MaxStreamWindow:         c.QUICMaxStreamWindow,
+		InitialConnectionWindow: c.QUICInitialConnWindow,
+		MaxConnectionWindow:     c.QUICMaxConnWindow,
+		EnableDatagrams:         c.QUICEnableDatagrams,
+	}
+}
+
+// validHostPort accepts "host:port" and ":port" with a numeric port in 0..65535.
+func validHostPort(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("port %q is not a number in 0..65535", port)
+	}
+	return nil
+}
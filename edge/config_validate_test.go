@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateRejectsInvalidCombinations(t *testing.T) {
+	for name, tc := range map[string]struct {
+		edit func(*Config)
+		want []string
+	}{
+		"negative and zero durations": {
+			func(c *Config) { c.ReadTimeout, c.IdleTimeout, c.ReadyDrainDelay = 0, 0, -time.Second },
+			[]string{"read_timeout must be positive", "idle_timeout must be positive", "ready_drain_delay must not be negative", "exceeds read_timeout (0s)"},
+		},
+		"header timeout over read timeout": {
+			func(c *Config) { c.ReadTimeout, c.ReadHeaderTO = time.Second, 2*time.Second },
+			[]string{"read_header_to (2s) exceeds read_timeout (1s)"},
+		},
+		"pong before ping": {
+			func(c *Config) { c.WSPingInterval, c.WSPongWait = 30*time.Second, 10*time.Second },
+			[]string{"ws_pong_wait (10s) must exceed ws_ping_interval (30s)"},
+		},
+		"bad and duplicate addresses": {
+			func(c *Config) { c.TLSListenAddr, c.WSListenAddr, c.AdminListenAddr = "8443", ":9090", ":9090" },
+			[]string{`tls_listen_addr "8443"`, "ws_listen_addr and admin_listen_addr both listen on :9090"},
+		},
+		"header limits above body limit": {
+			func(c *Config) { c.MaxHeaderBytes, c.MaxHeaderValueBytes, c.MaxBodyBytes = 4096, 8192, 1024 },
+			[]string{"max_header_value_bytes (8192) exceeds max_header_bytes (4096)", "max_header_bytes (4096) should be below max_body_bytes (1024)"},
+		},
+		"negative rate limit": {
+			func(c *Config) { c.BucketCapacity, c.RefillPerSecond = -1, -1 },
+			[]string{"rate limit:"},
+		},
+		"actor pool and endpoints": {
+			func(c *Config) { c.ActorPoolSize, c.ActorPoolMaxIdle, c.ActorManagerEndpoints = 2, 3, nil },
+			[]string{"actor pool:", "actor_manager_endpoints must not be empty"},
+		},
+		"unknown enums": {
+			func(c *Config) { c.LogLevel, c.AccessLogFormat, c.CookieSameSite = "loud", "xml", "Sometimes" },
+			[]string{"log_level:", `access_log_format "xml"`, `cookie_same_site "Sometimes"`},
+		},
+		"negative WebSocket limits": {
+			func(c *Config) { c.WSMaxConns = -1 },
+			[]string{"ws_max_conns and ws_hub_queue must not be negative"},
+		},
+		"WebSocket auth without a credential": {
+			func(c *Config) { c.WSAuthRequired, c.WSAuthSecret, c.EnableChallenge = true, "", false },
+			[]string{"ws_auth_required: set ws_auth_secret"},
+		},
+		"latency buckets out of order": {
+			func(c *Config) { c.LatencyBuckets = []float64{0.1, 0.05} },
+			[]string{"latency_buckets must be positive and strictly increasing"},
+		},
+	} {
+		c := DefaultConfig()
+		tc.edit(c)
+		err := c.Validate()
+		if err == nil {
+			t.Errorf("%s: accepted", name)
+			continue
+		}
+		// Every problem is reported at once, one per line
+		for _, want := range tc.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: error missing %q:\n%v", name, want, err)
+			}
+		}
+		if n := strings.Count(err.Error(), "\n") + 1; n != len(tc.want) {
+			t.Errorf("%s: %d problems reported, want %d:\n%v", name, n, len(tc.want), err)
+		}
+	}
+}
+
+func TestLoadConfigValidatesBeforeReturning(t *testing.T) {
+	_, err := LoadConfig(writeConfig(t, `{"read_timeout": "1s", "read_header_to": "5s"}`), envMap(nil))
+	if err == nil || !strings.Contains(err.Error(), "read_header_to") {
+		t.Errorf("LoadConfig = %v, want the validation error", err)
+	}
+	_, err = LoadConfig("", envMap(map[string]string{EnvPrefix + "WS_LISTEN_ADDR": "nowhere"}))
+	if err == nil || !strings.Contains(err.Error(), "ws_listen_addr") {
+		t.Errorf("LoadConfig with a bad env address = %v", err)
+	}
+}
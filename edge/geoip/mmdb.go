@@ -0,0 +1,323 @@
+// Package geoip resolves client IPs to ISO country codes from a MaxMind DB (.mmdb) file,
+// e.g. GeoLite2-Country. Only what a country lookup needs is implemented: the search tree
+// and a decoder for the data section types.
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+)
+
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+var (
+	errCorrupt    = errors.New("geoip: corrupt database")
+	errNoMetadata = errors.New("geoip: metadata marker not found")
+)
+
+// DB is an in-memory MaxMind DB; it is safe for concurrent lookups.
+type DB struct {
+	buf        []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	dataStart  uint // offset of the data section in buf
+	ipv4Start  uint // node reached after 96 zero bits in an IPv6 tree
+}
+
+// Open reads and validates the database at path.
+func Open(path string) (*DB, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return New(buf)
+}
+
+// New parses a database already in memory.
+func New(buf []byte) (*DB, error) {
+	at := bytes.LastIndex(buf, metadataMarker)
+	if at < 0 {
+		return nil, errNoMetadata
+	}
+	metaStart := uint(at + len(metadataMarker))
+	meta, _, err := (&decoder{buf: buf[metaStart:]}).decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("geoip: metadata: %w", err)
+	}
+	m, ok := meta.(map[string]any)
+	if !ok {
+		return nil, errCorrupt
+	}
+	db := &DB{buf: buf, nodeCount: metaUint(m, "node_count"), recordSize: metaUint(m, "record_size"), ipVersion: metaUint(m, "ip_version")}
+	switch db.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("geoip: unsupported record size %d", db.recordSize)
+	}
+	if db.ipVersion != 4 && db.ipVersion != 6 {
+		return nil, fmt.Errorf("geoip: unsupported ip version %d", db.ipVersion)
+	}
+	treeSize := db.nodeCount * db.recordSize / 4
+	if treeSize+16 > metaStart {
+		return nil, errCorrupt
+	}
+	db.dataStart = treeSize + 16
+	if db.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < db.nodeCount; i++ {
+			node = db.record(node, 0)
+		}
+		db.ipv4Start = node
+	}
+	return db, nil
+}
+
+func metaUint(m map[string]any, key string) uint {
+	v, _ := m[key].(uint64)
+	return uint(v)
+}
+
+// record returns the left (bit 0) or right (bit 1) record of node.
+func (db *DB) record(node, bit uint) uint {
+	b := db.buf[node*db.recordSize/4:]
+	switch db.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// Lookup returns the data record for ip, or nil if the database has none.
+func (db *DB) Lookup(ip net.IP) (any, error) {
+	node := uint(0)
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+		if db.ipVersion == 6 {
+			node = db.ipv4Start
+		}
+	} else if db.ipVersion == 4 {
+		return nil, nil // IPv6 address in an IPv4-only database
+	}
+	for i := 0; i < len(ip)*8 && node < db.nodeCount; i++ {
+		node = db.record(node, uint(ip[i>>3]>>(7-i&7))&1)
+	}
+	switch {
+	case node == db.nodeCount:
+		return nil, nil
+	case node < db.nodeCount:
+		return nil, errCorrupt // ran out of address bits inside the tree
+	}
+	off := node - db.nodeCount - 16
+	d := &decoder{buf: db.buf[db.dataStart:]}
+	v, _, err := d.decode(off)
+	return v, err
+}
+
+// Country returns the ISO 3166-1 alpha-2 code for ip ("" if unknown).
+func (db *DB) Country(ip net.IP) (string, error) {
+	rec, err := db.Lookup(ip)
+	if err != nil || rec == nil {
+		return "", err
+	}
+	m, _ := rec.(map[string]any)
+	for _, key := range []string{"country", "registered_country"} {
+		if c, ok := m[key].(map[string]any); ok {
+			if iso, ok := c["iso_code"].(string); ok && iso != "" {
+				return iso, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// decoder reads values from a data section; pointers are relative to buf.
+type decoder struct{ buf []byte }
+
+// Data section type numbers.
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// maxDepth bounds nesting so a hostile file cannot recurse without limit.
+const maxDepth = 32
+
+func (d *decoder) decode(off uint) (any, uint, error) { return d.decodeDepth(off, 0) }
+
+func (d *decoder) decodeDepth(off uint, depth int) (any, uint, error) {
+	if depth > maxDepth {
+		return nil, 0, errCorrupt
+	}
+	if off >= uint(len(d.buf)) {
+		return nil, 0, errCorrupt
+	}
+	ctrl := d.buf[off]
+	off++
+	typ := uint(ctrl >> 5)
+	if typ == typePointer {
+		ptr, next, err := d.pointer(ctrl, off)
+		if err != nil {
+			return nil, 0, err
+		}
+		v, _, err := d.decodeDepth(ptr, depth+1)
+		return v, next, err
+	}
+	if typ == typeExtended {
+		if off >= uint(len(d.buf)) {
+			return nil, 0, errCorrupt
+		}
+		typ = 7 + uint(d.buf[off])
+		off++
+	}
+	size, off, err := d.size(ctrl, off)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch typ {
+	case typeMap:
+		m := make(map[string]any, min(size, 64))
+		for i := uint(0); i < size; i++ {
+			k, next, err := d.decodeDepth(off, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, errCorrupt
+			}
+			if m[key], off, err = d.decodeDepth(next, depth+1); err != nil {
+				return nil, 0, err
+			}
+		}
+		return m, off, nil
+	case typeArray:
+		a := make([]any, 0, min(size, 64))
+		for i := uint(0); i < size; i++ {
+			var v any
+			if v, off, err = d.decodeDepth(off, depth+1); err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+		}
+		return a, off, nil
+	case typeBool:
+		return size != 0, off, nil
+	case typeContainer, typeEndMarker:
+		return nil, off, nil
+	}
+	if off+size > uint(len(d.buf)) {
+		return nil, 0, errCorrupt
+	}
+	raw := d.buf[off : off+size]
+	off += size
+	switch typ {
+	case typeString:
+		return string(raw), off, nil
+	case typeBytes, typeUint128:
+		return append([]byte(nil), raw...), off, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errCorrupt
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(raw)), off, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errCorrupt
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(raw)), off, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, errCorrupt
+		}
+		var n uint64
+		for _, c := range raw {
+			n = n<<8 | uint64(c)
+		}
+		return n, off, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, errCorrupt
+		}
+		var n uint32
+		for _, c := range raw {
+			n = n<<8 | uint32(c)
+		}
+		return int32(n), off, nil
+	}
+	return nil, 0, errCorrupt
+}
+
+// size decodes the payload length that follows a control byte.
+func (d *decoder) size(ctrl byte, off uint) (uint, uint, error) {
+	size := uint(ctrl & 0x1f)
+	if size < 29 {
+		return size, off, nil
+	}
+	n := size - 28 // 1..3 extra bytes
+	if off+n > uint(len(d.buf)) {
+		return 0, 0, errCorrupt
+	}
+	var extra uint
+	for _, c := range d.buf[off : off+n] {
+		extra = extra<<8 | uint(c)
+	}
+	switch size {
+	case 29:
+		size = 29 + extra
+	case 30:
+		size = 285 + extra
+	default:
+		size = 65821 + extra
+	}
+	return size, off + n, nil
+}
+
+// pointer decodes a pointer's target offset and the offset just past it.
+func (d *decoder) pointer(ctrl byte, off uint) (uint, uint, error) {
+	ss := uint(ctrl>>3) & 3
+	n := ss + 1
+	if off+n > uint(len(d.buf)) {
+		return 0, 0, errCorrupt
+	}
+	var p uint
+	for _, c := range d.buf[off : off+n] {
+		p = p<<8 | uint(c)
+	}
+	vvv := uint(ctrl & 7)
+	switch ss {
+	case 0:
+		p |= vvv << 8
+	case 1:
+		p = 2048 + (p | vvv<<16)
+	case 2:
+		p = 526336 + (p | vvv<<24)
+	}
+	return p, off + n, nil
+}
@@ -0,0 +1,101 @@
+package geoip
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// enc builds MaxMind DB data-section values.
+func encString(s string) []byte { return append([]byte{typeString<<5 | byte(len(s))}, s...) }
+func encUint(v byte) []byte     { return []byte{typeUint32<<5 | 1, v} }
+func encMap(kv ...[]byte) []byte {
+	out := []byte{typeMap<<5 | byte(len(kv)/2)}
+	for _, b := range kv {
+		out = append(out, b...)
+	}
+	return out
+}
+
+func country(iso string) []byte {
+	return encMap(encString("country"), encMap(encString("iso_code"), encString(iso)))
+}
+
+// testDB is a two-node IPv4 tree with 24-bit records:
+// 0.0.0.0/2 -> US, 64.0.0.0/2 -> no data, 128.0.0.0/1 -> DE (via registered_country).
+func testDB() []byte {
+	const nodes = 2
+	us := country("US")
+	de := encMap(encString("registered_country"), encMap(encString("iso_code"), encString("DE")))
+	data := append(append([]byte{}, us...), de...)
+	rec := func(v uint) []byte { return []byte{byte(v >> 16), byte(v >> 8), byte(v)} }
+	dataRec := func(off int) uint { return uint(nodes + 16 + off) }
+
+	var buf []byte
+	buf = append(buf, rec(1)...)                // node 0, bit 0 -> node 1
+	buf = append(buf, rec(dataRec(len(us)))...) // node 0, bit 1 -> DE
+	buf = append(buf, rec(dataRec(0))...)       // node 1, bit 0 -> US
+	buf = append(buf, rec(nodes)...)            // node 1, bit 1 -> empty
+	buf = append(buf, make([]byte, 16)...)      // data section separator
+	buf = append(buf, data...)
+	buf = append(buf, metadataMarker...)
+	return append(buf, encMap(
+		encString("node_count"), encUint(nodes),
+		encString("record_size"), encUint(24),
+		encString("ip_version"), encUint(4),
+	)...)
+}
+
+func TestCountryLookup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	if err := os.WriteFile(path, testDB(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ip, want := range map[string]string{
+		"8.8.8.8":     "US",
+		"63.255.0.1":  "US",
+		"64.0.0.1":    "",
+		"127.0.0.1":   "",
+		"128.0.0.1":   "DE",
+		"203.0.113.9": "DE",
+		"2001:db8::1": "", // IPv6 in an IPv4 database
+	} {
+		if got, err := db.Country(net.ParseIP(ip)); err != nil || got != want {
+			t.Errorf("Country(%s) = %q, %v; want %q", ip, got, err, want)
+		}
+	}
+}
+
+func TestRejectsBrokenDatabases(t *testing.T) {
+	good := testDB()
+	cut := len(good) - 40 // inside the metadata map
+	if _, err := New(good[:cut]); err == nil {
+		t.Error("truncated metadata accepted")
+	}
+	if _, err := New(good[:8]); !errors.Is(err, errNoMetadata) {
+		t.Errorf("no metadata: %v", err)
+	}
+	if _, err := New([]byte("not a database")); err == nil {
+		t.Error("garbage accepted")
+	}
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.mmdb")); err == nil {
+		t.Error("missing file accepted")
+	}
+
+	// A record pointing past the data section fails the lookup rather than panicking
+	bad := append([]byte{}, good...)
+	bad[5] = 0xff // node 0, bit 1
+	db, err := New(bad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Country(net.ParseIP("200.0.0.1")); err == nil {
+		t.Error("dangling data pointer accepted")
+	}
+}
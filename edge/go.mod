@@ -3,6 +3,7 @@ module olwsx/edge
 go 1.24.4
 
 require (
+	github.com/andybalholm/brotli v1.1.1
 	github.com/gorilla/websocket v1.5.1
 	github.com/quic-go/quic-go v0.44.0
 )
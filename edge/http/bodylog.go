@@ -0,0 +1,101 @@
+package http
+
+import (
+	"encoding/json"
+	"mime"
+	"net"
+	"net/url"
+	"strings"
+
+	"olwsx/edge/logging"
+)
+
+const redacted = "[REDACTED]"
+
+// BodyLog logs a bounded, redacted prefix of request bodies for incident debugging.
+// Only clients in Sources are logged; an empty Sources list logs nobody.
+type BodyLog struct {
+	Enabled      bool
+	MaxBytes     int      // logged prefix length after redaction
+	RedactFields []string // JSON keys / form fields replaced with [REDACTED], case-insensitive
+	Sources      []*net.IPNet
+}
+
+// wants reports whether body is logged for client, the address resolved through TrustedProxies.
+func (b BodyLog) wants(client string, body []byte) bool {
+	return b.Enabled && b.MaxBytes > 0 && len(body) > 0 && ipInNets(client, b.Sources, false)
+}
+
+// log emits the body line next to the access log, keyed by trace id.
+func (b BodyLog) log(traceID uint64, method, path, contentType string, body []byte) {
+	shown := b.redact(contentType, body)
+	truncated := len(shown) > b.MaxBytes
+	if truncated {
+		shown = shown[:b.MaxBytes]
+	}
+	logging.Info("body trace=%016x method=%s path=%q len=%d truncated=%t body=%q",
+		traceID, method, path, len(body), truncated, shown)
+}
+
+// redact masks configured fields in JSON and form bodies; other types are logged as-is.
+// Bodies that claim a redactable type but fail to parse are withheld rather than leaked.
+func (b BodyLog) redact(contentType string, body []byte) []byte {
+	mt, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mt == "application/json" || strings.HasSuffix(mt, "+json"):
+		if len(b.RedactFields) == 0 {
+			return body
+		}
+		var v any
+		if err := json.Unmarshal(body, &v); err != nil {
+			return []byte("[unparseable json withheld]")
+		}
+		out, err := json.Marshal(b.redactValue(v))
+		if err != nil {
+			return []byte("[unparseable json withheld]")
+		}
+		return out
+	case mt == "application/x-www-form-urlencoded":
+		if len(b.RedactFields) == 0 {
+			return body
+		}
+		q, err := url.ParseQuery(string(body))
+		if err != nil {
+			return []byte("[unparseable form withheld]")
+		}
+		for k := range q {
+			if b.sensitive(k) {
+				q[k] = []string{redacted}
+			}
+		}
+		return []byte(q.Encode())
+	}
+	return body
+}
+
+func (b BodyLog) redactValue(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, inner := range t {
+			if b.sensitive(k) {
+				t[k] = redacted
+			} else {
+				t[k] = b.redactValue(inner)
+			}
+		}
+	case []any:
+		for i, inner := range t {
+			t[i] = b.redactValue(inner)
+		}
+	}
+	return v
+}
+
+func (b BodyLog) sensitive(field string) bool {
+	for _, f := range b.RedactFields {
+		if strings.EqualFold(f, field) {
+			return true
+		}
+	}
+	return false
+}
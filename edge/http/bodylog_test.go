@@ -0,0 +1,110 @@
+package http
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"olwsx/edge/logging"
+)
+
+// captureLog routes the default logger into a buffer for the duration of the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	prev := logging.Default()
+	logging.SetDefault(logging.New(&buf, logging.LevelDebug))
+	t.Cleanup(func() { logging.SetDefault(prev) })
+	return &buf
+}
+
+// bodyLogEdge logs bodies from sources (httptest requests come from 192.0.2.1).
+func bodyLogEdge(t *testing.T, enabled bool, maxBytes int, sources ...string) *testEdge {
+	return &testEdge{opts: Options{BodyLog: BodyLog{
+		Enabled:      enabled,
+		MaxBytes:     maxBytes,
+		RedactFields: []string{"password", "api_key"},
+		Sources:      mustCIDRs(t, sources...),
+	}}}
+}
+
+func postBody(e *testEdge, contentType, body string) {
+	r := httptest.NewRequest("POST", "/login", strings.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+	e.serve(r)
+}
+
+func TestBodyLogRedactsAllowlistedBodies(t *testing.T) {
+	out := captureLog(t)
+	e := bodyLogEdge(t, true, 1024, "192.0.2.0/24")
+	postBody(e, "application/json", `{"user":"ada","Password":"hunter2","nested":{"api_key":"k-123"}}`)
+	postBody(e, "application/x-www-form-urlencoded", "user=ada&password=hunter2")
+
+	got := out.String()
+	if strings.Contains(got, "hunter2") || strings.Contains(got, "k-123") {
+		t.Fatalf("secret leaked into log:\n%s", got)
+	}
+	for _, want := range []string{"trace=0000000000000abc", `path="/login"`, `\"user\":\"ada\"`, "user=ada", redacted} {
+		if !strings.Contains(got, want) {
+			t.Errorf("log missing %q:\n%s", want, got)
+		}
+	}
+	if e.actorCalls() != 2 {
+		t.Errorf("actor calls = %d", e.actorCalls())
+	}
+
+	out.Reset()
+	postBody(e, "application/json", `{"user":`)
+	if got := out.String(); !strings.Contains(got, "withheld") || strings.Contains(got, `{\"user\":`) {
+		t.Errorf("unparseable JSON logged raw:\n%s", got)
+	}
+}
+
+func TestBodyLogIsBounded(t *testing.T) {
+	out := captureLog(t)
+	postBody(bodyLogEdge(t, true, 16, "192.0.2.1/32"), "text/plain", strings.Repeat("a", 16)+strings.Repeat("b", 100))
+	got := out.String()
+	if !strings.Contains(got, "len=116 truncated=true") || !strings.Contains(got, `body="`+strings.Repeat("a", 16)+`"`) {
+		t.Errorf("log not bounded to 16 bytes:\n%s", got)
+	}
+}
+
+func TestBodyLogOffOrNotAllowlisted(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		enabled bool
+		sources []string
+	}{
+		{"disabled", false, []string{"192.0.2.0/24"}},
+		{"no sources", true, nil},
+		{"other source", true, []string{"198.51.100.0/24"}},
+	} {
+		out := captureLog(t)
+		postBody(bodyLogEdge(t, tc.enabled, 1024, tc.sources...), "text/plain", "visible?")
+		if strings.Contains(out.String(), "visible?") {
+			t.Errorf("%s: body logged:\n%s", tc.name, out)
+		}
+	}
+}
+
+func TestBodyLogMatchesProxiedClient(t *testing.T) {
+	proxied := func(e *testEdge, client string) {
+		e.opts.TrustedProxies = mustCIDRs(t, "10.0.0.1")
+		r := httptest.NewRequest("POST", "/login", strings.NewReader("from "+client))
+		r.RemoteAddr = "10.0.0.1:4000"
+		r.Header.Set("X-Forwarded-For", client)
+		e.serve(r)
+	}
+	out := captureLog(t)
+	proxied(bodyLogEdge(t, true, 1024, "203.0.113.0/24"), "203.0.113.7")
+	if !strings.Contains(out.String(), "from 203.0.113.7") {
+		t.Errorf("allowlisted client behind the proxy not logged:\n%s", out)
+	}
+
+	// The load balancer's own address is not what the allowlist matches
+	out.Reset()
+	proxied(bodyLogEdge(t, true, 1024, "10.0.0.0/8"), "198.51.100.9")
+	if strings.Contains(out.String(), "from 198.51.100.9") {
+		t.Errorf("body logged for the proxy address:\n%s", out)
+	}
+}
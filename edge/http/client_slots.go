@@ -0,0 +1,37 @@
+package http
+
+import "sync"
+
+// clientSlots caps concurrent core calls per client IP, independent of the global semaphore.
+type clientSlots struct {
+	mu    sync.Mutex
+	max   int
+	inUse map[string]int
+}
+
+func newClientSlots(max int) *clientSlots {
+	if max <= 0 {
+		return nil
+	}
+	return &clientSlots{max: max, inUse: make(map[string]int)}
+}
+
+// acquire reserves a slot for the client IP (as resolved by ClientIP, so clients behind a
+// trusted proxy are counted apart); the returned release must be called once.
+func (c *clientSlots) acquire(host string) (release func(), ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.inUse[host] >= c.max {
+		return nil, false
+	}
+	c.inUse[host]++
+	return func() {
+		c.mu.Lock()
+		if c.inUse[host] <= 1 {
+			delete(c.inUse, host) // keep the map bounded by active clients
+		} else {
+			c.inUse[host]--
+		}
+		c.mu.Unlock()
+	}, true
+}
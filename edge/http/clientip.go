@@ -0,0 +1,37 @@
+package http
+
+import (
+	"net"
+	stdhttp "net/http"
+	"strings"
+)
+
+// ClientIP resolves the originating client of r. The peer address is used unless it is a
+// trusted proxy, in which case X-Forwarded-For is walked right to left and the first hop not
+// in trusted wins; a chain made only of trusted hops resolves to its leftmost entry.
+func ClientIP(r *stdhttp.Request, trusted []*net.IPNet) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !ipInNets(host, trusted, false) {
+		return host
+	}
+	var hops []string
+	for _, v := range r.Header.Values("X-Forwarded-For") {
+		for _, h := range strings.Split(v, ",") {
+			if h = strings.TrimSpace(h); h != "" {
+				hops = append(hops, h)
+			}
+		}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		if net.ParseIP(hops[i]) == nil {
+			return host // garbage in the chain: fall back to the peer rather than trust it
+		}
+		if !ipInNets(hops[i], trusted, false) || i == 0 {
+			return hops[i]
+		}
+	}
+	return host
+}
@@ -0,0 +1,122 @@
+package http
+
+import (
+	"bytes"
+	"compress/gzip"
+	"mime"
+	stdhttp "net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Compression configures response body encoding at the edge.
+type Compression struct {
+	Enabled  bool
+	MinBytes int      // bodies smaller than this go out as-is
+	Types    []string // eligible media types; "text/" style entries match by prefix
+	Level    int      // gzip level (1-9) and brotli quality (0-11) are both clamped from this
+}
+
+// DefaultCompressibleTypes are text-like media types worth compressing.
+var DefaultCompressibleTypes = []string{
+	"text/",
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/wasm",
+	"image/svg+xml",
+}
+
+// compressBody encodes body per the client's Accept-Encoding (br preferred over gzip) when the
+// response is eligible, setting Content-Encoding and Vary. It returns body unchanged otherwise.
+func compressBody(c Compression, r *stdhttp.Request, h stdhttp.Header, status int, body []byte) []byte {
+	if !c.Enabled || len(body) < c.MinBytes || len(body) == 0 {
+		return body
+	}
+	if status < 200 || status == stdhttp.StatusNoContent || status == stdhttp.StatusNotModified || status == stdhttp.StatusPartialContent {
+		return body
+	}
+	if h.Get("Content-Encoding") != "" || !compressibleType(h.Get("Content-Type"), c.Types) {
+		return body // already encoded (or opaque like images/archives)
+	}
+	h.Add("Vary", "Accept-Encoding")
+	enc := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+	if enc == "" {
+		return body
+	}
+	var buf bytes.Buffer
+	switch enc {
+	case "br":
+		q := c.Level
+		if q < 0 || q > 11 {
+			q = 5
+		}
+		bw := brotli.NewWriterLevel(&buf, q)
+		_, _ = bw.Write(body)
+		if bw.Close() != nil {
+			return body
+		}
+	case "gzip":
+		lvl := c.Level
+		if lvl < gzip.BestSpeed || lvl > gzip.BestCompression {
+			lvl = gzip.DefaultCompression
+		}
+		gw, _ := gzip.NewWriterLevel(&buf, lvl)
+		_, _ = gw.Write(body)
+		if gw.Close() != nil {
+			return body
+		}
+	}
+	if buf.Len() >= len(body) {
+		return body
+	}
+	h.Set("Content-Encoding", enc)
+	h.Del("Content-Length")
+	if et := h.Get("ETag"); et != "" && !strings.HasPrefix(et, "W/") {
+		h.Set("ETag", "W/"+et) // encoded bytes differ from the identity representation
+	}
+	return buf.Bytes()
+}
+
+func compressibleType(ct string, types []string) bool {
+	if ct == "" {
+		return false
+	}
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+	if len(types) == 0 {
+		types = DefaultCompressibleTypes
+	}
+	for _, t := range types {
+		if mt == t || (strings.HasSuffix(t, "/") && strings.HasPrefix(mt, t)) {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateEncoding picks "br" or "gzip" from Accept-Encoding honoring q-values ("" = identity).
+func negotiateEncoding(accept string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q <= 0 || (name != "br" && name != "gzip") {
+			continue
+		}
+		if q > bestQ || (q == bestQ && name == "br") {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
@@ -0,0 +1,99 @@
+package http
+
+import (
+	"compress/gzip"
+	"io"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+// compressEdge serves body with contentType through a dispatcher compressing at 1KB and up.
+func compressEdge(contentType, body string) *testEdge {
+	return &testEdge{
+		opts: Options{Compression: Compression{Enabled: true, MinBytes: 1024, Level: 5}},
+		core: func(method, path, headers string, b []byte, traceID, spanID uint64, hints uint32) (CoreResp, int) {
+			return CoreResp{Status: 200, HeadersFlat: "Content-Type: " + contentType + "\r\n", Body: []byte(body)}, 0
+		},
+	}
+}
+
+func getEncoded(e *testEdge, accept string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", "/", nil)
+	if accept != "" {
+		r.Header.Set("Accept-Encoding", accept)
+	}
+	return e.serve(r)
+}
+
+func TestResponseCompressionNegotiation(t *testing.T) {
+	body := strings.Repeat(`{"id":1,"name":"olwsx"}`, 100)
+	e := compressEdge("application/json; charset=utf-8", body)
+	for _, tc := range []struct {
+		accept, want string
+	}{
+		{"gzip, br", "br"},
+		{"gzip", "gzip"},
+		{"br;q=0.5, gzip;q=0.8", "gzip"},
+		{"br;q=0, gzip;q=0", ""},
+		{"identity", ""},
+		{"", ""},
+	} {
+		rec := getEncoded(e, tc.accept)
+		if got := rec.Header().Get("Content-Encoding"); got != tc.want {
+			t.Errorf("Accept-Encoding %q: Content-Encoding %q, want %q", tc.accept, got, tc.want)
+			continue
+		}
+		if rec.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("Accept-Encoding %q: Vary %q", tc.accept, rec.Header().Get("Vary"))
+		}
+		var rd io.Reader = rec.Body
+		switch tc.want {
+		case "gzip":
+			zr, err := gzip.NewReader(rec.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rd = zr
+		case "br":
+			rd = brotli.NewReader(rec.Body)
+		}
+		if got, err := io.ReadAll(rd); err != nil || string(got) != body {
+			t.Errorf("Accept-Encoding %q: decoded %d bytes, %v", tc.accept, len(got), err)
+		}
+	}
+}
+
+func TestResponseCompressionSkipsSmallAndOpaqueBodies(t *testing.T) {
+	for _, tc := range []struct {
+		name, contentType, body string
+	}{
+		{"below threshold", "text/plain", strings.Repeat("a", 1023)},
+		{"image", "image/png", strings.Repeat("a", 4096)},
+		{"no content type", "", strings.Repeat("a", 4096)},
+	} {
+		rec := getEncoded(compressEdge(tc.contentType, tc.body), "gzip, br")
+		if ce := rec.Header().Get("Content-Encoding"); ce != "" || rec.Body.String() != tc.body {
+			t.Errorf("%s: Content-Encoding %q, %d body bytes", tc.name, ce, rec.Body.Len())
+		}
+	}
+}
+
+func TestResponseCompressionKeepsActorEncoding(t *testing.T) {
+	e := &testEdge{
+		opts: Options{Compression: Compression{Enabled: true}},
+		core: func(method, path, headers string, b []byte, traceID, spanID uint64, hints uint32) (CoreResp, int) {
+			return CoreResp{Status: 200, HeadersFlat: "Content-Type: text/plain\r\nContent-Encoding: gzip\r\n", Body: []byte("already")}, 0
+		},
+	}
+	rec := getEncoded(e, "br")
+	if rec.Header().Get("Content-Encoding") != "gzip" || rec.Body.String() != "already" {
+		t.Errorf("actor-encoded body rewritten: %q %q", rec.Header().Get("Content-Encoding"), rec.Body)
+	}
+	if rec.Code != stdhttp.StatusOK {
+		t.Errorf("status %d", rec.Code)
+	}
+}
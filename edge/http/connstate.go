@@ -0,0 +1,125 @@
+package http
+
+import (
+	"net"
+	stdhttp "net/http"
+	"sync"
+)
+
+// ConnTracker follows connection lifecycles through http.Server.ConnState: it reports every
+// transition for the connection gauges and closes connections beyond MaxPerIP from one peer,
+// so a client trickling headers cannot hold an unbounded share of the listener's slots.
+// One tracker may be hooked into several servers; the per-IP cap then spans all of them.
+type ConnTracker struct {
+	maxPerIP   int
+	transition func(from, to string) // from "" = new connection; to "closed" = gone
+	reject     func(reason string)
+
+	mu    sync.Mutex
+	conns map[net.Conn]trackedConn
+	perIP map[string]int
+}
+
+type trackedConn struct {
+	host    string
+	state   string
+	counted bool // holds a per-IP slot
+}
+
+// NewConnTracker caps connections per peer IP at maxPerIP (0 = unlimited). transition and
+// reject may be nil.
+func NewConnTracker(maxPerIP int, transition func(from, to string), reject func(reason string)) *ConnTracker {
+	return &ConnTracker{
+		maxPerIP:   maxPerIP,
+		transition: transition,
+		reject:     reject,
+		conns:      make(map[net.Conn]trackedConn),
+		perIP:      make(map[string]int),
+	}
+}
+
+// Hook chains t into srv.ConnState, keeping any callback already installed.
+func (t *ConnTracker) Hook(srv *stdhttp.Server) {
+	prev := srv.ConnState
+	srv.ConnState = func(c net.Conn, st stdhttp.ConnState) {
+		t.observe(c, st)
+		if prev != nil {
+			prev(c, st)
+		}
+	}
+}
+
+func (t *ConnTracker) observe(c net.Conn, st stdhttp.ConnState) {
+	to := connStateName(st)
+	t.mu.Lock()
+	tc, known := t.conns[c]
+	from := tc.state
+	limited := false
+	if !known {
+		tc.host = peerHost(c.RemoteAddr())
+		if t.maxPerIP > 0 && t.perIP[tc.host] >= t.maxPerIP {
+			limited = true
+		} else {
+			t.perIP[tc.host]++
+			tc.counted = true
+		}
+	}
+	if to == "closed" {
+		delete(t.conns, c)
+		if tc.counted {
+			if t.perIP[tc.host] <= 1 {
+				delete(t.perIP, tc.host) // keep the map bounded by connected peers
+			} else {
+				t.perIP[tc.host]--
+			}
+		}
+	} else {
+		tc.state = to
+		t.conns[c] = tc
+	}
+	t.mu.Unlock()
+
+	if t.transition != nil && from != to {
+		t.transition(from, to)
+	}
+	if limited {
+		// net/http sees the read fail and reports StateClosed, which releases the entry
+		_ = c.Close()
+		if t.reject != nil {
+			t.reject("conn_limit")
+		}
+	}
+}
+
+// Open returns the number of tracked connections from host.
+func (t *ConnTracker) Open(host string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.perIP[host]
+}
+
+// connStateName maps states to metric labels; hijacked connections (WebSocket upgrades)
+// leave the server and are reported closed.
+func connStateName(st stdhttp.ConnState) string {
+	switch st {
+	case stdhttp.StateNew:
+		return "new"
+	case stdhttp.StateActive:
+		return "active"
+	case stdhttp.StateIdle:
+		return "idle"
+	default:
+		return "closed"
+	}
+}
+
+func peerHost(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
@@ -0,0 +1,130 @@
+package http
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubConn is a connection from a fixed peer that records Close.
+type stubConn struct {
+	net.Conn
+	peer   string
+	closed bool
+}
+
+func (c *stubConn) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.ParseIP(c.peer), Port: 40000}
+}
+func (c *stubConn) Close() error { c.closed = true; return nil }
+
+func TestConnTrackerTransitionsAndCap(t *testing.T) {
+	var moves, rejects []string
+	tr := NewConnTracker(2,
+		func(from, to string) { moves = append(moves, from+">"+to) },
+		func(reason string) { rejects = append(rejects, reason) })
+	a, b, c := &stubConn{peer: "192.0.2.1"}, &stubConn{peer: "192.0.2.1"}, &stubConn{peer: "192.0.2.1"}
+	other := &stubConn{peer: "198.51.100.1"}
+
+	tr.observe(a, stdhttp.StateNew)
+	tr.observe(a, stdhttp.StateActive)
+	tr.observe(a, stdhttp.StateIdle)
+	tr.observe(b, stdhttp.StateNew)
+	if strings.Join(moves, " ") != ">new new>active active>idle >new" {
+		t.Errorf("transitions = %v", moves)
+	}
+	if tr.Open("192.0.2.1") != 2 {
+		t.Errorf("open = %d", tr.Open("192.0.2.1"))
+	}
+
+	// A third connection from the same peer is closed; other peers are unaffected
+	tr.observe(c, stdhttp.StateNew)
+	if !c.closed || len(rejects) != 1 || rejects[0] != "conn_limit" || tr.Open("192.0.2.1") != 2 {
+		t.Errorf("over the cap: closed=%v rejects=%v open=%d", c.closed, rejects, tr.Open("192.0.2.1"))
+	}
+	tr.observe(c, stdhttp.StateClosed)
+	if tr.Open("192.0.2.1") != 2 {
+		t.Errorf("closing a rejected connection released a slot: open=%d", tr.Open("192.0.2.1"))
+	}
+	tr.observe(other, stdhttp.StateNew)
+	if other.closed {
+		t.Error("other peer limited")
+	}
+
+	// Closed and hijacked connections free their slots
+	tr.observe(a, stdhttp.StateClosed)
+	tr.observe(b, stdhttp.StateHijacked)
+	if tr.Open("192.0.2.1") != 0 || len(tr.perIP) != 1 {
+		t.Errorf("after close: open=%d perIP=%v", tr.Open("192.0.2.1"), tr.perIP)
+	}
+	d := &stubConn{peer: "192.0.2.1"}
+	tr.observe(d, stdhttp.StateNew)
+	if d.closed {
+		t.Error("slot not reusable after close")
+	}
+}
+
+func TestConnTrackerCapsRealServer(t *testing.T) {
+	var mu sync.Mutex
+	var rejects []string
+	tr := NewConnTracker(2, nil, func(reason string) { mu.Lock(); rejects = append(rejects, reason); mu.Unlock() })
+	srv := httptest.NewUnstartedServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	tr.Hook(srv.Config)
+	srv.Start()
+	defer srv.Close()
+
+	dial := func() net.Conn {
+		c, err := net.Dial("tcp", srv.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { c.Close() })
+		return c
+	}
+	get := func(c net.Conn) error {
+		c.SetDeadline(time.Now().Add(2 * time.Second))
+		if _, err := fmt.Fprint(c, "GET / HTTP/1.1\r\nHost: x\r\n\r\n"); err != nil {
+			return err
+		}
+		resp, err := stdhttp.ReadResponse(bufio.NewReader(c), nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	held := []net.Conn{dial(), dial()}
+	for _, c := range held {
+		if err := get(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := get(dial()); err == nil {
+		t.Error("third connection from the same IP was served")
+	}
+	mu.Lock()
+	if len(rejects) != 1 || rejects[0] != "conn_limit" {
+		t.Errorf("rejects = %v", rejects)
+	}
+	mu.Unlock()
+
+	// Once a held connection closes, a new one is admitted
+	held[0].Close()
+	for deadline := time.Now().Add(2 * time.Second); tr.Open("127.0.0.1") > 1; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("closed connection still counted")
+		}
+	}
+	if err := get(dial()); err != nil {
+		t.Errorf("connection after a slot freed: %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package http
+
+import (
+	stdhttp "net/http"
+	"strings"
+)
+
+// CookiePolicy upgrades actor Set-Cookie headers with attributes they lack.
+// Attributes already present are never changed, so cookies keep their own choices
+// for anything the policy leaves off.
+type CookiePolicy struct {
+	Secure   bool
+	HttpOnly bool
+	SameSite string   // "Lax", "Strict" or "None"; "" leaves SameSite alone
+	Exempt   []string // cookie names passed through untouched
+}
+
+// apply rewrites every Set-Cookie value in h according to p.
+func (p CookiePolicy) apply(h stdhttp.Header) {
+	if !p.Secure && !p.HttpOnly && p.SameSite == "" {
+		return
+	}
+	cookies := h.Values("Set-Cookie")
+	for i, c := range cookies {
+		cookies[i] = p.upgrade(c)
+	}
+}
+
+func (p CookiePolicy) upgrade(cookie string) string {
+	parts := strings.Split(cookie, ";")
+	name, _, _ := strings.Cut(parts[0], "=")
+	for _, e := range p.Exempt {
+		if strings.TrimSpace(name) == e {
+			return cookie
+		}
+	}
+	has := map[string]string{}
+	for _, attr := range parts[1:] {
+		k, v, _ := strings.Cut(strings.TrimSpace(attr), "=")
+		has[strings.ToLower(k)] = v
+	}
+	out := cookie
+	sameSite, hasSameSite := has["samesite"]
+	if p.SameSite != "" && !hasSameSite {
+		out += "; SameSite=" + p.SameSite
+		sameSite = p.SameSite
+	}
+	// Browsers reject SameSite=None without Secure
+	if _, ok := has["secure"]; !ok && (p.Secure || strings.EqualFold(sameSite, "none")) {
+		out += "; Secure"
+	}
+	if _, ok := has["httponly"]; p.HttpOnly && !ok {
+		out += "; HttpOnly"
+	}
+	return out
+}
@@ -0,0 +1,55 @@
+package http
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func cookieEdge(p CookiePolicy, cookies ...string) []string {
+	var flat strings.Builder
+	for _, c := range cookies {
+		flat.WriteString("Set-Cookie: " + c + "\r\n")
+	}
+	e := &testEdge{
+		opts: Options{Cookies: p},
+		core: func(method, path, headers string, body []byte, traceID, spanID uint64, hints uint32) (CoreResp, int) {
+			return CoreResp{Status: 200, HeadersFlat: flat.String()}, 0
+		},
+	}
+	return e.serve(httptest.NewRequest("GET", "/", nil)).Result().Header.Values("Set-Cookie")
+}
+
+func TestCookiePolicyZeroLeavesCookiesAlone(t *testing.T) {
+	in := []string{"sid=1; Path=/", "pref=dark; SameSite=None"}
+	got := cookieEdge(CookiePolicy{}, in...)
+	if strings.Join(got, "|") != strings.Join(in, "|") {
+		t.Errorf("Set-Cookie = %q, want unchanged %q", got, in)
+	}
+}
+
+func TestCookiePolicyAddsMissingAttributes(t *testing.T) {
+	got := cookieEdge(CookiePolicy{Secure: true, HttpOnly: true, SameSite: "Lax", Exempt: []string{"js"}},
+		"sid=1; Path=/",
+		"theme=dark; SameSite=Strict; HttpOnly",
+		"js=visible",
+	)
+	want := []string{
+		"sid=1; Path=/; SameSite=Lax; Secure; HttpOnly",
+		"theme=dark; SameSite=Strict; HttpOnly; Secure",
+		"js=visible",
+	}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Set-Cookie =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestCookiePolicySameSiteNoneForcesSecure(t *testing.T) {
+	got := cookieEdge(CookiePolicy{SameSite: "None"}, "sid=1")
+	if len(got) != 1 || got[0] != "sid=1; SameSite=None; Secure" {
+		t.Errorf("Set-Cookie = %q", got)
+	}
+	if got := cookieEdge(CookiePolicy{HttpOnly: true}, "sid=1; samesite=none"); got[0] != "sid=1; samesite=none; Secure; HttpOnly" {
+		t.Errorf("actor SameSite=None without Secure: %q", got[0])
+	}
+}
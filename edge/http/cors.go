@@ -0,0 +1,115 @@
+package http
+
+import (
+	stdhttp "net/http"
+	"strconv"
+	"strings"
+)
+
+// CORSPolicy controls cross-origin access to the edge.
+type CORSPolicy struct {
+	Enabled          bool
+	AllowedOrigins   []string // exact origins, "https://*.example.com" wildcards, or "*"
+	AllowedMethods   []string
+	AllowedHeaders   []string // empty = reflect the preflight's requested headers
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAgeSeconds    int
+}
+
+// CORS answers preflights itself and decorates actual responses for allowed origins.
+// Requests from disallowed origins get no CORS headers (preflights get 403).
+func CORS(p CORSPolicy, next stdhttp.Handler) stdhttp.Handler {
+	if !p.Enabled {
+		return next
+	}
+	methods := strings.Join(p.AllowedMethods, ", ")
+	allowedHeaders := strings.Join(p.AllowedHeaders, ", ")
+	exposed := strings.Join(p.ExposedHeaders, ", ")
+	return stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		preflight := r.Method == stdhttp.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if !p.originAllowed(origin) {
+			if preflight {
+				stdhttp.Error(w, "CORS origin not allowed", stdhttp.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		if p.AllowCredentials || !p.wildcard() {
+			h.Set("Access-Control-Allow-Origin", origin) // credentials forbid "*"
+		} else {
+			h.Set("Access-Control-Allow-Origin", "*")
+		}
+		if p.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			if exposed != "" {
+				h.Set("Access-Control-Expose-Headers", exposed)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		reqMethod := r.Header.Get("Access-Control-Request-Method")
+		if !containsFold(p.AllowedMethods, reqMethod) {
+			stdhttp.Error(w, "CORS method not allowed", stdhttp.StatusForbidden)
+			return
+		}
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+		h.Set("Access-Control-Allow-Methods", methods)
+		if allowedHeaders != "" {
+			h.Set("Access-Control-Allow-Headers", allowedHeaders)
+		} else if rh := r.Header.Get("Access-Control-Request-Headers"); rh != "" {
+			h.Set("Access-Control-Allow-Headers", rh)
+		}
+		if p.MaxAgeSeconds > 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(p.MaxAgeSeconds))
+		}
+		w.WriteHeader(stdhttp.StatusNoContent)
+	})
+}
+
+func (p CORSPolicy) wildcard() bool {
+	for _, o := range p.AllowedOrigins {
+		if o == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (p CORSPolicy) originAllowed(origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, a := range p.AllowedOrigins {
+		a = strings.ToLower(strings.TrimSuffix(a, "/"))
+		if a == "*" || a == origin {
+			return true
+		}
+		if scheme, host, ok := strings.Cut(a, "://*."); ok {
+			prefix := scheme + "://"
+			if strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, "."+host) &&
+				len(origin) > len(prefix)+len(host)+1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
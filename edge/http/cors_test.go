@@ -0,0 +1,102 @@
+package http
+
+import (
+	stdhttp "net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var testCORS = CORSPolicy{
+	Enabled:        true,
+	AllowedOrigins: []string{"https://app.example.com", "https://*.example.org"},
+	AllowedMethods: []string{"GET", "POST", "PUT"},
+	ExposedHeaders: []string{"X-Trace-ID"},
+	MaxAgeSeconds:  600,
+}
+
+func corsServe(p CORSPolicy, e *testEdge, r *stdhttp.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	CORS(p, e.handler()).ServeHTTP(rec, r)
+	return rec
+}
+
+func preflight(origin, method, headers string) *stdhttp.Request {
+	r := httptest.NewRequest("OPTIONS", "/api", nil)
+	r.Header.Set("Origin", origin)
+	r.Header.Set("Access-Control-Request-Method", method)
+	if headers != "" {
+		r.Header.Set("Access-Control-Request-Headers", headers)
+	}
+	return r
+}
+
+func TestCORSPreflightAnsweredAtEdge(t *testing.T) {
+	e := &testEdge{}
+	rec := corsServe(testCORS, e, preflight("https://app.example.com", "PUT", "X-Custom"))
+	h := rec.Header()
+	if rec.Code != stdhttp.StatusNoContent || e.actorCalls() != 0 {
+		t.Fatalf("status %d, actor calls %d", rec.Code, e.actorCalls())
+	}
+	for name, want := range map[string]string{
+		"Access-Control-Allow-Origin":  "https://app.example.com",
+		"Access-Control-Allow-Methods": "GET, POST, PUT",
+		"Access-Control-Allow-Headers": "X-Custom", // reflected when none are configured
+		"Access-Control-Max-Age":       "600",
+	} {
+		if got := h.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if h.Get("Access-Control-Allow-Credentials") != "" {
+		t.Error("credentials allowed without AllowCredentials")
+	}
+
+	// Wildcard subdomains, and methods outside the policy
+	if rec := corsServe(testCORS, e, preflight("https://a.example.org", "GET", "")); rec.Code != stdhttp.StatusNoContent {
+		t.Errorf("wildcard subdomain preflight: status %d", rec.Code)
+	}
+	if rec := corsServe(testCORS, e, preflight("https://app.example.com", "DELETE", "")); rec.Code != stdhttp.StatusForbidden {
+		t.Errorf("DELETE preflight: status %d", rec.Code)
+	}
+}
+
+func TestCORSSimpleRequestDecorated(t *testing.T) {
+	e := &testEdge{}
+	r := httptest.NewRequest("GET", "/api", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	rec := corsServe(testCORS, e, r)
+	if rec.Code != stdhttp.StatusOK || e.actorCalls() != 1 {
+		t.Fatalf("status %d, actor calls %d", rec.Code, e.actorCalls())
+	}
+	h := rec.Header()
+	if h.Get("Access-Control-Allow-Origin") != "https://app.example.com" || h.Get("Access-Control-Expose-Headers") != "X-Trace-ID" || h.Get("Vary") != "Origin" {
+		t.Errorf("headers %v", h)
+	}
+
+	// Credentials echo the origin instead of "*"
+	p := testCORS
+	p.AllowedOrigins, p.AllowCredentials = []string{"*"}, true
+	rec = corsServe(p, e, r)
+	if rec.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" || rec.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("credentialed wildcard: %v", rec.Header())
+	}
+	p.AllowCredentials = false
+	if got := corsServe(p, e, r).Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("public wildcard: Allow-Origin %q", got)
+	}
+}
+
+func TestCORSDisallowedOrigin(t *testing.T) {
+	e := &testEdge{}
+	if rec := corsServe(testCORS, e, preflight("https://evil.example.com", "GET", "")); rec.Code != stdhttp.StatusForbidden || e.actorCalls() != 0 {
+		t.Errorf("preflight: status %d, actor calls %d", rec.Code, e.actorCalls())
+	}
+	for _, origin := range []string{"https://evil.example.com", "https://example.org", "http://app.example.com"} {
+		r := httptest.NewRequest("GET", "/api", nil)
+		r.Header.Set("Origin", origin)
+		rec := corsServe(testCORS, e, r)
+		if rec.Code != stdhttp.StatusOK || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("%s: status %d, Allow-Origin %q", origin, rec.Code, rec.Header().Get("Access-Control-Allow-Origin"))
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package http
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	stdhttp "net/http"
+	"strings"
+)
+
+var (
+	errBodyTooLarge        = errors.New("request body too large")
+	errUnsupportedEncoding = errors.New("unsupported content-encoding")
+	errInflatedTooLarge    = errors.New("decompressed body too large")
+	errMalformedBody       = errors.New("malformed compressed body")
+)
+
+// inflateBody replaces a gzip/deflate encoded r.Body with its decoded stream, capped at
+// maxBytes decoded bytes (decompression bombs surface as errInflatedTooLarge on read).
+// Content-Encoding and Content-Length are stripped so the actor sees a plain body. Nothing is
+// read here: the body stays untouched (and an Expect: 100-continue client uninvited) until
+// the dispatcher reads it after its checks. Only an unknown encoding fails up front.
+func inflateBody(r *stdhttp.Request, maxBytes int) error {
+	enc := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	if enc == "" || enc == "identity" {
+		return nil
+	}
+	var dec io.Reader
+	switch enc {
+	case "gzip", "x-gzip":
+		dec = &lazyGzip{src: r.Body}
+	case "deflate":
+		dec = &lazyDeflate{src: r.Body}
+	default:
+		return errUnsupportedEncoding
+	}
+	r.Body = io.NopCloser(&cappedReader{r: dec, left: int64(maxBytes), over: errInflatedTooLarge, decoded: true})
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	r.ContentLength = -1
+	return nil
+}
+
+// lazyGzip defers gzip.NewReader, which reads the member header, to the first Read.
+type lazyGzip struct {
+	src io.Reader
+	zr  *gzip.Reader
+}
+
+func (l *lazyGzip) Read(p []byte) (int, error) {
+	if l.zr == nil {
+		zr, err := gzip.NewReader(l.src)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF // an empty body is not a gzip stream
+		}
+		if err != nil {
+			return 0, err
+		}
+		l.zr = zr
+	}
+	return l.zr.Read(p)
+}
+
+// lazyDeflate decodes "deflate", which RFC 9110 defines as the zlib format; senders that
+// emit raw DEFLATE (no zlib header) are still accepted. The header is inspected on first Read.
+type lazyDeflate struct {
+	src io.Reader
+	dr  io.Reader
+}
+
+func (l *lazyDeflate) Read(p []byte) (int, error) {
+	if l.dr == nil {
+		br := bufio.NewReader(l.src)
+		hdr, err := br.Peek(2)
+		if err == io.EOF && len(hdr) == 0 {
+			err = io.ErrUnexpectedEOF // an empty body is not a deflate stream
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		if isZlibHeader(hdr) {
+			zr, err := zlib.NewReader(br)
+			if err != nil {
+				return 0, err
+			}
+			l.dr = zr
+		} else {
+			l.dr = flate.NewReader(br)
+		}
+	}
+	return l.dr.Read(p)
+}
+
+// isZlibHeader reports whether hdr is a zlib CMF/FLG pair: method 8 (deflate), window <= 32K
+// and a check value making the pair a multiple of 31 (RFC 1950 §2.2).
+func isZlibHeader(hdr []byte) bool {
+	if len(hdr) < 2 {
+		return false
+	}
+	return hdr[0]&0x0f == 8 && hdr[0]>>4 <= 7 && (uint16(hdr[0])<<8|uint16(hdr[1]))%31 == 0
+}
+
+// cappedReader fails with over instead of truncating once more than left bytes are produced:
+// it reads one byte past the cap to tell "exactly at the limit" from "over it". On decoded
+// streams other failures (except the raw body's own cap) surface as errMalformedBody.
+type cappedReader struct {
+	r       io.Reader
+	left    int64
+	over    error
+	decoded bool
+}
+
+func (c *cappedReader) Read(p []byte) (int, error) {
+	if c.left < 0 {
+		return 0, c.over
+	}
+	if int64(len(p)) > c.left+1 {
+		p = p[:c.left+1]
+	}
+	n, err := c.r.Read(p)
+	c.left -= int64(n)
+	if c.left < 0 {
+		return n, c.over
+	}
+	if c.decoded && err != nil && err != io.EOF && !errors.Is(err, errBodyTooLarge) {
+		return n, errMalformedBody
+	}
+	return n, err
+}
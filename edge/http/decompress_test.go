@@ -0,0 +1,103 @@
+package http
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// inflateEdge forwards to an actor that records the body and headers it receives.
+func inflateEdge(decompress bool, bodyBytes int, gotBody, gotHeaders *string) *testEdge {
+	return &testEdge{
+		limits: Limits{BodyBytes: bodyBytes},
+		opts:   Options{DecompressRequests: decompress},
+		core: func(method, path, headers string, body []byte, traceID, spanID uint64, hints uint32) (CoreResp, int) {
+			*gotBody, *gotHeaders = string(body), headers
+			return CoreResp{Status: 200}, 0
+		},
+	}
+}
+
+func encodedPost(encoding string, body []byte) *stdhttp.Request {
+	r := httptest.NewRequest("POST", "/", bytes.NewReader(body))
+	r.Header.Set("Content-Encoding", encoding)
+	return r
+}
+
+func TestCompressedRequestBodyIsInflated(t *testing.T) {
+	var zlibbed, rawDeflated bytes.Buffer
+	zw := zlib.NewWriter(&zlibbed)
+	zw.Write([]byte("hello deflate"))
+	zw.Close()
+	fw, _ := flate.NewWriter(&rawDeflated, flate.BestSpeed)
+	fw.Write([]byte("hello raw deflate"))
+	fw.Close()
+	for _, tc := range []struct {
+		encoding string
+		body     []byte
+		want     string
+	}{
+		{"gzip", gzipped(t, "hello gzip"), "hello gzip"},
+		{"x-gzip", gzipped(t, "hello x-gzip"), "hello x-gzip"},
+		{"deflate", zlibbed.Bytes(), "hello deflate"},
+		{"deflate", rawDeflated.Bytes(), "hello raw deflate"}, // legacy senders omit the zlib header
+	} {
+		var body, headers string
+		e := inflateEdge(true, 1<<20, &body, &headers)
+		if rec := e.serve(encodedPost(tc.encoding, tc.body)); rec.Code != stdhttp.StatusOK {
+			t.Errorf("%s: status %d", tc.encoding, rec.Code)
+		}
+		if body != tc.want || strings.Contains(headers, "Content-Encoding") {
+			t.Errorf("%s: actor got body %q, headers %q", tc.encoding, body, headers)
+		}
+	}
+}
+
+func TestDecompressionBombIsCapped(t *testing.T) {
+	bomb := gzipped(t, strings.Repeat("\x00", 1<<20))
+	if len(bomb) > 64<<10 {
+		t.Fatalf("bomb is %d bytes compressed; want it under the limit", len(bomb))
+	}
+	var body, headers string
+	e := inflateEdge(true, 64<<10, &body, &headers)
+	if rec := e.serve(encodedPost("gzip", bomb)); rec.Code != stdhttp.StatusRequestEntityTooLarge || e.actorCalls() != 0 {
+		t.Errorf("bomb: status %d, actor calls %d", rec.Code, e.actorCalls())
+	}
+	if got := e.rejected(); len(got) != 1 || got[0] != "body_too_large" {
+		t.Errorf("rejects = %v", got)
+	}
+}
+
+func TestMalformedCompressedBodyIsRejected(t *testing.T) {
+	valid := gzipped(t, strings.Repeat("payload ", 100))
+	for _, tc := range []struct {
+		name, encoding string
+		body           []byte
+		want           int
+	}{
+		{"garbage", "gzip", []byte("definitely not gzip"), stdhttp.StatusBadRequest},
+		{"truncated", "gzip", valid[:len(valid)/2], stdhttp.StatusBadRequest},
+		{"empty deflate", "deflate", nil, stdhttp.StatusBadRequest},
+		{"unsupported", "zstd", valid, stdhttp.StatusUnsupportedMediaType},
+	} {
+		var body, headers string
+		e := inflateEdge(true, 1<<20, &body, &headers)
+		if rec := e.serve(encodedPost(tc.encoding, tc.body)); rec.Code != tc.want || e.actorCalls() != 0 {
+			t.Errorf("%s: status %d (want %d), actor calls %d", tc.name, rec.Code, tc.want, e.actorCalls())
+		}
+	}
+}
+
+func TestCompressedBodyForwardedWhenDecompressionOff(t *testing.T) {
+	raw := gzipped(t, "opaque")
+	var body, headers string
+	e := inflateEdge(false, 1<<20, &body, &headers)
+	e.serve(encodedPost("gzip", raw))
+	if body != string(raw) || !strings.Contains(headers, "Content-Encoding: gzip") {
+		t.Errorf("actor got %d bytes, headers %q", len(body), headers)
+	}
+}
@@ -2,12 +2,16 @@ package http
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	stdhttp "net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"olwsx/edge/logging"
 	"olwsx/edge/wire"
 )
 
@@ -17,19 +21,124 @@ type CoreResp struct {
 	HeadersFlat string
 	Body        []byte
 	MetaFlags   uint32
+	Reason      string // custom reason phrase (HTTP/1.1 only); empty = standard
 }
 
+// Limits bounds what the dispatcher accepts and forwards.
+type Limits struct {
+	HeaderBytes          int // total flattened header bytes
+	HeaderValueBytes     int // any single header value
+	BodyBytes            int
+	MaxInFlight          int // concurrent core calls; 0 = unbounded
+	MaxInFlightPerClient int // concurrent core calls per client IP; 0 = unbounded
+	RetryAfter           int // Retry-After seconds on rate-limited, 429 and 503 answers; 0 = 1
+
+	// BodyBytesByPrefix overrides BodyBytes for request paths under a prefix (longest prefix wins).
+	BodyBytesByPrefix map[string]int
+}
+
+// bodyLimit resolves the body cap for path.
+func (l Limits) bodyLimit(path string) int {
+	limit, best := l.BodyBytes, -1
+	for prefix, n := range l.BodyBytesByPrefix {
+		if len(prefix) > best && strings.HasPrefix(path, prefix) {
+			limit, best = n, len(prefix)
+		}
+	}
+	return limit
+}
+
+// Options carries optional response-shaping behaviour of the dispatcher.
+type Options struct {
+	Compression Compression
+
+	// ETags adds validators to GET/HEAD responses, answers matching conditionals with 304, and
+	// checks If-Match on writes against a preflight GET (412 on mismatch).
+	ETags bool
+
+	// DecompressRequests inflates gzip/deflate request bodies (bounded by the body limit) before forwarding.
+	DecompressRequests bool
+
+	// StaleCache serves recent actor-marked GET responses (with Warning: 110) when the actor call fails.
+	StaleCache StaleCache
+
+	// Methods rejects methods outside the allowlist with 405 before any actor call.
+	Methods MethodPolicy
+
+	// Cookies adds Secure/HttpOnly/SameSite to actor Set-Cookie headers that lack them.
+	Cookies CookiePolicy
+
+	// Errors renders edge-generated error responses; nil = PlainErrors.
+	Errors ErrorRenderer
+
+	// BodyLog logs redacted request body prefixes for allowlisted clients (off by default).
+	BodyLog BodyLog
+
+	// InspectBody scans the buffered request body before the actor call; a match is flagged
+	// exactly like a WAFCheck match. nil = no body inspection.
+	InspectBody func(contentType string, body []byte) (blocked bool, rule string)
+
+	// Allowlist clients (resolved by ClientIP through TrustedProxies) skip the WAF, rate limit
+	// and challenge checks entirely. Empty = nobody.
+	Allowlist      []*net.IPNet
+	TrustedProxies []*net.IPNet
+
+	// Geo rejects clients by country with 403 before the actor call.
+	Geo GeoPolicy
+
+	// Cleared reports whether the client (IP resolved by ClientIP) holds a valid challenge
+	// clearance; cleared clients skip ChallengeCheck. nil = nobody is cleared.
+	Cleared func(r *stdhttp.Request, clientIP string) bool
+
+	// AltSvc is sent as the Alt-Svc header on h1/h2 responses to advertise HTTP/3 (see AltSvcH3).
+	AltSvc string
+
+	// RequestID names the request-ID header (e.g. X-Request-ID): a well-formed client value is
+	// kept, anything else replaced by a generated one, which is forwarded to the actor, echoed
+	// on the response and logged. "" = off.
+	RequestID string
+
+	// Version is sent as the VersionHeader on every response (e.g. "1.4.0 (3f2a9c1)"); "" = off.
+	Version string
+}
+
+// AltSvcH3 builds an Alt-Svc value advertising h3 on listenAddr's port, e.g. `h3=":8443"; ma=86400`.
+func AltSvcH3(listenAddr string, maxAge time.Duration) string {
+	_, port, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		port = strings.TrimPrefix(listenAddr, ":")
+	}
+	return fmt.Sprintf(`h3=":%s"; ma=%d`, port, int64(maxAge/time.Second))
+}
+
+// CoreVersionMismatch is the CoreCaller code for an actor speaking an unsupported protocol version.
+const CoreVersionMismatch = 6
+
+// WAFTimeout is the WAFCheck rule for an evaluation that ran out of time; it counts as a block.
+const WAFTimeout = "waf_timeout"
+
+// VersionHeader names the edge build on responses when Options.Version is set.
+const VersionHeader = "X-Olwsx-Version"
+
+// WAFRuleHeader carries the matched WAF rule to the actor (hint HintWAFBlocked is set as well).
+const WAFRuleHeader = "X-Olwsx-Waf-Rule"
+
+// ActorSpanHeader is an optional actor response header naming the actor's own span for the
+// request; it is relayed to the client and recorded in the access log next to the edge's
+// trace and span IDs.
+const ActorSpanHeader = "X-Olwsx-Actor-Span"
+
 type CoreCaller func(method, path, headers string, body []byte, traceID, spanID uint64, hints uint32) (CoreResp, int)
 type IDGen func() (uint64, uint64)
-type RateCheck func(remote string) bool
-type WAFCheck func(path, ua string) bool
-type ChallengeCheck func(remote string) bool
-type AccessLogger func(method, path string, status, bodyLen int, hints uint32, dur time.Duration, remote, ua string)
-type MetricReject func(reason string)
-type MetricError func(name string)
+type RateCheck func(clientIP string) bool
+type WAFCheck func(path, ua string, header stdhttp.Header) (blocked bool, rule string)
+type ChallengeCheck func(r *stdhttp.Request, clientIP string) (puzzle []byte, issued bool) // issued = answer 403 with the JSON puzzle
+type AccessLogger func(method, path, transport string, status, bodyLen int, hints uint32, wafRule string, dur time.Duration, remote, ua string, traceID, spanID uint64, requestID, actorSpan string)
+type MetricReject func(reason string, traceID uint64)
+type MetricError func(name string, traceID uint64)
 
 // Handler wires normalization, limits, waf, rate-limit hooks, tracing, and calls into actor/core via CoreCaller.
-func Handler(maxHeaderBytes, maxBodyBytes int,
+func Handler(limits Limits, opts Options,
 	rateCheck RateCheck,
 	wafCheck WAFCheck,
 	challengeCheck ChallengeCheck,
@@ -39,91 +148,324 @@ func Handler(maxHeaderBytes, maxBodyBytes int,
 	metricReject MetricReject,
 	metricError MetricError,
 ) stdhttp.Handler {
+	// Semaphore shedding load instead of queuing when the actor is saturated
+	var inflight chan struct{}
+	if limits.MaxInFlight > 0 {
+		inflight = make(chan struct{}, limits.MaxInFlight)
+	}
+	perClient := newClientSlots(limits.MaxInFlightPerClient)
+	stale := newStaleCache(opts.StaleCache)
+	retryAfter := strconv.Itoa(max(limits.RetryAfter, 1))
+	render := opts.Errors
+	if render == nil {
+		render = PlainErrors
+	}
 	return stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
 		start := time.Now()
 
-		// Hard body limit
-		if r.ContentLength > int64(maxBodyBytes) && r.ContentLength >= 0 {
-			errorTooLarge(w, "Body too large")
-			metricReject("body_too_large")
+		// IDs first so every response, including early rejections, carries X-Trace-ID
+		traceID, spanID := newIDs()
+		w.Header().Set("X-Trace-ID", fmt.Sprintf("%016x", traceID))
+		if opts.Version != "" {
+			w.Header().Set(VersionHeader, opts.Version)
+		}
+		var requestID string
+		if opts.RequestID != "" {
+			requestID = RequestID(r.Header.Get(opts.RequestID), traceID, spanID)
+			r.Header.Set(opts.RequestID, requestID)
+			w.Header().Set(opts.RequestID, requestID)
+		}
+		var hints uint32   // security hints
+		var wafRule string // matched WAF rule, "" = none
+		transport := transportOf(r)
+		if opts.AltSvc != "" && transport != "h3" {
+			w.Header().Set("Alt-Svc", opts.AltSvc)
+		}
+		fail := func(status int, msg string) {
+			render(w, r, status, msg, traceID)
+			if accessLog != nil {
+				accessLog(r.Method, r.URL.RequestURI(), transport, status, len(msg), hints, wafRule, time.Since(start), r.RemoteAddr, r.UserAgent(), traceID, spanID, requestID, "")
+			}
+		}
+
+		// Method allowlist (per-route overrides)
+		if ok, allow := opts.Methods.permits(r.Method, r.URL.Path); !ok {
+			w.Header().Set("Allow", allow)
+			fail(stdhttp.StatusMethodNotAllowed, "Method not allowed")
+			metricReject("method_not_allowed", traceID)
 			return
 		}
-		r.Body = io.NopCloser(io.LimitReader(r.Body, int64(maxBodyBytes)))
 
-		// Security hints
-		var hints uint32
+		// Expect: only 100-continue is supported; the interim response is deferred until checks pass
+		expectContinue := false
+		if exp := r.Header.Get("Expect"); exp != "" {
+			if !strings.EqualFold(strings.TrimSpace(exp), "100-continue") {
+				fail(stdhttp.StatusExpectationFailed, "Unsupported expectation")
+				metricReject("expectation_failed", traceID)
+				return
+			}
+			expectContinue = true
+			r.Header.Del("Expect") // consumed by the edge, not forwarded
+		}
 
-		// Challenge gate
-		if challengeCheck != nil && challengeCheck(r.RemoteAddr) {
-			hints |= wire.HintChallenged
+		// Hard body limit (per-path override); rejected uploads never receive 100 Continue
+		maxBody := limits.bodyLimit(r.URL.Path)
+		if r.ContentLength > int64(maxBody) && r.ContentLength >= 0 {
+			fail(stdhttp.StatusRequestEntityTooLarge, "Body too large")
+			metricReject("body_too_large", traceID)
+			return
+		}
+		// Bodies without (or lying about) Content-Length fail at the cap instead of being truncated
+		r.Body = io.NopCloser(&cappedReader{r: r.Body, left: int64(maxBody), over: errBodyTooLarge})
+		if opts.DecompressRequests {
+			// Malformed or oversized compressed bodies surface when the body is read below
+			if err := inflateBody(r, maxBody); err != nil {
+				fail(stdhttp.StatusUnsupportedMediaType, "Unsupported Content-Encoding")
+				metricReject("bad_content_encoding", traceID)
+				return
+			}
 		}
 
-		// WAF-lite
-		if wafCheck != nil && wafCheck(r.URL.RequestURI(), r.UserAgent()) {
+		// Country rules are a compliance control, so they apply to allowlisted clients too
+		client := ClientIP(r, opts.TrustedProxies)
+		if opts.Geo.blocks(client) {
+			fail(stdhttp.StatusForbidden, "Forbidden")
+			metricReject("geo_blocked", traceID)
+			return
+		}
+
+		// Allowlisted clients bypass the security checks below
+		allowed := len(opts.Allowlist) > 0 && ipInNets(client, opts.Allowlist, false)
+
+		// Challenge gate: uncleared clients get a puzzle instead of the actor
+		if challengeCheck != nil && !allowed && !(opts.Cleared != nil && opts.Cleared(r, client)) {
+			if puzzle, issued := challengeCheck(r, client); issued {
+				hints |= wire.HintChallenged
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Cache-Control", "no-store")
+				w.WriteHeader(stdhttp.StatusForbidden)
+				_, _ = w.Write(puzzle)
+				if accessLog != nil {
+					accessLog(r.Method, r.URL.RequestURI(), transport, stdhttp.StatusForbidden, len(puzzle), hints, wafRule, time.Since(start), r.RemoteAddr, r.UserAgent(), traceID, spanID, requestID, "")
+				}
+				metricReject("challenge_issued", traceID)
+				return
+			}
+		}
+
+		// WAF-lite; the matched rule travels to the actor as a request header and into the access log
+		r.Header.Del(WAFRuleHeader) // never trust a client-supplied verdict
+		flagWAF := func(blocked bool, rule string) {
+			if !blocked || wafRule != "" {
+				return
+			}
 			hints |= wire.HintWAFBlocked
+			wafRule = rule
+			r.Header.Set(WAFRuleHeader, rule)
+			if rule == WAFTimeout {
+				metricReject("waf_timeout", traceID)
+			} else {
+				metricReject("waf_blocked", traceID)
+			}
+		}
+		if wafCheck != nil && !allowed {
+			flagWAF(wafCheck(r.URL.RequestURI(), r.UserAgent(), r.Header))
 		}
 
-		// Rate limit
-		if rateCheck != nil && rateCheck(r.RemoteAddr) {
+		// Rate limit, per client IP so clients behind a trusted proxy get their own buckets
+		if rateCheck != nil && !allowed && rateCheck(client) {
 			hints |= wire.HintRateLimited
-			w.Header().Set("Retry-After", fmt.Sprintf("%d", 1))
+			w.Header().Set("Retry-After", retryAfter)
 		}
 
 		// Normalize headers
-		method, path, headersFlat, hdrSize := Normalize(r, maxHeaderBytes)
-		if hdrSize > maxHeaderBytes {
-			errorTooLarge(w, "Headers too large")
-			metricReject("headers_too_large")
+		method, path, headersFlat, hdrSize, oversized := Normalize(r, limits.HeaderBytes, limits.HeaderValueBytes)
+		if oversized != "" {
+			// Log the header name only; the value may carry credentials.
+			logging.Warn("reject header_value_too_large header=%q remote=%s", oversized, r.RemoteAddr)
+			fail(stdhttp.StatusRequestHeaderFieldsTooLarge, "Header value too large")
+			metricReject("header_value_too_large", traceID)
+			return
+		}
+		if hdrSize > limits.HeaderBytes {
+			fail(stdhttp.StatusRequestHeaderFieldsTooLarge, "Headers too large")
+			metricReject("headers_too_large", traceID)
 			return
 		}
 
-		// Read body
+		// HEAD is forwarded as GET so actors need no HEAD handlers; the body is dropped on the way out
+		head := method == stdhttp.MethodHead
+		if head {
+			method = stdhttp.MethodGet
+			hints |= wire.HintHead
+		}
+
+		// Actor call slots, per client then global. A client waiting on 100 Continue gets them
+		// before its body is invited, so a refused upload is never sent; everyone else takes
+		// them once the body is in, so slow uploads do not hold actor capacity.
+		var releases []func()
+		defer func() {
+			for _, release := range releases {
+				release()
+			}
+		}()
+		acquireSlots := func() bool {
+			if perClient != nil {
+				release, ok := perClient.acquire(client)
+				if !ok {
+					w.Header().Set("Retry-After", retryAfter)
+					fail(stdhttp.StatusTooManyRequests, "Too many concurrent requests")
+					metricReject("client_in_flight", traceID)
+					return false
+				}
+				releases = append(releases, release)
+			}
+			if inflight != nil {
+				select {
+				case inflight <- struct{}{}:
+					releases = append(releases, func() { <-inflight })
+				default:
+					w.Header().Set("Retry-After", retryAfter)
+					fail(stdhttp.StatusServiceUnavailable, "Core saturated")
+					metricReject("core_saturated", traceID)
+					return false
+				}
+			}
+			return true
+		}
+
+		// Read body, inviting it first when the client is waiting on 100 Continue
+		slotsHeld := false
+		if expectContinue && r.ContentLength != 0 {
+			if !acquireSlots() {
+				return
+			}
+			slotsHeld = true
+			w.WriteHeader(stdhttp.StatusContinue)
+		}
 		var bodyBuf bytes.Buffer
 		if _, err := bodyBuf.ReadFrom(r.Body); err != nil {
-			errorBadGateway(w, "Read body failed")
-			metricError("read_body_error")
+			switch {
+			case errors.Is(err, errBodyTooLarge):
+				fail(stdhttp.StatusRequestEntityTooLarge, "Body too large")
+				metricReject("body_too_large", traceID)
+				return
+			case errors.Is(err, errInflatedTooLarge):
+				fail(stdhttp.StatusRequestEntityTooLarge, "Decompressed body too large")
+				metricReject("body_too_large", traceID)
+				return
+			case errors.Is(err, errMalformedBody):
+				fail(stdhttp.StatusBadRequest, "Malformed compressed body")
+				metricReject("bad_content_encoding", traceID)
+				return
+			}
+			fail(stdhttp.StatusBadGateway, "Read body failed")
+			metricError("read_body_error", traceID)
 			return
 		}
 		bodyBytes := bodyBuf.Bytes()
 
-		// IDs
-		traceID, spanID := newIDs()
+		if opts.InspectBody != nil && !allowed && wafRule == "" {
+			if blocked, rule := opts.InspectBody(r.Header.Get("Content-Type"), bodyBytes); blocked {
+				flagWAF(blocked, rule)
+				// Headers were flattened before the body was read: redo it so the rule header sorts
+				// into place and counts against the header limit like any other
+				_, _, headersFlat, hdrSize, _ = Normalize(r, limits.HeaderBytes, limits.HeaderValueBytes)
+				if hdrSize > limits.HeaderBytes {
+					fail(stdhttp.StatusRequestHeaderFieldsTooLarge, "Headers too large")
+					metricReject("headers_too_large", traceID)
+					return
+				}
+			}
+		}
+
+		if opts.BodyLog.wants(client, bodyBytes) {
+			opts.BodyLog.log(traceID, method, path, r.Header.Get("Content-Type"), bodyBytes)
+		}
 
 		// Core/Actor call
+		if !slotsHeld && !acquireSlots() {
+			return
+		}
+		if ifMatch := r.Header.Get("If-Match"); opts.ETags && ifMatch != "" && isWrite(method) {
+			cur, code := coreCall(stdhttp.MethodGet, path, preflightHeaders(r.Header), nil, traceID, spanID, hints)
+			if code == 0 && ifMatchFails(ifMatch, cur) {
+				fail(stdhttp.StatusPreconditionFailed, "Precondition failed")
+				metricReject("precondition_failed", traceID)
+				return
+			}
+		}
 		resp, code := coreCall(method, path, headersFlat, bodyBytes, traceID, spanID, hints)
+		if code == CoreVersionMismatch {
+			logging.Error("core/actor protocol version mismatch method=%s path=%q trace=%016x", method, path, traceID)
+			metricError("version_mismatch", traceID)
+		} else if code != 0 {
+			metricError("core_actor_error", traceID)
+		}
 		if code != 0 {
-			errorBadGateway(w, fmt.Sprintf("Core/Actor error: %d", code))
-			metricError("core_actor_error")
-			return
+			cached, ok := stale.lookup(method, path)
+			if !ok {
+				fail(stdhttp.StatusBadGateway, fmt.Sprintf("Core/Actor error: %d", code))
+				return
+			}
+			resp = cached
+			w.Header().Set("Warning", `110 - "Response is Stale"`)
+		} else {
+			stale.store(method, path, resp)
 		}
 
 		// Emit response
-		for _, hv := range ParseFlat(resp.HeadersFlat) {
-			parts := strings.SplitN(hv, ":", 2)
-			if len(parts) == 2 {
-				w.Header().Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
-			}
+		for _, f := range EndToEndFields(ParseFlatFields(resp.HeadersFlat)) {
+			w.Header().Add(f.Name, f.Value)
 		}
-		w.Header().Set("X-Trace-ID", fmt.Sprintf("%016x", traceID))
-		w.WriteHeader(resp.Status)
-		if len(resp.Body) > 0 {
-			_, _ = w.Write(resp.Body)
+		opts.Cookies.apply(w.Header())
+		if opts.ETags {
+			applyConditional(r, w.Header(), &resp)
+		}
+		applyRange(r, w.Header(), &resp)
+		resp.Body = compressBody(opts.Compression, r, w.Header(), resp.Status, resp.Body)
+		if !writeWithReason(w, r, resp) {
+			// The body is fully buffered, so its final length (after range and compression) is
+			// authoritative over any Content-Length the actor sent; HEAD reports the GET length.
+			if bodyAllowed(resp.Status) {
+				w.Header().Set("Content-Length", strconv.Itoa(len(resp.Body)))
+			} else {
+				w.Header().Del("Content-Length")
+			}
+			w.WriteHeader(resp.Status)
+			if len(resp.Body) > 0 && !head {
+				_, _ = w.Write(resp.Body)
+			}
 		}
 
 		// Access log
 		if accessLog != nil {
-			accessLog(method, path, resp.Status, len(resp.Body), hints, time.Since(start), r.RemoteAddr, r.UserAgent())
+			accessLog(r.Method, path, transport, resp.Status, len(resp.Body), hints, wafRule, time.Since(start), r.RemoteAddr, r.UserAgent(),
+				traceID, spanID, requestID, flatHeaderValue(resp.HeadersFlat, ActorSpanHeader))
 		}
 	})
 }
 
-func errorTooLarge(w stdhttp.ResponseWriter, msg string) {
-	w.Header().Set("Content-Type", "text/plain")
-	w.WriteHeader(stdhttp.StatusRequestEntityTooLarge)
-	_, _ = w.Write([]byte(msg))
+// transportOf names the protocol a request arrived on: "h1", "h2" or "h3".
+func transportOf(r *stdhttp.Request) string {
+	switch r.ProtoMajor {
+	case 3:
+		return "h3"
+	case 2:
+		return "h2"
+	}
+	return "h1"
+}
+
+func isWrite(method string) bool {
+	switch method {
+	case stdhttp.MethodPut, stdhttp.MethodPatch, stdhttp.MethodDelete, stdhttp.MethodPost:
+		return true
+	}
+	return false
+}
+
+// bodyAllowed reports whether a response with status may carry a body (RFC 9110 §6.4.1).
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != stdhttp.StatusNoContent && status != stdhttp.StatusNotModified
 }
-func errorBadGateway(w stdhttp.ResponseWriter, msg string) {
-	w.Header().Set("Content-Type", "text/plain")
-	w.WriteHeader(stdhttp.StatusBadGateway)
-	_, _ = w.Write([]byte(msg))
-}
\ No newline at end of file
@@ -0,0 +1,894 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"olwsx/edge/wire"
+)
+
+// testEdge assembles a dispatcher Handler with test doubles. Zero fields get permissive
+// defaults: generous limits and an actor answering 200 "ok".
+type testEdge struct {
+	limits    Limits
+	opts      Options
+	rate      RateCheck
+	waf       WAFCheck
+	challenge ChallengeCheck
+	core      CoreCaller
+	log       AccessLogger
+
+	mu      sync.Mutex
+	rejects []string
+	errors  []string
+	calls   int
+}
+
+func (e *testEdge) handler() stdhttp.Handler {
+	if e.limits.HeaderBytes == 0 {
+		e.limits.HeaderBytes = 64 << 10
+	}
+	if e.limits.BodyBytes == 0 {
+		e.limits.BodyBytes = 1 << 20
+	}
+	core := e.core
+	if core == nil {
+		core = func(method, path, headers string, body []byte, traceID, spanID uint64, hints uint32) (CoreResp, int) {
+			return CoreResp{Status: 200, HeadersFlat: "Content-Type: text/plain\r\n", Body: []byte("ok")}, 0
+		}
+	}
+	counted := func(method, path, headers string, body []byte, traceID, spanID uint64, hints uint32) (CoreResp, int) {
+		e.mu.Lock()
+		e.calls++
+		e.mu.Unlock()
+		return core(method, path, headers, body, traceID, spanID, hints)
+	}
+	return Handler(e.limits, e.opts, e.rate, e.waf, e.challenge, counted,
+		func() (uint64, uint64) { return 0xabc, 0xdef },
+		e.log,
+		func(reason string, traceID uint64) {
+			e.mu.Lock()
+			e.rejects = append(e.rejects, reason)
+			e.mu.Unlock()
+		},
+		func(reason string, traceID uint64) {
+			e.mu.Lock()
+			e.errors = append(e.errors, reason)
+			e.mu.Unlock()
+		})
+}
+
+// serve runs one request through a fresh handler.
+func (e *testEdge) serve(r *stdhttp.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	e.handler().ServeHTTP(rec, r)
+	return rec
+}
+
+func (e *testEdge) rejected() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.rejects...)
+}
+
+func (e *testEdge) errored() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.errors...)
+}
+
+func (e *testEdge) actorCalls() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.calls
+}
+
+func mustCIDRs(t *testing.T, list ...string) []*net.IPNet {
+	t.Helper()
+	nets, err := ParseCIDRs(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nets
+}
+
+func TestPerClientCapKeysOnClientBehindTrustedProxy(t *testing.T) {
+	entered := make(chan struct{}, 4)
+	unblock := make(chan struct{})
+	e := &testEdge{
+		limits: Limits{MaxInFlightPerClient: 1},
+		opts:   Options{TrustedProxies: mustCIDRs(t, "10.0.0.1")},
+		core: func(method, path, headers string, body []byte, traceID, spanID uint64, hints uint32) (CoreResp, int) {
+			entered <- struct{}{}
+			<-unblock
+			return CoreResp{Status: 200}, 0
+		},
+	}
+	h := e.handler()
+	viaProxy := func(client string) *stdhttp.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = "10.0.0.1:4000"
+		r.Header.Set("X-Forwarded-For", client)
+		return r
+	}
+
+	// Two clients behind the same proxy each hold their own slot
+	var wg sync.WaitGroup
+	codes := make(chan int, 2)
+	for _, client := range []string{"203.0.113.1", "203.0.113.2"} {
+		wg.Add(1)
+		go func(r *stdhttp.Request) {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+			codes <- rec.Code
+		}(viaProxy(client))
+	}
+	<-entered
+	<-entered
+
+	// A second request from a client already in flight is refused
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, viaProxy("203.0.113.1"))
+	if rec.Code != stdhttp.StatusTooManyRequests {
+		t.Errorf("second request from the same client: status %d, want 429", rec.Code)
+	}
+	close(unblock)
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		if code != 200 {
+			t.Errorf("proxied client got %d, want 200", code)
+		}
+	}
+	if got := strings.Join(e.rejected(), ","); got != "client_in_flight" {
+		t.Errorf("rejects = %q", got)
+	}
+}
+
+func TestRateLimitKeysOnClientBehindTrustedProxy(t *testing.T) {
+	var keys []string
+	e := &testEdge{
+		opts: Options{TrustedProxies: mustCIDRs(t, "10.0.0.0/8")},
+		rate: func(clientIP string) bool { keys = append(keys, clientIP); return false },
+	}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.1.2.3:5555"
+	r.Header.Set("X-Forwarded-For", "198.51.100.7, 10.9.9.9")
+	e.serve(r)
+	r = httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "192.0.2.9:5555"
+	r.Header.Set("X-Forwarded-For", "198.51.100.7") // untrusted peer: header ignored
+	e.serve(r)
+	if got := strings.Join(keys, ","); got != "198.51.100.7,192.0.2.9" {
+		t.Errorf("rate limit keys = %q", got)
+	}
+}
+
+// firstStatusLine sends raw request headers (no body) and returns the first status line the
+// server answers with, which is "HTTP/1.1 100 Continue" when the body is invited.
+func firstStatusLine(t *testing.T, conn net.Conn, br *bufio.Reader, req string) string {
+	t.Helper()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.WriteString(conn, req); err != nil {
+		t.Fatal(err)
+	}
+	line, err := br.ReadString('\n')
+	if err != nil {
+		t.Fatalf("no response: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n")
+}
+
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	io.WriteString(zw, s)
+	zw.Close()
+	return b.Bytes()
+}
+
+func TestExpectContinueNotSentForRejectedCompressedUpload(t *testing.T) {
+	e := &testEdge{opts: Options{
+		DecompressRequests: true,
+		Geo:                GeoPolicy{Country: func(net.IP) (string, error) { return "XX", nil }, Deny: []string{"XX"}},
+	}}
+	ts := httptest.NewServer(e.handler())
+	defer ts.Close()
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	line := firstStatusLine(t, conn, bufio.NewReader(conn),
+		"POST /up HTTP/1.1\r\nHost: x\r\nContent-Encoding: gzip\r\nContent-Length: 100\r\nExpect: 100-continue\r\n\r\n")
+	if line != "HTTP/1.1 403 Forbidden" {
+		t.Errorf("first status line = %q, want the 403 without 100 Continue", line)
+	}
+}
+
+func TestExpectContinueNotSentWhenSlotsAreTaken(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		limits Limits
+		want   string
+	}{
+		{"per-client", Limits{MaxInFlightPerClient: 1}, "HTTP/1.1 429 Too Many Requests"},
+		{"global", Limits{MaxInFlight: 1}, "HTTP/1.1 503 Service Unavailable"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			entered, unblock := make(chan struct{}), make(chan struct{})
+			e := &testEdge{limits: tc.limits, core: func(method, path, headers string, body []byte, traceID, spanID uint64, hints uint32) (CoreResp, int) {
+				if path == "/slow" {
+					close(entered)
+					<-unblock
+				}
+				return CoreResp{Status: 200}, 0
+			}}
+			ts := httptest.NewServer(e.handler())
+			defer ts.Close()
+			go stdhttp.Get(ts.URL + "/slow")
+			<-entered
+			defer close(unblock)
+
+			conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			line := firstStatusLine(t, conn, bufio.NewReader(conn),
+				"POST /up HTTP/1.1\r\nHost: x\r\nContent-Length: 5\r\nExpect: 100-continue\r\n\r\n")
+			if line != tc.want {
+				t.Errorf("first status line = %q, want %q", line, tc.want)
+			}
+		})
+	}
+}
+
+func TestExpectContinueInvitesAcceptedCompressedUpload(t *testing.T) {
+	var got string
+	e := &testEdge{
+		opts: Options{DecompressRequests: true},
+		core: func(method, path, headers string, body []byte, traceID, spanID uint64, hints uint32) (CoreResp, int) {
+			got = string(body)
+			return CoreResp{Status: 200}, 0
+		},
+	}
+	ts := httptest.NewServer(e.handler())
+	defer ts.Close()
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	body := gzipped(t, "hello actor")
+	line := firstStatusLine(t, conn, br, fmt.Sprintf(
+		"POST /up HTTP/1.1\r\nHost: x\r\nContent-Encoding: gzip\r\nContent-Length: %d\r\nExpect: 100-continue\r\n\r\n", len(body)))
+	if line != "HTTP/1.1 100 Continue" {
+		t.Fatalf("first status line = %q, want 100 Continue", line)
+	}
+	for line != "" { // interim response headers, up to the blank line
+		l, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimRight(l, "\r\n")
+	}
+	conn.Write(body)
+	resp, err := stdhttp.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 || got != "hello actor" {
+		t.Errorf("status %d, actor body %q", resp.StatusCode, got)
+	}
+}
+
+func TestEmptyGzipBodyIsMalformed(t *testing.T) {
+	e := &testEdge{opts: Options{DecompressRequests: true}}
+	r := httptest.NewRequest("POST", "/", strings.NewReader(""))
+	r.Header.Set("Content-Encoding", "gzip")
+	if rec := e.serve(r); rec.Code != stdhttp.StatusBadRequest {
+		t.Errorf("status %d, want 400", rec.Code)
+	}
+}
+
+func TestRetryAfterFollowsLimits(t *testing.T) {
+	for _, tc := range []struct {
+		retryAfter int
+		want       string
+	}{{0, "1"}, {7, "7"}} {
+		e := &testEdge{
+			limits: Limits{RetryAfter: tc.retryAfter},
+			rate:   func(string) bool { return true },
+		}
+		if got := e.serve(httptest.NewRequest("GET", "/", nil)).Header().Get("Retry-After"); got != tc.want {
+			t.Errorf("RetryAfter %d: Retry-After %q, want %q", tc.retryAfter, got, tc.want)
+		}
+	}
+}
+
+func TestOversizedHeaderValueIsRejected(t *testing.T) {
+	e := &testEdge{limits: Limits{HeaderValueBytes: 64}}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Cookie", strings.Repeat("x", 65))
+	rec := e.serve(r)
+	if rec.Code != stdhttp.StatusRequestHeaderFieldsTooLarge || e.actorCalls() != 0 {
+		t.Fatalf("oversized Cookie: status %d, actor calls %d", rec.Code, e.actorCalls())
+	}
+	if got := e.rejected(); len(got) != 1 || got[0] != "header_value_too_large" {
+		t.Errorf("rejects = %v", got)
+	}
+
+	// A value at the cap is fine
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Cookie", strings.Repeat("x", 64))
+	if rec := e.serve(r); rec.Code != stdhttp.StatusOK {
+		t.Errorf("Cookie at the cap: status %d", rec.Code)
+	}
+}
+
+func TestInFlightCapShedsTheNextRequest(t *testing.T) {
+	const n = 3
+	entered := make(chan struct{}, n)
+	unblock := make(chan struct{})
+	e := &testEdge{
+		limits: Limits{MaxInFlight: n},
+		core: func(method, path, headers string, body []byte, traceID, spanID uint64, hints uint32) (CoreResp, int) {
+			entered <- struct{}{}
+			<-unblock
+			return CoreResp{Status: 200}, 0
+		},
+	}
+	h := e.handler()
+	codes := make(chan int, n)
+	for i := 0; i < n; i++ {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = fmt.Sprintf("192.0.2.%d:1234", i+1)
+		go func() {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+			codes <- rec.Code
+		}()
+	}
+	for i := 0; i < n; i++ {
+		<-entered
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != stdhttp.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("request %d: status %d, Retry-After %q", n+1, rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if got := e.rejected(); len(got) != 1 || got[0] != "core_saturated" {
+		t.Errorf("rejects = %v", got)
+	}
+
+	close(unblock)
+	for i := 0; i < n; i++ {
+		if code := <-codes; code != stdhttp.StatusOK {
+			t.Errorf("admitted request: status %d", code)
+		}
+	}
+	// Released slots admit new requests
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != stdhttp.StatusOK {
+		t.Errorf("after release: status %d", rec.Code)
+	}
+}
+
+func TestBodyLimitFollowsLongestPathPrefix(t *testing.T) {
+	e := &testEdge{limits: Limits{BodyBytes: 10, BodyBytesByPrefix: map[string]int{"/upload": 100, "/upload/avatar": 5}}}
+	for _, tc := range []struct {
+		path    string
+		size    int
+		chunked bool
+		want    int
+	}{
+		{"/api", 10, false, stdhttp.StatusOK},
+		{"/api", 50, false, stdhttp.StatusRequestEntityTooLarge},
+		{"/api", 50, true, stdhttp.StatusRequestEntityTooLarge}, // no Content-Length: caught while reading
+		{"/upload/file", 50, false, stdhttp.StatusOK},
+		{"/upload/file", 50, true, stdhttp.StatusOK},
+		{"/upload/file", 101, true, stdhttp.StatusRequestEntityTooLarge},
+		{"/upload/avatar", 6, false, stdhttp.StatusRequestEntityTooLarge},
+	} {
+		var body io.Reader = strings.NewReader(strings.Repeat("x", tc.size))
+		if tc.chunked {
+			body = io.MultiReader(body) // hides the length from NewRequest
+		}
+		r := httptest.NewRequest("POST", tc.path, body)
+		if got := e.serve(r).Code; got != tc.want {
+			t.Errorf("POST %s with %d bytes (chunked %v): status %d, want %d", tc.path, tc.size, tc.chunked, got, tc.want)
+		}
+	}
+}
+
+func TestActorVersionMismatchIsBadGateway(t *testing.T) {
+	e := &testEdge{core: func(method, path, headers string, body []byte, traceID, spanID uint64, hints uint32) (CoreResp, int) {
+		return CoreResp{}, CoreVersionMismatch
+	}}
+	rec := e.serve(httptest.NewRequest("GET", "/", nil))
+	if rec.Code != stdhttp.StatusBadGateway {
+		t.Errorf("status %d", rec.Code)
+	}
+	if got := e.errored(); len(got) != 1 || got[0] != "version_mismatch" {
+		t.Errorf("error metrics = %v, want [version_mismatch]", got)
+	}
+
+	e.core = func(method, path, headers string, body []byte, traceID, spanID uint64, hints uint32) (CoreResp, int) {
+		return CoreResp{}, 5
+	}
+	e.errors = nil
+	e.serve(httptest.NewRequest("GET", "/", nil))
+	if got := e.errored(); len(got) != 1 || got[0] != "core_actor_error" {
+		t.Errorf("generic failure metrics = %v", got)
+	}
+}
+
+func TestWAFVerdictTravelsToActor(t *testing.T) {
+	var gotHints uint32
+	var gotHeaders string
+	e := &testEdge{
+		core: func(method, path, headers string, body []byte, traceID, spanID uint64, hints uint32) (CoreResp, int) {
+			gotHints, gotHeaders = hints, headers
+			return CoreResp{Status: 200}, 0
+		},
+	}
+	for _, tc := range []struct{ rule, reject string }{{"path:path_traversal", "waf_blocked"}, {WAFTimeout, "waf_timeout"}} {
+		e.waf = func(path, ua string, h stdhttp.Header) (bool, string) { return true, tc.rule }
+		e.rejects = nil
+		r := httptest.NewRequest("GET", "/x", nil)
+		r.Header.Set(WAFRuleHeader, "spoofed")
+		e.serve(r)
+		if gotHints&wire.HintWAFBlocked == 0 || !strings.Contains(gotHeaders, WAFRuleHeader+": "+tc.rule+"\r\n") || strings.Contains(gotHeaders, "spoofed") {
+			t.Errorf("%s: hints %#x, headers %q", tc.rule, gotHints, gotHeaders)
+		}
+		if rej := e.rejected(); len(rej) != 1 || rej[0] != tc.reject {
+			t.Errorf("%s: rejects %v, want [%s]", tc.rule, rej, tc.reject)
+		}
+	}
+
+	// A clean verdict forwards no rule, and a client cannot forge one
+	e.waf = func(path, ua string, h stdhttp.Header) (bool, string) { return false, "" }
+	r := httptest.NewRequest("GET", "/x", nil)
+	r.Header.Set(WAFRuleHeader, "spoofed")
+	e.serve(r)
+	if gotHints&wire.HintWAFBlocked != 0 || strings.Contains(gotHeaders, WAFRuleHeader) {
+		t.Errorf("clean request: hints %#x, headers %q", gotHints, gotHeaders)
+	}
+}
+
+func TestBodyWAFFlagsWithoutConsumingBody(t *testing.T) {
+	var gotBody []byte
+	var gotHints uint32
+	var gotHeaders string
+	e := &testEdge{
+		opts: Options{InspectBody: func(contentType string, body []byte) (bool, string) {
+			if strings.Contains(string(body), "UNION SELECT") {
+				return true, "body:sqli_union"
+			}
+			return false, ""
+		}},
+		core: func(method, path, headers string, body []byte, traceID, spanID uint64, hints uint32) (CoreResp, int) {
+			gotBody, gotHints, gotHeaders = body, hints, headers
+			return CoreResp{Status: 200}, 0
+		},
+	}
+	for _, tc := range []struct {
+		body string
+		rule string
+	}{
+		{`{"q":"1 UNION SELECT pw FROM users"}`, "body:sqli_union"},
+		{`{"q":"harmless"}`, ""},
+	} {
+		e.rejects = nil
+		r := httptest.NewRequest("POST", "/search", strings.NewReader(tc.body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("Zz-After", "1") // sorts after the rule header
+		e.serve(r)
+		if want, _ := FlattenHeaders(r.Header); gotHeaders != want {
+			t.Errorf("%s: headers %q, want the sorted flattening %q", tc.body, gotHeaders, want)
+		}
+		if string(gotBody) != tc.body {
+			t.Errorf("actor got body %q, want %q", gotBody, tc.body)
+		}
+		flagged := gotHints&wire.HintWAFBlocked != 0
+		if flagged != (tc.rule != "") || (tc.rule != "" && !strings.Contains(gotHeaders, WAFRuleHeader+": "+tc.rule+"\r\n")) {
+			t.Errorf("%s: hints %#x, headers %q", tc.body, gotHints, gotHeaders)
+		}
+		if rej := e.rejected(); (tc.rule != "") != (len(rej) == 1 && rej[0] == "waf_blocked") {
+			t.Errorf("%s: rejects %v", tc.body, rej)
+		}
+	}
+}
+
+func TestBodyWAFRuleHeaderCountsAgainstHeaderLimit(t *testing.T) {
+	r := httptest.NewRequest("POST", "/search", strings.NewReader("<script>"))
+	_, size := FlattenHeaders(r.Header)
+	e := &testEdge{
+		limits: Limits{HeaderBytes: size + 8}, // room for the request's headers, not the rule's
+		opts:   Options{InspectBody: func(string, []byte) (bool, string) { return true, "body:xss_script" }},
+	}
+	if rec := e.serve(r); rec.Code != stdhttp.StatusRequestHeaderFieldsTooLarge || e.actorCalls() != 0 {
+		t.Errorf("status %d, actor calls %d; want 431 before the actor", rec.Code, e.actorCalls())
+	}
+	if rej := e.rejected(); len(rej) != 2 || rej[1] != "headers_too_large" {
+		t.Errorf("rejects = %v", rej)
+	}
+}
+
+func TestWAFRuleReachesAccessLog(t *testing.T) {
+	var logged []string
+	e := &testEdge{
+		waf: func(path, ua string, h stdhttp.Header) (bool, string) {
+			if strings.Contains(ua, "sqlmap") {
+				return true, "ua:sqlmap"
+			}
+			return false, ""
+		},
+		opts: Options{InspectBody: func(string, []byte) (bool, string) { return true, "body:xss_script" }},
+		log: func(method, path, transport string, status, bodyLen int, hints uint32, wafRule string, dur time.Duration, remote, ua string, traceID, spanID uint64, requestID, actorSpan string) {
+			logged = append(logged, wafRule)
+		},
+	}
+	r := httptest.NewRequest("POST", "/", strings.NewReader("<script>"))
+	r.Header.Set("User-Agent", "sqlmap/1.7")
+	e.serve(r)
+	e.serve(httptest.NewRequest("POST", "/", strings.NewReader("<script>")))
+	// The request-line verdict wins over the body scan, which only runs when nothing matched yet
+	if strings.Join(logged, ",") != "ua:sqlmap,body:xss_script" {
+		t.Errorf("access log rules = %q", logged)
+	}
+}
+
+func TestAllowlistBypassesSecurityChecks(t *testing.T) {
+	var seen []uint32
+	e := &testEdge{
+		opts: Options{
+			Allowlist:      mustCIDRs(t, "10.1.0.0/16"),
+			TrustedProxies: mustCIDRs(t, "10.0.0.1"),
+			InspectBody:    func(string, []byte) (bool, string) { return true, "body:any" },
+		},
+		rate:      func(string) bool { return true },
+		waf:       func(path, ua string, h stdhttp.Header) (bool, string) { return true, "path:any" },
+		challenge: func(*stdhttp.Request, string) ([]byte, bool) { return []byte(`{"puzzle":1}`), true },
+		core: func(method, path, headers string, body []byte, traceID, spanID uint64, hints uint32) (CoreResp, int) {
+			seen = append(seen, hints)
+			return CoreResp{Status: 200}, 0
+		},
+	}
+	request := func(remote, xff string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/", strings.NewReader("body"))
+		r.RemoteAddr = remote
+		if xff != "" {
+			r.Header.Set("X-Forwarded-For", xff)
+		}
+		return e.serve(r)
+	}
+
+	// Directly, and through a trusted proxy
+	for _, tc := range []struct{ remote, xff string }{{"10.1.2.3:5000", ""}, {"10.0.0.1:5000", "10.1.9.9"}} {
+		seen = nil
+		rec := request(tc.remote, tc.xff)
+		if rec.Code != 200 || len(seen) != 1 || seen[0]&(wire.HintWAFBlocked|wire.HintRateLimited|wire.HintChallenged) != 0 {
+			t.Errorf("allowlisted %s (xff %q): status %d, hints %v", tc.remote, tc.xff, rec.Code, seen)
+		}
+		if rec.Header().Get("Retry-After") != "" {
+			t.Errorf("allowlisted %s was rate limited", tc.remote)
+		}
+	}
+	if rej := e.rejected(); len(rej) != 0 {
+		t.Errorf("allowlisted requests rejected: %v", rej)
+	}
+
+	// Others are checked, including one spoofing an allowlisted X-Forwarded-For
+	for _, tc := range []struct{ remote, xff string }{{"192.0.2.1:5000", ""}, {"192.0.2.1:5000", "10.1.2.3"}} {
+		seen = nil
+		if rec := request(tc.remote, tc.xff); rec.Code != stdhttp.StatusForbidden || len(seen) != 0 {
+			t.Errorf("%s (xff %q): status %d, actor hints %v; want the challenge", tc.remote, tc.xff, rec.Code, seen)
+		}
+	}
+	e.challenge = nil
+	seen = nil
+	request("192.0.2.1:5000", "")
+	if len(seen) != 1 || seen[0]&wire.HintWAFBlocked == 0 || seen[0]&wire.HintRateLimited == 0 {
+		t.Errorf("unlisted client hints %v, want WAF and rate-limit flags", seen)
+	}
+}
+
+func TestAltSvcAdvertisedOnH1AndH2(t *testing.T) {
+	if got := AltSvcH3(":8443", 24*time.Hour); got != `h3=":8443"; ma=86400` {
+		t.Errorf("AltSvcH3 = %q", got)
+	}
+	if got := AltSvcH3("[::1]:443", time.Minute); got != `h3=":443"; ma=60` {
+		t.Errorf("AltSvcH3 ipv6 = %q", got)
+	}
+
+	e := &testEdge{
+		opts: Options{AltSvc: `h3=":8443"; ma=86400`},
+		core: func(method, path, headers string, body []byte, traceID, spanID uint64, hints uint32) (CoreResp, int) {
+			if path == "/down" {
+				return CoreResp{}, -1
+			}
+			return CoreResp{Status: 200}, 0
+		},
+	}
+	for _, tc := range []struct {
+		major      int
+		path, want string
+	}{
+		{1, "/", `h3=":8443"; ma=86400`},
+		{2, "/", `h3=":8443"; ma=86400`},
+		{1, "/down", `h3=":8443"; ma=86400`}, // error responses too
+		{3, "/", ""},                         // already on h3
+	} {
+		r := httptest.NewRequest("GET", tc.path, nil)
+		r.ProtoMajor = tc.major
+		rec := e.serve(r)
+		if got := rec.Header().Get("Alt-Svc"); got != tc.want {
+			t.Errorf("HTTP/%d %s (status %d): Alt-Svc %q, want %q", tc.major, tc.path, rec.Code, got, tc.want)
+		}
+	}
+	if got := (&testEdge{}).serve(httptest.NewRequest("GET", "/", nil)).Header().Get("Alt-Svc"); got != "" {
+		t.Errorf("Alt-Svc %q without HTTP/3", got)
+	}
+}
+
+func TestHopByHopHeadersDroppedBothWays(t *testing.T) {
+	var sent string
+	e := &testEdge{core: func(method, path, headers string, body []byte, traceID, spanID uint64, hints uint32) (CoreResp, int) {
+		sent = headers
+		return CoreResp{Status: 200, Body: []byte("ok"),
+			HeadersFlat: "Connection: X-Actor-Hop\r\nKeep-Alive: timeout=9\r\nX-Actor-Hop: 1\r\nTransfer-Encoding: chunked\r\nUpgrade: websocket\r\nX-End: kept\r\n"}, 0
+	}}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Connection", "X-Client-Hop")
+	r.Header.Set("X-Client-Hop", "1")
+	r.Header.Set("Keep-Alive", "timeout=5")
+	r.Header.Set("Te", "trailers")
+	r.Header.Set("Proxy-Authorization", "Basic x")
+	r.Header.Set("X-Keep", "yes")
+	rec := e.serve(r)
+
+	for _, hop := range []string{"Connection", "X-Client-Hop", "Keep-Alive", "Te:", "Proxy-Authorization"} {
+		if strings.Contains(sent, hop) {
+			t.Errorf("%s forwarded to the actor:\n%s", hop, sent)
+		}
+	}
+	if !strings.Contains(sent, "X-Keep: yes\r\n") {
+		t.Errorf("end-to-end header dropped on the way in:\n%s", sent)
+	}
+	h := rec.Header()
+	for _, hop := range []string{"Connection", "Keep-Alive", "X-Actor-Hop", "Transfer-Encoding", "Upgrade"} {
+		if h.Get(hop) != "" {
+			t.Errorf("%s relayed to the client: %v", hop, h)
+		}
+	}
+	if h.Get("X-End") != "kept" || rec.Body.String() != "ok" {
+		t.Errorf("response: %v %q", h, rec.Body)
+	}
+}
+
+func TestHEADMatchesGETWithoutBody(t *testing.T) {
+	var methods []string
+	var hints []uint32
+	e := &testEdge{core: func(method, path, headers string, body []byte, traceID, spanID uint64, h uint32) (CoreResp, int) {
+		methods, hints = append(methods, method), append(hints, h)
+		if path == "/empty" {
+			return CoreResp{Status: 204}, 0
+		}
+		return CoreResp{Status: 200, HeadersFlat: "Content-Type: text/plain\r\nX-Page: 1\r\n", Body: []byte("hello, world")}, 0
+	}}
+	srv := httptest.NewServer(e.handler())
+	defer srv.Close()
+
+	fetch := func(method, path string) (*stdhttp.Response, []byte) {
+		req, _ := stdhttp.NewRequest(method, srv.URL+path, nil)
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, body
+	}
+	get, getBody := fetch("GET", "/page")
+	head, headBody := fetch("HEAD", "/page")
+	if len(headBody) != 0 || string(getBody) != "hello, world" {
+		t.Errorf("GET body %q, HEAD body %q", getBody, headBody)
+	}
+	if head.StatusCode != get.StatusCode || head.ContentLength != int64(len(getBody)) {
+		t.Errorf("HEAD status %d length %d, GET status %d length %d", head.StatusCode, head.ContentLength, get.StatusCode, len(getBody))
+	}
+	for _, k := range []string{"Content-Type", "X-Page", "Content-Length"} {
+		if head.Header.Get(k) != get.Header.Get(k) {
+			t.Errorf("%s: HEAD %q, GET %q", k, head.Header.Get(k), get.Header.Get(k))
+		}
+	}
+	if methods[1] != "GET" || hints[1]&wire.HintHead == 0 || hints[0]&wire.HintHead != 0 {
+		t.Errorf("actor saw methods %v hints %v, want HEAD forwarded as GET with HintHead", methods, hints)
+	}
+
+	// No Content-Length is invented for statuses that never carry a body
+	if resp, _ := fetch("HEAD", "/empty"); resp.StatusCode != 204 || resp.Header.Get("Content-Length") != "" {
+		t.Errorf("HEAD 204: status %d Content-Length %q", resp.StatusCode, resp.Header.Get("Content-Length"))
+	}
+}
+
+func TestContentLengthMatchesBufferedBody(t *testing.T) {
+	big := strings.Repeat("compressible ", 4096)
+	e := &testEdge{
+		opts: Options{Compression: Compression{Enabled: true, MinBytes: 1024, Level: 5}},
+		core: func(method, path, headers string, body []byte, traceID, spanID uint64, hints uint32) (CoreResp, int) {
+			switch path {
+			case "/liar": // the actor's own Content-Length disagrees with its body
+				return CoreResp{Status: 200, HeadersFlat: "Content-Length: 999\r\n", Body: []byte("short")}, 0
+			case "/big":
+				return CoreResp{Status: 200, HeadersFlat: "Content-Type: text/plain\r\n", Body: []byte(big)}, 0
+			case "/empty":
+				return CoreResp{Status: 204, HeadersFlat: "Content-Length: 3\r\n"}, 0
+			}
+			return CoreResp{Status: 200, Body: []byte("hello")}, 0
+		},
+	}
+	srv := httptest.NewServer(e.handler())
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		path, encoding string
+		want           int64 // -1: no Content-Length at all
+	}{
+		{"/plain", "", 5},
+		{"/liar", "", 5},
+		{"/big", "", int64(len(big))},
+		{"/big", "gzip", 0}, // checked against the compressed body below
+		{"/empty", "", -1},
+	} {
+		req, _ := stdhttp.NewRequest("GET", srv.URL+tc.path, nil)
+		// An explicit Accept-Encoding stops the transport from negotiating and decoding gzip itself
+		req.Header.Set("Accept-Encoding", "identity")
+		if tc.encoding != "" {
+			req.Header.Set("Accept-Encoding", tc.encoding)
+		}
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", tc.path, err)
+		}
+		want := tc.want
+		if tc.encoding != "" {
+			if resp.Header.Get("Content-Encoding") != tc.encoding || len(body) >= len(big) {
+				t.Fatalf("%s: not compressed (%q, %d bytes)", tc.path, resp.Header.Get("Content-Encoding"), len(body))
+			}
+			want = int64(len(body))
+		}
+		if len(resp.TransferEncoding) != 0 {
+			t.Errorf("%s %s: buffered response sent with Transfer-Encoding %v", tc.path, tc.encoding, resp.TransferEncoding)
+		}
+		if want < 0 {
+			if cl := resp.Header.Get("Content-Length"); cl != "" || len(body) != 0 {
+				t.Errorf("%s: bodiless status carries Content-Length %q", tc.path, cl)
+			}
+			continue
+		}
+		if resp.ContentLength != want || int64(len(body)) != want {
+			t.Errorf("%s %s: Content-Length %d, body %d bytes, want %d", tc.path, tc.encoding, resp.ContentLength, len(body), want)
+		}
+	}
+}
+
+func TestTotalHeaderSizeAnswers431(t *testing.T) {
+	const limit = 256
+	e := &testEdge{limits: Limits{HeaderBytes: limit}}
+	withHeader := func(size int) *stdhttp.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-Big", strings.Repeat("v", size-len("X-Big")-4)) // "X-Big: v...\r\n"
+		return r
+	}
+	if rec := e.serve(withHeader(limit)); rec.Code != stdhttp.StatusOK {
+		t.Errorf("headers at the limit: status %d", rec.Code)
+	}
+	rec := e.serve(withHeader(limit + 1))
+	if rec.Code != stdhttp.StatusRequestHeaderFieldsTooLarge || e.actorCalls() != 1 {
+		t.Errorf("headers one byte over: status %d, actor calls %d", rec.Code, e.actorCalls())
+	}
+	if got := e.rejected(); len(got) != 1 || got[0] != "headers_too_large" {
+		t.Errorf("rejects = %v", got)
+	}
+}
+
+func TestChunkedBodyOverLimitIsRejectedNotTruncated(t *testing.T) {
+	var got []byte
+	e := &testEdge{
+		limits: Limits{BodyBytes: 16},
+		core: func(method, path, headers string, body []byte, traceID, spanID uint64, hints uint32) (CoreResp, int) {
+			got = append([]byte(nil), body...)
+			return CoreResp{Status: 200, Body: []byte("ok")}, 0
+		},
+	}
+	srv := httptest.NewServer(e.handler())
+	defer srv.Close()
+	post := func(size int) int {
+		req, _ := stdhttp.NewRequest("POST", srv.URL+"/up", io.MultiReader(strings.NewReader(strings.Repeat("b", size))))
+		req.ContentLength = -1 // sent chunked
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := post(16); code != stdhttp.StatusOK || len(got) != 16 {
+		t.Errorf("chunked body at the limit: status %d, actor got %d bytes", code, len(got))
+	}
+	got = nil
+	if code := post(17); code != stdhttp.StatusRequestEntityTooLarge || got != nil {
+		t.Errorf("chunked body one byte over: status %d, actor got %d bytes", code, len(got))
+	}
+	if r := e.rejected(); len(r) != 1 || r[0] != "body_too_large" {
+		t.Errorf("rejects = %v", r)
+	}
+
+	// A Content-Length understating the body is caught the same way
+	r := httptest.NewRequest("POST", "/up", strings.NewReader(strings.Repeat("b", 40)))
+	r.ContentLength = 8
+	if rec := e.serve(r); rec.Code != stdhttp.StatusRequestEntityTooLarge {
+		t.Errorf("understated Content-Length: status %d", rec.Code)
+	}
+
+	// With decompression on, the raw cap still answers 413 rather than a malformed-body 400
+	e.opts.DecompressRequests = true
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(bytes.Repeat([]byte{0x5a}, 4096))
+	zw.Close()
+	if gz.Len() <= 16 {
+		t.Fatal("fixture compressed below the cap")
+	}
+	r = httptest.NewRequest("POST", "/up", io.MultiReader(bytes.NewReader(gz.Bytes())))
+	r.Header.Set("Content-Encoding", "gzip")
+	if rec := e.serve(r); rec.Code != stdhttp.StatusRequestEntityTooLarge {
+		t.Errorf("oversized gzip upload: status %d", rec.Code)
+	}
+}
+
+func TestVersionHeaderOnEveryResponse(t *testing.T) {
+	e := &testEdge{opts: Options{Version: "1.4.0 (3f2a9c1d8e0b)"}}
+	ok := e.serve(httptest.NewRequest("GET", "/", nil))
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Big", strings.Repeat("x", 128<<10))
+	early := e.serve(r) // rejected before reaching the actor
+	for name, rec := range map[string]*httptest.ResponseRecorder{"served": ok, "rejected": early} {
+		if got := rec.Header().Get(VersionHeader); got != "1.4.0 (3f2a9c1d8e0b)" {
+			t.Errorf("%s (%d): %s = %q", name, rec.Code, VersionHeader, got)
+		}
+	}
+	if early.Code < 400 {
+		t.Errorf("oversized header answered %d", early.Code)
+	}
+
+	e.opts.Version = ""
+	if rec := e.serve(httptest.NewRequest("GET", "/", nil)); rec.Header().Get(VersionHeader) != "" {
+		t.Errorf("off by default, got %q", rec.Header().Get(VersionHeader))
+	}
+}
@@ -0,0 +1,92 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net"
+	stdhttp "net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Drainer wraps a server so shutdown first stops accepting and gives open keep-alive
+// connections a drain window to close on their own before the server forces them.
+type Drainer struct {
+	srv      *stdhttp.Server
+	drain    time.Duration
+	draining atomic.Bool
+
+	mu    sync.Mutex
+	ln    net.Listener
+	conns map[net.Conn]struct{}
+}
+
+// NewDrainer hooks srv's ConnState and Handler; drain <= 0 skips the drain window.
+func NewDrainer(srv *stdhttp.Server, drain time.Duration) *Drainer {
+	d := &Drainer{srv: srv, drain: drain, conns: make(map[net.Conn]struct{})}
+	prev := srv.ConnState
+	srv.ConnState = func(c net.Conn, st stdhttp.ConnState) {
+		d.mu.Lock()
+		switch st {
+		case stdhttp.StateClosed, stdhttp.StateHijacked:
+			delete(d.conns, c)
+		default:
+			d.conns[c] = struct{}{}
+		}
+		d.mu.Unlock()
+		if prev != nil {
+			prev(c, st)
+		}
+	}
+	next := srv.Handler
+	srv.Handler = stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		// HTTP/1.x clients are told to go away after their current request
+		if d.draining.Load() && r.ProtoMajor == 1 {
+			w.Header().Set("Connection", "close")
+		}
+		next.ServeHTTP(w, r)
+	})
+	return d
+}
+
+// Serve serves on ln until shutdown; the listener closing during the drain is not an error.
+func (d *Drainer) Serve(ln net.Listener) error {
+	d.mu.Lock()
+	d.ln = ln
+	d.mu.Unlock()
+	err := d.srv.Serve(ln)
+	if d.draining.Load() && errors.Is(err, net.ErrClosed) {
+		return stdhttp.ErrServerClosed
+	}
+	return err
+}
+
+// Shutdown stops accepting, waits up to the drain window (bounded by ctx) for connections to
+// close on their own, then shuts the server down, waiting for in-flight requests until ctx expires.
+func (d *Drainer) Shutdown(ctx context.Context) error {
+	d.draining.Store(true)
+	d.mu.Lock()
+	ln := d.ln
+	d.mu.Unlock()
+	if ln != nil && d.drain > 0 {
+		_ = ln.Close()
+		drainCtx, cancel := context.WithTimeout(ctx, d.drain)
+		tick := time.NewTicker(50 * time.Millisecond)
+		for d.open() > 0 && drainCtx.Err() == nil {
+			select {
+			case <-tick.C:
+			case <-drainCtx.Done():
+			}
+		}
+		tick.Stop()
+		cancel()
+	}
+	return d.srv.Shutdown(ctx)
+}
+
+func (d *Drainer) open() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.conns)
+}
@@ -0,0 +1,106 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"net"
+	stdhttp "net/http"
+	"testing"
+	"time"
+)
+
+// startDrainer serves "ok" on a loopback listener behind a Drainer with the given window.
+func startDrainer(t *testing.T, drain time.Duration) (*Drainer, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &stdhttp.Server{Handler: stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		w.Write([]byte("ok"))
+	})}
+	d := NewDrainer(srv, drain)
+	go d.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+	return d, ln.Addr().String()
+}
+
+// keepAlive opens a connection and completes one request on it, leaving it idle.
+func keepAlive(t *testing.T, addr string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	br := bufio.NewReader(c)
+	if resp := roundTrip(t, c, br); resp.Close {
+		t.Fatal("server closed the connection before shutdown")
+	}
+	return c, br
+}
+
+func roundTrip(t *testing.T, c net.Conn, br *bufio.Reader) *stdhttp.Response {
+	t.Helper()
+	if _, err := c.Write([]byte("GET / HTTP/1.1\r\nHost: edge\r\n\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := stdhttp.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func shutdownAsync(d *Drainer) <-chan time.Duration {
+	done := make(chan time.Duration, 1)
+	start := time.Now()
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		d.Shutdown(ctx)
+		done <- time.Since(start)
+	}()
+	return done
+}
+
+func TestIdleConnectionGetsDrainWindow(t *testing.T) {
+	const drain = 300 * time.Millisecond
+	d, addr := startDrainer(t, drain)
+	c, br := keepAlive(t, addr)
+
+	done := shutdownAsync(d)
+	time.Sleep(50 * time.Millisecond)
+	if _, err := net.DialTimeout("tcp", addr, time.Second); err == nil {
+		t.Error("new connection accepted while draining")
+	}
+	took := <-done
+	if took < drain {
+		t.Errorf("Shutdown returned after %v, before the %v drain window", took, drain)
+	}
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := br.ReadByte(); err == nil {
+		t.Error("idle connection still open after the drain window")
+	}
+}
+
+func TestDrainEndsWhenClientsLeave(t *testing.T) {
+	d, addr := startDrainer(t, 5*time.Second)
+	c, br := keepAlive(t, addr)
+
+	done := shutdownAsync(d)
+	time.Sleep(50 * time.Millisecond)
+	// The idle connection still works during the drain, and is asked to close
+	if resp := roundTrip(t, c, br); !resp.Close {
+		t.Error("response during the drain lacks Connection: close")
+	}
+	select {
+	case took := <-done:
+		if took > 2*time.Second {
+			t.Errorf("Shutdown took %v after the last client left", took)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Shutdown waited out the drain window with no connections left")
+	}
+}
@@ -0,0 +1,78 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	stdhttp "net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrorRenderer writes an edge-generated error response. traceID is the request's trace ID,
+// the same one sent in X-Trace-ID; IDs are assigned before any check, so early rejections have one too.
+type ErrorRenderer func(w stdhttp.ResponseWriter, r *stdhttp.Request, status int, msg string, traceID uint64)
+
+// PlainErrors is the default renderer: the message as text/plain.
+func PlainErrors(w stdhttp.ResponseWriter, _ *stdhttp.Request, status int, msg string, _ uint64) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(msg))
+}
+
+// NegotiatedErrors renders JSON or HTML when the client's Accept prefers them, else plain text.
+func NegotiatedErrors(w stdhttp.ResponseWriter, r *stdhttp.Request, status int, msg string, traceID uint64) {
+	trace := ""
+	if traceID != 0 {
+		trace = fmt.Sprintf("%016x", traceID)
+	}
+	switch preferredErrorType(r.Header.Get("Accept")) {
+	case "application/json":
+		body, _ := json.Marshal(struct {
+			Error   string `json:"error"`
+			Status  int    `json:"status"`
+			TraceID string `json:"trace_id,omitempty"`
+		}{msg, status, trace})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write(body)
+	case "text/html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		_, _ = fmt.Fprintf(w, "<!DOCTYPE html><html><head><title>%d %s</title></head><body><h1>%d %s</h1><p>%s</p>",
+			status, stdhttp.StatusText(status), status, stdhttp.StatusText(status), html.EscapeString(msg))
+		if trace != "" {
+			_, _ = fmt.Fprintf(w, "<p><small>Trace ID: %s</small></p>", trace)
+		}
+		_, _ = w.Write([]byte("</body></html>"))
+	default:
+		PlainErrors(w, r, status, msg, traceID)
+	}
+}
+
+// preferredErrorType picks the highest-q Accept entry among JSON and HTML; ties favour the earlier entry.
+func preferredErrorType(accept string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		mt = strings.ToLower(strings.TrimSpace(mt))
+		switch {
+		case mt == "application/json" || strings.HasSuffix(mt, "+json"):
+			mt = "application/json"
+		case mt == "text/html" || mt == "application/xhtml+xml":
+			mt = "text/html"
+		default:
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				q = f
+			}
+		}
+		if q > bestQ {
+			best, bestQ = mt, q
+		}
+	}
+	return best
+}
@@ -0,0 +1,86 @@
+package http
+
+import (
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEarlyRejectionCarriesTraceID(t *testing.T) {
+	e := &testEdge{opts: Options{
+		Errors: NegotiatedErrors,
+		Geo:    GeoPolicy{Country: func(net.IP) (string, error) { return "XX", nil }, Deny: []string{"XX"}},
+	}}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "application/json")
+	rec := e.serve(r)
+	var body struct {
+		Status  int    `json:"status"`
+		TraceID string `json:"trace_id"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body %q: %v", rec.Body, err)
+	}
+	if body.Status != 403 || body.TraceID != "0000000000000abc" || rec.Header().Get("X-Trace-ID") != body.TraceID {
+		t.Errorf("status %d, trace_id %q, X-Trace-ID %q", body.Status, body.TraceID, rec.Header().Get("X-Trace-ID"))
+	}
+}
+
+func TestNegotiatedErrorsFollowsAccept(t *testing.T) {
+	for accept, want := range map[string]string{
+		"":                                 "text/plain",
+		"*/*":                              "text/plain",
+		"text/html,application/json;q=0.9": "text/html; charset=utf-8",
+		"text/html;q=0.5, application/problem+json": "application/json",
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		NegotiatedErrors(rec, r, 404, "<missing>", 0xabc)
+		if ct := rec.Header().Get("Content-Type"); ct != want {
+			t.Errorf("Accept %q: Content-Type %q, want %q", accept, ct, want)
+		}
+		if want == "text/html; charset=utf-8" && !strings.Contains(rec.Body.String(), "&lt;missing&gt;") {
+			t.Errorf("HTML body not escaped: %s", rec.Body)
+		}
+	}
+}
+
+func TestDispatcherErrorsAreRendered(t *testing.T) {
+	failing := func(method, path, headers string, body []byte, traceID, spanID uint64, hints uint32) (CoreResp, int) {
+		return CoreResp{}, 4
+	}
+	for _, tc := range []struct {
+		name    string
+		render  ErrorRenderer
+		accept  string
+		method  string
+		body    string
+		status  int
+		ctype   string
+		content []string
+	}{
+		{"default plain", nil, "application/json", "GET", "", 502, "text/plain", []string{"Core/Actor error: 4"}},
+		{"json bad gateway", NegotiatedErrors, "application/json", "GET", "", 502, "application/json",
+			[]string{`"error":"Core/Actor error: 4"`, `"status":502`, `"trace_id":"0000000000000abc"`}},
+		{"html bad gateway", NegotiatedErrors, "text/html", "GET", "", 502, "text/html; charset=utf-8",
+			[]string{"<h1>502 Bad Gateway</h1>", "Trace ID: 0000000000000abc"}},
+		{"json too large", NegotiatedErrors, "application/json", "POST", strings.Repeat("x", 64), 413, "application/json",
+			[]string{`"status":413`, `"trace_id":"0000000000000abc"`}},
+	} {
+		e := &testEdge{limits: Limits{BodyBytes: 16}, opts: Options{Errors: tc.render}, core: failing}
+		r := httptest.NewRequest(tc.method, "/", strings.NewReader(tc.body))
+		r.Header.Set("Accept", tc.accept)
+		rec := e.serve(r)
+		if rec.Code != tc.status || rec.Header().Get("Content-Type") != tc.ctype {
+			t.Errorf("%s: status %d, Content-Type %q", tc.name, rec.Code, rec.Header().Get("Content-Type"))
+		}
+		for _, want := range tc.content {
+			if !strings.Contains(rec.Body.String(), want) {
+				t.Errorf("%s: body missing %q: %s", tc.name, want, rec.Body)
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	stdhttp "net/http"
+	"strings"
+	"time"
+)
+
+// contentETag derives a strong validator from the body when the actor didn't provide one.
+func contentETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:12]) + `"`
+}
+
+// applyConditional sets an ETag on cacheable GET/HEAD 200 responses and downgrades them to
+// 304 Not Modified when If-None-Match (or, absent that, If-Modified-Since) matches.
+func applyConditional(r *stdhttp.Request, h stdhttp.Header, resp *CoreResp) {
+	if resp.Status != stdhttp.StatusOK || (r.Method != stdhttp.MethodGet && r.Method != stdhttp.MethodHead) {
+		return
+	}
+	etag := h.Get("ETag")
+	if etag == "" {
+		etag = contentETag(resp.Body)
+		h.Set("ETag", etag)
+	}
+	notModified := false
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		notModified = etagListMatch(inm, etag, false)
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		lm, err1 := stdhttp.ParseTime(h.Get("Last-Modified"))
+		since, err2 := stdhttp.ParseTime(ims)
+		notModified = err1 == nil && err2 == nil && !lm.Truncate(time.Second).After(since)
+	}
+	if notModified {
+		resp.Status = stdhttp.StatusNotModified
+		resp.Body = nil
+		h.Del("Content-Type")
+		h.Del("Content-Length")
+	}
+}
+
+// ifMatchFails evaluates If-Match for a state-changing request against the current
+// representation (status/headers/body from a preflight GET). Strong comparison per RFC 9110.
+func ifMatchFails(ifMatch string, cur CoreResp) bool {
+	if cur.Status != stdhttp.StatusOK {
+		return true // no current representation to match
+	}
+	if strings.TrimSpace(ifMatch) == "*" {
+		return false
+	}
+	etag := flatHeaderValue(cur.HeadersFlat, "ETag")
+	if etag == "" {
+		etag = contentETag(cur.Body)
+	}
+	return !etagListMatch(ifMatch, etag, true)
+}
+
+// etagListMatch checks a comma-separated entity-tag list (or "*") against etag.
+func etagListMatch(list, etag string, strong bool) bool {
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+	if strong && strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	want := strings.TrimPrefix(etag, "W/")
+	for _, t := range strings.Split(list, ",") {
+		t = strings.TrimSpace(t)
+		if strong && strings.HasPrefix(t, "W/") {
+			continue
+		}
+		if strings.TrimPrefix(t, "W/") == want {
+			return true
+		}
+	}
+	return false
+}
+
+// flatHeaderValue returns the first value of name in a flattened "K: V\r\n" block.
+func flatHeaderValue(flat, name string) string {
+	for _, f := range ParseFlatFields(flat) {
+		if strings.EqualFold(f.Name, name) {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// preflightHeaders flattens h without conditional headers for the If-Match lookup GET.
+func preflightHeaders(h stdhttp.Header) string {
+	c := StripHopByHop(h).Clone()
+	for _, k := range []string{"If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since", "If-Range", "Range", "Content-Type", "Content-Length"} {
+		c.Del(k)
+	}
+	flat, _ := FlattenHeaders(c)
+	return flat
+}
@@ -0,0 +1,108 @@
+package http
+
+import (
+	stdhttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// etagEdge serves "v1" with the actor headers flat; writes are recorded in *writes.
+func etagEdge(flat string, writes *int) *testEdge {
+	return &testEdge{
+		opts: Options{ETags: true},
+		core: func(method, path, headers string, body []byte, traceID, spanID uint64, hints uint32) (CoreResp, int) {
+			if method != "GET" {
+				*writes++
+				return CoreResp{Status: 204}, 0
+			}
+			return CoreResp{Status: 200, HeadersFlat: "Content-Type: text/plain\r\n" + flat, Body: []byte("v1")}, 0
+		},
+	}
+}
+
+func conditional(e *testEdge, method, name, value string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/doc", nil)
+	if name != "" {
+		r.Header.Set(name, value)
+	}
+	return e.serve(r)
+}
+
+func TestIfNoneMatch(t *testing.T) {
+	var writes int
+	for _, tc := range []struct {
+		name, flat, inm string
+		want            int
+	}{
+		{"strong match", `ETag: "abc"` + "\r\n", `"abc"`, stdhttp.StatusNotModified},
+		{"listed", `ETag: "abc"` + "\r\n", `"x", "abc"`, stdhttp.StatusNotModified},
+		{"weak client tag", `ETag: "abc"` + "\r\n", `W/"abc"`, stdhttp.StatusNotModified},
+		{"weak actor tag", `ETag: W/"abc"` + "\r\n", `"abc"`, stdhttp.StatusNotModified},
+		{"wildcard", `ETag: "abc"` + "\r\n", `*`, stdhttp.StatusNotModified},
+		{"no match", `ETag: "abc"` + "\r\n", `"abd"`, stdhttp.StatusOK},
+	} {
+		rec := conditional(etagEdge(tc.flat, &writes), "GET", "If-None-Match", tc.inm)
+		if rec.Code != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, rec.Code, tc.want)
+		}
+		if tc.want == stdhttp.StatusNotModified && (rec.Body.Len() != 0 || rec.Header().Get("ETag") == "") {
+			t.Errorf("%s: 304 with body %q, ETag %q", tc.name, rec.Body, rec.Header().Get("ETag"))
+		}
+	}
+}
+
+func TestComputedETagAndIfModifiedSince(t *testing.T) {
+	var writes int
+	e := etagEdge("Last-Modified: Mon, 02 Jan 2006 15:04:05 GMT\r\n", &writes)
+	etag := conditional(e, "GET", "", "").Header().Get("ETag")
+	if !strings.HasPrefix(etag, `"`) {
+		t.Fatalf("computed ETag = %q, want a strong tag", etag)
+	}
+	if rec := conditional(e, "HEAD", "If-None-Match", etag); rec.Code != stdhttp.StatusNotModified {
+		t.Errorf("HEAD with the computed ETag: status %d", rec.Code)
+	}
+	for _, tc := range []struct {
+		ims  string
+		want int
+	}{
+		{"Mon, 02 Jan 2006 15:04:05 GMT", stdhttp.StatusNotModified},
+		{"Tue, 03 Jan 2006 00:00:00 GMT", stdhttp.StatusNotModified},
+		{"Sun, 01 Jan 2006 00:00:00 GMT", stdhttp.StatusOK},
+		{"not a date", stdhttp.StatusOK},
+	} {
+		if rec := conditional(e, "GET", "If-Modified-Since", tc.ims); rec.Code != tc.want {
+			t.Errorf("If-Modified-Since %q: status %d, want %d", tc.ims, rec.Code, tc.want)
+		}
+	}
+	// If-None-Match takes precedence over If-Modified-Since
+	r := httptest.NewRequest("GET", "/doc", nil)
+	r.Header.Set("If-None-Match", `"other"`)
+	r.Header.Set("If-Modified-Since", "Tue, 03 Jan 2006 00:00:00 GMT")
+	if rec := e.serve(r); rec.Code != stdhttp.StatusOK {
+		t.Errorf("If-None-Match mismatch with a fresh If-Modified-Since: status %d", rec.Code)
+	}
+}
+
+func TestIfMatchOnWrites(t *testing.T) {
+	for _, tc := range []struct {
+		name, flat, ifMatch string
+		want                int
+	}{
+		{"strong match", `ETag: "abc"` + "\r\n", `"abc"`, stdhttp.StatusNoContent},
+		{"wildcard", `ETag: "abc"` + "\r\n", `*`, stdhttp.StatusNoContent},
+		{"mismatch", `ETag: "abc"` + "\r\n", `"abd"`, stdhttp.StatusPreconditionFailed},
+		{"weak client tag", `ETag: "abc"` + "\r\n", `W/"abc"`, stdhttp.StatusPreconditionFailed},
+		{"weak actor tag", `ETag: W/"abc"` + "\r\n", `W/"abc"`, stdhttp.StatusPreconditionFailed},
+	} {
+		var writes int
+		e := etagEdge(tc.flat, &writes)
+		rec := conditional(e, "PUT", "If-Match", tc.ifMatch)
+		if rec.Code != tc.want {
+			t.Errorf("%s: status %d, want %d", tc.name, rec.Code, tc.want)
+		}
+		if wrote := writes == 1; wrote != (tc.want == stdhttp.StatusNoContent) {
+			t.Errorf("%s: actor saw %d writes", tc.name, writes)
+		}
+	}
+}
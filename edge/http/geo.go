@@ -0,0 +1,33 @@
+package http
+
+import (
+	"net"
+)
+
+// GeoPolicy blocks clients by country. Deny wins over Allow; a non-empty Allow admits only the
+// listed countries. Lookups fail open: a nil Country, a lookup error or an unknown country
+// never blocks.
+type GeoPolicy struct {
+	Country func(ip net.IP) (string, error) // ISO 3166-1 alpha-2 code, "" = unknown
+	Allow   []string
+	Deny    []string
+}
+
+// blocks reports whether clientIP (as returned by ClientIP) is outside the policy.
+func (g GeoPolicy) blocks(clientIP string) bool {
+	if g.Country == nil || (len(g.Allow) == 0 && len(g.Deny) == 0) {
+		return false
+	}
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+	cc, err := g.Country(ip)
+	if err != nil || cc == "" {
+		return false
+	}
+	if containsFold(g.Deny, cc) {
+		return true
+	}
+	return len(g.Allow) > 0 && !containsFold(g.Allow, cc)
+}
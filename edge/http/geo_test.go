@@ -0,0 +1,73 @@
+package http
+
+import (
+	"errors"
+	"net"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// stubCountries resolves 192.0.0.0/8 to FR and 198.0.0.0/8 to CN, fails on 203.0.0.0/8 and
+// knows nothing else.
+func stubCountries(ip net.IP) (string, error) {
+	switch ip.To4()[0] {
+	case 192:
+		return "FR", nil
+	case 198:
+		return "CN", nil
+	case 203:
+		return "", errors.New("lookup failed")
+	}
+	return "", nil
+}
+
+func TestGeoPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		allow, deny []string
+		ip          string
+		blocked     bool
+	}{
+		{"denied", nil, []string{"cn"}, "198.51.100.7", true},
+		{"not denied", nil, []string{"CN"}, "192.0.2.7", false},
+		{"allowed", []string{"FR", "DE"}, nil, "192.0.2.7", false},
+		{"outside allow", []string{"FR"}, nil, "198.51.100.7", true},
+		{"deny wins", []string{"CN"}, []string{"CN"}, "198.51.100.7", true},
+		{"unknown fails open", []string{"FR"}, nil, "10.0.0.1", false},
+		{"error fails open", []string{"FR"}, []string{"CN"}, "203.0.113.1", false},
+		{"unparseable IP", []string{"FR"}, nil, "not-an-ip", false},
+		{"no rules", nil, nil, "198.51.100.7", false},
+	} {
+		g := GeoPolicy{Country: stubCountries, Allow: tc.allow, Deny: tc.deny}
+		if got := g.blocks(tc.ip); got != tc.blocked {
+			t.Errorf("%s: blocks(%s) = %v", tc.name, tc.ip, got)
+		}
+	}
+	if (GeoPolicy{Deny: []string{"CN"}}).blocks("198.51.100.7") {
+		t.Error("blocked without a resolver (missing database)")
+	}
+}
+
+func TestGeoBlockedBeforeActor(t *testing.T) {
+	e := &testEdge{opts: Options{
+		Geo:       GeoPolicy{Country: stubCountries, Deny: []string{"CN"}},
+		Allowlist: mustCIDRs(t, "198.51.100.0/24"),
+	}}
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "198.51.100.7:5000"
+	rec := e.serve(r)
+	// Country rules are compliance controls, so the allowlist does not exempt them
+	if rec.Code != stdhttp.StatusForbidden || e.actorCalls() != 0 {
+		t.Errorf("denied country: status %d, actor calls %d", rec.Code, e.actorCalls())
+	}
+	if rej := e.rejected(); len(rej) != 1 || rej[0] != "geo_blocked" {
+		t.Errorf("rejects %v", rej)
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "192.0.2.7:5000"
+	if rec := e.serve(r); rec.Code != stdhttp.StatusOK || e.actorCalls() != 1 {
+		t.Errorf("other country: status %d", rec.Code)
+	}
+}
@@ -22,4 +22,14 @@ func NewH2H1Server(handler stdhttp.Handler, maxHeaderBytes int, timeouts Timeout
 		ReadHeaderTimeout: timeouts.ReadHeader,
 		MaxHeaderBytes:    maxHeaderBytes,
 	}
+}
+
+// NewH2CServer constructs a plaintext server speaking HTTP/1.1 and HTTP/2 cleartext (h2c, prior
+// knowledge), for meshes where a sidecar terminates TLS.
+func NewH2CServer(handler stdhttp.Handler, maxHeaderBytes int, timeouts Timeouts) *stdhttp.Server {
+	srv := NewH2H1Server(handler, maxHeaderBytes, timeouts)
+	srv.Protocols = new(stdhttp.Protocols)
+	srv.Protocols.SetHTTP1(true)
+	srv.Protocols.SetUnencryptedHTTP2(true)
+	return srv
 }
\ No newline at end of file
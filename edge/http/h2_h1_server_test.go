@@ -0,0 +1,55 @@
+package http
+
+import (
+	"io"
+	"net"
+	stdhttp "net/http"
+	"testing"
+	"time"
+)
+
+func TestH2CServerSpeaksCleartextHTTP2(t *testing.T) {
+	transports := make(chan string, 2)
+	e := &testEdge{log: func(method, path, transport string, status, bodyLen int, hints uint32, wafRule string, dur time.Duration, remote, ua string, traceID, spanID uint64, requestID, actorSpan string) {
+		transports <- transport
+	}}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewH2CServer(e.handler(), 64<<10, Timeouts{Read: 5 * time.Second, Write: 5 * time.Second, Idle: time.Minute, ReadHeader: time.Second})
+	go srv.Serve(ln)
+	t.Cleanup(func() { srv.Close() })
+
+	get := func(protos *stdhttp.Protocols) *stdhttp.Response {
+		t.Helper()
+		c := &stdhttp.Client{Transport: &stdhttp.Transport{Protocols: protos}, Timeout: 5 * time.Second}
+		resp, err := c.Get("http://" + ln.Addr().String() + "/x")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { c.CloseIdleConnections() })
+		return resp
+	}
+
+	h2c := new(stdhttp.Protocols)
+	h2c.SetUnencryptedHTTP2(true)
+	resp := get(h2c)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 || resp.StatusCode != 200 || string(body) != "ok" {
+		t.Errorf("h2c: %s %d %q", resp.Proto, resp.StatusCode, body)
+	}
+
+	// HTTP/1.1 clients share the listener
+	h1 := new(stdhttp.Protocols)
+	h1.SetHTTP1(true)
+	resp = get(h1)
+	resp.Body.Close()
+	if resp.ProtoMajor != 1 || resp.StatusCode != 200 {
+		t.Errorf("h1: %s %d", resp.Proto, resp.StatusCode)
+	}
+	if first, second := <-transports, <-transports; first != "h2" || second != "h1" {
+		t.Errorf("dispatcher saw transports %s, %s", first, second)
+	}
+}
@@ -0,0 +1,69 @@
+package http
+
+import (
+	"net"
+	stdhttp "net/http"
+)
+
+// HealthFastPath answers load-balancer probes on path with 200 before any security middleware,
+// actor call, access log or metric runs. If sources is non-empty only those networks get the
+// fast path; other clients fall through to next like any request.
+func HealthFastPath(path string, sources []*net.IPNet, next stdhttp.Handler) stdhttp.Handler {
+	if path == "" {
+		return next
+	}
+	return stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		if r.URL.Path != path || !ipInNets(r.RemoteAddr, sources, true) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(stdhttp.StatusOK)
+		if r.Method != stdhttp.MethodHead {
+			_, _ = w.Write([]byte("OK"))
+		}
+	})
+}
+
+// ParseCIDRs parses CIDR strings (bare IPs become /32 or /128).
+func ParseCIDRs(list []string) ([]*net.IPNet, error) {
+	out := make([]*net.IPNet, 0, len(list))
+	for _, c := range list {
+		if ip := net.ParseIP(c); ip != nil {
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			out = append(out, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
+// ipInNets reports whether remoteAddr's host is in nets; emptyMatches is returned for an empty list.
+func ipInNets(remoteAddr string, nets []*net.IPNet, emptyMatches bool) bool {
+	if len(nets) == 0 {
+		return emptyMatches
+	}
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
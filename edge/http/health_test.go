@@ -0,0 +1,61 @@
+package http
+
+import (
+	stdhttp "net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthFastPathBypassesMiddleware(t *testing.T) {
+	logged := 0
+	e := &testEdge{
+		rate:      func(string) bool { return true },
+		waf:       func(path, ua string, h stdhttp.Header) (bool, string) { return true, "any" },
+		challenge: func(*stdhttp.Request, string) ([]byte, bool) { return []byte(`{}`), true },
+		log: func(method, path, transport string, status, bodyLen int, hints uint32, wafRule string, dur time.Duration, remote, ua string, traceID, spanID uint64, requestID, actorSpan string) {
+			logged++
+		},
+	}
+	h := HealthFastPath("/healthz", mustCIDRs(t, "10.0.0.0/8"), e.handler())
+
+	for _, method := range []string{"GET", "HEAD"} {
+		r := httptest.NewRequest(method, "/healthz", nil)
+		r.RemoteAddr = "10.1.2.3:5000"
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		wantBody := "OK"
+		if method == "HEAD" {
+			wantBody = ""
+		}
+		if rec.Code != stdhttp.StatusOK || rec.Body.String() != wantBody || rec.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("%s probe: status %d, body %q, Cache-Control %q", method, rec.Code, rec.Body, rec.Header().Get("Cache-Control"))
+		}
+	}
+	if e.actorCalls() != 0 || len(e.rejected()) != 0 || logged != 0 {
+		t.Errorf("probes reached the dispatcher: actor calls %d, rejects %v, access log lines %d", e.actorCalls(), e.rejected(), logged)
+	}
+
+	// Other sources, and other paths, go through the full pipeline
+	for _, tc := range []struct{ remote, path string }{{"192.0.2.1:5000", "/healthz"}, {"10.1.2.3:5000", "/healthz/deep"}} {
+		r := httptest.NewRequest("GET", tc.path, nil)
+		r.RemoteAddr = tc.remote
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code != stdhttp.StatusForbidden {
+			t.Errorf("%s from %s: status %d, want the challenge", tc.path, tc.remote, rec.Code)
+		}
+	}
+	if logged != 2 {
+		t.Errorf("access log lines = %d, want 2", logged)
+	}
+}
+
+func TestHealthFastPathDisabledWithoutPath(t *testing.T) {
+	e := &testEdge{}
+	h := HealthFastPath("", nil, e.handler())
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/healthz", nil))
+	if e.actorCalls() != 1 {
+		t.Errorf("actor calls = %d, want the probe forwarded", e.actorCalls())
+	}
+}
@@ -0,0 +1,72 @@
+package http
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// Listen binds a TCP listener whose accepted connections send keep-alive probes every
+// keepAlive (0 disables probing) and of which at most maxConns (0 = unlimited) are open at
+// once; further connections wait in the kernel backlog until one closes.
+func Listen(addr string, maxConns int, keepAlive time.Duration) (net.Listener, error) {
+	lc := net.ListenConfig{KeepAlive: -1}
+	if keepAlive > 0 {
+		lc.KeepAliveConfig = net.KeepAliveConfig{Enable: true, Idle: keepAlive, Interval: keepAlive, Count: -1}
+	}
+	ln, err := lc.Listen(context.Background(), "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if maxConns > 0 {
+		ln = LimitListener(ln, maxConns)
+	}
+	return ln, nil
+}
+
+// LimitListener returns a listener accepting at most n simultaneous connections from l, in
+// the manner of x/net/netutil.LimitListener: Accept blocks while n are open.
+func LimitListener(l net.Listener, n int) net.Listener {
+	return &limitListener{Listener: l, sem: make(chan struct{}, n), done: make(chan struct{})}
+}
+
+type limitListener struct {
+	net.Listener
+	sem       chan struct{}
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	select {
+	case l.sem <- struct{}{}:
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+	c, err := l.Listener.Accept()
+	if err != nil {
+		<-l.sem
+		return nil, err
+	}
+	return &limitConn{Conn: c, release: func() { <-l.sem }}, nil
+}
+
+func (l *limitListener) Close() error {
+	err := l.Listener.Close()
+	l.closeOnce.Do(func() { close(l.done) })
+	return err
+}
+
+// limitConn frees its slot on the first Close.
+type limitConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
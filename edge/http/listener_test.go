@@ -0,0 +1,96 @@
+package http
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestListenCapsOpenConnections(t *testing.T) {
+	ln, err := Listen("127.0.0.1:0", 2, 15*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted := make(chan net.Conn, 4)
+	acceptErr := make(chan error, 1)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				acceptErr <- err
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	for i := 0; i < 3; i++ {
+		c, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+	}
+	first, second := <-accepted, <-accepted
+	select {
+	case <-accepted:
+		t.Fatal("third connection accepted past the cap of 2")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Closing one frees its slot for the waiting connection; a second Close frees nothing more
+	first.Close()
+	first.Close()
+	select {
+	case third := <-accepted:
+		defer third.Close()
+	case <-time.After(2 * time.Second):
+		t.Fatal("waiting connection not accepted after a slot was freed")
+	}
+	second.Close()
+
+	ln.Close()
+	select {
+	case err := <-acceptErr:
+		if err == nil {
+			t.Error("Accept returned nil error after Close")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Accept still blocked after Close")
+	}
+}
+
+func TestLimitListenerUnblocksOnClose(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln := LimitListener(inner, 1)
+	c, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	held, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer held.Close()
+
+	// With the only slot held, Accept waits on the semaphore until the listener closes
+	done := make(chan error, 1)
+	go func() {
+		_, err := ln.Accept()
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	ln.Close()
+	select {
+	case err := <-done:
+		if err != net.ErrClosed {
+			t.Errorf("Accept after Close = %v, want net.ErrClosed", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Accept blocked past Close")
+	}
+}
@@ -0,0 +1,36 @@
+package http
+
+import (
+	"strings"
+)
+
+// MethodPolicy restricts which HTTP methods reach the actor. An empty Allowed list permits every method.
+type MethodPolicy struct {
+	Allowed  []string
+	ByPrefix map[string][]string // per-route override of Allowed; longest prefix wins
+}
+
+// allowed resolves the method set for path.
+func (m MethodPolicy) allowed(path string) []string {
+	set, best := m.Allowed, -1
+	for prefix, methods := range m.ByPrefix {
+		if len(prefix) > best && strings.HasPrefix(path, prefix) {
+			set, best = methods, len(prefix)
+		}
+	}
+	return set
+}
+
+// permits reports whether method is allowed on path and, if not, the Allow header value.
+func (m MethodPolicy) permits(method, path string) (bool, string) {
+	set := m.allowed(path)
+	if len(set) == 0 {
+		return true, ""
+	}
+	for _, s := range set {
+		if s == method {
+			return true, ""
+		}
+	}
+	return false, strings.Join(set, ", ")
+}
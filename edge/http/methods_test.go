@@ -0,0 +1,53 @@
+package http
+
+import (
+	stdhttp "net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var testMethods = MethodPolicy{
+	Allowed: []string{"GET", "HEAD", "POST", "PUT", "DELETE", "PATCH", "OPTIONS"},
+	ByPrefix: map[string][]string{
+		"/static/":        {"GET", "HEAD"},
+		"/static/upload/": {"PUT"},
+	},
+}
+
+func TestMethodAllowlist(t *testing.T) {
+	for _, tc := range []struct {
+		method, path string
+		want         int
+		allow        string
+	}{
+		{"GET", "/api", stdhttp.StatusOK, ""},
+		{"PATCH", "/api", stdhttp.StatusOK, ""},
+		{"TRACE", "/api", stdhttp.StatusMethodNotAllowed, "GET, HEAD, POST, PUT, DELETE, PATCH, OPTIONS"},
+		{"PROPFIND", "/api", stdhttp.StatusMethodNotAllowed, "GET, HEAD, POST, PUT, DELETE, PATCH, OPTIONS"},
+		{"HEAD", "/static/app.js", stdhttp.StatusOK, ""},
+		{"POST", "/static/app.js", stdhttp.StatusMethodNotAllowed, "GET, HEAD"},
+		{"PUT", "/static/upload/x", stdhttp.StatusOK, ""},
+		{"GET", "/static/upload/x", stdhttp.StatusMethodNotAllowed, "PUT"},
+	} {
+		e := &testEdge{opts: Options{Methods: testMethods}}
+		rec := e.serve(httptest.NewRequest(tc.method, tc.path, nil))
+		if rec.Code != tc.want {
+			t.Errorf("%s %s: status %d, want %d", tc.method, tc.path, rec.Code, tc.want)
+		}
+		if got := rec.Header().Get("Allow"); got != tc.allow {
+			t.Errorf("%s %s: Allow %q, want %q", tc.method, tc.path, got, tc.allow)
+		}
+		if tc.want == stdhttp.StatusMethodNotAllowed {
+			if got := e.rejected(); e.actorCalls() != 0 || len(got) != 1 || got[0] != "method_not_allowed" {
+				t.Errorf("%s %s: actor calls %d, rejects %v", tc.method, tc.path, e.actorCalls(), got)
+			}
+		}
+	}
+}
+
+func TestEmptyMethodPolicyAllowsAll(t *testing.T) {
+	e := &testEdge{}
+	if rec := e.serve(httptest.NewRequest("PROPFIND", "/dav", nil)); rec.Code != stdhttp.StatusOK || e.actorCalls() != 1 {
+		t.Errorf("status %d, actor calls %d", rec.Code, e.actorCalls())
+	}
+}
@@ -2,28 +2,125 @@ package http
 
 import (
 	stdhttp "net/http"
+	"slices"
 	"strings"
+	"sync"
 )
 
 // Normalize extracts deterministic method, path, headersFlat and headerBytesCount.
-func Normalize(r *stdhttp.Request, maxHeaderBytes int) (method, path, headersFlat string, hdrSize int) {
+// oversized names the first header carrying a single value above maxValueBytes (0 disables the check).
+// Headers totalling more than maxHeaderBytes are not flattened: headersFlat is "" and hdrSize
+// exceeds the limit.
+func Normalize(r *stdhttp.Request, maxHeaderBytes, maxValueBytes int) (method, path, headersFlat string, hdrSize int, oversized string) {
 	method = r.Method
 	path = r.URL.RequestURI()
-	headersFlat, hdrSize = FlattenHeaders(r.Header)
+	if oversized = OversizedHeader(r.Header, maxValueBytes); oversized != "" {
+		return
+	}
+	headersFlat, hdrSize = flattenHeaders(StripHopByHop(r.Header), maxHeaderBytes)
 	return
 }
 
-// FlattenHeaders returns "K: V\r\n" repeated and the total bytes length.
+// hopByHop are the connection-scoped headers of RFC 7230 §6.1 (plus the legacy
+// Proxy-Connection); they describe a single hop and are never forwarded.
+var hopByHop = []string{"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authenticate",
+	"Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade"}
+
+// connectionListed returns the canonical names a Connection header nominates as hop-by-hop.
+func connectionListed(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, tok := range strings.Split(v, ",") {
+			if tok = strings.TrimSpace(tok); tok != "" {
+				out = append(out, stdhttp.CanonicalHeaderKey(tok))
+			}
+		}
+	}
+	return out
+}
+
+// StripHopByHop returns h without hop-by-hop headers or the headers its Connection header
+// lists. h itself is returned when there is nothing to strip, otherwise a trimmed clone.
+func StripHopByHop(h stdhttp.Header) stdhttp.Header {
+	drop := append(connectionListed(h["Connection"]), hopByHop...)
+	var out stdhttp.Header
+	for _, k := range drop {
+		if _, ok := h[k]; !ok {
+			continue
+		}
+		if out == nil {
+			out = h.Clone()
+		}
+		delete(out, k)
+	}
+	if out == nil {
+		return h
+	}
+	return out
+}
+
+// OversizedHeader returns the name of a header whose single value exceeds maxValueBytes; when
+// several do, the smallest name, so the answer does not depend on map order.
+func OversizedHeader(h stdhttp.Header, maxValueBytes int) string {
+	if maxValueBytes <= 0 {
+		return ""
+	}
+	name := ""
+	for k, vals := range h {
+		for _, v := range vals {
+			if len(v) > maxValueBytes {
+				if name == "" || k < name {
+					name = k
+				}
+				break
+			}
+		}
+	}
+	return name
+}
+
+// flattenKeys recycles the sorted-name scratch slices of FlattenHeaders.
+var flattenKeys = sync.Pool{New: func() any { k := make([]string, 0, 32); return &k }}
+
+// FlattenHeaders returns "K: V\r\n" repeated and the total bytes length. Names are emitted in
+// sorted order so the same request always flattens to the same bytes; repeated values keep
+// their order, one line each. It runs on every request: the size is computed first so the
+// result is built in a single allocation, and the name slice comes from a pool.
 func FlattenHeaders(h stdhttp.Header) (string, int) {
-	var b strings.Builder
+	return flattenHeaders(h, 0)
+}
+
+// flattenHeaders is FlattenHeaders that gives up as soon as the running size passes limit
+// (0 = no limit), returning "" and a size above limit without building anything.
+func flattenHeaders(h stdhttp.Header, limit int) (string, int) {
 	size := 0
 	for k, vals := range h {
 		for _, v := range vals {
-			line := k + ": " + v + "\r\n"
-			b.WriteString(line)
-			size += len(line)
+			size += len(k) + len(v) + 4 // ": " and "\r\n"
+		}
+		if limit > 0 && size > limit {
+			return "", size
+		}
+	}
+	kp := flattenKeys.Get().(*[]string)
+	keys := (*kp)[:0]
+	for k := range h {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	var b strings.Builder
+	b.Grow(size)
+	for _, k := range keys {
+		for _, v := range h[k] {
+			b.WriteString(k)
+			b.WriteString(": ")
+			b.WriteString(v)
+			b.WriteString("\r\n")
 		}
 	}
+	clear(keys) // don't pin header names from finished requests
+	*kp = keys
+	flattenKeys.Put(kp)
 	return b.String(), size
 }
 
@@ -41,4 +138,48 @@ func ParseFlat(s string) []string {
 		out = append(out, ln)
 	}
 	return out
-}
\ No newline at end of file
+}
+
+// HeaderField is one line of a flattened header block.
+type HeaderField struct {
+	Name  string
+	Value string
+}
+
+// ParseFlatFields splits a flattened block into fields in emission order. Each line is cut at
+// its first ":" (field names cannot contain one) and optional whitespace around the value is
+// trimmed, so values may themselves contain colons; lines without a name are dropped.
+// Repeated names (Set-Cookie) come back as separate fields.
+func ParseFlatFields(s string) []HeaderField {
+	lines := ParseFlat(s)
+	out := make([]HeaderField, 0, len(lines))
+	for _, ln := range lines {
+		k, v, ok := strings.Cut(ln, ":")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			continue
+		}
+		out = append(out, HeaderField{Name: k, Value: strings.Trim(v, " \t")})
+	}
+	return out
+}
+
+// EndToEndFields drops hop-by-hop fields, and those a Connection field lists, from a parsed
+// actor response so they are not relayed to the client.
+func EndToEndFields(fields []HeaderField) []HeaderField {
+	var listed []string
+	for _, f := range fields {
+		if strings.EqualFold(f.Name, "Connection") {
+			listed = append(listed, connectionListed([]string{f.Value})...)
+		}
+	}
+	out := fields[:0]
+	for _, f := range fields {
+		name := stdhttp.CanonicalHeaderKey(f.Name)
+		if slices.Contains(hopByHop, name) || slices.Contains(listed, name) {
+			continue
+		}
+		out = append(out, f)
+	}
+	return out
+}
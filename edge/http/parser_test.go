@@ -0,0 +1,149 @@
+package http
+
+import (
+	stdhttp "net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// benchHeaders is a typical browser request's header set.
+func benchHeaders() stdhttp.Header {
+	return stdhttp.Header{
+		"Accept":          {"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
+		"Accept-Encoding": {"gzip, deflate, br"},
+		"Accept-Language": {"en-US,en;q=0.5"},
+		"Cookie":          {"session=0123456789abcdef; theme=dark"},
+		"User-Agent":      {"Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0"},
+		"X-Forwarded-For": {"203.0.113.7"},
+		"X-Request-Id":    {"4bf92f3577b34da6a3ce929d0e0e4736"},
+	}
+}
+
+func TestParseFlatFieldsCutsAtFirstColon(t *testing.T) {
+	got := ParseFlatFields("Location:http://a.example/x\r\n" +
+		"X-Odd:a: b\r\n" +
+		"X-Padded: \t v \t\r\n" +
+		"Set-Cookie: a=1\r\n" +
+		"Set-Cookie: b=2\r\n" +
+		": no name\r\n" +
+		"no colon\r\n" +
+		"X-Empty:\r\n")
+	want := []HeaderField{
+		{"Location", "http://a.example/x"},
+		{"X-Odd", "a: b"},
+		{"X-Padded", "v"},
+		{"Set-Cookie", "a=1"},
+		{"Set-Cookie", "b=2"},
+		{"X-Empty", ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseFlatFields =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestFlattenHeadersIsSortedAndSized(t *testing.T) {
+	h := stdhttp.Header{"B": {"2", "3"}, "A": {"1"}}
+	flat, n := FlattenHeaders(h)
+	if want := "A: 1\r\nB: 2\r\nB: 3\r\n"; flat != want || n != len(want) {
+		t.Errorf("FlattenHeaders = %q, %d; want %q, %d", flat, n, want, len(want))
+	}
+	if flat, n := flattenHeaders(h, 8); flat != "" || n <= 8 {
+		t.Errorf("over the limit: %q, %d", flat, n)
+	}
+}
+
+func TestOversizedHeaderPicksSmallestName(t *testing.T) {
+	long := strings.Repeat("x", 11)
+	h := stdhttp.Header{"Zeta": {long}, "Alpha": {"ok", long}, "Mid": {"ok"}}
+	for i := 0; i < 20; i++ { // map order varies between iterations
+		if got := OversizedHeader(h, 10); got != "Alpha" {
+			t.Fatalf("OversizedHeader = %q, want Alpha", got)
+		}
+	}
+	if got := OversizedHeader(h, 11); got != "" {
+		t.Errorf("values at the limit reported: %q", got)
+	}
+	if got := OversizedHeader(h, 0); got != "" {
+		t.Errorf("limit 0 reported %q", got)
+	}
+}
+
+func BenchmarkFlattenHeaders(b *testing.B) {
+	h := benchHeaders()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		FlattenHeaders(h)
+	}
+}
+
+func BenchmarkOversizedHeader(b *testing.B) {
+	h := benchHeaders()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		OversizedHeader(h, 16<<10)
+	}
+}
+
+func TestHeaderHotPathAllocations(t *testing.T) {
+	h := benchHeaders()
+	if n := testing.AllocsPerRun(100, func() { FlattenHeaders(h) }); n > 1 {
+		t.Errorf("FlattenHeaders: %v allocs/op, want only the result string", n)
+	}
+	if n := testing.AllocsPerRun(100, func() { OversizedHeader(h, 16<<10) }); n != 0 {
+		t.Errorf("OversizedHeader: %v allocs/op, want 0", n)
+	}
+}
+
+func TestStripHopByHop(t *testing.T) {
+	h := stdhttp.Header{
+		"Connection":          {"keep-alive, X-Hop"},
+		"Keep-Alive":          {"timeout=5"},
+		"Te":                  {"trailers"},
+		"Upgrade":             {"h2c"},
+		"Proxy-Authorization": {"Basic x"},
+		"X-Hop":               {"1"},
+		"Accept":              {"*/*"},
+		"Cookie":              {"a=1"},
+	}
+	got := StripHopByHop(h)
+	if len(got) != 2 || got.Get("Accept") != "*/*" || got.Get("Cookie") != "a=1" {
+		t.Errorf("stripped = %v", got)
+	}
+	if len(h) != 8 {
+		t.Error("StripHopByHop modified its argument")
+	}
+	clean := stdhttp.Header{"Accept": {"*/*"}}
+	if got := StripHopByHop(clean); len(got) != 1 {
+		t.Errorf("clean headers = %v", got)
+	}
+
+	fields := EndToEndFields(ParseFlatFields("Connection: close, X-Internal\r\nTransfer-Encoding: chunked\r\n" +
+		"x-internal: secret\r\nTrailer: X-Sum\r\nContent-Type: text/plain\r\nSet-Cookie: a=1\r\nSet-Cookie: b=2\r\n"))
+	var kept []string
+	for _, f := range fields {
+		kept = append(kept, f.Name+"="+f.Value)
+	}
+	if strings.Join(kept, " ") != "Content-Type=text/plain Set-Cookie=a=1 Set-Cookie=b=2" {
+		t.Errorf("end-to-end fields = %v", kept)
+	}
+}
+
+func TestFlattenHeadersGivesUpPastLimit(t *testing.T) {
+	h := benchHeaders()
+	full, size := FlattenHeaders(h)
+	if got, n := flattenHeaders(h, size); got != full || n != size {
+		t.Errorf("at the limit: %d bytes, want the full %d", n, size)
+	}
+	if got, n := flattenHeaders(h, size-1); got != "" || n <= size-1 {
+		t.Errorf("over the limit: %q, size %d", got, n)
+	}
+	huge := stdhttp.Header{}
+	for i := 0; i < 1000; i++ {
+		huge.Set("X-Pad-"+strconv.Itoa(i), strings.Repeat("p", 1000))
+	}
+	if n := testing.AllocsPerRun(20, func() { flattenHeaders(huge, 16<<10) }); n != 0 {
+		t.Errorf("rejecting oversized headers: %v allocs/op, want 0", n)
+	}
+}
@@ -0,0 +1,132 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	stdhttp "net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"olwsx/edge/wire"
+)
+
+// maxRanges bounds multi-range requests; more than this serves the full body.
+const maxRanges = 16
+
+var errUnsatisfiable = errors.New("range not satisfiable")
+
+type byteRange struct{ start, end int64 } // inclusive
+
+// applyRange turns a full 200 response into 206/416 per the request's Range header when the
+// actor flagged the body with wire.MetaFullResource. h is the outgoing header set.
+func applyRange(r *stdhttp.Request, h stdhttp.Header, resp *CoreResp) {
+	if resp.Status != stdhttp.StatusOK || resp.MetaFlags&wire.MetaFullResource == 0 {
+		return
+	}
+	h.Set("Accept-Ranges", "bytes")
+	spec := r.Header.Get("Range")
+	if spec == "" || (r.Method != stdhttp.MethodGet && r.Method != stdhttp.MethodHead) {
+		return
+	}
+	if ir := r.Header.Get("If-Range"); ir != "" && ir != h.Get("ETag") {
+		return // representation changed: send it whole
+	}
+	size := int64(len(resp.Body))
+	ranges, err := parseRange(spec, size)
+	if errors.Is(err, errUnsatisfiable) {
+		h.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		h.Del("Content-Type")
+		resp.Status = stdhttp.StatusRequestedRangeNotSatisfiable
+		resp.Body = nil
+		return
+	}
+	if err != nil || len(ranges) == 0 || len(ranges) > maxRanges {
+		return // malformed or abusive: ignore the header (RFC 9110 §14.2)
+	}
+	if len(ranges) == 1 {
+		rg := ranges[0]
+		h.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", rg.start, rg.end, size))
+		resp.Status = stdhttp.StatusPartialContent
+		resp.Body = resp.Body[rg.start : rg.end+1]
+		return
+	}
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	ct := h.Get("Content-Type")
+	for _, rg := range ranges {
+		ph := textproto.MIMEHeader{}
+		if ct != "" {
+			ph.Set("Content-Type", ct)
+		}
+		ph.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", rg.start, rg.end, size))
+		pw, _ := mw.CreatePart(ph)
+		_, _ = pw.Write(resp.Body[rg.start : rg.end+1])
+	}
+	_ = mw.Close()
+	h.Set("Content-Type", "multipart/byteranges; boundary="+mw.Boundary())
+	resp.Status = stdhttp.StatusPartialContent
+	resp.Body = buf.Bytes()
+}
+
+// parseRange parses "bytes=a-b, c-, -n" against size. Ranges that start past the end are
+// dropped; if none remain the result is errUnsatisfiable.
+func parseRange(spec string, size int64) ([]byteRange, error) {
+	unit, set, ok := strings.Cut(spec, "=")
+	if !ok || strings.TrimSpace(unit) != "bytes" {
+		return nil, errors.New("invalid range unit")
+	}
+	var out []byteRange
+	for _, part := range strings.Split(set, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		first, last, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, errors.New("invalid range")
+		}
+		first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+		var rg byteRange
+		if first == "" {
+			// suffix range: last n bytes
+			n, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || n < 0 {
+				return nil, errors.New("invalid range")
+			}
+			if n == 0 || size == 0 {
+				continue
+			}
+			if n > size {
+				n = size
+			}
+			rg = byteRange{size - n, size - 1}
+		} else {
+			start, err := strconv.ParseInt(first, 10, 64)
+			if err != nil || start < 0 {
+				return nil, errors.New("invalid range")
+			}
+			if start >= size {
+				continue
+			}
+			end := size - 1
+			if last != "" {
+				e, err := strconv.ParseInt(last, 10, 64)
+				if err != nil || e < start {
+					return nil, errors.New("invalid range")
+				}
+				if e < end {
+					end = e
+				}
+			}
+			rg = byteRange{start, end}
+		}
+		out = append(out, rg)
+	}
+	if len(out) == 0 {
+		return nil, errUnsatisfiable
+	}
+	return out, nil
+}
@@ -0,0 +1,103 @@
+package http
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"olwsx/edge/wire"
+)
+
+const rangeBody = "0123456789"
+
+// rangeEdge serves rangeBody as text/plain, flagged as the full resource when full is set.
+func rangeEdge(full bool) *testEdge {
+	var flags uint32
+	if full {
+		flags = wire.MetaFullResource
+	}
+	return &testEdge{core: func(method, path, headers string, body []byte, traceID, spanID uint64, hints uint32) (CoreResp, int) {
+		return CoreResp{Status: 200, HeadersFlat: "Content-Type: text/plain\r\n", Body: []byte(rangeBody), MetaFlags: flags}, 0
+	}}
+}
+
+func getRange(e *testEdge, spec string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", "/file", nil)
+	r.Header.Set("Range", spec)
+	return e.serve(r)
+}
+
+func TestSingleRange(t *testing.T) {
+	for _, tc := range []struct{ spec, body, contentRange string }{
+		{"bytes=2-5", "2345", "bytes 2-5/10"},
+		{"bytes=7-", "789", "bytes 7-9/10"},
+		{"bytes=-3", "789", "bytes 7-9/10"},
+		{"bytes=8-100", "89", "bytes 8-9/10"},
+	} {
+		rec := getRange(rangeEdge(true), tc.spec)
+		if rec.Code != stdhttp.StatusPartialContent || rec.Body.String() != tc.body {
+			t.Errorf("%s: status %d, body %q", tc.spec, rec.Code, rec.Body)
+		}
+		if got := rec.Header().Get("Content-Range"); got != tc.contentRange {
+			t.Errorf("%s: Content-Range %q, want %q", tc.spec, got, tc.contentRange)
+		}
+		if got := rec.Header().Get("Content-Length"); got != strconv.Itoa(len(tc.body)) {
+			t.Errorf("%s: Content-Length %q", tc.spec, got)
+		}
+	}
+}
+
+func TestMultiRange(t *testing.T) {
+	rec := getRange(rangeEdge(true), "bytes=0-1, 8-")
+	mt, params, err := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+	if rec.Code != stdhttp.StatusPartialContent || err != nil || mt != "multipart/byteranges" {
+		t.Fatalf("status %d, Content-Type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	mr := multipart.NewReader(rec.Body, params["boundary"])
+	for _, want := range []struct{ body, contentRange string }{{"01", "bytes 0-1/10"}, {"89", "bytes 8-9/10"}} {
+		p, err := mr.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := io.ReadAll(p)
+		if string(got) != want.body || p.Header.Get("Content-Range") != want.contentRange || p.Header.Get("Content-Type") != "text/plain" {
+			t.Errorf("part %q, headers %v", got, p.Header)
+		}
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Errorf("extra part: %v", err)
+	}
+}
+
+func TestUnsatisfiableRange(t *testing.T) {
+	rec := getRange(rangeEdge(true), "bytes=10-20")
+	if rec.Code != stdhttp.StatusRequestedRangeNotSatisfiable || rec.Header().Get("Content-Range") != "bytes */10" || rec.Body.Len() != 0 {
+		t.Errorf("status %d, Content-Range %q, body %q", rec.Code, rec.Header().Get("Content-Range"), rec.Body)
+	}
+}
+
+func TestRangeIgnoredWithoutFullResourceOrWhenMalformed(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		full bool
+		spec string
+	}{
+		{"not flagged", false, "bytes=0-1"},
+		{"bad unit", true, "items=0-1"},
+		{"reversed", true, "bytes=5-2"},
+		{"too many ranges", true, "bytes=" + strings.Repeat("0-0,", maxRanges) + "0-0"},
+	} {
+		rec := getRange(rangeEdge(tc.full), tc.spec)
+		if rec.Code != stdhttp.StatusOK || rec.Body.String() != rangeBody {
+			t.Errorf("%s: status %d, body %q", tc.name, rec.Code, rec.Body)
+		}
+	}
+	if got := getRange(rangeEdge(true), "bytes=x").Header().Get("Accept-Ranges"); got != "bytes" {
+		t.Errorf("Accept-Ranges = %q on a flagged body", got)
+	}
+}
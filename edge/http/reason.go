@@ -0,0 +1,135 @@
+package http
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	stdhttp "net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// writeWithReason emits resp with the actor's custom reason phrase. net/http always writes the
+// standard phrase, so for HTTP/1.x the connection is hijacked and the response written verbatim.
+// The response is always length-framed, so afterwards the connection is handed back to its
+// server (see ResumeHijacked) unless the exchange ends it. It returns false when the standard
+// path should be used instead.
+func writeWithReason(w stdhttp.ResponseWriter, r *stdhttp.Request, resp CoreResp) bool {
+	reason := sanitizeReason(resp.Reason)
+	if reason == "" || reason == stdhttp.StatusText(resp.Status) || r.ProtoMajor != 1 || resp.Status < 200 {
+		return false
+	}
+	conn, rw, err := stdhttp.NewResponseController(w).Hijack()
+	if err != nil {
+		return false
+	}
+	h := w.Header().Clone()
+	if bodyAllowed(resp.Status) {
+		h.Set("Content-Length", strconv.Itoa(len(resp.Body)))
+	} else {
+		h.Del("Content-Length")
+	}
+	if h.Get("Date") == "" {
+		h.Set("Date", nowHTTP())
+	}
+	// Pipelined bytes already read past this request cannot be handed back with the connection
+	keepAlive := !r.Close && !strings.EqualFold(h.Get("Connection"), "close") && rw.Reader.Buffered() == 0
+	if keepAlive && r.ProtoMinor == 0 {
+		h.Set("Connection", "keep-alive")
+	} else if !keepAlive {
+		h.Set("Connection", "close")
+	}
+	bw := rw.Writer
+	if bw == nil {
+		bw = bufio.NewWriter(conn)
+	}
+	fmt.Fprintf(bw, "HTTP/%d.%d %03d %s\r\n", r.ProtoMajor, r.ProtoMinor, resp.Status, reason)
+	_ = h.Write(bw)
+	_, _ = bw.WriteString("\r\n")
+	if r.Method != stdhttp.MethodHead && bodyAllowed(resp.Status) {
+		_, _ = bw.Write(resp.Body)
+	}
+	if err := bw.Flush(); err != nil || !keepAlive || !resume(r.Context(), conn) {
+		_ = conn.Close()
+	}
+	return true
+}
+
+// sanitizeReason keeps visible ASCII, space and tab (RFC 9112 reason-phrase), capped at 128 bytes.
+func sanitizeReason(s string) string {
+	out := make([]byte, 0, len(s))
+	for i := 0; i < len(s) && len(out) < 128; i++ {
+		c := s[i]
+		if c == '\t' || (c >= 0x20 && c < 0x7f) {
+			out = append(out, c)
+		}
+	}
+	return string(out)
+}
+
+func nowHTTP() string { return time.Now().UTC().Format(stdhttp.TimeFormat) }
+
+type resumeKey struct{}
+
+// ResumeHijacked lets handlers return hijacked HTTP/1.x connections to srv once they have written
+// a complete response themselves, so custom reason phrases keep the connection alive. It chains
+// srv.ConnContext and starts serving resumed connections; call it once before serving. The
+// returned listener closes with the server.
+func ResumeHijacked(srv *stdhttp.Server) net.Listener {
+	ln := &resumeListener{conns: make(chan net.Conn), done: make(chan struct{})}
+	prev := srv.ConnContext
+	srv.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		if prev != nil {
+			ctx = prev(ctx, c)
+		}
+		return context.WithValue(ctx, resumeKey{}, ln)
+	}
+	go func() { _ = srv.Serve(ln) }()
+	return ln
+}
+
+// resume hands conn back to the server that accepted it; false = no resumer (or it is closed)
+// and the caller still owns conn.
+func resume(ctx context.Context, conn net.Conn) bool {
+	ln, ok := ctx.Value(resumeKey{}).(*resumeListener)
+	if !ok {
+		return false
+	}
+	select {
+	case ln.conns <- conn:
+		return true
+	case <-ln.done:
+		return false
+	}
+}
+
+// resumeListener feeds resumed connections to http.Server.Serve.
+type resumeListener struct {
+	conns chan net.Conn
+	done  chan struct{}
+	once  sync.Once
+}
+
+func (l *resumeListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *resumeListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return nil
+}
+
+func (l *resumeListener) Addr() net.Addr { return resumeAddr{} }
+
+type resumeAddr struct{}
+
+func (resumeAddr) Network() string { return "resume" }
+func (resumeAddr) String() string  { return "resumed" }
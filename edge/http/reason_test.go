@@ -0,0 +1,132 @@
+package http
+
+import (
+	"bufio"
+	"io"
+	"net"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// reasonServer answers every request through writeWithReason with the status in ?status=
+// and reason "Custom Phrase".
+func reasonServer(t *testing.T) string {
+	t.Helper()
+	ts := httptest.NewUnstartedServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		status, _ := strconv.Atoi(r.URL.Query().Get("status"))
+		if !writeWithReason(w, r, CoreResp{Status: status, Body: []byte("body"), Reason: "Custom Phrase"}) {
+			t.Errorf("writeWithReason declined status %d", status)
+		}
+	}))
+	ResumeHijacked(ts.Config)
+	ts.Start()
+	t.Cleanup(ts.Close)
+	return ts.Listener.Addr().String()
+}
+
+func rawExchange(t *testing.T, conn net.Conn, br *bufio.Reader, req string) (statusLine string, resp *stdhttp.Response) {
+	t.Helper()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := io.WriteString(conn, req); err != nil {
+		t.Fatal(err)
+	}
+	line, err := br.Peek(64)
+	if err != nil && len(line) == 0 {
+		t.Fatalf("reading response: %v", err)
+	}
+	statusLine, _, _ = strings.Cut(string(line), "\r\n")
+	resp, err = stdhttp.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("parsing response: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return statusLine, resp
+}
+
+func TestReasonPhraseKeepsConnectionAlive(t *testing.T) {
+	addr := reasonServer(t)
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	for i := 0; i < 3; i++ {
+		line, resp := rawExchange(t, conn, br, "GET /?status=299 HTTP/1.1\r\nHost: x\r\n\r\n")
+		if line != "HTTP/1.1 299 Custom Phrase" {
+			t.Fatalf("request %d status line = %q", i, line)
+		}
+		if resp.Close || resp.ContentLength != 4 {
+			t.Fatalf("request %d: close=%v content-length=%d", i, resp.Close, resp.ContentLength)
+		}
+	}
+}
+
+func TestReasonPhraseNoContentLengthWithoutBody(t *testing.T) {
+	addr := reasonServer(t)
+	for _, status := range []int{204, 304} {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		br := bufio.NewReader(conn)
+		_, resp := rawExchange(t, conn, br, "GET /?status="+strconv.Itoa(status)+" HTTP/1.1\r\nHost: x\r\n\r\n")
+		if cl := resp.Header.Get("Content-Length"); cl != "" {
+			t.Errorf("%d response carries Content-Length %q", status, cl)
+		}
+		// The connection stays usable: no stray body bytes precede the next response
+		line, _ := rawExchange(t, conn, br, "GET /?status=299 HTTP/1.1\r\nHost: x\r\n\r\n")
+		if line != "HTTP/1.1 299 Custom Phrase" {
+			t.Errorf("after %d, next status line = %q", status, line)
+		}
+		conn.Close()
+	}
+}
+
+func TestReasonPhraseEchoesHTTP10(t *testing.T) {
+	addr := reasonServer(t)
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	line, resp := rawExchange(t, conn, br, "GET /?status=299 HTTP/1.0\r\nConnection: keep-alive\r\n\r\n")
+	if line != "HTTP/1.0 299 Custom Phrase" {
+		t.Fatalf("status line = %q", line)
+	}
+	if got := resp.Header.Get("Connection"); !strings.EqualFold(got, "keep-alive") {
+		t.Errorf("Connection = %q, want keep-alive", got)
+	}
+	if line, _ := rawExchange(t, conn, br, "GET /?status=299 HTTP/1.0\r\n\r\n"); line != "HTTP/1.0 299 Custom Phrase" {
+		t.Errorf("second status line = %q", line)
+	}
+	// A plain HTTP/1.0 request ends the connection
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := br.ReadByte(); err != io.EOF {
+		t.Errorf("connection still open after HTTP/1.0 without keep-alive: %v", err)
+	}
+}
+
+func TestReasonPhraseHonorsConnectionClose(t *testing.T) {
+	addr := reasonServer(t)
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	_, resp := rawExchange(t, conn, br, "GET /?status=299 HTTP/1.1\r\nHost: x\r\nConnection: close\r\n\r\n")
+	if !resp.Close {
+		t.Error("response to Connection: close did not announce close")
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := br.ReadByte(); err != io.EOF {
+		t.Errorf("connection still open: %v", err)
+	}
+}
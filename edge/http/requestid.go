@@ -0,0 +1,32 @@
+package http
+
+import "fmt"
+
+// maxRequestIDLen bounds accepted request IDs; UUIDs and most tracing IDs fit well within it.
+const maxRequestIDLen = 128
+
+// RequestID returns incoming if it is a well-formed request ID, otherwise a fresh one derived
+// from the trace and span IDs. Well-formed means 1..maxRequestIDLen characters from
+// [A-Za-z0-9._:+=/-], so the value is safe in headers, logs and the envelope.
+func RequestID(incoming string, traceID, spanID uint64) string {
+	if validRequestID(incoming) {
+		return incoming
+	}
+	return fmt.Sprintf("%016x%016x", traceID, spanID)
+}
+
+func validRequestID(s string) bool {
+	if s == "" || len(s) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':', c == '+', c == '=', c == '/':
+		default:
+			return false
+		}
+	}
+	return true
+}
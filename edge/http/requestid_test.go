@@ -0,0 +1,67 @@
+package http
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestIDKeepsOnlyWellFormedValues(t *testing.T) {
+	const generated = "0000000000000abc0000000000000def"
+	for in, want := range map[string]string{
+		"3f2b8c1e-7a4d-4e55-9b1a-2c6f0d9e8a71": "3f2b8c1e-7a4d-4e55-9b1a-2c6f0d9e8a71",
+		"svc.a:req_42+b/c=":                    "svc.a:req_42+b/c=",
+		strings.Repeat("a", maxRequestIDLen):   strings.Repeat("a", maxRequestIDLen),
+		"":                                     generated,
+		strings.Repeat("a", maxRequestIDLen+1): generated,
+		"id with spaces":                       generated,
+		"id\r\nX-Injected: 1":                  generated,
+		`"quoted"`:                             generated,
+		"ïd":                                   generated,
+	} {
+		if got := RequestID(in, 0xabc, 0xdef); got != want {
+			t.Errorf("RequestID(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRequestIDForwardedEchoedAndLogged(t *testing.T) {
+	var sent, logged string
+	e := &testEdge{
+		opts: Options{RequestID: "X-Request-ID"},
+		core: func(method, path, headers string, body []byte, traceID, spanID uint64, hints uint32) (CoreResp, int) {
+			sent = headers
+			return CoreResp{Status: 200, Body: []byte("ok")}, 0
+		},
+		log: func(method, path, transport string, status, bodyLen int, hints uint32, wafRule string, dur time.Duration, remote, ua string, traceID, spanID uint64, requestID, actorSpan string) {
+			logged = requestID
+		},
+	}
+	for _, tc := range []struct{ name, in, want string }{
+		{"pass-through", "req-123", "req-123"},
+		{"absent", "", "0000000000000abc0000000000000def"},
+		{"malformed", "bad id;<script>", "0000000000000abc0000000000000def"},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tc.in != "" {
+			r.Header.Set("X-Request-ID", tc.in)
+		}
+		rec := e.serve(r)
+		if got := rec.Header().Get("X-Request-ID"); got != tc.want {
+			t.Errorf("%s: echoed %q, want %q", tc.name, got, tc.want)
+		}
+		if !strings.Contains(sent, "X-Request-Id: "+tc.want+"\r\n") || (tc.in != tc.want && tc.in != "" && strings.Contains(sent, tc.in)) {
+			t.Errorf("%s: actor headers:\n%s", tc.name, sent)
+		}
+		if logged != tc.want {
+			t.Errorf("%s: logged %q, want %q", tc.name, logged, tc.want)
+		}
+	}
+
+	// Off by default: nothing generated or echoed
+	e.opts.RequestID = ""
+	if rec := e.serve(httptest.NewRequest("GET", "/", nil)); rec.Header().Get("X-Request-ID") != "" || logged != "" {
+		t.Errorf("disabled: echoed %q, logged %q", rec.Header().Get("X-Request-ID"), logged)
+	}
+}
@@ -0,0 +1,93 @@
+package http
+
+import (
+	"container/list"
+	stdhttp "net/http"
+	"sync"
+	"time"
+
+	"olwsx/edge/wire"
+)
+
+// StaleCache keeps recent cacheable GET responses so they can be served when the actor is down.
+// Only responses the actor marks with wire.MetaCacheable are stored.
+type StaleCache struct {
+	Entries int           // LRU capacity; 0 disables
+	TTL     time.Duration // how long an entry may stand in for the actor
+}
+
+type staleEntry struct {
+	key    string
+	resp   CoreResp
+	stored time.Time
+}
+
+type staleCache struct {
+	mu    sync.Mutex
+	max   int
+	ttl   time.Duration
+	order *list.List // front = most recently used
+	byKey map[string]*list.Element
+}
+
+func newStaleCache(c StaleCache) *staleCache {
+	if c.Entries <= 0 || c.TTL <= 0 {
+		return nil
+	}
+	return &staleCache{max: c.Entries, ttl: c.TTL, order: list.New(), byKey: make(map[string]*list.Element)}
+}
+
+// staleKey maps HEAD onto GET so either can be answered from the same entry.
+func staleKey(method, path string) (string, bool) {
+	switch method {
+	case stdhttp.MethodGet, stdhttp.MethodHead:
+		return stdhttp.MethodGet + " " + path, true
+	}
+	return "", false
+}
+
+// store remembers a successful, actor-marked response for method+path.
+func (c *staleCache) store(method, path string, resp CoreResp) {
+	key, ok := staleKey(method, path)
+	if c == nil || !ok || method != stdhttp.MethodGet || resp.Status != stdhttp.StatusOK ||
+		resp.MetaFlags&wire.MetaCacheable == 0 || flatHeaderValue(resp.HeadersFlat, "Set-Cookie") != "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.byKey[key]; ok {
+		el.Value = &staleEntry{key: key, resp: resp, stored: time.Now()}
+		c.order.MoveToFront(el)
+		return
+	}
+	c.byKey[key] = c.order.PushFront(&staleEntry{key: key, resp: resp, stored: time.Now()})
+	for c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.byKey, oldest.Value.(*staleEntry).key)
+	}
+}
+
+// lookup returns a copy of the entry for method+path if it is younger than the TTL.
+func (c *staleCache) lookup(method, path string) (CoreResp, bool) {
+	key, ok := staleKey(method, path)
+	if c == nil || !ok {
+		return CoreResp{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.byKey[key]
+	if !ok {
+		return CoreResp{}, false
+	}
+	e := el.Value.(*staleEntry)
+	if time.Since(e.stored) > c.ttl {
+		c.order.Remove(el)
+		delete(c.byKey, key)
+		return CoreResp{}, false
+	}
+	c.order.MoveToFront(el)
+	resp := e.resp
+	resp.Body = append([]byte(nil), e.resp.Body...) // later stages rewrite the body
+	return resp, true
+}
@@ -0,0 +1,109 @@
+package http
+
+import (
+	stdhttp "net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"olwsx/edge/wire"
+)
+
+// flakyActor answers every path with its own body, marked cacheable unless the path is
+// /private, and fails every call while down is set.
+type flakyActor struct {
+	down bool
+	h    stdhttp.Handler
+}
+
+func newFlakyActor(c StaleCache) *flakyActor {
+	a := &flakyActor{}
+	e := &testEdge{
+		opts: Options{StaleCache: c},
+		core: func(method, path, headers string, body []byte, traceID, spanID uint64, hints uint32) (CoreResp, int) {
+			if a.down {
+				return CoreResp{}, -1
+			}
+			meta := wire.MetaCacheable
+			if path == "/private" {
+				meta = 0
+			}
+			return CoreResp{Status: 200, HeadersFlat: "Content-Type: text/plain\r\n", Body: []byte(method + " " + path), MetaFlags: meta}, 0
+		},
+	}
+	a.h = e.handler()
+	return a
+}
+
+func (a *flakyActor) do(method, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	a.h.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	return rec
+}
+
+func TestStaleResponseServedOnActorFailure(t *testing.T) {
+	a := newFlakyActor(StaleCache{Entries: 8, TTL: time.Minute})
+	a.do("GET", "/page")
+	a.down = true
+
+	rec := a.do("GET", "/page")
+	if rec.Code != stdhttp.StatusOK || rec.Body.String() != "GET /page" || rec.Header().Get("Warning") != `110 - "Response is Stale"` {
+		t.Fatalf("stale GET: status %d, body %q, Warning %q", rec.Code, rec.Body, rec.Header().Get("Warning"))
+	}
+	if rec := a.do("HEAD", "/page"); rec.Code != stdhttp.StatusOK || rec.Body.Len() != 0 || rec.Header().Get("Warning") == "" {
+		t.Errorf("stale HEAD: status %d, body %q", rec.Code, rec.Body)
+	}
+	// Serving the entry must not consume or corrupt it
+	if rec := a.do("GET", "/page"); rec.Body.String() != "GET /page" {
+		t.Errorf("second stale GET: body %q", rec.Body)
+	}
+	if rec := a.do("GET", "/never-seen"); rec.Code != stdhttp.StatusBadGateway {
+		t.Errorf("uncached GET: status %d", rec.Code)
+	}
+}
+
+func TestStaleCacheBypassesNonIdempotentAndUnmarked(t *testing.T) {
+	a := newFlakyActor(StaleCache{Entries: 8, TTL: time.Minute})
+	a.do("GET", "/form")
+	a.do("POST", "/submit")
+	a.do("GET", "/private")
+	a.down = true
+
+	for _, tc := range []struct{ method, path string }{
+		{"POST", "/form"}, // a cached GET never answers a write
+		{"PUT", "/form"},
+		{"GET", "/submit"},  // POST responses are never stored
+		{"GET", "/private"}, // actor did not mark it cacheable
+	} {
+		if rec := a.do(tc.method, tc.path); rec.Code != stdhttp.StatusBadGateway || rec.Header().Get("Warning") != "" {
+			t.Errorf("%s %s: status %d, Warning %q", tc.method, tc.path, rec.Code, rec.Header().Get("Warning"))
+		}
+	}
+}
+
+func TestStaleCacheTTLAndCapacity(t *testing.T) {
+	a := newFlakyActor(StaleCache{Entries: 2, TTL: 50 * time.Millisecond})
+	a.do("GET", "/a")
+	a.do("GET", "/b")
+	a.do("GET", "/c") // evicts /a
+	a.down = true
+	if rec := a.do("GET", "/a"); rec.Code != stdhttp.StatusBadGateway {
+		t.Errorf("evicted entry served: status %d", rec.Code)
+	}
+	if rec := a.do("GET", "/c"); rec.Code != stdhttp.StatusOK {
+		t.Errorf("fresh entry: status %d", rec.Code)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if rec := a.do("GET", "/c"); rec.Code != stdhttp.StatusBadGateway {
+		t.Errorf("expired entry served: status %d", rec.Code)
+	}
+}
+
+func TestStaleCacheDisabledByDefault(t *testing.T) {
+	a := newFlakyActor(StaleCache{})
+	a.do("GET", "/page")
+	a.down = true
+	if rec := a.do("GET", "/page"); rec.Code != stdhttp.StatusBadGateway {
+		t.Errorf("status %d", rec.Code)
+	}
+}
@@ -0,0 +1,112 @@
+// Package logging is the edge's leveled logger; every edge package logs through it.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// Level orders message severity; messages below a logger's threshold are dropped.
+type Level int32
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = [...]string{"DEBUG", "INFO", "WARN", "ERROR"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("LEVEL(%d)", int32(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel accepts "debug", "info", "warn"/"warning" and "error" (any case).
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return LevelDebug, nil
+	case "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q", s)
+}
+
+// Logger is the leveled logging interface; inject a custom one with SetDefault.
+type Logger interface {
+	Debug(format string, args ...any)
+	Info(format string, args ...any)
+	Warn(format string, args ...any)
+	Error(format string, args ...any)
+}
+
+// StdLogger writes "LEVEL message" lines through the standard log package.
+type StdLogger struct {
+	out *log.Logger
+	min atomic.Int32
+}
+
+// New returns a StdLogger writing to w that drops messages below min. Errors always emit.
+func New(w io.Writer, min Level) *StdLogger {
+	l := &StdLogger{out: log.New(w, "", log.LstdFlags)}
+	l.SetLevel(min)
+	return l
+}
+
+// SetLevel changes the threshold at runtime; it is capped at LevelError so errors are never dropped.
+func (l *StdLogger) SetLevel(min Level) {
+	if min > LevelError {
+		min = LevelError
+	}
+	l.min.Store(int32(min))
+}
+
+// Enabled reports whether messages at lvl are emitted.
+func (l *StdLogger) Enabled(lvl Level) bool { return lvl >= Level(l.min.Load()) }
+
+func (l *StdLogger) logf(lvl Level, format string, args []any) {
+	if !l.Enabled(lvl) {
+		return
+	}
+	_ = l.out.Output(3, lvl.String()+" "+fmt.Sprintf(format, args...))
+}
+
+func (l *StdLogger) Debug(format string, args ...any) { l.logf(LevelDebug, format, args) }
+func (l *StdLogger) Info(format string, args ...any)  { l.logf(LevelInfo, format, args) }
+func (l *StdLogger) Warn(format string, args ...any)  { l.logf(LevelWarn, format, args) }
+func (l *StdLogger) Error(format string, args ...any) { l.logf(LevelError, format, args) }
+
+type holder struct{ Logger }
+
+var current atomic.Pointer[holder]
+
+func init() { SetDefault(New(os.Stderr, LevelInfo)) }
+
+// SetDefault replaces the logger used by the package-level functions.
+func SetDefault(l Logger) { current.Store(&holder{l}) }
+
+// Default returns the logger used by the package-level functions.
+func Default() Logger { return current.Load().Logger }
+
+func Debug(format string, args ...any) { Default().Debug(format, args...) }
+func Info(format string, args ...any)  { Default().Info(format, args...) }
+func Warn(format string, args ...any)  { Default().Warn(format, args...) }
+func Error(format string, args ...any) { Default().Error(format, args...) }
+
+// Fatal logs at error level and exits the process.
+func Fatal(format string, args ...any) {
+	Default().Error(format, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestThresholdSuppressesLowerLevels(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, LevelWarn)
+	l.Debug("d %d", 1)
+	l.Info("i %d", 2)
+	l.Warn("w %d", 3)
+	l.Error("e %d", 4)
+	got := buf.String()
+	if strings.Contains(got, "d 1") || strings.Contains(got, "i 2") {
+		t.Errorf("below-threshold messages emitted:\n%s", got)
+	}
+	if !strings.Contains(got, "WARN w 3\n") || !strings.Contains(got, "ERROR e 4\n") {
+		t.Errorf("missing warn/error lines:\n%s", got)
+	}
+
+	buf.Reset()
+	l.SetLevel(LevelDebug)
+	l.Debug("now visible")
+	if !strings.Contains(buf.String(), "DEBUG now visible") {
+		t.Errorf("SetLevel(debug) did not take effect: %q", buf.String())
+	}
+}
+
+func TestErrorsAlwaysEmit(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, LevelError+5)
+	l.Warn("quiet")
+	l.Error("loud")
+	if strings.Contains(buf.String(), "quiet") || !strings.Contains(buf.String(), "ERROR loud") {
+		t.Errorf("threshold above error: %q", buf.String())
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for in, want := range map[string]Level{"debug": LevelDebug, " INFO ": LevelInfo, "warning": LevelWarn, "Warn": LevelWarn, "error": LevelError} {
+		if got, err := ParseLevel(in); err != nil || got != want {
+			t.Errorf("ParseLevel(%q) = %v, %v", in, got, err)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("ParseLevel(verbose) accepted")
+	}
+}
+
+// recorder is an injected Logger capturing package-level calls.
+type recorder struct{ lines []string }
+
+func (r *recorder) Debug(f string, a ...any) { r.lines = append(r.lines, "debug "+f) }
+func (r *recorder) Info(f string, a ...any)  { r.lines = append(r.lines, "info "+f) }
+func (r *recorder) Warn(f string, a ...any)  { r.lines = append(r.lines, "warn "+f) }
+func (r *recorder) Error(f string, a ...any) { r.lines = append(r.lines, "error "+f) }
+
+func TestSetDefaultInjectsLogger(t *testing.T) {
+	prev := Default()
+	t.Cleanup(func() { SetDefault(prev) })
+	r := &recorder{}
+	SetDefault(r)
+	Info("a")
+	Error("b")
+	if Default() != r || strings.Join(r.lines, ",") != "info a,error b" {
+		t.Errorf("injected logger got %v", r.lines)
+	}
+}
@@ -0,0 +1,180 @@
+package logging
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotateOptions bounds a RotatingFile; zero values disable the respective limit.
+type RotateOptions struct {
+	MaxBytes int64         // rotate before a write would grow the file past this size
+	MaxAge   time.Duration // rotate once the current file is this old
+	MaxFiles int           // rotated segments kept (oldest pruned first)
+	Compress bool          // gzip rotated segments in the background
+}
+
+// RotatingFile is an io.WriteCloser that rotates path to path.<timestamp>[.gz] by size or age.
+// It is safe for concurrent writers; each Write lands whole in one segment.
+type RotatingFile struct {
+	path string
+	opts RotateOptions
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+	bg     sync.WaitGroup // background compress/prune work
+}
+
+// rotatedStamp sorts lexically in time order.
+const rotatedStamp = "20060102T150405.000"
+
+// OpenRotating opens (appending to) path and rotates it according to opts.
+func OpenRotating(path string, opts RotateOptions) (*RotatingFile, error) {
+	r := &RotatingFile{path: path, opts: opts}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size, r.opened = f, st.Size(), time.Now()
+	return nil
+}
+
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return 0, os.ErrClosed
+	}
+	if r.due(int64(len(p))) {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// due reports whether the next write of n bytes must go to a fresh segment.
+func (r *RotatingFile) due(n int64) bool {
+	if r.size == 0 {
+		return false // never rotate an empty file, even for an oversized write
+	}
+	if r.opts.MaxBytes > 0 && r.size+n > r.opts.MaxBytes {
+		return true
+	}
+	return r.opts.MaxAge > 0 && time.Since(r.opened) >= r.opts.MaxAge
+}
+
+// rotate renames the current file aside and reopens path; r.mu must be held.
+func (r *RotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	r.f = nil
+	name := r.path + "." + time.Now().Format(rotatedStamp)
+	for i := 1; fileExists(name) || fileExists(name+".gz"); i++ {
+		name = fmt.Sprintf("%s.%s.%d", r.path, time.Now().Format(rotatedStamp), i)
+	}
+	if err := os.Rename(r.path, name); err != nil {
+		return err
+	}
+	if err := r.open(); err != nil {
+		return err
+	}
+	r.bg.Add(1)
+	go func() {
+		defer r.bg.Done()
+		if r.opts.Compress {
+			_ = gzipFile(name)
+		}
+		r.prune()
+	}()
+	return nil
+}
+
+// prune removes the oldest rotated segments beyond MaxFiles.
+func (r *RotatingFile) prune() {
+	if r.opts.MaxFiles <= 0 {
+		return
+	}
+	matches, _ := filepath.Glob(r.path + ".*")
+	var segs []string
+	for _, m := range matches {
+		if !strings.HasSuffix(m, ".gz.tmp") {
+			segs = append(segs, m)
+		}
+	}
+	sort.Slice(segs, func(i, j int) bool { return strings.TrimSuffix(segs[i], ".gz") < strings.TrimSuffix(segs[j], ".gz") })
+	for len(segs) > r.opts.MaxFiles {
+		_ = os.Remove(segs[0])
+		segs = segs[1:]
+	}
+}
+
+// Close closes the current file and waits for pending compression.
+func (r *RotatingFile) Close() error {
+	r.mu.Lock()
+	var err error
+	if r.f != nil {
+		err = r.f.Close()
+		r.f = nil
+	}
+	r.mu.Unlock()
+	r.bg.Wait()
+	return err
+}
+
+// gzipFile replaces name with name.gz.
+func gzipFile(name string) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := name + ".gz.tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err = io.Copy(zw, in); err == nil {
+		err = zw.Close()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, name+".gz")
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(name)
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
@@ -0,0 +1,145 @@
+package logging
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// segments lists rotated files next to path, oldest first.
+func segments(t *testing.T, path string) []string {
+	t.Helper()
+	m, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestRotatesAtSizeThresholdAndPrunes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	r, err := OpenRotating(path, RotateOptions{MaxBytes: 20, MaxFiles: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := "0123456789\n" // 11 bytes: one fits under 20, two do not
+	for i := 0; i < 5; i++ {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * time.Millisecond) // distinct rotation stamps
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if cur, _ := os.ReadFile(path); string(cur) != line {
+		t.Errorf("current file = %q, want one line", cur)
+	}
+	segs := segments(t, path)
+	if len(segs) != 2 {
+		t.Fatalf("kept %d rotated segments %v, want 2", len(segs), segs)
+	}
+	for _, s := range segs {
+		if b, _ := os.ReadFile(s); string(b) != line {
+			t.Errorf("%s = %q", s, b)
+		}
+	}
+}
+
+func TestOversizedWriteIsNotSplit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	r, err := OpenRotating(path, RotateOptions{MaxBytes: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Write([]byte("much longer than four bytes\n"))
+	r.Close()
+	if len(segments(t, path)) != 0 {
+		t.Error("an empty file was rotated")
+	}
+}
+
+func TestRotatesByAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	r, err := OpenRotating(path, RotateOptions{MaxAge: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Write([]byte("old\n"))
+	time.Sleep(20 * time.Millisecond)
+	r.Write([]byte("new\n"))
+	r.Close()
+	if cur, _ := os.ReadFile(path); string(cur) != "new\n" || len(segments(t, path)) != 1 {
+		t.Errorf("current %q, segments %v", cur, segments(t, path))
+	}
+}
+
+func TestCompressedSegments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	r, err := OpenRotating(path, RotateOptions{MaxBytes: 8, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Write([]byte("first\n"))
+	r.Write([]byte("second\n"))
+	r.Close() // waits for compression
+
+	segs := segments(t, path)
+	if len(segs) != 1 || !strings.HasSuffix(segs[0], ".gz") {
+		t.Fatalf("segments %v, want one .gz", segs)
+	}
+	f, err := os.Open(segs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := io.ReadAll(zr); string(b) != "first\n" {
+		t.Errorf("segment holds %q", b)
+	}
+}
+
+func TestConcurrentWritesLandWhole(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	r, err := OpenRotating(path, RotateOptions{MaxBytes: 256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := strings.Repeat("x", 31) + "\n"
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				r.Write([]byte(line))
+			}
+		}()
+	}
+	wg.Wait()
+	r.Close()
+
+	total := 0
+	for _, name := range append(segments(t, path), path) {
+		b, _ := os.ReadFile(name)
+		if len(b) > 256 || len(b)%len(line) != 0 {
+			t.Errorf("%s: %d bytes is not whole lines under the limit", name, len(b))
+		}
+		total += strings.Count(string(b), line)
+	}
+	if total != 400 {
+		t.Errorf("found %d lines, want 400", total)
+	}
+	if _, err := r.Write([]byte(line)); err != os.ErrClosed {
+		t.Errorf("write after close: %v", err)
+	}
+}
@@ -4,17 +4,23 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/binary"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sync"
 	"syscall"
 	"time"
 
+	"olwsx/edge/geoip"
 	edgehttp "olwsx/edge/http"
+	"olwsx/edge/logging"
 	edgequic "olwsx/edge/quic"
 	edgetls "olwsx/edge/tls"
 	edgews "olwsx/edge/websocket"
@@ -34,53 +40,141 @@ func newIDs() (uint64, uint64) {
 	return binary.LittleEndian.Uint64(buf[:8]), binary.LittleEndian.Uint64(buf[8:])
 }
 
-// coreCall bridges edge to Actor Manager via Unix domain socket.
+// altSvcFor is the Alt-Svc value advertising HTTP/3 on h1/h2 responses, or "" with HTTP/3 off.
+func altSvcFor(c *Config) string {
+	if !c.EnableHTTP3 {
+		return ""
+	}
+	addr := c.AltSvcH3Addr
+	if addr == "" {
+		addr = c.TLSListenAddr
+	}
+	return edgehttp.AltSvcH3(addr, c.AltSvcMaxAge)
+}
+
+// coreCall bridges edge to Actor Manager (unix or tcp), failing over across ActorManagerEndpoints.
 // Edge forms a stable envelope and expects a binary response using wire.Response layout.
 func coreCall(method, path, headers string, body []byte, traceID, spanID uint64, hints uint32) (edgehttp.CoreResp, int) {
-	// Ensure socket exists
-	sock := ActorManagerSocket
-	if sock == "" {
+	// Ensure at least one socket is configured
+	if len(actors.eps) == 0 {
 		return edgehttp.CoreResp{}, 1
 	}
-	conn, err := net.Dial("unix", sock)
+	conn, ep, err := actorConns.get()
 	if err != nil {
-		log.Printf("actor dial error: %v", err)
+		logging.Error("actor dial error: %v", err)
 		return edgehttp.CoreResp{}, 2
 	}
-	defer conn.Close()
+	// Back to the pool only after a complete framed response; anything else closes it
+	reusable := false
+	defer func() { actorConns.put(conn, ep, reusable) }()
 
 	// Write envelope
-	env := wire.WriteEnvelope(method, path, headers, body, traceID, spanID, hints)
-	if _, err := conn.Write(env); err != nil {
-		log.Printf("actor write error: %v", err)
+	env := wire.AcquireBuffer()
+	defer wire.ReleaseBuffer(env)
+	wire.WriteEnvelopeTo(env, method, path, headers, body, traceID, spanID, hints)
+	if _, err := conn.Write(env.Bytes()); err != nil {
+		logging.Error("actor write error (%s): %v", ep, err)
+		actors.markFailed(ep)
 		return edgehttp.CoreResp{}, 3
 	}
 
-	// Read response (length-prefixed frame)
-	// For simplicity we read until EOF; in production, frame length should be prefixed.
-	buf := make([]byte, 1<<20) // 1MB temp buffer; actor should respect edge limits
-	n, err := conn.Read(buf)
-	if err != nil && n == 0 {
-		log.Printf("actor read error: %v", err)
+	// Read response: framed responses are read exactly by their declared length, bare ones
+	// until the actor closes the socket; either way capped at ActorMaxResponse
+	dec := wire.NewResponseDecoder(conn, conf().ActorMaxResponse)
+	resp, err := dec.Decode()
+	var netErr net.Error
+	if errors.Is(err, io.EOF) || errors.Is(err, wire.ErrShortFrame) || errors.As(err, &netErr) {
+		logging.Error("actor read error (%s): %v", ep, err)
+		actors.markFailed(ep)
 		return edgehttp.CoreResp{}, 4
 	}
-	resp, err := wire.ReadResponse(buf[:n])
+	actors.markOK(ep)
+	if errors.Is(err, wire.ErrResponseVersion) {
+		logging.Error("actor protocol mismatch (%s): %v", ep, err)
+		return edgehttp.CoreResp{}, edgehttp.CoreVersionMismatch
+	}
 	if err != nil {
-		log.Printf("actor parse error: %v", err)
+		logging.Error("actor parse error: %v", err)
 		return edgehttp.CoreResp{}, 5
 	}
+	reusable = dec.Framed()
 	return edgehttp.CoreResp{
 		Status:      int(resp.Status),
 		HeadersFlat: resp.HeadersFlat,
 		Body:        resp.Body,
 		MetaFlags:   resp.MetaFlags,
+		Reason:      resp.Reason,
 	}, 0
 }
 
 func main() {
-	// Ensure socket directory exists (edge doesn't create actor socket, only path directory)
-	if dir := filepath.Dir(ActorManagerSocket); dir != "" {
-		_ = os.MkdirAll(dir, 0755)
+	// Configuration: defaults, then the JSON file, then OLWSX_* environment variables
+	configPath := flag.String("config", os.Getenv("OLWSX_CONFIG"), "JSON config file overlaying the built-in defaults")
+	flag.Parse()
+	cfg, err := LoadConfig(*configPath, os.LookupEnv)
+	if err != nil {
+		logging.Fatal("invalid configuration:\n%v", err)
+	}
+	activeConfig.Store(cfg)
+	if err := SetRateLimit(cfg.BucketCapacity, cfg.RefillPerSecond); err != nil {
+		logging.Fatal("rate limit: %v", err)
+	}
+	setDifficulty(cfg.ChallengeDifficulty)
+
+	// Leveled logging first so startup messages honor LogLevel; a custom logging.Logger may be set here instead
+	level, err := logging.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		logging.Fatal("log level: %v", err)
+	}
+	logging.SetDefault(logging.New(os.Stderr, level))
+	logging.Info("Edge build %s, %s", admin.Build(), admin.Build().GoVersion)
+	if cfg.AccessLogFile != "" {
+		f, err := logging.OpenRotating(cfg.AccessLogFile, logging.RotateOptions{
+			MaxBytes: cfg.AccessLogMaxBytes,
+			MaxAge:   cfg.AccessLogMaxAge,
+			MaxFiles: cfg.AccessLogMaxFiles,
+			Compress: cfg.AccessLogCompress,
+		})
+		if err != nil {
+			logging.Fatal("access log file: %v", err)
+		}
+		defer f.Close()
+		accessSink = log.New(f, "", log.LstdFlags)
+	}
+
+	// Ensure socket directories exist (edge doesn't create actor sockets, only path directories)
+	for _, ep := range cfg.ActorManagerEndpoints {
+		if ep.Network != "unix" && ep.Network != "" {
+			continue
+		}
+		if dir := filepath.Dir(ep.Address); dir != "" {
+			_ = os.MkdirAll(dir, 0755)
+		}
+	}
+
+	// Actor endpoints and connection pool
+	actors = newActorEndpoints(cfg.ActorManagerEndpoints, cfg.ActorFailCooldown, cfg.ActorDialTimeout, nil)
+	actorConns = newActorPool(actors, cfg.ActorPoolSize, cfg.ActorPoolMaxIdle, cfg.ActorDialTimeout)
+
+	// Actor IPC over TCP may be TLS-protected
+	if cfg.ActorTLS {
+		actorTLS, err := edgetls.ClientConfig(cfg.ActorTLSCAFile, cfg.ActorTLSServerName)
+		if err != nil {
+			logging.Fatal("actor TLS config failed: %v", err)
+		}
+		actors.setTLS(actorTLS)
+	}
+
+	// WAF rules from WAFRulesFile replace the built-ins; POST /waf/reload re-reads them
+	if err := ReloadWAFRules(); err != nil {
+		logging.Fatal("waf rules: %v", err)
+	}
+	// SIGHUP re-reads the config file, swapping in hot-reloadable changes and the WAF rules
+	go reloadOnSIGHUP(*configPath)
+
+	// Challenge difficulty follows load when adaptive mode is on
+	if cfg.EnableChallenge && cfg.ChallengeAdaptive {
+		go adaptChallenge()
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -95,17 +189,103 @@ func main() {
 	// TLS config
 	cert, err := edgetls.LoadOrSelfSign("server.crt", "server.key")
 	if err != nil {
-		log.Fatalf("TLS cert load failed: %v", err)
+		logging.Fatal("TLS cert load failed: %v", err)
 	}
-	tlsCfg := edgetls.ServerConfig(cert, TLSMinVersion13)
+	tlsCfg := edgetls.ServerConfig(cert, cfg.TLSMinVersion13)
 
 	// Handler wiring
+	// Debug body logging is limited to these sources
+	bodyLogSources, err := edgehttp.ParseCIDRs(cfg.BodyLogSources)
+	if err != nil {
+		logging.Fatal("body log sources: %v", err)
+	}
+
+	// Allowlisted clients skip WAF, rate limit and challenge
+	allowlist, err := edgehttp.ParseCIDRs(cfg.SecurityAllowlist)
+	if err != nil {
+		logging.Fatal("security allowlist: %v", err)
+	}
+	trustedProxies, err := edgehttp.ParseCIDRs(cfg.TrustedProxies)
+	if err != nil {
+		logging.Fatal("trusted proxies: %v", err)
+	}
+
+	// Country rules; a missing or unreadable database disables them (fail open)
+	geo := edgehttp.GeoPolicy{Allow: cfg.GeoAllowCountries, Deny: cfg.GeoDenyCountries}
+	if cfg.GeoIPDatabase != "" {
+		if db, err := geoip.Open(cfg.GeoIPDatabase); err != nil {
+			logging.Warn("geoip database %s unavailable, country rules disabled: %v", cfg.GeoIPDatabase, err)
+		} else {
+			geo.Country = db.Country
+		}
+	}
+
+	// h1/h2 responses advertise the QUIC listener
+	altSvc := altSvcFor(cfg)
+
+	// Build identification on every response, if enabled
+	version := ""
+	if cfg.VersionHeader {
+		version = admin.Build().String()
+	}
+
+	errorRenderer := edgehttp.ErrorRenderer(edgehttp.PlainErrors)
+	if cfg.NegotiateErrors {
+		errorRenderer = edgehttp.NegotiatedErrors
+	}
+
 	handler := edgehttp.Handler(
-		MaxHeaderBytes,
-		MaxBodyBytes,
+		edgehttp.Limits{
+			HeaderBytes:          cfg.MaxHeaderBytes,
+			HeaderValueBytes:     cfg.MaxHeaderValueBytes,
+			BodyBytes:            cfg.MaxBodyBytes,
+			MaxInFlight:          cfg.ActorMaxInFlight,
+			MaxInFlightPerClient: cfg.ActorMaxPerClient,
+			RetryAfter:           cfg.RetryAfterSecond,
+
+			BodyBytesByPrefix: cfg.PathBodyLimits,
+		},
+		edgehttp.Options{
+			Compression: edgehttp.Compression{
+				Enabled:  cfg.CompressResponses,
+				MinBytes: cfg.CompressMinBytes,
+				Level:    cfg.CompressLevel,
+			},
+			DecompressRequests: cfg.DecompressBodies,
+			ETags:              cfg.EnableETags,
+			StaleCache: edgehttp.StaleCache{
+				Entries: cfg.StaleCacheEntries,
+				TTL:     cfg.StaleCacheTTL,
+			},
+			Methods: edgehttp.MethodPolicy{
+				Allowed:  cfg.AllowedMethods,
+				ByPrefix: cfg.PathAllowedMethods,
+			},
+			Cookies: edgehttp.CookiePolicy{
+				Secure:   cfg.CookieSecure,
+				HttpOnly: cfg.CookieHttpOnly,
+				SameSite: cfg.CookieSameSite,
+				Exempt:   cfg.CookiePolicyExempt,
+			},
+			Errors: errorRenderer,
+			BodyLog: edgehttp.BodyLog{
+				Enabled:      cfg.BodyLogEnabled,
+				MaxBytes:     cfg.BodyLogMaxBytes,
+				RedactFields: cfg.BodyLogRedactFields,
+				Sources:      bodyLogSources,
+			},
+			InspectBody:    InspectBody,
+			Allowlist:      allowlist,
+			TrustedProxies: trustedProxies,
+			Geo:            geo,
+			Cleared:        Cleared,
+			AltSvc:         altSvc,
+			RequestID:      cfg.RequestIDHeader,
+			Version:        version,
+		},
 		Limited,
-		func(path, ua string) bool { return Blocked(path, ua) },
-		func(remote string) bool { return Challenge(remote) },
+		BlockedReason,
+		Challenge,
 		coreCall,
 		newIDs,
 		AccessLog,
@@ -113,44 +293,167 @@ func main() {
 		MetricError,
 	)
 
+	// CORS preflights are answered at the edge
+	handler = edgehttp.CORS(edgehttp.CORSPolicy{
+		Enabled:          cfg.CORSEnabled,
+		AllowedOrigins:   cfg.CORSAllowedOrigins,
+		AllowedMethods:   cfg.CORSAllowedMethods,
+		AllowedHeaders:   cfg.CORSAllowedHeaders,
+		ExposedHeaders:   cfg.CORSExposedHeaders,
+		AllowCredentials: cfg.CORSAllowCredentials,
+		MaxAgeSeconds:    cfg.CORSMaxAgeSeconds,
+	}, handler)
+
+	// Challenge puzzles are issued and verified ahead of the dispatcher
+	handler = ChallengeEndpoint(handler, trustedProxies)
+
+	// Health probes short-circuit ahead of all middleware
+	healthSources, err := edgehttp.ParseCIDRs(cfg.HealthCheckSources)
+	if err != nil {
+		logging.Fatal("health check sources: %v", err)
+	}
+	handler = edgehttp.HealthFastPath(cfg.HealthCheckPath, healthSources, handler)
+
 	// HTTP/1.1 + HTTP/2
-	srv := edgehttp.NewH2H1Server(handler, MaxHeaderBytes, edgehttp.Timeouts{
-		Read:       ReadTimeout,
-		Write:      WriteTimeout,
-		Idle:       IdleTimeout,
-		ReadHeader: ReadHeaderTO,
+	srv := edgehttp.NewH2H1Server(handler, cfg.MaxHeaderBytes, edgehttp.Timeouts{
+		Read:       cfg.ReadTimeout,
+		Write:      cfg.WriteTimeout,
+		Idle:       cfg.IdleTimeout,
+		ReadHeader: cfg.ReadHeaderTO,
 	})
+	edgehttp.ResumeHijacked(srv) // custom reason phrases keep HTTP/1.1 connections alive
+	conns := edgehttp.NewConnTracker(cfg.MaxConnsPerIP, MetricConnState, func(reason string) { MetricReject(reason, 0) })
+	conns.Hook(srv)
+	drainer := edgehttp.NewDrainer(srv, cfg.DrainTimeout)
 
-	ln, err := edgetls.ListenTLS("tcp", TLSListenAddr, tlsCfg)
+	tcpLn, err := edgehttp.Listen(cfg.TLSListenAddr, cfg.ListenMaxConns, cfg.TCPKeepAlive)
 	if err != nil {
-		log.Fatalf("TLS listen failed: %v", err)
+		logging.Fatal("TLS listen failed: %v", err)
 	}
+	ln := edgetls.NewListener(tcpLn, tlsCfg)
 	defer ln.Close()
 
 	go func() {
-		MetricTransport("h2_h1_tls")
-		log.Printf("Edge serving TLS (ALPN: h2,http/1.1) at https://0.0.0.0%s", TLSListenAddr)
-		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("HTTP server error: %v", err)
+		logging.Info("Edge serving TLS (ALPN: h2,http/1.1) at https://0.0.0.0%s", cfg.TLSListenAddr)
+		if err := drainer.Serve(ln); err != nil && err != http.ErrServerClosed {
+			logging.Fatal("HTTP server error: %v", err)
 		}
 	}()
 
+	// Plaintext HTTP/1.1 + h2c
+	var h2cDrainer *edgehttp.Drainer
+	if cfg.EnableH2C {
+		h2cSrv := edgehttp.NewH2CServer(handler, cfg.MaxHeaderBytes, edgehttp.Timeouts{
+			Read:       cfg.ReadTimeout,
+			Write:      cfg.WriteTimeout,
+			Idle:       cfg.IdleTimeout,
+			ReadHeader: cfg.ReadHeaderTO,
+		})
+		edgehttp.ResumeHijacked(h2cSrv)
+		conns.Hook(h2cSrv)
+		h2cDrainer = edgehttp.NewDrainer(h2cSrv, cfg.DrainTimeout)
+		h2cLn, err := edgehttp.Listen(cfg.H2CListenAddr, cfg.ListenMaxConns, cfg.TCPKeepAlive)
+		if err != nil {
+			logging.Fatal("h2c listen failed: %v", err)
+		}
+		defer h2cLn.Close()
+		go func() {
+			logging.Info("Edge serving plaintext (h2c,http/1.1) at http://0.0.0.0%s", cfg.H2CListenAddr)
+			if err := h2cDrainer.Serve(h2cLn); err != nil && err != http.ErrServerClosed {
+				logging.Fatal("h2c server error: %v", err)
+			}
+		}()
+	}
+
 	// HTTP/3 QUIC
-	if EnableHTTP3 {
-		go edgequic.ListenAndServe(TLSListenAddr, tlsCfg, handler)
+	var quicSrv *edgequic.Server
+	if cfg.EnableHTTP3 {
+		quicSrv, err = edgequic.NewServer(cfg.TLSListenAddr, tlsCfg, handler, cfg.DrainTimeout, cfg.RetryAfterSecond, cfg.quicTransport())
+		if err != nil {
+			logging.Fatal("HTTP/3 config: %v", err)
+		}
+		if err := quicSrv.Listen(); err != nil {
+			logging.Fatal("HTTP/3 listen failed: %v", err)
+		}
+		go func() {
+			if err := quicSrv.Serve(); err != nil {
+				logging.Fatal("HTTP/3 server error: %v", err)
+			}
+		}()
 	}
 
 	// WebSocket/SSE
-	go edgews.ListenAndServe(WSListenAddr)
+	wsSrv := edgews.NewServer(cfg.WSListenAddr, coreCall, newIDs, edgews.Options{
+		CheckOrigin:       cfg.WSCheckOrigin,
+		AllowedOrigins:    cfg.WSAllowedOrigins,
+		PingInterval:      cfg.WSPingInterval,
+		PongWait:          cfg.WSPongWait,
+		MaxMessageBytes:   cfg.WSMaxMessageBytes,
+		WriteTimeout:      cfg.WSWriteTimeout,
+		EnableCompression: cfg.WSCompression,
+		CompressionLevel:  cfg.WSCompressionLvl,
+		JSONErrors:        cfg.WSJSONErrors,
+		MaxConns:          cfg.WSMaxConns,
+		Authorize:         wsAuthorizer(cfg, trustedProxies),
+		HubQueue:          cfg.WSHubQueue,
+		SSEPoll:           cfg.SSEPollInterval,
+		SSEKeepalive:      cfg.SSEKeepalive,
+		DrainTimeout:      cfg.DrainTimeout,
+		Metric:            MetricWS,
+	})
+	go wsSrv.ListenAndServe()
 
 	// Admin health + metrics
-	go admin.ListenAndServe(AdminListenAddr, admin.HealthHandler, admin.MetricsHandler)
+	admin.RegisterCollector(admin.RuntimeCollector)
+	admin.RegisterCollector(actorConns.writeMetrics)
+	admin.RegisterCollector(wsConnMetrics(wsSrv.Active))
+	adminSrv := admin.NewServer(cfg.AdminListenAddr, admin.HealthHandler, admin.MetricsHandler)
+	adminSrv.Handle("/ratelimit", admin.RateLimitHandler(SetRateLimit))
+	adminSrv.Handle("/waf/reload", admin.ReloadHandler(ReloadWAFRules))
+	go runTrafficSampler(ctx)
+	adminSrv.Handle("/snapshot", admin.SnapshotHandler(TrafficSnapshot))
+	adminSrv.Handle("/version", admin.VersionHandler)
+	readiness := admin.NewReadiness(map[string]admin.ReadyCheck{"actor": actors.probe}, cfg.ReadyCheckTimeout)
+	adminSrv.Handle("/ready", readiness.ServeHTTP)
+	adminSrv.OnRequest(MetricAdmin)
+	go adminSrv.ListenAndServe()
 
 	<-ctx.Done()
-	log.Println("Shutting down edge...")
-	shutdownCtx, cancelSD := context.WithTimeout(context.Background(), ShutdownTimeout)
+	// Fail readiness first and keep serving normally while load balancers stop routing to us
+	readiness.SetDraining()
+	// Shutdown timing is hot-reloadable, so read the current config rather than the startup one
+	logging.Info("Shutting down edge: draining readiness for %s", conf().ReadyDrainDelay)
+	time.Sleep(conf().ReadyDrainDelay)
+	shutdownCtx, cancelSD := context.WithTimeout(context.Background(), conf().ShutdownTimeout)
 	defer cancelSD()
-	_ = srv.Shutdown(shutdownCtx)
-	log.Println("Edge shutdown complete.")
+
+	// Drain all transports concurrently: idle connections get DrainTimeout to close on their own,
+	// in-flight requests get the shared ShutdownTimeout deadline. Admin goes last so /ready
+	// keeps reporting "draining" until traffic has stopped.
+	shutdowns := map[string]func(context.Context) error{
+		"h2_h1": drainer.Shutdown,
+		"ws":    wsSrv.Shutdown,
+	}
+	if quicSrv != nil {
+		shutdowns["h3"] = quicSrv.Shutdown
+	}
+	if h2cDrainer != nil {
+		shutdowns["h2c"] = h2cDrainer.Shutdown
+	}
+	var wg sync.WaitGroup
+	for name, fn := range shutdowns {
+		wg.Add(1)
+		go func(name string, fn func(context.Context) error) {
+			defer wg.Done()
+			if err := fn(shutdownCtx); err != nil {
+				logging.Warn("%s shutdown: %v", name, err)
+			}
+		}(name, fn)
+	}
+	wg.Wait()
+	if err := adminSrv.Shutdown(shutdownCtx); err != nil {
+		logging.Warn("admin shutdown: %v", err)
+	}
+	logging.Info("Edge shutdown complete.")
 	fmt.Println("") // flush newline
-}
\ No newline at end of file
+}
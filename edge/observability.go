@@ -1,47 +1,236 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"log"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"olwsx/edge/admin"
+	"olwsx/edge/logging"
+	"olwsx/edge/wire"
+)
+
+// In production this integrates real OTel exporters. Here: stable hooks with structured
+// fields for deterministic behavior; counters land in admin.Default, served on /metrics.
+
+// accessSeq drives the AccessLogSample 1-in-N decision without locking.
+var accessSeq atomic.Uint64
+
+// sampleAccess reports whether a request is access-logged: always for non-2xx statuses or
+// rate-limited/WAF hints, else every AccessLogSample-th request.
+func sampleAccess(status int, hints uint32) bool {
+	if conf().AccessLogSample <= 1 || status < 200 || status >= 300 || hints&(wire.HintRateLimited|wire.HintWAFBlocked) != 0 {
+		return true
+	}
+	return accessSeq.Add(1)%uint64(conf().AccessLogSample) == 0
+}
+
+// accessSink receives every access line in both formats: stderr, or AccessLogFile when set.
+// Access lines are governed by AccessLogEnabled and AccessLogSample, not by LogLevel.
+var accessSink = log.New(os.Stderr, "", log.LstdFlags)
+
+var requestsTotal = admin.Default.Counter("olwsx_edge_requests_total", "total requests processed")
+
+// Known metric label values; anything else is counted as "other" so a bug or a hostile
+// input cannot blow up series cardinality. New reasons/events must be added here.
+var (
+	rejectReasons = labelSet("method_not_allowed", "expectation_failed", "body_too_large", "bad_content_encoding",
+		"header_value_too_large", "headers_too_large", "client_in_flight", "core_saturated", "precondition_failed", "waf_timeout",
+		"waf_blocked", "geo_blocked", "challenge_issued", "challenge_failed", "conn_limit")
+	errorNames     = labelSet("read_body_error", "core_actor_error", "version_mismatch")
+	transportKinds = labelSet("h1", "h2", "h3")
+	wsEvents       = labelSet("upgrade", "upgrade_rejected", "unauthorized", "conn_limit", "timeout", "write_timeout", "too_large", "actor_unavailable", "slow_consumer")
+	adminEvents    = labelSet("health", "metrics", "ready", "ratelimit", "waf_reload", "snapshot", "version", "not_found")
 )
 
-// In production this integrates real OTel and Prometheus exporters.
-// Here: stable hooks with structured fields for deterministic behavior.
+func labelSet(values ...string) map[string]bool {
+	m := make(map[string]bool, len(values))
+	for _, v := range values {
+		m[v] = true
+	}
+	return m
+}
 
-func AccessLog(method, path string, status, bodyLen int, hints uint32, dur time.Duration, remote, ua string) {
-	if !AccessLogEnabled {
+// bounded returns v if it is a known label value, else "other".
+func bounded(v string, known map[string]bool) string {
+	if known[v] {
+		return v
+	}
+	return "other"
+}
+
+// statusClass buckets an HTTP status as "2xx", "4xx", ...
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "other"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// AccessLog is called once per dispatched request, so it also feeds the request metrics.
+func AccessLog(method, path, transport string, status, bodyLen int, hints uint32, wafRule string, dur time.Duration, remote, ua string, traceID, spanID uint64, requestID, actorSpan string) {
+	if conf().MetricsEnabled {
+		class := statusClass(status)
+		requestsTotal.Inc()
+		MetricTransport(transport)
+		admin.Default.Counter("olwsx_edge_responses_total", "responses by status class", "class", class).Inc()
+		admin.Default.Histogram("olwsx_edge_request_duration_seconds", "request latency at the edge",
+			conf().LatencyBuckets, "class", class, "transport", bounded(transport, transportKinds)).Observe(dur.Seconds())
+		if wafRule != "" { // rule IDs come from the loaded ruleset, so the label set stays bounded
+			admin.Default.Counter("olwsx_edge_waf_matches_total", "requests flagged by the WAF, by rule", "rule", wafRule).Inc()
+		}
+	}
+	if !conf().AccessLogEnabled || !sampleAccess(status, hints) {
+		return
+	}
+	if conf().AccessLogFormat == "json" {
+		writeAccessLogJSON(method, path, transport, status, bodyLen, hints, wafRule, dur, remote, ua, traceID, spanID, requestID, actorSpan)
 		return
 	}
-	log.Printf("access method=%s path=%q status=%d body=%d hints=0x%08x dur=%s remote=%s ua=%q",
-		method, path, status, bodyLen, hints, dur, remote, ua)
+	const format = "access method=%s path=%q proto=%s status=%d body=%d hints=0x%08x waf=%s dur=%s remote=%s ua=%q trace=%016x span=%016x rid=%s actor_span=%s"
+	accessSink.Printf(format, method, path, transport, status, bodyLen, hints, orDash(wafRule), dur, remote, ua, traceID, spanID, orDash(requestID), orDash(actorSpan))
+}
+
+// orDash renders an empty value as "-" so text access lines keep a fixed field layout.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// MetricReject counts a rejected request and logs it at debug level with its trace ID, so a
+// reject can be followed from the counter to the request (0 = not tied to one).
+func MetricReject(reason string, traceID uint64) {
+	if conf().MetricsEnabled {
+		admin.Default.Counter("olwsx_edge_rejects_total", "requests rejected by the edge, by reason", "reason", bounded(reason, rejectReasons)).Inc()
+	}
+	logging.Debug("reject reason=%s trace=%016x", reason, traceID)
 }
 
-func MetricReject(reason string) {
-	if MetricsEnabled {
-		log.Printf("metric reject reason=%s", reason)
+// MetricError counts an edge or core/actor error and logs it at debug level with its trace ID.
+func MetricError(name string, traceID uint64) {
+	if conf().MetricsEnabled {
+		admin.Default.Counter("olwsx_edge_errors_total", "edge and core/actor errors, by name", "name", bounded(name, errorNames)).Inc()
 	}
+	logging.Debug("error name=%s trace=%016x", name, traceID)
 }
 
-func MetricError(name string) {
-	if MetricsEnabled {
-		log.Printf("metric error name=%s", name)
+func MetricTransport(kind string) {
+	if conf().MetricsEnabled {
+		admin.Default.Counter("olwsx_edge_transport_total", "requests by transport", "kind", bounded(kind, transportKinds)).Inc()
 	}
 }
 
-func MetricTransport(name string) {
-	if MetricsEnabled {
-		log.Printf("metric transport name=%s", name)
+// MetricConnState moves a connection between the olwsx_edge_connections{state} gauges; from
+// "" is a new connection and to "closed" one that is gone. Gauges are kept even with
+// MetricsEnabled off so toggling it on a reload cannot skew them.
+func MetricConnState(from, to string) {
+	if from != "" {
+		admin.Default.Gauge("olwsx_edge_connections", "open h1/h2 connections, by state", "state", from).Add(-1)
+	}
+	if to == "closed" {
+		admin.Default.Counter("olwsx_edge_connections_closed_total", "h1/h2 connections closed or hijacked").Inc()
+		return
 	}
+	admin.Default.Gauge("olwsx_edge_connections", "open h1/h2 connections, by state", "state", to).Add(1)
 }
 
 func MetricWS(event string) {
-	if MetricsEnabled {
-		log.Printf("metric ws event=%s", event)
+	if conf().MetricsEnabled {
+		admin.Default.Counter("olwsx_edge_ws_events_total", "WebSocket/SSE events", "event", bounded(event, wsEvents)).Inc()
+	}
+}
+
+// wsConnMetrics is an admin collector reporting the live WebSocket connection and SSE stream count.
+func wsConnMetrics(active func() int64) admin.Collector {
+	return func(w io.Writer) {
+		fmt.Fprintln(w, "# HELP olwsx_edge_ws_connections open WebSocket connections and SSE streams")
+		fmt.Fprintln(w, "# TYPE olwsx_edge_ws_connections gauge")
+		fmt.Fprintf(w, "olwsx_edge_ws_connections %d\n", active())
 	}
 }
 
 func MetricAdmin(event string) {
-	if MetricsEnabled {
-		log.Printf("metric admin event=%s", event)
+	if conf().MetricsEnabled {
+		admin.Default.Counter("olwsx_edge_admin_events_total", "admin server events", "event", bounded(event, adminEvents)).Inc()
 	}
-}
\ No newline at end of file
+}
+
+// trafficWindow is how often runTrafficSampler closes a snapshot window.
+const trafficWindow = time.Second
+
+// traffic holds the counters at the end of the last sampled window (the first starts at boot)
+// and that window's summary. Only sampleTraffic advances it, so readers never shift the window.
+var traffic = struct {
+	sync.Mutex
+	at               time.Time
+	requests, errors uint64
+	latency          []uint64
+	last             admin.Snapshot
+}{at: time.Now()}
+
+// runTrafficSampler closes a traffic window every trafficWindow until ctx is done.
+func runTrafficSampler(ctx context.Context) {
+	t := time.NewTicker(trafficWindow)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			sampleTraffic()
+		}
+	}
+}
+
+// TrafficSnapshot returns the summary of the last sampled window; before the first one closes
+// it reports no traffic. Any number of consumers may poll it without skewing each other.
+func TrafficSnapshot() admin.Snapshot {
+	traffic.Lock()
+	defer traffic.Unlock()
+	if traffic.last.TsMs == 0 {
+		return admin.Snapshot{TsMs: time.Now().UnixMilli(), Traffic: admin.TrafficStats{LatencyMs: map[string]int{"p50": 0, "p90": 0, "p99": 0}}}
+	}
+	return traffic.last
+}
+
+// sampleTraffic closes the current window from the metrics registry: request rate,
+// p50/p90/p99 edge latency and the 5xx ratio since the previous sample.
+func sampleTraffic() {
+	traffic.Lock()
+	defer traffic.Unlock()
+	now := time.Now()
+	elapsed := now.Sub(traffic.at)
+	bounds := conf().LatencyBuckets
+	requests := requestsTotal.Value()
+	errors := admin.Default.CounterSum("olwsx_edge_responses_total", "class", "5xx")
+	latency := admin.Default.HistogramCounts("olwsx_edge_request_duration_seconds", bounds)
+	window := make([]uint64, len(latency))
+	for i, c := range latency {
+		window[i] = c
+		if i < len(traffic.latency) {
+			window[i] -= traffic.latency[i]
+		}
+	}
+	stats := admin.TrafficStats{LatencyMs: map[string]int{}}
+	for _, q := range []struct {
+		name string
+		q    float64
+	}{{"p50", 0.5}, {"p90", 0.9}, {"p99", 0.99}} {
+		stats.LatencyMs[q.name] = int(math.Round(admin.BucketQuantile(bounds, window, q.q) * 1000))
+	}
+	if n := requests - traffic.requests; n > 0 {
+		stats.RateRPS = int(math.Round(float64(n) / elapsed.Seconds()))
+		stats.ErrorRatio = float64(errors-traffic.errors) / float64(n)
+	}
+	traffic.at, traffic.requests, traffic.errors, traffic.latency = now, requests, errors, latency
+	traffic.last = admin.Snapshot{TsMs: now.UnixMilli(), Traffic: stats}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"olwsx/edge/admin"
+	edgehttp "olwsx/edge/http"
+	"olwsx/edge/logging"
+)
+
+// metricsEdge is a dispatcher wired to the real metric hooks; the actor fails on /down.
+func metricsEdge() http.Handler {
+	return edgehttp.Handler(
+		edgehttp.Limits{HeaderBytes: 64 << 10, BodyBytes: 16},
+		edgehttp.Options{},
+		nil, nil, nil,
+		func(method, path, headers string, body []byte, traceID, spanID uint64, hints uint32) (edgehttp.CoreResp, int) {
+			if path == "/down" {
+				return edgehttp.CoreResp{}, 4
+			}
+			return edgehttp.CoreResp{Status: 200, Body: []byte("ok")}, 0
+		},
+		newIDs, AccessLog, MetricReject, MetricError)
+}
+
+// counterValues reads the current value of each labeled series from the registry.
+func counterValues(series map[string][]string) map[string]uint64 {
+	out := make(map[string]uint64, len(series))
+	for key, q := range series {
+		out[key] = admin.Default.CounterSum(q[0], q[1:]...)
+	}
+	return out
+}
+
+func TestDispatcherFeedsMetricsRegistry(t *testing.T) {
+	withConfig(t, func(c *Config) { c.AccessLogEnabled = false })
+	series := map[string][]string{
+		"requests": {"olwsx_edge_requests_total"},
+		"2xx":      {"olwsx_edge_responses_total", "class", "2xx"},
+		"4xx":      {"olwsx_edge_responses_total", "class", "4xx"},
+		"5xx":      {"olwsx_edge_responses_total", "class", "5xx"},
+		"too_big":  {"olwsx_edge_rejects_total", "reason", "body_too_large"},
+		"core":     {"olwsx_edge_errors_total", "name", "core_actor_error"},
+		"h1":       {"olwsx_edge_transport_total", "kind", "h1"},
+	}
+	before := counterValues(series)
+
+	h := metricsEdge()
+	for _, r := range []*http.Request{
+		httptest.NewRequest("GET", "/ok", nil),
+		httptest.NewRequest("GET", "/ok", nil),
+		httptest.NewRequest("GET", "/down", nil),
+		httptest.NewRequest("POST", "/ok", strings.NewReader(strings.Repeat("x", 64))),
+	} {
+		h.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	after := counterValues(series)
+	for key, want := range map[string]uint64{"requests": 4, "2xx": 2, "4xx": 1, "5xx": 1, "too_big": 1, "core": 1, "h1": 4} {
+		if got := after[key] - before[key]; got != want {
+			t.Errorf("%s %v grew by %d, want %d", key, series[key], got, want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	admin.MetricsHandler(rec, httptest.NewRequest("GET", "/metrics", nil))
+	text := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE olwsx_edge_requests_total counter\n",
+		`olwsx_edge_responses_total{class="2xx"} `,
+		`olwsx_edge_rejects_total{reason="body_too_large"} `,
+		`olwsx_edge_errors_total{name="core_actor_error"} `,
+		`olwsx_edge_request_duration_seconds_count{class="5xx",transport="h1"} `,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("exposition missing %q", want)
+		}
+	}
+}
+
+func TestMetricsDisabledCountsNothing(t *testing.T) {
+	withConfig(t, func(c *Config) { c.MetricsEnabled = false; c.AccessLogEnabled = false })
+	before := admin.Default.CounterSum("olwsx_edge_requests_total")
+	metricsEdge().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/ok", nil))
+	if admin.Default.CounterSum("olwsx_edge_requests_total") != before {
+		t.Error("requests counted with metrics disabled")
+	}
+}
+
+func TestAccessLogObservesLatencyHistogram(t *testing.T) {
+	withConfig(t, func(c *Config) { c.AccessLogEnabled = false; c.LatencyBuckets = []float64{0.25, 0.5, 1} })
+	// 1xx over h3 is a series no other test touches, so its bounds come from this config
+	for _, d := range []time.Duration{125 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond, 750 * time.Millisecond, 2 * time.Second} {
+		AccessLog("GET", "/", "h3", 101, 0, 0, "", d, "192.0.2.1", "", 1, 2, "", "")
+	}
+
+	rec := httptest.NewRecorder()
+	admin.MetricsHandler(rec, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		"# TYPE olwsx_edge_request_duration_seconds histogram\n",
+		`olwsx_edge_request_duration_seconds_bucket{class="1xx",transport="h3",le="0.25"} 2` + "\n",
+		`olwsx_edge_request_duration_seconds_bucket{class="1xx",transport="h3",le="0.5"} 3` + "\n",
+		`olwsx_edge_request_duration_seconds_bucket{class="1xx",transport="h3",le="1"} 4` + "\n",
+		`olwsx_edge_request_duration_seconds_bucket{class="1xx",transport="h3",le="+Inf"} 5` + "\n",
+		`olwsx_edge_request_duration_seconds_sum{class="1xx",transport="h3"} 3.625` + "\n",
+		`olwsx_edge_request_duration_seconds_count{class="1xx",transport="h3"} 5` + "\n",
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("exposition missing %q", want)
+		}
+	}
+}
+
+func TestRejectAndTransportCountersPerLabel(t *testing.T) {
+	withConfig(t, func(c *Config) {})
+	series := map[string][]string{
+		"waf":       {"olwsx_edge_rejects_total", "reason", "waf_blocked"},
+		"geo":       {"olwsx_edge_rejects_total", "reason", "geo_blocked"},
+		"h2":        {"olwsx_edge_transport_total", "kind", "h2"},
+		"h3":        {"olwsx_edge_transport_total", "kind", "h3"},
+		"ws":        {"olwsx_edge_ws_events_total", "event", "upgrade"},
+		"admin":     {"olwsx_edge_admin_events_total", "event", "health"},
+		"rejects":   {"olwsx_edge_rejects_total"},
+		"transport": {"olwsx_edge_transport_total"},
+	}
+	before := counterValues(series)
+	MetricReject("waf_blocked", 1)
+	MetricReject("waf_blocked", 2)
+	MetricReject("geo_blocked", 3)
+	MetricTransport("h2")
+	MetricTransport("h3")
+	MetricTransport("h3")
+	MetricWS("upgrade")
+	MetricAdmin("health")
+
+	after := counterValues(series)
+	for key, want := range map[string]uint64{"waf": 2, "geo": 1, "h2": 1, "h3": 2, "ws": 1, "admin": 1, "rejects": 3, "transport": 3} {
+		if got := after[key] - before[key]; got != want {
+			t.Errorf("%s %v grew by %d, want %d", key, series[key], got, want)
+		}
+	}
+}
+
+func TestRejectAndErrorLogTraceID(t *testing.T) {
+	withConfig(t, func(c *Config) {})
+	var buf bytes.Buffer
+	prev := logging.Default()
+	logging.SetDefault(logging.New(&buf, logging.LevelDebug))
+	t.Cleanup(func() { logging.SetDefault(prev) })
+
+	MetricReject("waf_blocked", 0xabc)
+	MetricError("core_actor_error", 0xdef)
+	for _, want := range []string{"reject reason=waf_blocked trace=0000000000000abc", "error name=core_actor_error trace=0000000000000def"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("log missing %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestUnknownMetricLabelsAreBounded(t *testing.T) {
+	withConfig(t, func(c *Config) {})
+	for i := 0; i < 3; i++ {
+		MetricReject("attacker-chosen-"+strconv.Itoa(i), 0)
+		MetricTransport("gopher" + strconv.Itoa(i))
+		MetricWS("ws-" + strconv.Itoa(i))
+		MetricAdmin("/admin/" + strconv.Itoa(i))
+	}
+
+	rec := httptest.NewRecorder()
+	admin.MetricsHandler(rec, httptest.NewRequest("GET", "/metrics", nil))
+	text := rec.Body.String()
+	for _, leak := range []string{"attacker-chosen", "gopher", "ws-", "/admin/"} {
+		if strings.Contains(text, leak) {
+			t.Errorf("unknown label %q reached the exposition", leak)
+		}
+	}
+	for _, want := range []string{
+		`olwsx_edge_rejects_total{reason="other"} `,
+		`olwsx_edge_transport_total{kind="other"} `,
+		`olwsx_edge_ws_events_total{event="other"} `,
+		`olwsx_edge_admin_events_total{event="other"} `,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("exposition missing %q", want)
+		}
+	}
+}
+
+func TestConnStateGauges(t *testing.T) {
+	gauge := func(state string) int64 {
+		return admin.Default.Gauge("olwsx_edge_connections", "open h1/h2 connections, by state", "state", state).Value()
+	}
+	closed := func() uint64 { return admin.Default.CounterSum("olwsx_edge_connections_closed_total") }
+	newBefore, idleBefore, closedBefore := gauge("new"), gauge("idle"), closed()
+
+	MetricConnState("", "new")
+	MetricConnState("", "new")
+	MetricConnState("new", "active")
+	MetricConnState("active", "idle")
+	if gauge("new")-newBefore != 1 || gauge("idle")-idleBefore != 1 {
+		t.Errorf("new %+d, idle %+d; want +1 each", gauge("new")-newBefore, gauge("idle")-idleBefore)
+	}
+	MetricConnState("idle", "closed")
+	MetricConnState("new", "closed")
+	if gauge("new") != newBefore || gauge("idle") != idleBefore || closed()-closedBefore != 2 {
+		t.Errorf("after closing: new %+d, idle %+d, closed %+d", gauge("new")-newBefore, gauge("idle")-idleBefore, closed()-closedBefore)
+	}
+}
+
+func TestWSConnectionGaugeReadsLiveCount(t *testing.T) {
+	var n int64 = 3
+	var buf strings.Builder
+	collect := wsConnMetrics(func() int64 { return n })
+	collect(&buf)
+	n = 0
+	collect(&buf)
+	if !strings.Contains(buf.String(), "# TYPE olwsx_edge_ws_connections gauge\n") ||
+		!strings.Contains(buf.String(), "olwsx_edge_ws_connections 3\n") || !strings.HasSuffix(buf.String(), "olwsx_edge_ws_connections 0\n") {
+		t.Errorf("collector wrote:\n%s", buf.String())
+	}
+}
+
+func TestEveryKnownWSAndAdminEventHasItsSeries(t *testing.T) {
+	withConfig(t, func(c *Config) {})
+	for _, tc := range []struct {
+		name string
+		set  map[string]bool
+		hook func(string)
+	}{
+		{"olwsx_edge_ws_events_total", wsEvents, MetricWS},
+		{"olwsx_edge_admin_events_total", adminEvents, MetricAdmin},
+	} {
+		for event := range tc.set {
+			before := admin.Default.CounterSum(tc.name, "event", event)
+			tc.hook(event)
+			if got := admin.Default.CounterSum(tc.name, "event", event) - before; got != 1 {
+				t.Errorf("%s{event=%q} grew by %d", tc.name, event, got)
+			}
+		}
+	}
+}
+
+// rewindTraffic backdates the start of the current snapshot window by d.
+func rewindTraffic(d time.Duration) {
+	traffic.Lock()
+	traffic.at = time.Now().Add(-d)
+	traffic.Unlock()
+}
+
+// trafficRequests records 100 requests: 50 in (25ms, 50ms], 40 in (50ms, 100ms], 10 failing in (100ms, 250ms].
+func trafficRequests() {
+	for i := 0; i < 100; i++ {
+		status, dur := 200, 30*time.Millisecond
+		switch {
+		case i >= 90:
+			status, dur = 503, 200*time.Millisecond
+		case i >= 50:
+			dur = 70 * time.Millisecond
+		}
+		AccessLog("GET", "/", "h1", status, 0, 0, "", dur, "192.0.2.1", "", 1, 2, "", "")
+	}
+}
+
+func TestTrafficSnapshotReflectsTraffic(t *testing.T) {
+	withConfig(t, func(c *Config) { c.AccessLogEnabled = false })
+	// Close whatever window earlier tests left open, then time this one as 10s
+	sampleTraffic()
+	rewindTraffic(10 * time.Second)
+
+	trafficRequests()
+	sampleTraffic()
+	snap := TrafficSnapshot()
+	if snap.Traffic.RateRPS != 10 || math.Abs(snap.Traffic.ErrorRatio-0.1) > 1e-9 {
+		t.Errorf("rate %d rps, error ratio %v; want 10 and 0.1", snap.Traffic.RateRPS, snap.Traffic.ErrorRatio)
+	}
+	for q, want := range map[string]int{"p50": 50, "p90": 100, "p99": 235} {
+		if got := snap.Traffic.LatencyMs[q]; got != want {
+			t.Errorf("%s = %dms, want %d", q, got, want)
+		}
+	}
+
+	// Polls between samples repeat the last window rather than measuring a new one
+	if again := TrafficSnapshot(); again.TsMs != snap.TsMs {
+		t.Errorf("re-poll recomputed: %+v", again)
+	}
+	// An idle window reports no traffic, not the previous one
+	rewindTraffic(10 * time.Second)
+	sampleTraffic()
+	if idle := TrafficSnapshot(); idle.Traffic.RateRPS != 0 || idle.Traffic.ErrorRatio != 0 || idle.Traffic.LatencyMs["p99"] != 0 {
+		t.Errorf("idle window: %+v", idle.Traffic)
+	}
+}
+
+func TestTrafficSnapshotConsumersDoNotSkewEachOther(t *testing.T) {
+	withConfig(t, func(c *Config) { c.AccessLogEnabled = false })
+	sampleTraffic()
+	rewindTraffic(10 * time.Second)
+
+	// A fast poller (e.g. the snapshot stream) reads throughout the window...
+	trafficRequests()
+	for i := 0; i < 5; i++ {
+		TrafficSnapshot()
+	}
+	sampleTraffic()
+	// ...and a slow one (e.g. the history sampler) still sees the whole window, as it does
+	// through the edge admin endpoint
+	direct := TrafficSnapshot()
+	rec := httptest.NewRecorder()
+	admin.SnapshotHandler(TrafficSnapshot)(rec, httptest.NewRequest("GET", "/snapshot", nil))
+	var served admin.Snapshot
+	if err := json.Unmarshal(rec.Body.Bytes(), &served); err != nil {
+		t.Fatal(err)
+	}
+	for name, snap := range map[string]admin.Snapshot{"direct": direct, "served": served} {
+		if snap.TsMs != direct.TsMs || snap.Traffic.RateRPS != 10 || math.Abs(snap.Traffic.ErrorRatio-0.1) > 1e-9 || snap.Traffic.LatencyMs["p50"] != 50 {
+			t.Errorf("%s consumer saw %+v", name, snap)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package quic
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// Transport tunes the QUIC connections behind the HTTP/3 server; zero values keep quic-go's
+// defaults (100 streams, 30s idle timeout, 512KB/768KB initial windows).
+type Transport struct {
+	MaxIncomingStreams      int64         // concurrent request streams per connection
+	MaxIdleTimeout          time.Duration // close connections silent for this long
+	InitialStreamWindow     uint64        // initial per-stream receive window (bytes)
+	MaxStreamWindow         uint64        // ceiling the stream window may auto-tune up to
+	InitialConnectionWindow uint64        // initial per-connection receive window (bytes)
+	MaxConnectionWindow     uint64        // ceiling the connection window may auto-tune up to
+	EnableDatagrams         bool          // RFC 9297 HTTP datagrams
+}
+
+// Upper bounds accepted by Validate.
+const (
+	maxStreams     = 1 << 16
+	maxIdle        = 10 * time.Minute
+	maxWindow      = 1 << 30 // 1GB
+	minIdleTimeout = time.Second
+)
+
+// Validate rejects values quic-go would misinterpret (a negative stream count disables streams
+// entirely) or silently clamp, and initial windows above their ceilings.
+func (t Transport) Validate() error {
+	if t.MaxIncomingStreams < 0 || t.MaxIncomingStreams > maxStreams {
+		return fmt.Errorf("quic: max incoming streams %d out of range 0..%d", t.MaxIncomingStreams, maxStreams)
+	}
+	if t.MaxIdleTimeout != 0 && (t.MaxIdleTimeout < minIdleTimeout || t.MaxIdleTimeout > maxIdle) {
+		return fmt.Errorf("quic: max idle timeout %s out of range %s..%s", t.MaxIdleTimeout, minIdleTimeout, maxIdle)
+	}
+	for _, w := range []struct {
+		name         string
+		initial, max uint64
+	}{
+		{"stream", t.InitialStreamWindow, t.MaxStreamWindow},
+		{"connection", t.InitialConnectionWindow, t.MaxConnectionWindow},
+	} {
+		if w.initial > maxWindow || w.max > maxWindow {
+			return fmt.Errorf("quic: %s window above %d bytes", w.name, maxWindow)
+		}
+		if w.initial != 0 && w.max != 0 && w.initial > w.max {
+			return fmt.Errorf("quic: initial %s window %d exceeds max %d", w.name, w.initial, w.max)
+		}
+	}
+	return nil
+}
+
+// quicConfig renders t; 0-RTT stays enabled as in http3's default config.
+func (t Transport) quicConfig() *quic.Config {
+	return &quic.Config{
+		MaxIncomingStreams:             t.MaxIncomingStreams,
+		MaxIdleTimeout:                 t.MaxIdleTimeout,
+		InitialStreamReceiveWindow:     t.InitialStreamWindow,
+		MaxStreamReceiveWindow:         t.MaxStreamWindow,
+		InitialConnectionReceiveWindow: t.InitialConnectionWindow,
+		MaxConnectionReceiveWindow:     t.MaxConnectionWindow,
+		EnableDatagrams:                t.EnableDatagrams,
+		Allow0RTT:                      true,
+	}
+}
@@ -0,0 +1,71 @@
+package quic
+
+import (
+	stdhttp "net/http"
+	"testing"
+	"time"
+)
+
+func TestTransportAppliedToQUICConfig(t *testing.T) {
+	tp := Transport{
+		MaxIncomingStreams:      250,
+		MaxIdleTimeout:          45 * time.Second,
+		InitialStreamWindow:     1 << 20,
+		MaxStreamWindow:         8 << 20,
+		InitialConnectionWindow: 2 << 20,
+		MaxConnectionWindow:     16 << 20,
+		EnableDatagrams:         true,
+	}
+	s, err := NewServer("127.0.0.1:0", nil, stdhttp.NotFoundHandler(), 0, 1, tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := s.h3.QUICConfig
+	if c.MaxIncomingStreams != 250 || c.MaxIdleTimeout != 45*time.Second ||
+		c.InitialStreamReceiveWindow != 1<<20 || c.MaxStreamReceiveWindow != 8<<20 ||
+		c.InitialConnectionReceiveWindow != 2<<20 || c.MaxConnectionReceiveWindow != 16<<20 ||
+		!c.EnableDatagrams || !c.Allow0RTT {
+		t.Errorf("QUICConfig = %+v", c)
+	}
+	if !s.h3.EnableDatagrams {
+		t.Error("datagrams not enabled on the HTTP/3 server")
+	}
+
+	// Zero values leave quic-go's defaults in place
+	s, err = NewServer("127.0.0.1:0", nil, stdhttp.NotFoundHandler(), 0, 1, Transport{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := s.h3.QUICConfig; c.MaxIncomingStreams != 0 || c.MaxIdleTimeout != 0 || c.EnableDatagrams || s.h3.EnableDatagrams {
+		t.Errorf("zero Transport = %+v", c)
+	}
+}
+
+func TestTransportValidation(t *testing.T) {
+	for name, tp := range map[string]Transport{
+		"negative streams":        {MaxIncomingStreams: -1},
+		"too many streams":        {MaxIncomingStreams: maxStreams + 1},
+		"idle too short":          {MaxIdleTimeout: 500 * time.Millisecond},
+		"idle too long":           {MaxIdleTimeout: time.Hour},
+		"stream window too big":   {MaxStreamWindow: maxWindow + 1},
+		"stream initial over max": {InitialStreamWindow: 2 << 20, MaxStreamWindow: 1 << 20},
+		"conn initial over max":   {InitialConnectionWindow: 2 << 20, MaxConnectionWindow: 1 << 20},
+	} {
+		if err := tp.Validate(); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+		if _, err := NewServer("127.0.0.1:0", nil, stdhttp.NotFoundHandler(), 0, 1, tp); err == nil {
+			t.Errorf("%s: NewServer accepted", name)
+		}
+	}
+	for name, tp := range map[string]Transport{
+		"zero":         {},
+		"bounds":       {MaxIncomingStreams: maxStreams, MaxIdleTimeout: maxIdle, MaxConnectionWindow: maxWindow},
+		"initial only": {InitialStreamWindow: 4 << 20},
+		"min idle":     {MaxIdleTimeout: minIdleTimeout},
+	} {
+		if err := tp.Validate(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
@@ -1,22 +1,149 @@
 package quic
 
 import (
+	"context"
 	"crypto/tls"
-	"log"
+	"errors"
+	"fmt"
+	"net"
 	stdhttp "net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/http3"
+
+	"olwsx/edge/logging"
 )
 
-// ListenAndServe starts an HTTP/3 server on the given address with shared handler.
-func ListenAndServe(addr string, cfg *tls.Config, handler stdhttp.Handler) {
-	s := &http3.Server{
-		Addr:      addr,
-		TLSConfig: cfg,
-		Handler:   handler,
+// Server wraps http3.Server with in-flight request and connection tracking, since http3 has no graceful close.
+type Server struct {
+	h3       *http3.Server
+	inflight sync.WaitGroup
+	draining atomic.Bool
+	drain    time.Duration
+	conns    atomic.Int64   // open QUIC connections
+	conn     net.PacketConn // bound by Listen
+}
+
+// NewServer builds an HTTP/3 server on the given address with shared handler and transport
+// tuning tp (validated here). drain is how long Shutdown lets idle connections close on their own;
+// requests arriving meanwhile get 503 with Retry-After retryAfter seconds (0 = 1).
+func NewServer(addr string, cfg *tls.Config, handler stdhttp.Handler, drain time.Duration, retryAfter int, tp Transport) (*Server, error) {
+	if err := tp.Validate(); err != nil {
+		return nil, err
+	}
+	s := &Server{drain: drain}
+	retry := strconv.Itoa(max(retryAfter, 1))
+	s.h3 = &http3.Server{
+		Addr:            addr,
+		TLSConfig:       cfg,
+		QUICConfig:      tp.quicConfig(),
+		EnableDatagrams: tp.EnableDatagrams,
+		ConnContext: func(ctx context.Context, c quic.Connection) context.Context {
+			s.conns.Add(1)
+			go func() {
+				<-c.Context().Done()
+				s.conns.Add(-1)
+			}()
+			return ctx
+		},
+		Handler: stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+			if s.draining.Load() {
+				w.Header().Set("Retry-After", retry)
+				stdhttp.Error(w, "shutting down", stdhttp.StatusServiceUnavailable)
+				return
+			}
+			s.inflight.Add(1)
+			defer s.inflight.Done()
+			handler.ServeHTTP(w, r)
+		}),
+	}
+	return s, nil
+}
+
+// Listen binds the UDP socket, so bind failures (e.g. port in use) reach the caller before
+// Serve runs in the background.
+func (s *Server) Listen() error {
+	conn, err := net.ListenPacket("udp", s.h3.Addr)
+	if err != nil {
+		return fmt.Errorf("http3 listen %s: %w", s.h3.Addr, err)
+	}
+	s.conn = conn
+	return nil
+}
+
+// Serve blocks until the server stops. It returns nil after Shutdown or Close and the serve
+// error otherwise; Listen must have succeeded.
+func (s *Server) Serve() error {
+	if s.conn == nil {
+		return errors.New("http3: Serve before Listen")
+	}
+	logging.Info("Edge serving HTTP/3 QUIC on %s", s.conn.LocalAddr())
+	err := s.h3.Serve(s.conn)
+	if s.draining.Load() || errors.Is(err, stdhttp.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// ListenAndServe is Listen followed by Serve.
+func (s *Server) ListenAndServe() error {
+	if err := s.Listen(); err != nil {
+		return err
+	}
+	return s.Serve()
+}
+
+// Close stops the server immediately, aborting in-flight requests.
+func (s *Server) Close() error {
+	s.draining.Store(true)
+	return s.closeTransport()
+}
+
+// closeTransport closes the http3 listeners and the UDP socket, which http3 does not own.
+func (s *Server) closeTransport() error {
+	err := s.h3.Close()
+	if s.conn != nil {
+		if cerr := s.conn.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Shutdown refuses new requests, waits for in-flight ones until ctx expires, gives idle connections
+// the drain window to close, then closes the listener.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.draining.Store(true)
+	done := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(done)
+	}()
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	// Requests are refused while draining, so clients close idle connections on their own
+	if err == nil && s.drain > 0 {
+		drainCtx, cancel := context.WithTimeout(ctx, s.drain)
+		tick := time.NewTicker(50 * time.Millisecond)
+		for s.conns.Load() > 0 && drainCtx.Err() == nil {
+			select {
+			case <-tick.C:
+			case <-drainCtx.Done():
+			}
+		}
+		tick.Stop()
+		cancel()
 	}
-	log.Printf("Edge serving HTTP/3 QUIC on %s", addr)
-	if err := s.ListenAndServe(); err != nil {
-		log.Printf("HTTP/3 server error: %v", err)
+	if cerr := s.closeTransport(); cerr != nil && err == nil {
+		err = cerr
 	}
-}
\ No newline at end of file
+	return err
+}
@@ -0,0 +1,134 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	edgetls "olwsx/edge/tls"
+)
+
+// blockingServer is an unbound server whose handler holds each request until unblock closes.
+func blockingServer(t *testing.T) (s *Server, entered chan struct{}, unblock chan struct{}) {
+	t.Helper()
+	entered, unblock = make(chan struct{}, 1), make(chan struct{})
+	s, err := NewServer("127.0.0.1:0", nil, stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		entered <- struct{}{}
+		<-unblock
+	}), 0, 3, Transport{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, entered, unblock
+}
+
+func TestShutdownWaitsForInFlightAndRefusesNew(t *testing.T) {
+	s, entered, unblock := blockingServer(t)
+	inflight := make(chan int, 1)
+	go func() {
+		rec := httptest.NewRecorder()
+		s.h3.Handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		inflight <- rec.Code
+	}()
+	<-entered
+
+	done := make(chan error, 1)
+	go func() { done <- s.Shutdown(context.Background()) }()
+	for !s.draining.Load() {
+		time.Sleep(time.Millisecond)
+	}
+	rec := httptest.NewRecorder()
+	s.h3.Handler.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != stdhttp.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "3" {
+		t.Errorf("request while draining: status %d, Retry-After %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("Shutdown returned with a request in flight: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(unblock)
+	if err := <-done; err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+	if code := <-inflight; code != stdhttp.StatusOK {
+		t.Errorf("in-flight request: status %d", code)
+	}
+}
+
+func TestShutdownGivesUpAtDeadline(t *testing.T) {
+	s, entered, unblock := blockingServer(t)
+	defer close(unblock)
+	go s.h3.Handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	<-entered
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Shutdown = %v, want deadline exceeded", err)
+	}
+}
+
+func TestBindFailureReachesCaller(t *testing.T) {
+	taken, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+	s, err := NewServer(taken.LocalAddr().String(), nil, stdhttp.NotFoundHandler(), 0, 1, Transport{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ListenAndServe(); err == nil || !strings.Contains(err.Error(), taken.LocalAddr().String()) {
+		t.Errorf("ListenAndServe on a bound port = %v", err)
+	}
+
+	idle, err := NewServer("127.0.0.1:0", nil, stdhttp.NotFoundHandler(), 0, 1, Transport{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := idle.Serve(); err == nil {
+		t.Error("Serve before Listen succeeded")
+	}
+}
+
+func TestCloseStopsServe(t *testing.T) {
+	cert, err := edgetls.LoadOrSelfSign("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServer("127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}}, stdhttp.NotFoundHandler(), 0, 1, Transport{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	addr := s.conn.LocalAddr().String()
+	served := make(chan error, 1)
+	go func() { served <- s.Serve() }()
+	time.Sleep(20 * time.Millisecond)
+
+	if err := s.Close(); err != nil {
+		t.Errorf("Close = %v", err)
+	}
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("Serve after Close = %v, want nil", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Serve still running after Close")
+	}
+	// The UDP socket is released
+	again, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		t.Fatalf("port still bound after Close: %v", err)
+	}
+	again.Close()
+}
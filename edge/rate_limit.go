@@ -1,9 +1,13 @@
 package main
 
 import (
+	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"olwsx/edge/admin"
 )
 
 type bucket struct {
@@ -14,9 +18,59 @@ type bucket struct {
 var (
 	mu      sync.Mutex
 	buckets = map[string]*bucket{}
+
+	// Runtime limiter settings; start at the config defaults and change via SetRateLimit.
+	bucketCapacity  atomic.Int64
+	refillPerSecond atomic.Int64
 )
 
-// Limited returns true if the IP is limited (true means limit applied).
+// MaxBucketCapacity bounds SetRateLimit so a typo cannot effectively disable the limiter.
+const MaxBucketCapacity = 1_000_000
+
+func init() {
+	bucketCapacity.Store(int64(conf().BucketCapacity))
+	refillPerSecond.Store(int64(conf().RefillPerSecond))
+	publishRateLimit()
+}
+
+// SetRateLimit replaces the per-IP bucket capacity and refill rate without a restart.
+// Existing buckets are clamped to the new capacity on their next request.
+func SetRateLimit(capacity, refillPerSec int) error {
+	if err := validRateLimit(capacity, refillPerSec); err != nil {
+		return err
+	}
+	mu.Lock()
+	bucketCapacity.Store(int64(capacity))
+	refillPerSecond.Store(int64(refillPerSec))
+	mu.Unlock()
+	publishRateLimit()
+	return nil
+}
+
+// validRateLimit is the range check shared by SetRateLimit and Config.Validate.
+func validRateLimit(capacity, refillPerSec int) error {
+	if capacity <= 0 || capacity > MaxBucketCapacity {
+		return fmt.Errorf("capacity %d out of range 1..%d", capacity, MaxBucketCapacity)
+	}
+	if refillPerSec <= 0 || refillPerSec > capacity {
+		return fmt.Errorf("refill %d/s out of range 1..%d", refillPerSec, capacity)
+	}
+	return nil
+}
+
+// publishRateLimit mirrors the active limiter settings into admin gauges.
+func publishRateLimit() {
+	capacity, refill := RateLimit()
+	admin.Default.Gauge("olwsx_edge_ratelimit_bucket_capacity", "per-IP token bucket capacity").Set(int64(capacity))
+	admin.Default.Gauge("olwsx_edge_ratelimit_refill_per_second", "per-IP token bucket refill rate").Set(int64(refill))
+}
+
+// RateLimit returns the active bucket capacity and refill rate.
+func RateLimit() (capacity, refillPerSec int) {
+	return int(bucketCapacity.Load()), int(refillPerSecond.Load())
+}
+
+// Limited returns true if the client IP (or a host:port peer address) is limited (true means limit applied).
 func Limited(remoteAddr string) bool {
 	host, _, err := net.SplitHostPort(remoteAddr)
 	if err != nil {
@@ -24,19 +78,20 @@ func Limited(remoteAddr string) bool {
 	}
 	now := time.Now()
 	mu.Lock()
+	capacity, refill := RateLimit()
 	b, ok := buckets[host]
 	if !ok {
-		b = &bucket{tokens: BucketCapacity, last: now}
+		b = &bucket{tokens: capacity, last: now}
 		buckets[host] = b
 	} else {
 		elapsed := int(now.Sub(b.last).Seconds())
 		if elapsed > 0 {
-			b.tokens += elapsed * RefillPerSecond
-			if b.tokens > BucketCapacity {
-				b.tokens = BucketCapacity
-			}
+			b.tokens += elapsed * refill
 			b.last = now
 		}
+		if b.tokens > capacity {
+			b.tokens = capacity
+		}
 	}
 	if b.tokens > 0 {
 		b.tokens--
@@ -45,4 +100,4 @@ func Limited(remoteAddr string) bool {
 	}
 	mu.Unlock()
 	return true
-}
\ No newline at end of file
+}
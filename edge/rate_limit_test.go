@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"olwsx/edge/admin"
+)
+
+// withRateLimit sets the limiter for one test with empty buckets, restoring it afterwards.
+func withRateLimit(t *testing.T, capacity, refill int) {
+	t.Helper()
+	prevCap, prevRefill := RateLimit()
+	resetBuckets := func() {
+		mu.Lock()
+		buckets = map[string]*bucket{}
+		mu.Unlock()
+	}
+	resetBuckets()
+	if err := SetRateLimit(capacity, refill); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		resetBuckets()
+		SetRateLimit(prevCap, prevRefill)
+	})
+}
+
+// allowed counts how many of n back-to-back requests from ip pass the limiter.
+func allowed(ip string, n int) int {
+	ok := 0
+	for i := 0; i < n; i++ {
+		if !Limited(ip + ":1234") {
+			ok++
+		}
+	}
+	return ok
+}
+
+func TestSetRateLimitRetunesLimiter(t *testing.T) {
+	withRateLimit(t, 3, 1)
+	if got := allowed("198.51.100.1", 10); got != 3 {
+		t.Fatalf("capacity 3 allowed %d requests", got)
+	}
+	if err := SetRateLimit(8, 4); err != nil {
+		t.Fatal(err)
+	}
+	if got := allowed("198.51.100.2", 20); got != 8 {
+		t.Errorf("capacity 8 allowed %d requests from a new client", got)
+	}
+	// Lowering the capacity clamps existing buckets on their next request
+	allowed("198.51.100.3", 1) // 7 tokens left
+	if err := SetRateLimit(2, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := allowed("198.51.100.3", 10); got != 2 {
+		t.Errorf("client with a clamped bucket got %d requests, want 2", got)
+	}
+}
+
+func TestSetRateLimitRejectsNonsense(t *testing.T) {
+	withRateLimit(t, 5, 2)
+	for _, tc := range [][2]int{{0, 1}, {-5, 1}, {10, 0}, {10, 11}, {MaxBucketCapacity + 1, 1}} {
+		if err := SetRateLimit(tc[0], tc[1]); err == nil {
+			t.Errorf("SetRateLimit(%d, %d) accepted", tc[0], tc[1])
+		}
+	}
+	if c, r := RateLimit(); c != 5 || r != 2 {
+		t.Errorf("limiter changed to %d/%d by rejected values", c, r)
+	}
+}
+
+func TestRateLimitEndpointRetunesLimiter(t *testing.T) {
+	withRateLimit(t, 50, 10)
+	srv := httptest.NewServer(admin.RateLimitHandler(SetRateLimit))
+	defer srv.Close()
+	post := func(body string) int {
+		resp, err := http.Post(srv.URL, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := post(`{"capacity": 2, "refill_per_s": 1}`); code != http.StatusOK {
+		t.Fatalf("status %d", code)
+	}
+	if got := allowed("198.51.100.4", 5); got != 2 {
+		t.Errorf("after the endpoint set capacity 2, %d requests passed", got)
+	}
+	if code := post(`{"capacity": 2, "refill_per_s": 9}`); code != http.StatusUnprocessableEntity {
+		t.Errorf("refill above capacity: status %d", code)
+	}
+
+	// Only loopback callers may retune the edge
+	rec := httptest.NewRecorder()
+	admin.RateLimitHandler(SetRateLimit)(rec, httptest.NewRequest("POST", "/ratelimit", strings.NewReader(`{"capacity": 9, "refill_per_s": 1}`)))
+	if c, _ := RateLimit(); rec.Code != http.StatusForbidden || c != 2 {
+		t.Errorf("remote caller: status %d, capacity %d", rec.Code, c)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"olwsx/edge/admin"
+)
+
+type readyBody struct {
+	Ready      bool              `json:"ready"`
+	Draining   bool              `json:"draining"`
+	Components map[string]string `json:"components"`
+}
+
+func getReady(t *testing.T, rd *admin.Readiness) (int, readyBody) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	rd.ServeHTTP(rec, httptest.NewRequest("GET", "/ready", nil))
+	var body readyBody
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("ready body %q: %v", rec.Body, err)
+	}
+	return rec.Code, body
+}
+
+func TestReadyFollowsActorReachability(t *testing.T) {
+	a := startFakeActor(t, true, 0)
+	eps := newActorEndpoints([]ActorEndpoint{{Network: "unix", Address: a.ln.Addr().String()}}, time.Second, time.Second, nil)
+	rd := admin.NewReadiness(map[string]admin.ReadyCheck{"actor": eps.probe}, time.Second)
+	if code, body := getReady(t, rd); code != 200 || !body.Ready || body.Components["actor"] != "ok" {
+		t.Errorf("reachable actor: %d %+v", code, body)
+	}
+
+	dead := newActorEndpoints([]ActorEndpoint{{Network: "unix", Address: filepath.Join(t.TempDir(), "dead.sock")}}, time.Second, time.Second, nil)
+	rd = admin.NewReadiness(map[string]admin.ReadyCheck{"actor": dead.probe}, time.Second)
+	code, body := getReady(t, rd)
+	if code != 503 || body.Ready || body.Draining || !strings.Contains(body.Components["actor"], "dead.sock") {
+		t.Errorf("unreachable actor: %d %+v", code, body)
+	}
+
+	// Liveness does not depend on the actor
+	rec := httptest.NewRecorder()
+	admin.HealthHandler(rec, httptest.NewRequest("GET", "/health", nil))
+	if rec.Code != 200 || rec.Body.String() != "OK\n" {
+		t.Errorf("/health = %d %q with the actor down", rec.Code, rec.Body)
+	}
+}
+
+func TestReadyBoundsSlowChecks(t *testing.T) {
+	hang := func(ctx context.Context) error { <-ctx.Done(); return ctx.Err() }
+	ok := func(context.Context) error { return nil }
+	rd := admin.NewReadiness(map[string]admin.ReadyCheck{"slow": hang, "fast": ok}, 20*time.Millisecond)
+	start := time.Now()
+	code, body := getReady(t, rd)
+	if code != 503 || body.Components["fast"] != "ok" || body.Components["slow"] != context.DeadlineExceeded.Error() {
+		t.Errorf("slow check: %d %+v", code, body)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("probe took %s", time.Since(start))
+	}
+}
+
+func TestDrainingFailsReadyButKeepsServing(t *testing.T) {
+	var probes atomic.Int64
+	rd := admin.NewReadiness(map[string]admin.ReadyCheck{"actor": func(context.Context) error { probes.Add(1); return nil }}, time.Second)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-release
+		}
+		io.WriteString(w, "served "+r.URL.Path)
+	}))
+	defer srv.Close()
+
+	inflight := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(srv.URL + "/slow")
+		if err != nil {
+			inflight <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		inflight <- string(b)
+	}()
+	time.Sleep(20 * time.Millisecond) // let /slow reach the handler
+
+	// What main does on SIGTERM, before the drain delay
+	rd.SetDraining()
+	code, body := getReady(t, rd)
+	if code != 503 || body.Ready || !body.Draining {
+		t.Errorf("draining: %d %+v", code, body)
+	}
+	if probes.Load() != 0 {
+		t.Error("dependency checks ran while draining")
+	}
+
+	resp, err := http.Get(srv.URL + "/new")
+	if err != nil {
+		t.Fatalf("new request while draining: %v", err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(b) != "served /new" {
+		t.Errorf("new request got %q", b)
+	}
+	close(release)
+	if got := <-inflight; got != "served /slow" {
+		t.Errorf("in-flight request got %q", got)
+	}
+}
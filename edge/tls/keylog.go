@@ -0,0 +1,8 @@
+//go:build !debug
+
+package tls
+
+import "io"
+
+// keyLogWriter is disabled outside debug builds regardless of SSLKEYLOGFILE.
+func keyLogWriter() io.Writer { return nil }
@@ -0,0 +1,26 @@
+//go:build debug
+
+package tls
+
+import (
+	"io"
+	"os"
+
+	"olwsx/edge/logging"
+)
+
+// keyLogWriter opens $SSLKEYLOGFILE (NSS key log format) for Wireshark decryption.
+// Only compiled into builds made with -tags debug.
+func keyLogWriter() io.Writer {
+	path := os.Getenv("SSLKEYLOGFILE")
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		logging.Error("SSLKEYLOGFILE open failed: %v", err)
+		return nil
+	}
+	logging.Warn("TLS key material is being logged to %s; all traffic can be decrypted. Never enable in production.", path)
+	return f
+}
@@ -0,0 +1,31 @@
+//go:build debug
+
+package tls
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestKeyLogWrittenWhenEnabled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.log")
+	t.Setenv("SSLKEYLOGFILE", path)
+	handshake(t, selfSignedConfig(t))
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// NSS key log format, TLS 1.3 labels
+	if !strings.Contains(string(raw), "CLIENT_HANDSHAKE_TRAFFIC_SECRET ") {
+		t.Errorf("key log = %q", raw)
+	}
+}
+
+func TestKeyLogOffWithoutEnv(t *testing.T) {
+	t.Setenv("SSLKEYLOGFILE", "")
+	if cfg := selfSignedConfig(t); cfg.KeyLogWriter != nil {
+		t.Error("KeyLogWriter set without SSLKEYLOGFILE")
+	}
+}
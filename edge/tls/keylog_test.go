@@ -0,0 +1,22 @@
+//go:build !debug
+
+package tls
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeyLogDisabledOutsideDebugBuilds(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.log")
+	t.Setenv("SSLKEYLOGFILE", path)
+	cfg := selfSignedConfig(t)
+	if cfg.KeyLogWriter != nil {
+		t.Fatal("KeyLogWriter set in a non-debug build")
+	}
+	handshake(t, cfg)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("key log written in a non-debug build: %v", err)
+	}
+}
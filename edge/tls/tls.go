@@ -7,6 +7,7 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"errors"
 	"math/big"
 	"net"
 	"os"
@@ -29,6 +30,8 @@ func ServerConfig(cert tls.Certificate, minTLS13 bool) *tls.Config {
 	if minTLS13 {
 		cfg.MinVersion = tls.VersionTLS13
 	}
+	// Debug builds only: honors SSLKEYLOGFILE
+	cfg.KeyLogWriter = keyLogWriter()
 	cfg.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
 		// Hook for SNI-based per-tenant config (future).
 		return nil, nil
@@ -36,10 +39,36 @@ func ServerConfig(cert tls.Certificate, minTLS13 bool) *tls.Config {
 	return cfg
 }
 
+// ClientConfig builds a TLS client config for edge-initiated links (e.g. Actor IPC over TCP).
+// An empty caFile uses the system roots.
+func ClientConfig(caFile, serverName string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if caFile != "" {
+		pemBytes, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pemBytes) {
+			return nil, errors.New("no certificates found in " + caFile)
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
 func ListenTLS(network, addr string, cfg *tls.Config) (net.Listener, error) {
 	return tls.Listen(network, addr, cfg)
 }
 
+// NewListener layers TLS over an already-bound listener, e.g. one from edgehttp.Listen.
+func NewListener(inner net.Listener, cfg *tls.Config) net.Listener {
+	return tls.NewListener(inner, cfg)
+}
+
 func fileExists(path string) bool {
 	_, err := os.Stat(path)
 	return err == nil
@@ -0,0 +1,32 @@
+package tls
+
+import (
+	"crypto/tls"
+	"net"
+	"testing"
+)
+
+// handshake completes one TLS handshake against cfg over an in-memory pipe.
+func handshake(t *testing.T, cfg *tls.Config) {
+	t.Helper()
+	sc, cc := net.Pipe()
+	defer sc.Close()
+	defer cc.Close()
+	errc := make(chan error, 1)
+	go func() { errc <- tls.Server(sc, cfg).Handshake() }()
+	if err := tls.Client(cc, &tls.Config{InsecureSkipVerify: true}).Handshake(); err != nil {
+		t.Fatalf("client handshake: %v", err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("server handshake: %v", err)
+	}
+}
+
+func selfSignedConfig(t *testing.T) *tls.Config {
+	t.Helper()
+	cert, err := LoadOrSelfSign("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ServerConfig(cert, true)
+}
@@ -1,28 +1,282 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
 	"regexp"
 	"strings"
-)
+	"sync/atomic"
+	"time"
 
-var (
-	pathTraversal = regexp.MustCompile(`(\.\./)|(/\.{2})`)
-	uaBlacklist   = []string{"sqlmap", "nmap", "nikto", "wpscan", "masscan", "curl/", "wget"}
+	edgehttp "olwsx/edge/http"
 )
 
-// Blocked returns true if path or UA is suspicious.
-func Blocked(path, ua string) bool {
-	if !EnableWAF {
-		return false
+// wafRules is one compiled WAF ruleset; a request matching any rule is flagged with its ID.
+type wafRules struct {
+	paths   []regexRule // against the request URI
+	uas     []uaRule    // lowercase substrings of the User-Agent
+	headers []headerRule
+	bodies  []regexRule // against a prefix of textual request bodies
+}
+
+type regexRule struct {
+	id string
+	re *regexp.Regexp
+}
+
+type uaRule struct{ id, sig string }
+
+type headerRule struct {
+	id   string
+	name string // canonical header name
+	re   *regexp.Regexp
+}
+
+// wafRulesFile is the on-disk ruleset format (JSON). Patterns are strings or {"id", "pattern"}
+// objects; unnamed rules are identified by position (e.g. "path_regex[0]").
+//
+//	{"path_regex": ["(\\.\\./)"], "ua_contains": [{"id": "sqlmap", "pattern": "sqlmap"}],
+//	 "headers": [{"name": "X-Forwarded-Host", "regex": "[<>]"}],
+//	 "body_regex": [{"id": "sqli_union", "pattern": "(?i)union\\s+select"}]}
+type wafRulesFile struct {
+	PathRegex  []wafPattern `json:"path_regex"`
+	BodyRegex  []wafPattern `json:"body_regex"`
+	UAContains []wafPattern `json:"ua_contains"`
+	Headers    []struct {
+		ID    string `json:"id"`
+		Name  string `json:"name"`
+		Regex string `json:"regex"`
+	} `json:"headers"`
+}
+
+type wafPattern struct{ ID, Pattern string }
+
+func (p *wafPattern) UnmarshalJSON(raw []byte) error {
+	if err := json.Unmarshal(raw, &p.Pattern); err == nil {
+		return nil
 	}
-	if pathTraversal.MatchString(path) {
-		return true
+	var obj struct {
+		ID      string `json:"id"`
+		Pattern string `json:"pattern"`
+	}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return err
+	}
+	p.ID, p.Pattern = obj.ID, obj.Pattern
+	return nil
+}
+
+// idOr returns id, or field[i] for unnamed rules.
+func idOr(id, field string, i int) string {
+	if id != "" {
+		return id
+	}
+	return fmt.Sprintf("%s[%d]", field, i)
+}
+
+// Built-in rules, used until (and unless) WAFRulesFile loads.
+var defaultWAFRules = &wafRules{
+	paths: []regexRule{{"path_traversal", regexp.MustCompile(`(\.\./)|(/\.{2})`)}},
+	uas: []uaRule{{"sqlmap", "sqlmap"}, {"nmap", "nmap"}, {"nikto", "nikto"}, {"wpscan", "wpscan"},
+		{"masscan", "masscan"}, {"curl", "curl/"}, {"wget", "wget"}},
+	bodies: []regexRule{
+		{"sqli_union", regexp.MustCompile(`(?i)\bunion\b(\s+all)?\s+\bselect\b`)},
+		{"sqli_tautology", regexp.MustCompile(`(?i)'\s*or\s+'?\w+'?\s*=\s*'?\w+`)},
+		{"sqli_stacked", regexp.MustCompile(`(?i);\s*(drop|truncate|alter)\s+table\b`)},
+		{"sqli_timing", regexp.MustCompile(`(?i)\b(sleep|benchmark|pg_sleep)\s*\(`)},
+		{"xss_script", regexp.MustCompile(`(?i)<script\b`)},
+	},
+}
+
+var activeWAF atomic.Pointer[wafRules]
+
+func init() { activeWAF.Store(defaultWAFRules) }
+
+// compileRegexRules compiles one regex list of a ruleset file.
+func compileRegexRules(field string, pats []wafPattern) ([]regexRule, error) {
+	var out []regexRule
+	for i, p := range pats {
+		if p.Pattern == "" {
+			return nil, fmt.Errorf("waf rules: %s[%d] is empty", field, i)
+		}
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("waf rules: %s[%d]: %w", field, i, err)
+		}
+		out = append(out, regexRule{id: idOr(p.ID, field, i), re: re})
+	}
+	return out, nil
+}
+
+// ParseWAFRules compiles a JSON ruleset; any invalid regex or empty entry rejects the whole set.
+func ParseWAFRules(raw []byte) (*wafRules, error) {
+	var f wafRulesFile
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("waf rules: %w", err)
+	}
+	rules := &wafRules{}
+	var err error
+	if rules.paths, err = compileRegexRules("path_regex", f.PathRegex); err != nil {
+		return nil, err
+	}
+	if rules.bodies, err = compileRegexRules("body_regex", f.BodyRegex); err != nil {
+		return nil, err
+	}
+	for i, ua := range f.UAContains {
+		if strings.TrimSpace(ua.Pattern) == "" {
+			return nil, fmt.Errorf("waf rules: ua_contains[%d] is empty", i)
+		}
+		rules.uas = append(rules.uas, uaRule{id: idOr(ua.ID, "ua_contains", i), sig: strings.ToLower(ua.Pattern)})
+	}
+	for i, h := range f.Headers {
+		if h.Name == "" || h.Regex == "" {
+			return nil, fmt.Errorf("waf rules: headers[%d] needs name and regex", i)
+		}
+		re, err := regexp.Compile(h.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("waf rules: headers[%d] %s: %w", i, h.Name, err)
+		}
+		rules.headers = append(rules.headers, headerRule{id: idOr(h.ID, "headers", i), name: http.CanonicalHeaderKey(h.Name), re: re})
+	}
+	return rules, nil
+}
+
+// LoadWAFRules compiles the ruleset at path and swaps it in atomically; on error the
+// active rules are kept.
+func LoadWAFRules(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
 	}
-	ua = strings.ToLower(ua)
-	for _, sig := range uaBlacklist {
-		if strings.Contains(ua, sig) {
-			return true
+	rules, err := ParseWAFRules(raw)
+	if err != nil {
+		return err
+	}
+	activeWAF.Store(rules)
+	return nil
+}
+
+// ReloadWAFRules reloads WAFRulesFile (no-op when unset); used by SIGHUP and the admin endpoint.
+func ReloadWAFRules() error {
+	path := conf().WAFRulesFile
+	if path == "" {
+		return nil
+	}
+	return LoadWAFRules(path)
+}
+
+// match returns "<category>:<rule id>" for the first matching rule, wafTimeout when the
+// evaluation exceeded budget, or "". Inputs are capped at WAFMaxInspectBytes; Go's RE2 regexps
+// run in linear time, so with capped inputs checking the budget between rules bounds the total.
+func (w *wafRules) match(path, ua string, h http.Header, budget time.Duration) string {
+	start := time.Now()
+	over := func() bool { return budget > 0 && time.Since(start) > budget }
+	path = capInspect(path)
+	for _, r := range w.paths {
+		if r.re.MatchString(path) {
+			return "path:" + r.id
+		}
+		if over() {
+			return wafTimeout
+		}
+	}
+	ua = strings.ToLower(capInspect(ua))
+	for _, r := range w.uas {
+		if strings.Contains(ua, r.sig) {
+			return "ua:" + r.id
+		}
+	}
+	for _, r := range w.headers {
+		for _, v := range h[r.name] {
+			if r.re.MatchString(capInspect(v)) {
+				return "header:" + r.id
+			}
+			if over() {
+				return wafTimeout
+			}
+		}
+	}
+	return ""
+}
+
+// wafTimeout is the verdict when rule evaluation ran out of WAFTimeBudget; it blocks.
+const wafTimeout = edgehttp.WAFTimeout
+
+func capInspect(s string) string {
+	if limit := conf().WAFMaxInspectBytes; limit > 0 && len(s) > limit {
+		return s[:limit]
+	}
+	return s
+}
+
+// BlockedReason reports whether path, UA or a header matches the active WAF rules and, if so,
+// the rule ("path:path_traversal", "ua:sqlmap", ...). An exhausted evaluation budget blocks
+// with rule wafTimeout.
+func BlockedReason(path, ua string, h http.Header) (bool, string) {
+	if !conf().EnableWAF {
+		return false, ""
+	}
+	rule := activeWAF.Load().match(path, ua, h, conf().WAFTimeBudget)
+	return rule != "", rule
+}
+
+// Blocked returns true if path, UA or a header is suspicious.
+func Blocked(path, ua string, h http.Header) bool {
+	blocked, _ := BlockedReason(path, ua, h)
+	return blocked
+}
+
+// InspectBody matches the first WAFMaxBodyInspectBytes of a textual request body against the
+// body rules (form bodies are URL-decoded first); binary content types are skipped.
+// Results are as for BlockedReason, with rules "body:<id>".
+func InspectBody(contentType string, body []byte) (bool, string) {
+	c := conf()
+	if !c.EnableWAF || !c.WAFInspectBody || len(body) == 0 || !inspectableBody(contentType) {
+		return false, ""
+	}
+	if len(body) > c.WAFMaxBodyInspectBytes {
+		body = body[:c.WAFMaxBodyInspectBytes]
+	}
+	text := string(body)
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		if dec, err := url.QueryUnescape(text); err == nil {
+			text = dec
+		}
+	}
+	start := time.Now()
+	for _, r := range activeWAF.Load().bodies {
+		if r.re.MatchString(text) {
+			return true, "body:" + r.id
+		}
+		if c.WAFTimeBudget > 0 && time.Since(start) > c.WAFTimeBudget {
+			return true, wafTimeout
 		}
 	}
+	return false, ""
+}
+
+// inspectableBody reports whether a content type carries text worth scanning ("" counts as text).
+func inspectableBody(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mt, "text/"),
+		mt == "application/json", strings.HasSuffix(mt, "+json"),
+		mt == "application/xml", strings.HasSuffix(mt, "+xml"),
+		mt == "application/x-www-form-urlencoded", mt == "application/graphql", mt == "application/javascript":
+		return true
+	}
 	return false
-}
\ No newline at end of file
+}
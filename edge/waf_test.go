@@ -0,0 +1,250 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"olwsx/edge/admin"
+	"olwsx/edge/wire"
+)
+
+const customWAF = `{
+	"path_regex": ["^/wp-admin", {"id": "dotenv", "pattern": "/\\.env$"}],
+	"ua_contains": [{"id": "evilbot", "pattern": "EvilBot"}],
+	"headers": [{"id": "host_xss", "name": "x-forwarded-host", "regex": "[<>]"}],
+	"body_regex": [{"id": "drop", "pattern": "(?i)drop\\s+table"}]
+}`
+
+// keepWAF restores the active ruleset after the test.
+func keepWAF(t *testing.T) {
+	prev := activeWAF.Load()
+	t.Cleanup(func() { activeWAF.Store(prev) })
+}
+
+func writeRules(t *testing.T, raw string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "waf.json")
+	if err := os.WriteFile(path, []byte(raw), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCustomWAFRulesMatch(t *testing.T) {
+	keepWAF(t)
+	withConfig(t, func(c *Config) {})
+	if err := LoadWAFRules(writeRules(t, customWAF)); err != nil {
+		t.Fatal(err)
+	}
+	hdr := func(k, v string) http.Header { return http.Header{http.CanonicalHeaderKey(k): {v}} }
+	for _, tc := range []struct {
+		path, ua string
+		h        http.Header
+		want     string
+	}{
+		{"/wp-admin/setup.php", "", nil, "path:path_regex[0]"},
+		{"/app/.env", "", nil, "path:dotenv"},
+		{"/", "Mozilla evilbot/2", nil, "ua:evilbot"},
+		{"/", "", hdr("X-Forwarded-Host", "<script>"), "header:host_xss"},
+		// The built-in rules are replaced, not extended
+		{"/../etc/passwd", "sqlmap/1.0", nil, ""},
+		{"/blog/wp-admin", "curl/8", hdr("X-Forwarded-Host", "example.com"), ""},
+	} {
+		if _, got := BlockedReason(tc.path, tc.ua, tc.h); got != tc.want {
+			t.Errorf("BlockedReason(%q, %q, %v) = %q, want %q", tc.path, tc.ua, tc.h, got, tc.want)
+		}
+	}
+	if _, got := InspectBody("text/plain", []byte("x; DROP  TABLE users")); got != "body:drop" {
+		t.Errorf("body rule = %q", got)
+	}
+	if blocked, _ := InspectBody("text/plain", []byte("union select")); blocked {
+		t.Error("built-in body rule still active")
+	}
+}
+
+func TestBadWAFRulesAreRejected(t *testing.T) {
+	keepWAF(t)
+	withConfig(t, func(c *Config) {})
+	good := activeWAF.Load()
+	for name, raw := range map[string]string{
+		"bad regex":     `{"path_regex": ["(unclosed"]}`,
+		"empty pattern": `{"ua_contains": [""]}`,
+		"header name":   `{"headers": [{"regex": "x"}]}`,
+		"unknown field": `{"paths": ["x"]}`,
+		"not json":      `path_regex: x`,
+	} {
+		if err := LoadWAFRules(writeRules(t, raw)); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+		if activeWAF.Load() != good {
+			t.Fatalf("%s: active rules replaced by a rejected set", name)
+		}
+	}
+	if err := LoadWAFRules(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("missing file accepted")
+	}
+}
+
+func TestWAFReloadEndpoint(t *testing.T) {
+	keepWAF(t)
+	path := writeRules(t, `{"path_regex": ["^/v1"]}`)
+	withConfig(t, func(c *Config) { c.WAFRulesFile = path })
+	reload := admin.ReloadHandler(ReloadWAFRules)
+	post := func() int {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/waf/reload", nil)
+		r.RemoteAddr = "127.0.0.1:9999"
+		reload(rec, r)
+		return rec.Code
+	}
+
+	if code := post(); code != http.StatusNoContent || !Blocked("/v1/x", "", nil) {
+		t.Fatalf("first load: %d", code)
+	}
+	os.WriteFile(path, []byte(`{"path_regex": ["^/v2"]}`), 0600)
+	if code := post(); code != http.StatusNoContent || Blocked("/v1/x", "", nil) || !Blocked("/v2/x", "", nil) {
+		t.Errorf("reload: %d", code)
+	}
+	os.WriteFile(path, []byte(`{"path_regex": ["["]}`), 0600)
+	if code := post(); code != http.StatusUnprocessableEntity || !Blocked("/v2/x", "", nil) {
+		t.Errorf("bad reload: %d, previous rules must stay active", code)
+	}
+}
+
+func TestWAFDisabledBlocksNothing(t *testing.T) {
+	withConfig(t, func(c *Config) { c.EnableWAF = false })
+	if blocked, _ := BlockedReason("/../etc/passwd", "sqlmap", nil); blocked {
+		t.Error("blocked with EnableWAF off")
+	}
+	if blocked, _ := InspectBody("text/plain", []byte("' or 1=1")); blocked {
+		t.Error("body blocked with EnableWAF off")
+	}
+}
+
+func TestWAFEvaluationIsBoundedOnAdversarialInput(t *testing.T) {
+	keepWAF(t)
+	withConfig(t, func(c *Config) {})
+	// Classic catastrophic-backtracking shapes; RE2 stays linear, and the cap bounds the input
+	rules, err := ParseWAFRules([]byte(`{"path_regex": ["(a+)+$", "(a|aa)+b", "(.*a){12}x"],
+		"headers": [{"name": "X-Probe", "regex": "(a*)*b"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	activeWAF.Store(rules)
+	path := "/" + strings.Repeat("a", 4<<20) + "!"
+	h := http.Header{"X-Probe": {strings.Repeat("a", 4<<20)}}
+
+	start := time.Now()
+	_, rule := BlockedReason(path, "", h)
+	if took := time.Since(start); took > 500*time.Millisecond {
+		t.Errorf("evaluation over a 4MiB path took %s", took)
+	}
+	// Only the first WAFMaxInspectBytes are inspected, so "(a+)+$" sees a run of a's and matches
+	if rule != "path:path_regex[0]" && rule != wafTimeout {
+		t.Errorf("rule = %q", rule)
+	}
+}
+
+func TestWAFInspectsOnlyTheCappedPrefix(t *testing.T) {
+	keepWAF(t)
+	withConfig(t, func(c *Config) { c.WAFMaxInspectBytes = 64; c.WAFTimeBudget = 0 })
+	if blocked, _ := BlockedReason("/"+strings.Repeat("x", 100)+"/../etc", "", nil); blocked {
+		t.Error("match beyond WAFMaxInspectBytes was seen")
+	}
+	if _, rule := BlockedReason("/../"+strings.Repeat("x", 100), "", nil); rule != "path:path_traversal" {
+		t.Errorf("match inside the cap: %q", rule)
+	}
+}
+
+func TestWAFTimeBudgetBlocks(t *testing.T) {
+	keepWAF(t)
+	withConfig(t, func(c *Config) { c.WAFTimeBudget = time.Nanosecond })
+	rules, err := ParseWAFRules([]byte(`{"path_regex": ["^/never$", "^/also-never$"], "body_regex": ["never1", "never2"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	activeWAF.Store(rules)
+	if blocked, rule := BlockedReason("/"+strings.Repeat("a", 4096), "", nil); !blocked || rule != wafTimeout {
+		t.Errorf("exhausted budget: blocked=%v rule=%q", blocked, rule)
+	}
+	if blocked, rule := InspectBody("text/plain", []byte(strings.Repeat("a", 4096))); !blocked || rule != wafTimeout {
+		t.Errorf("exhausted body budget: blocked=%v rule=%q", blocked, rule)
+	}
+}
+
+func TestInspectBodyBlocksInjection(t *testing.T) {
+	keepWAF(t)
+	activeWAF.Store(defaultWAFRules)
+	withConfig(t, func(c *Config) { c.WAFMaxBodyInspectBytes = 256 })
+	for _, tc := range []struct {
+		contentType, body, want string
+	}{
+		{"application/json", `{"q":"1' OR '1'='1"}`, "body:sqli_tautology"},
+		{"application/json; charset=utf-8", `{"q":"x UNION ALL SELECT password FROM users"}`, "body:sqli_union"},
+		{"application/vnd.api+json", `{"q":"1; DROP TABLE users"}`, "body:sqli_stacked"},
+		{"application/x-www-form-urlencoded", "q=%3Cscript%3Ealert(1)%3C%2Fscript%3E", "body:xss_script"},
+		{"", "id=1 and sleep(5)", "body:sqli_timing"},
+		// Benign text, binary types, and matches past the inspected prefix pass
+		{"application/json", `{"name":"Union Station","note":"select a seat"}`, ""},
+		{"image/png", "<script>", ""},
+		{"application/octet-stream", "' or 1=1", ""},
+		{"text/plain", strings.Repeat("x", 256) + "<script>", ""},
+	} {
+		if blocked, rule := InspectBody(tc.contentType, []byte(tc.body)); rule != tc.want || blocked != (tc.want != "") {
+			t.Errorf("InspectBody(%q, %q) = %v %q, want %q", tc.contentType, tc.body, blocked, rule, tc.want)
+		}
+	}
+
+	withConfig(t, func(c *Config) { c.WAFInspectBody = false })
+	if blocked, _ := InspectBody("application/json", []byte(`{"q":"' or 1=1"}`)); blocked {
+		t.Error("body inspected with WAFInspectBody off")
+	}
+}
+
+func TestDefaultWAFRulesReportTheirIDs(t *testing.T) {
+	keepWAF(t)
+	activeWAF.Store(defaultWAFRules)
+	withConfig(t, func(c *Config) {})
+	for _, tc := range []struct{ path, ua, want string }{
+		{"/static/../../etc/passwd", "", "path:path_traversal"},
+		{"/a/..", "", "path:path_traversal"},
+		{"/", "sqlmap/1.7", "ua:sqlmap"},
+		{"/", "Mozilla/5.0 (compatible; Nmap Scripting Engine)", "ua:nmap"},
+		{"/", "Nikto/2.5", "ua:nikto"},
+		{"/", "WPScan v3", "ua:wpscan"},
+		{"/", "masscan/1.3", "ua:masscan"},
+		{"/", "curl/8.4.0", "ua:curl"},
+		{"/", "Wget/1.21", "ua:wget"},
+		// Path rules are checked before UA rules
+		{"/../x", "sqlmap", "path:path_traversal"},
+		{"/docs/a..b", "Mozilla/5.0", ""},
+	} {
+		blocked, rule := BlockedReason(tc.path, tc.ua, nil)
+		if rule != tc.want || blocked != (tc.want != "") {
+			t.Errorf("BlockedReason(%q, %q) = %v %q, want %q", tc.path, tc.ua, blocked, rule, tc.want)
+		}
+		if Blocked(tc.path, tc.ua, nil) != blocked {
+			t.Errorf("Blocked(%q, %q) disagrees with BlockedReason", tc.path, tc.ua)
+		}
+	}
+}
+
+func TestWAFRuleReachesLogAndMetrics(t *testing.T) {
+	withConfig(t, func(c *Config) {})
+	buf := captureAccess(t)
+	before := admin.Default.CounterSum("olwsx_edge_waf_matches_total", "rule", "ua:sqlmap")
+	AccessLog("GET", "/", "h1", 200, 0, wire.HintWAFBlocked, "ua:sqlmap", 0, "192.0.2.1", "sqlmap", 1, 2, "", "")
+	AccessLog("GET", "/", "h1", 200, 0, 0, "", 0, "192.0.2.1", "", 1, 2, "", "")
+	if got := admin.Default.CounterSum("olwsx_edge_waf_matches_total", "rule", "ua:sqlmap") - before; got != 1 {
+		t.Errorf("waf_matches_total{rule=ua:sqlmap} grew by %d", got)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], " waf=ua:sqlmap ") || !strings.Contains(lines[1], " waf=- ") {
+		t.Errorf("access lines:\n%s", buf)
+	}
+}
@@ -0,0 +1,216 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// PublishHeader in an actor reply to a WebSocket frame broadcasts the reply to every
+// connection subscribed to the named topic instead of answering the sender alone.
+const PublishHeader = "X-Olwsx-Ws-Publish"
+
+// Subscription control frames. A client sends {"olwsx_op":"subscribe","topic":"news"} (or
+// "unsubscribe") as a text message; the edge handles it without forwarding and answers
+// {"olwsx_op":"subscribed","topic":"news"} ("unsubscribed"), or {"olwsx_op":"error",...}.
+const (
+	hubOpField        = `"olwsx_op"`
+	maxTopicBytes     = 128
+	maxTopicsPerConn  = 64
+	slowConsumerClose = "slow consumer"
+)
+
+// Hub fans messages out to the connections subscribed to a topic. Every subscriber has a
+// bounded send queue drained by its own goroutine, so a broadcast never waits on a client;
+// a subscriber whose queue is full is evicted (unsubscribed and disconnected), one whose
+// connection fails a write is merely unsubscribed.
+type Hub struct {
+	mu     sync.Mutex
+	topics map[string]map[*subscriber]struct{}
+	queue  int
+	metric func(event string)
+}
+
+// NewHub returns a hub with queue-deep send queues per subscriber; metric may be nil.
+func NewHub(queue int, metric func(event string)) *Hub {
+	return &Hub{topics: make(map[string]map[*subscriber]struct{}), queue: queue, metric: metric}
+}
+
+type hubMessage struct {
+	msgType int
+	data    []byte
+}
+
+// subscriber is one connection's membership; topics is guarded by Hub.mu.
+type subscriber struct {
+	conn   *websocket.Conn
+	out    *wsWriter
+	send   chan hubMessage
+	topics map[string]struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+// attach registers a connection and starts its send pump; call detach when it ends.
+func (h *Hub) attach(conn *websocket.Conn, out *wsWriter) *subscriber {
+	sub := &subscriber{
+		conn:   conn,
+		out:    out,
+		send:   make(chan hubMessage, h.queue),
+		topics: make(map[string]struct{}),
+		done:   make(chan struct{}),
+	}
+	go h.pump(sub)
+	return sub
+}
+
+// detach drops every subscription of sub and stops its pump.
+func (h *Hub) detach(sub *subscriber) {
+	h.mu.Lock()
+	for topic := range sub.topics {
+		h.removeLocked(sub, topic)
+	}
+	h.mu.Unlock()
+	sub.once.Do(func() { close(sub.done) })
+}
+
+func (h *Hub) pump(sub *subscriber) {
+	for {
+		select {
+		case <-sub.done:
+			return
+		case m := <-sub.send:
+			if err := sub.out.write(m.msgType, m.data); err != nil {
+				h.detach(sub) // the connection is gone; its handler sees that on its own read
+				return
+			}
+		}
+	}
+}
+
+// subscribe adds sub to topic; false when sub already holds maxTopicsPerConn topics.
+func (h *Hub) subscribe(sub *subscriber, topic string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := sub.topics[topic]; ok {
+		return true
+	}
+	if len(sub.topics) >= maxTopicsPerConn {
+		return false
+	}
+	subs := h.topics[topic]
+	if subs == nil {
+		subs = make(map[*subscriber]struct{})
+		h.topics[topic] = subs
+	}
+	subs[sub] = struct{}{}
+	sub.topics[topic] = struct{}{}
+	return true
+}
+
+func (h *Hub) unsubscribe(sub *subscriber, topic string) {
+	h.mu.Lock()
+	h.removeLocked(sub, topic)
+	h.mu.Unlock()
+}
+
+func (h *Hub) removeLocked(sub *subscriber, topic string) {
+	delete(sub.topics, topic)
+	if subs := h.topics[topic]; subs != nil {
+		delete(subs, sub)
+		if len(subs) == 0 {
+			delete(h.topics, topic)
+		}
+	}
+}
+
+// Publish queues data for every subscriber of topic and returns how many got it. Subscribers
+// whose queue is full are evicted rather than waited for.
+func (h *Hub) Publish(topic string, msgType int, data []byte) int {
+	h.mu.Lock()
+	subs := make([]*subscriber, 0, len(h.topics[topic]))
+	for sub := range h.topics[topic] {
+		subs = append(subs, sub)
+	}
+	h.mu.Unlock()
+	sent := 0
+	for _, sub := range subs {
+		select {
+		case sub.send <- hubMessage{msgType, data}:
+			sent++
+		default:
+			h.evict(sub)
+		}
+	}
+	return sent
+}
+
+// Subscribers returns the number of connections subscribed to topic.
+func (h *Hub) Subscribers(topic string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.topics[topic])
+}
+
+// evict disconnects a subscriber that cannot keep up; its handler then detaches it. The close
+// frame is sent from its own goroutine so a publisher never waits on the stalled client, after
+// an expired write deadline has broken any data write its pump is stuck in.
+func (h *Hub) evict(sub *subscriber) {
+	h.mu.Lock()
+	for topic := range sub.topics {
+		h.removeLocked(sub, topic)
+	}
+	h.mu.Unlock()
+	first := false
+	sub.once.Do(func() { first = true; close(sub.done) })
+	if !first {
+		return
+	}
+	if h.metric != nil {
+		h.metric("slow_consumer")
+	}
+	go func() {
+		// gorilla applies its own deadline per frame only; the net.Conn's interrupts a write in flight
+		_ = sub.conn.NetConn().SetWriteDeadline(time.Now())
+		msg := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, slowConsumerClose)
+		_ = sub.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		_ = sub.conn.Close()
+	}()
+}
+
+// hubOp is a subscription control frame.
+type hubOp struct {
+	Op    string `json:"olwsx_op"`
+	Topic string `json:"topic,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// handleOp runs a control frame and reports whether msg was one (and so must not be forwarded).
+func (h *Hub) handleOp(sub *subscriber, msgType int, msg []byte) bool {
+	if msgType != websocket.TextMessage || !bytes.Contains(msg, []byte(hubOpField)) {
+		return false
+	}
+	var op hubOp
+	if err := json.Unmarshal(msg, &op); err != nil || op.Op == "" {
+		return false
+	}
+	reply := hubOp{Op: op.Op + "d", Topic: op.Topic}
+	switch {
+	case op.Op != "subscribe" && op.Op != "unsubscribe":
+		reply = hubOp{Op: "error", Topic: op.Topic, Error: "unknown op " + op.Op}
+	case op.Topic == "" || len(op.Topic) > maxTopicBytes:
+		reply = hubOp{Op: "error", Topic: op.Topic, Error: "invalid topic"}
+	case op.Op == "unsubscribe":
+		h.unsubscribe(sub, op.Topic)
+	case !h.subscribe(sub, op.Topic):
+		reply = hubOp{Op: "error", Topic: op.Topic, Error: "too many subscriptions"}
+	}
+	out, _ := json.Marshal(reply)
+	if err := sub.out.write(websocket.TextMessage, out); err != nil {
+		h.detach(sub)
+	}
+	return true
+}
@@ -0,0 +1,195 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	edgehttp "olwsx/edge/http"
+)
+
+// hubOpReply sends a control frame on c and returns the edge's answer.
+func hubOpReply(t *testing.T, c *websocket.Conn, op, topic string) hubOp {
+	t.Helper()
+	req, _ := json.Marshal(hubOp{Op: op, Topic: topic})
+	if err := c.WriteMessage(websocket.TextMessage, req); err != nil {
+		t.Fatal(err)
+	}
+	var reply hubOp
+	if err := c.ReadJSON(&reply); err != nil {
+		t.Fatal(err)
+	}
+	return reply
+}
+
+// readText reads one message from c, failing after a second.
+func readText(t *testing.T, c *websocket.Conn) string {
+	t.Helper()
+	c.SetReadDeadline(time.Now().Add(time.Second))
+	defer c.SetReadDeadline(time.Time{})
+	_, msg, err := c.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(msg)
+}
+
+// quiet asserts nothing arrives on c for a short while.
+func quiet(t *testing.T, c *websocket.Conn) {
+	t.Helper()
+	c.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, msg, err := c.ReadMessage()
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Errorf("unexpected message %q (%v)", msg, err)
+	}
+}
+
+func TestPublishReachesEverySubscriber(t *testing.T) {
+	s := NewServer(":0", nil, nil, Options{HubQueue: 8})
+	base := startServer(t, s)
+	a, b, other := dial(t, base+"/ws", nil), dial(t, base+"/ws", nil), dial(t, base+"/ws", nil)
+	for _, c := range []*websocket.Conn{a, b} {
+		if got := hubOpReply(t, c, "subscribe", "news"); got != (hubOp{Op: "subscribed", Topic: "news"}) {
+			t.Fatalf("subscribe answered %+v", got)
+		}
+	}
+	hubOpReply(t, other, "subscribe", "sport")
+
+	if n := s.Hub().Publish("news", websocket.TextMessage, []byte("hello")); n != 2 {
+		t.Errorf("Publish reached %d subscribers, want 2", n)
+	}
+	for _, c := range []*websocket.Conn{a, b} {
+		if got := readText(t, c); got != "hello" {
+			t.Errorf("subscriber got %q", got)
+		}
+	}
+	quiet(t, other)
+
+	// Unsubscribing stops delivery; a closed connection leaves every topic
+	if got := hubOpReply(t, b, "unsubscribe", "news"); got.Op != "unsubscribed" {
+		t.Fatalf("unsubscribe answered %+v", got)
+	}
+	if n := s.Hub().Publish("news", websocket.TextMessage, []byte("again")); n != 1 || readText(t, a) != "again" {
+		t.Errorf("after unsubscribe Publish reached %d", n)
+	}
+	quiet(t, b)
+	a.Close()
+	waitActive(t, s, 2)
+	if n := s.Hub().Subscribers("news"); n != 0 {
+		t.Errorf("closed connection still subscribed (%d)", n)
+	}
+}
+
+func TestActorReplyIsBroadcastToTopic(t *testing.T) {
+	actor := &recordingActor{reply: edgehttp.CoreResp{Status: 200, HeadersFlat: PublishHeader + ": room-1\r\n", Body: []byte("to all")}}
+	s := NewServer(":0", actor.call, nil, Options{HubQueue: 8})
+	base := startServer(t, s)
+	sender, listener := dial(t, base+"/ws", nil), dial(t, base+"/ws", nil)
+	hubOpReply(t, listener, "subscribe", "room-1")
+
+	if err := sender.WriteMessage(websocket.TextMessage, []byte("post")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readText(t, listener); got != "to all" {
+		t.Errorf("subscriber got %q", got)
+	}
+	quiet(t, sender) // the sender is not subscribed, so the reply is not echoed to it
+}
+
+func TestSubscriptionControlErrors(t *testing.T) {
+	s := NewServer(":0", nil, nil, Options{HubQueue: 8})
+	c := dial(t, startServer(t, s)+"/ws", nil)
+	for _, tc := range []struct{ op, topic, want string }{
+		{"join", "news", "unknown op join"},
+		{"subscribe", "", "invalid topic"},
+		{"subscribe", strings.Repeat("t", maxTopicBytes+1), "invalid topic"},
+	} {
+		if got := hubOpReply(t, c, tc.op, tc.topic); got.Op != "error" || got.Error != tc.want {
+			t.Errorf("%s %q answered %+v", tc.op, tc.topic, got)
+		}
+	}
+	for i := 0; i < maxTopicsPerConn; i++ {
+		hubOpReply(t, c, "subscribe", "t"+strings.Repeat("x", i))
+	}
+	if got := hubOpReply(t, c, "subscribe", "one-too-many"); got.Error != "too many subscriptions" {
+		t.Errorf("subscription %d answered %+v", maxTopicsPerConn+1, got)
+	}
+
+	// Text that merely mentions the field is still an ordinary message
+	if err := c.WriteMessage(websocket.TextMessage, []byte(`"olwsx_op" in prose`)); err != nil {
+		t.Fatal(err)
+	}
+	if got := readText(t, c); got != `"olwsx_op" in prose` {
+		t.Errorf("echo %q", got)
+	}
+}
+
+func TestSlowSubscriberIsEvicted(t *testing.T) {
+	ch, metric := events()
+	s := NewServer(":0", nil, nil, Options{HubQueue: 2, Metric: metric})
+	base := startServer(t, s)
+	slow, fast := dial(t, base+"/ws", nil), dial(t, base+"/ws", nil)
+	hubOpReply(t, slow, "subscribe", "feed")
+	hubOpReply(t, fast, "subscribe", "feed")
+
+	// slow never reads: once its socket buffers and queue fill, the next publish evicts it
+	msg := make([]byte, 256<<10)
+	for i := 0; s.Hub().Subscribers("feed") == 2; i++ {
+		if i == 1000 {
+			t.Fatal("slow subscriber never evicted")
+		}
+		s.Hub().Publish("feed", websocket.BinaryMessage, msg)
+		fast.SetReadDeadline(time.Now().Add(time.Second))
+		if _, _, err := fast.ReadMessage(); err != nil {
+			t.Fatalf("fast subscriber: %v", err)
+		}
+	}
+	waitEvent(t, ch, "slow_consumer", time.Second)
+	waitActive(t, s, 1)
+
+	if n := s.Hub().Publish("feed", websocket.TextMessage, []byte("still here")); n != 1 || readText(t, fast) != "still here" {
+		t.Errorf("after eviction Publish reached %d", n)
+	}
+	slow.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err := slow.ReadMessage(); err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				t.Fatal("evicted subscriber was not disconnected")
+			}
+			break
+		}
+	}
+}
+
+func TestDisconnectedSubscriberIsNotASlowConsumer(t *testing.T) {
+	ch, metric := events()
+	s := NewServer(":0", nil, nil, Options{HubQueue: 8, Metric: metric})
+	base := startServer(t, s)
+	gone, stays := dial(t, base+"/ws", nil), dial(t, base+"/ws", nil)
+	hubOpReply(t, gone, "subscribe", "feed")
+	hubOpReply(t, stays, "subscribe", "feed")
+	gone.Close()
+
+	for i := 0; s.Hub().Subscribers("feed") == 2; i++ {
+		if i == 1000 {
+			t.Fatal("disconnected subscriber never dropped")
+		}
+		s.Hub().Publish("feed", websocket.TextMessage, []byte("tick"))
+		time.Sleep(time.Millisecond)
+	}
+	waitActive(t, s, 1)
+	for {
+		select {
+		case e := <-ch:
+			if e == "slow_consumer" {
+				t.Fatal("ordinary disconnect counted as a slow consumer")
+			}
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package websocket
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	edgehttp "olwsx/edge/http"
+	"olwsx/edge/logging"
+)
+
+// MethodSSE marks envelopes polling the actor for the next Server-Sent Event.
+// The actor answers 204 when nothing is pending, or 200 with the event data as body and
+// optional SSEEventHeader / SSEIDHeader naming the event and its id.
+const (
+	MethodSSE      = "SSE"
+	SSEEventHeader = "X-Olwsx-Sse-Event"
+	SSEIDHeader    = "X-Olwsx-Sse-Id"
+)
+
+// sseHandler streams actor events as text/event-stream until the client disconnects.
+func (s *Server) sseHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok || s.coreCall == nil {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	// Each stream polls the actor every SSEPoll, so it is admitted like a WebSocket connection
+	release, admitted := s.admit(w, r)
+	if !admitted {
+		return
+	}
+	defer release()
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	poll := s.opts.SSEPoll
+	if poll <= 0 {
+		poll = time.Second
+	}
+	keepalive := s.opts.SSEKeepalive
+	if keepalive <= 0 {
+		keepalive = 15 * time.Second
+	}
+	pollT := time.NewTicker(poll)
+	defer pollT.Stop()
+	keepT := time.NewTicker(keepalive)
+	defer keepT.Stop()
+
+	path := r.URL.RequestURI()
+	lastID := r.Header.Get("Last-Event-ID")
+	ctx := r.Context()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-keepT.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-pollT.C:
+			// Drain everything the actor has queued before waiting again
+			for ctx.Err() == nil {
+				ev, more, ok := s.nextEvent(path, r.Header, lastID)
+				if !ok {
+					fmt.Fprint(w, "event: error\ndata: actor unavailable\n\n")
+					flusher.Flush()
+					return
+				}
+				if !more {
+					break
+				}
+				if ev.id != "" {
+					lastID = ev.id
+				}
+				if _, err := w.Write(ev.encode()); err != nil {
+					return
+				}
+				flusher.Flush()
+				keepT.Reset(keepalive)
+			}
+		}
+	}
+}
+
+type sseEvent struct {
+	id, name string
+	data     []byte
+}
+
+// encode renders the event in text/event-stream framing; multi-line data becomes multiple data fields.
+func (e sseEvent) encode() []byte {
+	var b bytes.Buffer
+	if e.id != "" {
+		fmt.Fprintf(&b, "id: %s\n", e.id)
+	}
+	if e.name != "" {
+		fmt.Fprintf(&b, "event: %s\n", e.name)
+	}
+	for _, ln := range strings.Split(strings.ReplaceAll(string(e.data), "\r\n", "\n"), "\n") {
+		fmt.Fprintf(&b, "data: %s\n", ln)
+	}
+	b.WriteString("\n")
+	return b.Bytes()
+}
+
+// nextEvent polls the actor once; more=false means nothing is pending.
+func (s *Server) nextEvent(path string, hdr http.Header, lastID string) (ev sseEvent, more, ok bool) {
+	var traceID, spanID uint64
+	if s.newIDs != nil {
+		traceID, spanID = s.newIDs()
+	}
+	if lastID != "" && hdr.Get("Last-Event-ID") != lastID {
+		// The id of the last event delivered replaces the one the client reconnected with
+		hdr = hdr.Clone()
+		hdr.Set("Last-Event-ID", lastID)
+	}
+	headersFlat := actorHeaders(hdr)
+	resp, code := s.coreCall(MethodSSE, path, headersFlat, nil, traceID, spanID, 0)
+	if code != 0 || resp.Status >= 400 {
+		logging.Warn("SSE actor poll error: code=%d status=%d path=%q", code, resp.Status, path)
+		return ev, false, false
+	}
+	if resp.Status == http.StatusNoContent {
+		return ev, false, true
+	}
+	for _, f := range edgehttp.ParseFlatFields(resp.HeadersFlat) {
+		switch {
+		case strings.EqualFold(f.Name, SSEEventHeader):
+			ev.name = oneLine(f.Value)
+		case strings.EqualFold(f.Name, SSEIDHeader):
+			ev.id = oneLine(f.Value)
+		}
+	}
+	ev.data = resp.Body
+	return ev, true, true
+}
+
+// oneLine strips CR/LF so actor-supplied ids and names can't inject SSE fields.
+func oneLine(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
@@ -0,0 +1,144 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	edgehttp "olwsx/edge/http"
+)
+
+// sseActor hands out queued events one poll at a time (204 once empty) and records the
+// headers of every poll.
+type sseActor struct {
+	mu     sync.Mutex
+	events []edgehttp.CoreResp
+	polls  []string
+}
+
+func (a *sseActor) call(method, path, headers string, body []byte, traceID, spanID uint64, hints uint32) (edgehttp.CoreResp, int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.polls = append(a.polls, headers)
+	if len(a.events) == 0 {
+		return edgehttp.CoreResp{Status: http.StatusNoContent}, 0
+	}
+	ev := a.events[0]
+	a.events = a.events[1:]
+	return ev, 0
+}
+
+func (a *sseActor) pollHeaders() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string(nil), a.polls...)
+}
+
+func sseGet(t *testing.T, ctx context.Context, url string, h http.Header) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	for k, v := range h {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestSSEStreamsEventsAndReplacesLastEventID(t *testing.T) {
+	actor := &sseActor{events: []edgehttp.CoreResp{
+		{Status: 200, HeadersFlat: SSEIDHeader + ": 6\r\n" + SSEEventHeader + ": tick\r\n", Body: []byte("a\nb")},
+	}}
+	s := NewServer(":0", actor.call, nil, Options{SSEPoll: 10 * time.Millisecond})
+	ts := httptest.NewServer(s.srv.Handler)
+	defer ts.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	resp := sseGet(t, ctx, ts.URL+"/sse", http.Header{"Last-Event-Id": {"5"}, "Connection": {"keep-alive"}})
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	br := bufio.NewReader(resp.Body)
+	var ev []string
+	for len(ev) == 0 || ev[len(ev)-1] != "" {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		ev = append(ev, strings.TrimSuffix(line, "\n"))
+	}
+	if got, want := strings.Join(ev, "|"), "id: 6|event: tick|data: a|data: b|"; got != want {
+		t.Errorf("event = %q, want %q", got, want)
+	}
+
+	// The poll after the event carries the delivered id, once, and no hop-by-hop headers
+	deadline := time.Now().Add(2 * time.Second)
+	for len(actor.pollHeaders()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	polls := actor.pollHeaders()
+	if len(polls) < 3 {
+		t.Fatalf("only %d polls", len(polls))
+	}
+	if !strings.Contains(polls[0], "Last-Event-Id: 5\r\n") {
+		t.Errorf("first poll headers:\n%s", polls[0])
+	}
+	last := polls[len(polls)-1]
+	if n := strings.Count(strings.ToLower(last), "last-event-id:"); n != 1 || !strings.Contains(last, "Last-Event-Id: 6\r\n") {
+		t.Errorf("later poll has %d Last-Event-ID headers:\n%s", n, last)
+	}
+	if strings.Contains(last, "Connection:") {
+		t.Errorf("hop-by-hop header forwarded:\n%s", last)
+	}
+}
+
+func TestSSERequiresAuthorization(t *testing.T) {
+	actor := &sseActor{}
+	s := NewServer(":0", actor.call, nil, Options{
+		SSEPoll:   10 * time.Millisecond,
+		Authorize: func(r *http.Request) bool { return r.Header.Get("Authorization") == "Bearer ok" },
+	})
+	ts := httptest.NewServer(s.srv.Handler)
+	defer ts.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	resp := sseGet(t, ctx, ts.URL+"/sse", nil)
+	if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" {
+		t.Fatalf("unauthenticated stream: status %d, WWW-Authenticate %q", resp.StatusCode, resp.Header.Get("WWW-Authenticate"))
+	}
+	if resp := sseGet(t, ctx, ts.URL+"/sse", http.Header{"Authorization": {"Bearer ok"}}); resp.StatusCode != http.StatusOK {
+		t.Fatalf("authenticated stream: status %d", resp.StatusCode)
+	}
+}
+
+func TestSSESharesConnectionCap(t *testing.T) {
+	actor := &sseActor{}
+	s := NewServer(":0", actor.call, nil, Options{SSEPoll: 10 * time.Millisecond, MaxConns: 1})
+	ts := httptest.NewServer(s.srv.Handler)
+	defer ts.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if resp := sseGet(t, ctx, ts.URL+"/sse", nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("first stream: status %d", resp.StatusCode)
+	}
+	if resp := sseGet(t, ctx, ts.URL+"/sse", nil); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("second stream: status %d, want 503", resp.StatusCode)
+	}
+	if _, resp, err := dialResp(ts.URL + "/ws"); err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("upgrade while the stream holds the only slot: err %v", err)
+	}
+	if n := s.Active(); n != 1 {
+		t.Errorf("Active() = %d, want 1", n)
+	}
+}
@@ -1,45 +1,495 @@
 package websocket
 
 import (
-	"log"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
+
+	edgehttp "olwsx/edge/http"
+	"olwsx/edge/logging"
+)
+
+// MethodWS marks envelopes carrying a WebSocket frame; TypeHeader tells the actor
+// (and, in the reply, the edge) whether the payload is "text" or "binary".
+const (
+	MethodWS   = "WS"
+	TypeHeader = "X-Olwsx-Ws-Type"
 )
 
-var upgrader = websocket.Upgrader{
-	// TODO: add origin checks / auth gates if required by policy
-	CheckOrigin: func(r *http.Request) bool { return true },
+// Options tunes the WebSocket server policy.
+type Options struct {
+	// CheckOrigin rejects cross-origin upgrades with 403; disable only for trusted internal deployments.
+	CheckOrigin bool
+	// AllowedOrigins lists exact origins ("https://app.example.com") or wildcard subdomains
+	// ("https://*.example.com"). Empty means same-origin only.
+	AllowedOrigins []string
+
+	// PingInterval is how often the server pings; a connection with no pong (or frame)
+	// within PongWait is reaped. Zero PingInterval disables keepalive.
+	PingInterval time.Duration
+	PongWait     time.Duration
+
+	// WriteTimeout bounds each outbound message; a client that does not drain within it is
+	// disconnected. Zero = no deadline.
+	WriteTimeout time.Duration
+
+	// MaxMessageBytes caps a single inbound message; larger ones get a 1009 close. Zero = unlimited.
+	MaxMessageBytes int64
+
+	// EnableCompression negotiates permessage-deflate with clients that offer it;
+	// CompressionLevel is a flate level (-2..9), 0 = library default.
+	EnableCompression bool
+	CompressionLevel  int
+
+	// SSEPoll is how often /sse polls the actor for events; SSEKeepalive spaces comment heartbeats.
+	SSEPoll      time.Duration
+	SSEKeepalive time.Duration
+
+	// JSONErrors renders rejected upgrades as {"error","status","trace_id"} instead of plain text.
+	JSONErrors bool
+
+	// Authorize admits an upgrade request before any connection state is allocated; refused
+	// requests get 401. It may rewrite r, e.g. to strip the credential before it is forwarded.
+	// Nil = no authentication.
+	Authorize func(r *http.Request) bool
+
+	// MaxConns caps concurrent WebSocket connections and SSE streams together; further requests
+	// get 503. Zero = unlimited. Authorize gates /sse as well.
+	MaxConns int
+
+	// HubQueue enables topic pub/sub (see hub.go) with this many queued broadcasts per
+	// subscriber; a subscriber falling further behind is disconnected. Zero = pub/sub off.
+	HubQueue int
+
+	// DrainTimeout bounds how long Shutdown waits for clients to close after the going-away frame.
+	DrainTimeout time.Duration
+
+	// Metric receives connection events ("upgrade", "upgrade_rejected", "unauthorized",
+	// "conn_limit", "timeout", "write_timeout", "too_large", "actor_unavailable", "slow_consumer");
+	// may be nil.
+	Metric func(event string)
 }
 
-func ListenAndServe(addr string) {
+// Server is the edge WebSocket/SSE listener; it tracks live connections so Shutdown can drain them.
+type Server struct {
+	srv      *http.Server
+	upgrader websocket.Upgrader
+	opts     Options
+	coreCall edgehttp.CoreCaller // nil = echo mode
+	newIDs   edgehttp.IDGen
+	hub      *Hub // nil = pub/sub off
+
+	mu     sync.Mutex
+	conns  map[*websocket.Conn]struct{}
+	wg     sync.WaitGroup
+	active atomic.Int64 // upgrades in progress, live connections and SSE streams, checked against MaxConns
+
+	streams     context.Context // parent of request contexts; cancelled on Shutdown to end SSE streams
+	stopStreams context.CancelFunc
+}
+
+// NewServer builds the WebSocket server on addr; frames are forwarded to the actor via coreCall.
+// Run it with ListenAndServe.
+func NewServer(addr string, coreCall edgehttp.CoreCaller, newIDs edgehttp.IDGen, opts Options) *Server {
+	if opts.PingInterval > 0 && opts.PongWait <= opts.PingInterval {
+		opts.PongWait = opts.PingInterval * 2
+	}
+	s := &Server{
+		opts:     opts,
+		coreCall: coreCall,
+		newIDs:   newIDs,
+		conns:    make(map[*websocket.Conn]struct{}),
+	}
+	if opts.HubQueue > 0 {
+		s.hub = NewHub(opts.HubQueue, s.metric)
+	}
+	s.upgrader.CheckOrigin = originChecker(opts)
+	s.upgrader.EnableCompression = opts.EnableCompression
+	s.upgrader.Error = func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+		s.rejectUpgrade(w, r, status, reason.Error())
+	}
 	mux := http.NewServeMux()
-	mux.HandleFunc("/ws", wsHandler)
-	s := &http.Server{
-		Addr:    addr,
-		Handler: mux,
+	mux.HandleFunc("/ws", s.wsHandler)
+	mux.HandleFunc("/sse", s.sseHandler)
+	s.streams, s.stopStreams = context.WithCancel(context.Background())
+	s.srv = &http.Server{
+		Addr:        addr,
+		Handler:     mux,
+		BaseContext: func(net.Listener) context.Context { return s.streams },
+	}
+	return s
+}
+
+// ListenAndServe blocks until the server stops; unexpected errors are logged.
+func (s *Server) ListenAndServe() {
+	logging.Info("Edge WebSocket server on %s", s.srv.Addr)
+	if err := s.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logging.Error("WS server error: %v", err)
+	}
+}
+
+// Shutdown stops accepting upgrades, ends SSE streams, sends a going-away close frame to every live connection,
+// and waits for their handlers to exit until ctx expires, after which remaining conns are dropped.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.stopStreams()
+	err := s.srv.Shutdown(ctx)
+
+	// Clients get the drain window (bounded by ctx) to answer the close frame before being cut off
+	drainCtx := ctx
+	if s.opts.DrainTimeout > 0 {
+		var cancel context.CancelFunc
+		drainCtx, cancel = context.WithTimeout(ctx, s.opts.DrainTimeout)
+		defer cancel()
+	}
+
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutdown")
+	deadline := time.Now().Add(time.Second)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	s.mu.Lock()
+	for c := range s.conns {
+		_ = c.WriteControl(websocket.CloseMessage, msg, deadline)
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-drainCtx.Done():
+		s.mu.Lock()
+		for c := range s.conns {
+			_ = c.Close()
+		}
+		s.mu.Unlock()
+		if err == nil {
+			err = drainCtx.Err()
+		}
+	}
+	return err
+}
+
+// rejectUpgrade answers a refused upgrade (origin, auth, capacity, protocol) or SSE request with status.
+func (s *Server) rejectUpgrade(w http.ResponseWriter, r *http.Request, status int, reason string) {
+	s.metric("upgrade_rejected")
+	var traceID uint64
+	if s.newIDs != nil {
+		traceID, _ = s.newIDs()
+	}
+	traceHex := fmt.Sprintf("%016x", traceID)
+	w.Header().Set("X-Trace-ID", traceHex)
+	if websocket.IsWebSocketUpgrade(r) {
+		w.Header().Set("Sec-Websocket-Version", "13")
+	}
+	if !s.opts.JSONErrors {
+		http.Error(w, http.StatusText(status), status)
+		return
 	}
-	log.Printf("Edge WebSocket server on %s", addr)
-	if err := s.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Printf("WS server error: %v", err)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(struct {
+		Error   string `json:"error"`
+		Status  int    `json:"status"`
+		TraceID string `json:"trace_id"`
+	}{reason, status, traceHex})
+}
+
+func (s *Server) track(c *websocket.Conn) {
+	s.mu.Lock()
+	s.conns[c] = struct{}{}
+	s.mu.Unlock()
+}
+
+func (s *Server) untrack(c *websocket.Conn) {
+	s.mu.Lock()
+	delete(s.conns, c)
+	s.mu.Unlock()
+}
+
+// Hub returns the pub/sub hub, nil when HubQueue is zero.
+func (s *Server) Hub() *Hub {
+	return s.hub
+}
+
+// Active returns the number of WebSocket connections (including upgrades in progress) and SSE streams.
+func (s *Server) Active() int64 {
+	return s.active.Load()
+}
+
+// admit applies the checks /ws and /sse share before any stream state is allocated:
+// Authorize (401) and the MaxConns cap (503). An admitted caller holds a connection slot
+// until it calls release.
+func (s *Server) admit(w http.ResponseWriter, r *http.Request) (release func(), ok bool) {
+	if s.opts.Authorize != nil && !s.opts.Authorize(r) {
+		s.metric("unauthorized")
+		w.Header().Set("WWW-Authenticate", `Bearer realm="olwsx-ws"`)
+		s.rejectUpgrade(w, r, http.StatusUnauthorized, "authentication required")
+		return nil, false
+	}
+	// The slot is taken before upgrading so concurrent upgrades cannot overshoot MaxConns
+	if n := s.active.Add(1); s.opts.MaxConns > 0 && n > int64(s.opts.MaxConns) {
+		s.active.Add(-1)
+		s.metric("conn_limit")
+		s.rejectUpgrade(w, r, http.StatusServiceUnavailable, "too many WebSocket connections")
+		return nil, false
 	}
+	return func() { s.active.Add(-1) }, true
 }
 
-func wsHandler(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+func (s *Server) wsHandler(w http.ResponseWriter, r *http.Request) {
+	release, ok := s.admit(w, r)
+	if !ok {
+		return
+	}
+	defer release()
+	// Counted before upgrading: once hijacked the connection is invisible to http.Server.Shutdown,
+	// so Shutdown's Wait must already cover it
+	s.wg.Add(1)
+	defer s.wg.Done()
+	conn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Println("WebSocket upgrade error:", err)
+		logging.Debug("WebSocket upgrade error: %v", err)
 		return
 	}
+	s.track(conn)
+	defer s.untrack(conn)
+	s.metric("upgrade")
 	defer conn.Close()
+	if s.streams.Err() != nil {
+		// Shutdown began while upgrading and has already sent its going-away frames
+		msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutdown")
+		_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		return
+	}
+	if s.opts.EnableCompression && s.opts.CompressionLevel != 0 {
+		// Only takes effect when the client negotiated permessage-deflate
+		_ = conn.SetCompressionLevel(s.opts.CompressionLevel)
+	}
+	if s.opts.MaxMessageBytes > 0 {
+		conn.SetReadLimit(s.opts.MaxMessageBytes) // gorilla replies 1009 (message too big) on overflow
+	}
+	stopPing := s.keepalive(conn)
+	defer stopPing()
+	out := &wsWriter{conn: conn, timeout: s.opts.WriteTimeout}
+	var sub *subscriber
+	if s.hub != nil {
+		sub = s.hub.attach(conn, out)
+		defer s.hub.detach(sub)
+	}
+	path := r.URL.RequestURI()
+	headersFlat := actorHeaders(r.Header)
 	for {
 		msgType, msg, err := conn.ReadMessage()
 		if err != nil {
+			var ne net.Error
+			if errors.Is(err, websocket.ErrReadLimit) {
+				s.metric("too_large")
+			} else if errors.As(err, &ne) && ne.Timeout() {
+				s.metric("timeout")
+			}
+			break
+		}
+		s.extendRead(conn)
+		if sub != nil && s.hub.handleOp(sub, msgType, msg) {
+			continue
+		}
+		replyType, reply, topic, ok := s.forward(path, headersFlat, msgType, msg)
+		if !ok {
+			s.metric("actor_unavailable")
+			msg := websocket.FormatCloseMessage(websocket.CloseInternalServerErr, "actor unavailable")
+			_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
 			break
 		}
-		// Echo-only; real stream wiring goes to Actor layer via ports/NIFs.
-		if err := conn.WriteMessage(msgType, msg); err != nil {
+		if reply == nil {
+			continue // actor chose not to reply to this frame
+		}
+		if topic != "" && s.hub != nil {
+			s.hub.Publish(topic, replyType, reply)
+			continue
+		}
+		if err := out.write(replyType, reply); err != nil {
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				s.metric("write_timeout")
+			}
 			break
 		}
 	}
-}
\ No newline at end of file
+}
+
+// wsWriter is the single writer of data messages on a connection: writes are serialized and
+// each gets the write deadline, so a client that stops draining cannot block a goroutine
+// forever. Control frames (pings, close) go through conn.WriteControl, which gorilla
+// serializes with data writes itself.
+type wsWriter struct {
+	conn    *websocket.Conn
+	timeout time.Duration
+	mu      sync.Mutex
+}
+
+func (w *wsWriter) write(msgType int, data []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.timeout > 0 {
+		if err := w.conn.SetWriteDeadline(time.Now().Add(w.timeout)); err != nil {
+			return err
+		}
+	}
+	return w.conn.WriteMessage(msgType, data)
+}
+
+// keepalive arms the read deadline and pings the client every PingInterval; pongs extend the deadline.
+// The returned func stops the pinger.
+func (s *Server) keepalive(conn *websocket.Conn) func() {
+	if s.opts.PingInterval <= 0 {
+		return func() {}
+	}
+	s.extendRead(conn)
+	conn.SetPongHandler(func(string) error {
+		s.extendRead(conn)
+		return nil
+	})
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(s.opts.PingInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(s.opts.PingInterval)); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+func (s *Server) extendRead(conn *websocket.Conn) {
+	if s.opts.PongWait > 0 {
+		_ = conn.SetReadDeadline(time.Now().Add(s.opts.PongWait))
+	}
+}
+
+func (s *Server) metric(event string) {
+	if s.opts.Metric != nil {
+		s.opts.Metric(event)
+	}
+}
+
+// forward sends one frame to the actor as a wire envelope and returns the reply frame and,
+// if the actor set PublishHeader, the topic to broadcast it to. The reply keeps the inbound
+// message type unless the actor sets TypeHeader.
+func (s *Server) forward(path, headersFlat string, msgType int, msg []byte) (int, []byte, string, bool) {
+	if s.coreCall == nil {
+		return msgType, msg, "", true
+	}
+	var traceID, spanID uint64
+	if s.newIDs != nil {
+		traceID, spanID = s.newIDs()
+	}
+	headers := headersFlat + TypeHeader + ": " + typeName(msgType) + "\r\n"
+	resp, code := s.coreCall(MethodWS, path, headers, msg, traceID, spanID, 0)
+	if code != 0 {
+		logging.Warn("WS actor forward error: code=%d path=%q", code, path)
+		return 0, nil, "", false
+	}
+	outType, topic := msgType, ""
+	for _, f := range edgehttp.ParseFlatFields(resp.HeadersFlat) {
+		if strings.EqualFold(f.Name, PublishHeader) {
+			topic = f.Value
+		}
+		if strings.EqualFold(f.Name, TypeHeader) {
+			if f.Value == "binary" {
+				outType = websocket.BinaryMessage
+			} else {
+				outType = websocket.TextMessage
+			}
+		}
+	}
+	if len(resp.Body) == 0 {
+		return outType, nil, topic, true
+	}
+	return outType, resp.Body, topic, true
+}
+
+// handshakeOnly are upgrade negotiation headers that mean nothing to the actor once the
+// connection is established (Connection and Upgrade go with the hop-by-hop set).
+var handshakeOnly = []string{"Sec-Websocket-Key", "Sec-Websocket-Extensions", "Sec-Websocket-Version"}
+
+// actorHeaders flattens request headers for the actor as the HTTP path does: hop-by-hop
+// headers, and the WebSocket handshake headers, are not forwarded.
+func actorHeaders(h http.Header) string {
+	fwd := edgehttp.StripHopByHop(h).Clone()
+	for _, k := range handshakeOnly {
+		delete(fwd, k)
+	}
+	flat, _ := edgehttp.FlattenHeaders(fwd)
+	return flat
+}
+
+// originChecker enforces the Origin allowlist; requests without Origin (non-browser clients) pass.
+func originChecker(opts Options) func(r *http.Request) bool {
+	if !opts.CheckOrigin {
+		return func(r *http.Request) bool { return true }
+	}
+	allowed := make([]string, 0, len(opts.AllowedOrigins))
+	for _, o := range opts.AllowedOrigins {
+		allowed = append(allowed, strings.ToLower(strings.TrimSuffix(o, "/")))
+	}
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		u, err := url.Parse(origin)
+		if err != nil || u.Host == "" {
+			return false
+		}
+		if len(allowed) == 0 {
+			return strings.EqualFold(u.Host, r.Host)
+		}
+		return originAllowed(strings.ToLower(u.Scheme+"://"+u.Host), allowed)
+	}
+}
+
+func originAllowed(origin string, allowed []string) bool {
+	for _, a := range allowed {
+		if a == origin {
+			return true
+		}
+		// "https://*.example.com" matches any subdomain, not the apex
+		if scheme, host, ok := strings.Cut(a, "://*."); ok {
+			prefix := scheme + "://"
+			if strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, "."+host) &&
+				len(origin) > len(prefix)+len(host)+1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func typeName(msgType int) string {
+	if msgType == websocket.BinaryMessage {
+		return "binary"
+	}
+	return "text"
+}
@@ -0,0 +1,441 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	edgehttp "olwsx/edge/http"
+)
+
+// recordingActor answers every envelope with reply and remembers the last headers it saw.
+type recordingActor struct {
+	mu      sync.Mutex
+	headers string
+	reply   edgehttp.CoreResp
+}
+
+func (a *recordingActor) call(method, path, headers string, body []byte, traceID, spanID uint64, hints uint32) (edgehttp.CoreResp, int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.headers = headers
+	resp := a.reply
+	if resp.Status == 0 {
+		resp = edgehttp.CoreResp{Status: 200, Body: body}
+	}
+	return resp, 0
+}
+
+func (a *recordingActor) lastHeaders() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.headers
+}
+
+// startServer runs s behind an httptest server and returns its ws:// base URL.
+func startServer(t *testing.T, s *Server) string {
+	t.Helper()
+	ts := httptest.NewServer(s.srv.Handler)
+	t.Cleanup(ts.Close)
+	return "ws" + strings.TrimPrefix(ts.URL, "http")
+}
+
+// dialResp dials the ws:// form of an http:// URL without failing the test, for rejected upgrades.
+func dialResp(url string) (*websocket.Conn, *http.Response, error) {
+	return websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(url, "http"), nil)
+}
+
+func dial(t *testing.T, url string, h http.Header) *websocket.Conn {
+	t.Helper()
+	c, resp, err := websocket.DefaultDialer.Dial(url, h)
+	if err != nil {
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		t.Fatalf("dial %s: %v (status %d)", url, err, status)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestForwardDropsHopByHopAndHandshakeHeaders(t *testing.T) {
+	actor := &recordingActor{}
+	s := NewServer(":0", actor.call, nil, Options{})
+	base := startServer(t, s)
+	c := dial(t, base+"/ws", http.Header{"X-App": {"42"}, "Sec-Websocket-Protocol": {"chat"}})
+	if err := c.WriteMessage(websocket.TextMessage, []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if _, msg, err := c.ReadMessage(); err != nil || string(msg) != "hi" {
+		t.Fatalf("reply = %q, %v", msg, err)
+	}
+	got := actor.lastHeaders()
+	for _, want := range []string{"X-App: 42\r\n", "Sec-Websocket-Protocol: chat\r\n", TypeHeader + ": text\r\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("actor headers missing %q:\n%s", want, got)
+		}
+	}
+	for _, name := range []string{"Connection", "Upgrade", "Sec-Websocket-Key", "Sec-Websocket-Version", "Sec-Websocket-Extensions"} {
+		if strings.Contains(got, name+":") {
+			t.Errorf("actor headers leak %s:\n%s", name, got)
+		}
+	}
+}
+
+func TestShutdownWaitsForUpgradedConnections(t *testing.T) {
+	s := NewServer(":0", nil, nil, Options{})
+	base := startServer(t, s)
+	c := dial(t, base+"/ws", nil)
+	if err := c.WriteMessage(websocket.TextMessage, []byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+
+	closed := make(chan error, 1)
+	go func() {
+		_, _, err := c.ReadMessage() // answers the going-away frame, ending the handler
+		closed <- err
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if err := <-closed; !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("client saw %v, want a going-away close", err)
+	}
+}
+
+func TestOriginChecker(t *testing.T) {
+	allow := Options{CheckOrigin: true, AllowedOrigins: []string{"https://app.example.com/", "https://*.example.org"}}
+	for _, tc := range []struct {
+		name   string
+		opts   Options
+		origin string
+		want   bool
+	}{
+		{"missing origin", allow, "", true},
+		{"exact", allow, "https://app.example.com", true},
+		{"exact, case-insensitive", allow, "HTTPS://App.Example.com", true},
+		{"other host", allow, "https://evil.example.com", false},
+		{"other scheme", allow, "http://app.example.com", false},
+		{"wildcard subdomain", allow, "https://a.b.example.org", true},
+		{"wildcard excludes apex", allow, "https://example.org", false},
+		{"wildcard suffix trick", allow, "https://evilexample.org", false},
+		{"unparsable", allow, "://", false},
+		{"same origin by default", Options{CheckOrigin: true}, "https://edge.test", true},
+		{"cross origin by default", Options{CheckOrigin: true}, "https://other.test", false},
+		{"check disabled", Options{}, "https://other.test", true},
+	} {
+		r := httptest.NewRequest("GET", "http://edge.test/ws", nil)
+		if tc.origin != "" {
+			r.Header.Set("Origin", tc.origin)
+		}
+		if got := originChecker(tc.opts)(r); got != tc.want {
+			t.Errorf("%s: Origin %q allowed = %v, want %v", tc.name, tc.origin, got, tc.want)
+		}
+	}
+}
+
+func TestCrossOriginUpgradeIsForbidden(t *testing.T) {
+	s := NewServer(":0", nil, nil, Options{CheckOrigin: true, AllowedOrigins: []string{"https://app.example.com"}})
+	base := startServer(t, s)
+	_, resp, err := websocket.DefaultDialer.Dial(base+"/ws", http.Header{"Origin": {"https://evil.example.com"}})
+	if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("cross-origin upgrade: err %v, resp %v", err, resp)
+	}
+	dial(t, base+"/ws", http.Header{"Origin": {"https://app.example.com"}})
+	dial(t, base+"/ws", nil)
+}
+
+// events collects Options.Metric events.
+func events() (chan string, func(string)) {
+	ch := make(chan string, 64)
+	return ch, func(e string) { ch <- e }
+}
+
+// waitEvent waits for want, skipping other events.
+func waitEvent(t *testing.T, ch chan string, want string, within time.Duration) {
+	t.Helper()
+	deadline := time.After(within)
+	for {
+		select {
+		case e := <-ch:
+			if e == want {
+				return
+			}
+		case <-deadline:
+			t.Fatalf("no %q event within %v", want, within)
+		}
+	}
+}
+
+func TestUnresponsiveClientIsReaped(t *testing.T) {
+	ch, metric := events()
+	s := NewServer(":0", nil, nil, Options{PingInterval: 20 * time.Millisecond, PongWait: 60 * time.Millisecond, Metric: metric})
+	base := startServer(t, s)
+
+	// A client that keeps reading answers pings and stays connected past PongWait
+	live := dial(t, base+"/ws", nil)
+	liveErr := make(chan error, 1)
+	go func() {
+		_, _, err := live.ReadMessage()
+		liveErr <- err
+	}()
+
+	// A client that never reads never answers a ping
+	dead := dial(t, base+"/ws", nil)
+	start := time.Now()
+	waitEvent(t, ch, "timeout", time.Second)
+	if d := time.Since(start); d < 60*time.Millisecond {
+		t.Errorf("reaped after %v, before PongWait", d)
+	}
+	if _, _, err := dead.ReadMessage(); err == nil {
+		t.Error("reaped connection still readable")
+	}
+
+	select {
+	case err := <-liveErr:
+		t.Fatalf("responsive client dropped: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if err := live.WriteMessage(websocket.TextMessage, []byte("still here")); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-liveErr; err != nil {
+		t.Errorf("responsive client: %v", err)
+	}
+}
+
+func TestOversizedMessageClosesWith1009(t *testing.T) {
+	ch, metric := events()
+	s := NewServer(":0", nil, nil, Options{MaxMessageBytes: 16, Metric: metric})
+	base := startServer(t, s)
+	c := dial(t, base+"/ws", nil)
+
+	if err := c.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("a", 16))); err != nil {
+		t.Fatal(err)
+	}
+	if _, msg, err := c.ReadMessage(); err != nil || len(msg) != 16 {
+		t.Fatalf("message at the limit: %q, %v", msg, err)
+	}
+	if err := c.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("a", 17))); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Errorf("oversized message: %v, want a 1009 close", err)
+	}
+	waitEvent(t, ch, "too_large", time.Second)
+}
+
+func TestCompressionNegotiatedAndRoundTrips(t *testing.T) {
+	actor := &recordingActor{}
+	s := NewServer(":0", actor.call, nil, Options{EnableCompression: true, CompressionLevel: 6})
+	base := startServer(t, s)
+	d := websocket.Dialer{EnableCompression: true}
+	c, resp, err := d.Dial(base+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if ext := resp.Header.Get("Sec-Websocket-Extensions"); !strings.Contains(ext, "permessage-deflate") {
+		t.Fatalf("Sec-WebSocket-Extensions = %q", ext)
+	}
+	big := strings.Repeat(`{"event":"tick","value":42}`, 4096)
+	if err := c.WriteMessage(websocket.TextMessage, []byte(big)); err != nil {
+		t.Fatal(err)
+	}
+	if typ, msg, err := c.ReadMessage(); err != nil || typ != websocket.TextMessage || string(msg) != big {
+		t.Fatalf("round trip: type %d, %d bytes, %v", typ, len(msg), err)
+	}
+
+	// Clients that do not offer it get plain frames
+	plain, resp, err := websocket.DefaultDialer.Dial(base+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Close()
+	if ext := resp.Header.Get("Sec-Websocket-Extensions"); ext != "" {
+		t.Errorf("extension negotiated without an offer: %q", ext)
+	}
+}
+
+// upgradeError is the JSONErrors body of a rejected upgrade.
+type upgradeError struct {
+	Error   string `json:"error"`
+	Status  int    `json:"status"`
+	TraceID string `json:"trace_id"`
+}
+
+func rejectedUpgrade(t *testing.T, url string, h http.Header, want int) upgradeError {
+	t.Helper()
+	_, resp, err := websocket.DefaultDialer.Dial(url, h)
+	if err == nil || resp == nil || resp.StatusCode != want {
+		t.Fatalf("upgrade: err %v, resp %v; want status %d", err, resp, want)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type %q", ct)
+	}
+	var body upgradeError
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Status != want || body.Error == "" || body.TraceID != resp.Header.Get("X-Trace-ID") {
+		t.Errorf("error body %+v, X-Trace-ID %q", body, resp.Header.Get("X-Trace-ID"))
+	}
+	return body
+}
+
+func TestRejectedUpgradesRenderJSON(t *testing.T) {
+	ids := func() (uint64, uint64) { return 0xabc, 0xdef }
+	s := NewServer(":0", nil, ids, Options{JSONErrors: true, CheckOrigin: true, MaxConns: 1})
+	base := startServer(t, s)
+
+	body := rejectedUpgrade(t, base+"/ws", http.Header{"Origin": {"https://evil.example.com"}}, http.StatusForbidden)
+	if body.TraceID != "0000000000000abc" || !strings.Contains(body.Error, "origin") {
+		t.Errorf("origin rejection: %+v", body)
+	}
+
+	dial(t, base+"/ws", nil) // takes the only slot
+	if body := rejectedUpgrade(t, base+"/ws", nil, http.StatusServiceUnavailable); body.Error != "too many WebSocket connections" {
+		t.Errorf("capacity rejection: %+v", body)
+	}
+}
+
+func TestLifecycleEventsReported(t *testing.T) {
+	ch, metric := events()
+	down := func(method, path, headers string, body []byte, traceID, spanID uint64, hints uint32) (edgehttp.CoreResp, int) {
+		return edgehttp.CoreResp{}, 3
+	}
+	s := NewServer(":0", down, nil, Options{JSONErrors: true, CheckOrigin: true, Metric: metric})
+	base := startServer(t, s)
+
+	c := dial(t, base+"/ws", nil)
+	waitEvent(t, ch, "upgrade", time.Second)
+	if err := c.WriteMessage(websocket.TextMessage, []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseInternalServerErr) {
+		t.Errorf("actor down: %v, want a 1011 close", err)
+	}
+	waitEvent(t, ch, "actor_unavailable", time.Second)
+
+	rejectedUpgrade(t, base+"/ws", http.Header{"Origin": {"https://evil.example.com"}}, http.StatusForbidden)
+	waitEvent(t, ch, "upgrade_rejected", time.Second)
+}
+
+// waitActive polls s.Active until it reaches want.
+func waitActive(t *testing.T, s *Server, want int64) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); s.Active() != want; {
+		if time.Now().After(deadline) {
+			t.Fatalf("Active() = %d, want %d", s.Active(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMaxConnsCapsAndReleases(t *testing.T) {
+	ch, metric := events()
+	s := NewServer(":0", nil, nil, Options{JSONErrors: true, MaxConns: 3, Metric: metric})
+	base := startServer(t, s)
+
+	var clients []*websocket.Conn
+	for i := 0; i < 3; i++ {
+		clients = append(clients, dial(t, base+"/ws", nil))
+	}
+	waitActive(t, s, 3)
+	rejectedUpgrade(t, base+"/ws", nil, http.StatusServiceUnavailable)
+	waitEvent(t, ch, "conn_limit", time.Second)
+	if s.Active() != 3 {
+		t.Errorf("a rejected upgrade left Active() at %d", s.Active())
+	}
+
+	// Closing one frees its slot for the next client
+	clients[0].Close()
+	waitActive(t, s, 2)
+	c := dial(t, base+"/ws", nil)
+	if err := c.WriteMessage(websocket.TextMessage, []byte("in")); err != nil {
+		t.Fatal(err)
+	}
+	if _, msg, err := c.ReadMessage(); err != nil || string(msg) != "in" {
+		t.Fatalf("replacement client: %q, %v", msg, err)
+	}
+
+	c.Close()
+	for _, cl := range clients[1:] {
+		cl.Close()
+	}
+	waitActive(t, s, 0)
+}
+
+func TestStalledClientIsDroppedAfterWriteTimeout(t *testing.T) {
+	ch, metric := events()
+	s := NewServer(":0", nil, nil, Options{WriteTimeout: 200 * time.Millisecond, Metric: metric})
+	base := startServer(t, s)
+	c := dial(t, base+"/ws", nil)
+
+	// Flood echoes without ever reading them until the server's sends back up
+	start := time.Now()
+	go func() {
+		msg := make([]byte, 512<<10)
+		c.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		for c.WriteMessage(websocket.BinaryMessage, msg) == nil {
+		}
+	}()
+	waitEvent(t, ch, "write_timeout", 3*time.Second)
+	if took := time.Since(start); took < 200*time.Millisecond {
+		t.Errorf("dropped after %v, before the write timeout", took)
+	}
+	waitActive(t, s, 0)
+}
+
+func TestUpgradeRequiresAuthorization(t *testing.T) {
+	ch, metric := events()
+	s := NewServer(":0", nil, nil, Options{
+		JSONErrors: true,
+		Metric:     metric,
+		Authorize: func(r *http.Request) bool {
+			ok := r.Header.Get("Authorization") == "Bearer good"
+			r.Header.Del("Authorization")
+			return ok
+		},
+		MaxConns: 1,
+	})
+	base := startServer(t, s)
+
+	for name, h := range map[string]http.Header{
+		"absent":  nil,
+		"invalid": {"Authorization": {"Bearer bad"}},
+	} {
+		_, resp, err := websocket.DefaultDialer.Dial(base+"/ws", h)
+		if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" {
+			t.Fatalf("%s token: err %v, resp %v", name, err, resp)
+		}
+		waitEvent(t, ch, "unauthorized", time.Second)
+	}
+	if s.Active() != 0 {
+		t.Errorf("refused upgrades hold %d slots", s.Active())
+	}
+
+	// The only slot is still free for an authorized client
+	c := dial(t, base+"/ws", http.Header{"Authorization": {"Bearer good"}})
+	waitEvent(t, ch, "upgrade", time.Second)
+	if err := c.WriteMessage(websocket.TextMessage, []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if _, msg, err := c.ReadMessage(); err != nil || string(msg) != "hi" {
+		t.Fatalf("authorized client: %q, %v", msg, err)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"io"
 )
 
 type Response struct {
@@ -11,62 +13,156 @@ type Response struct {
 	HeadersFlat string
 	Body        []byte
 	MetaFlags   uint32
+	Reason      string // optional trailing field; empty = standard reason phrase
 }
 
+var (
+	ErrResponseVersion = errors.New("unsupported response frame version")
+	ErrShortFrame      = errors.New("short response frame")
+)
+
+// ReadResponse decodes an actor response, framed (see WriteResponse) or bare. The result does
+// not alias p.
 func ReadResponse(p []byte) (Response, error) {
+	if bytes.HasPrefix(p, []byte(ResponseMagic)) {
+		hdr := len(ResponseMagic) + 5
+		if len(p) < hdr {
+			return Response{}, ErrShortFrame
+		}
+		if err := checkVersion(p[len(ResponseMagic)]); err != nil {
+			return Response{}, err
+		}
+		n := binary.LittleEndian.Uint32(p[len(ResponseMagic)+1 : hdr])
+		if uint64(len(p)-hdr) < uint64(n) {
+			return Response{}, ErrShortFrame
+		}
+		p = p[hdr : hdr+int(n)]
+	}
+	out, err := parsePayload(p)
+	out.Body = bytes.Clone(out.Body)
+	return out, err
+}
+
+func checkVersion(v byte) error {
+	if v != ResponseVersion {
+		return fmt.Errorf("%w: got %d, want %d", ErrResponseVersion, v, ResponseVersion)
+	}
+	return nil
+}
+
+// parsePayload decodes an unframed response payload; Body aliases p.
+func parsePayload(p []byte) (Response, error) {
 	var out Response
-	r := bytes.NewReader(p)
-	var status int32
-	if err := binary.Read(r, binary.LittleEndian, &status); err != nil {
-		return out, err
+	if len(p) < 4 {
+		return out, ErrShortFrame
 	}
-	hdr, err := readStr(r)
+	out.Status = int32(binary.LittleEndian.Uint32(p))
+	p = p[4:]
+	hdr, p, err := cutField(p)
 	if err != nil {
 		return out, err
 	}
-	body, err := readBytes(r)
+	body, p, err := cutField(p)
 	if err != nil {
 		return out, err
 	}
-	var meta uint32
-	if err := binary.Read(r, binary.LittleEndian, &meta); err != nil {
-		return out, err
+	if len(p) < 4 {
+		return out, ErrShortFrame
+	}
+	out.MetaFlags = binary.LittleEndian.Uint32(p)
+	p = p[4:]
+	// Optional reason phrase: older actors end the frame after meta
+	if len(p) > 0 {
+		reason, _, err := cutField(p)
+		if err != nil {
+			return out, err
+		}
+		out.Reason = string(reason)
+	}
+	out.HeadersFlat = string(hdr)
+	if len(body) > 0 {
+		out.Body = body
 	}
-	out.Status = status
-	out.HeadersFlat = hdr
-	out.Body = body
-	out.MetaFlags = meta
 	return out, nil
 }
 
-func readStr(r *bytes.Reader) (string, error) {
-	var l uint32
-	if err := binary.Read(r, binary.LittleEndian, &l); err != nil {
-		return "", err
+// cutField splits a [len:uint32][bytes] field off the front of p.
+func cutField(p []byte) (field, rest []byte, err error) {
+	if len(p) < 4 {
+		return nil, nil, ErrShortFrame
+	}
+	n := binary.LittleEndian.Uint32(p)
+	p = p[4:]
+	if uint64(len(p)) < uint64(n) {
+		return nil, nil, errors.New("short read")
+	}
+	return p[:n], p[n:], nil
+}
+
+// ErrResponseTooLarge reports a response above the decoder's limit.
+var ErrResponseTooLarge = errors.New("actor response too large")
+
+// ResponseDecoder reads one actor response from a stream. Framed responses are read exactly
+// (header, then a payload buffer sized from the declared length), so small responses cost
+// small allocations and large ones are limited only by max; bare (legacy) responses are read
+// until EOF, growing as needed up to max.
+type ResponseDecoder struct {
+	r      io.Reader
+	max    int
+	framed bool
+}
+
+// NewResponseDecoder decodes from r, rejecting payloads above max bytes (max <= 0 = no limit).
+func NewResponseDecoder(r io.Reader, max int) *ResponseDecoder {
+	return &ResponseDecoder{r: r, max: max}
+}
+
+// Decode reads and decodes the next response; the returned Body is owned by the caller.
+func (d *ResponseDecoder) Decode() (Response, error) {
+	d.framed = false
+	var hdr [len(ResponseMagic) + 5]byte
+	if _, err := io.ReadFull(d.r, hdr[:len(ResponseMagic)]); err != nil {
+		return Response{}, err
+	}
+	if string(hdr[:len(ResponseMagic)]) != ResponseMagic {
+		return d.decodeBare(hdr[:len(ResponseMagic)])
+	}
+	if _, err := io.ReadFull(d.r, hdr[len(ResponseMagic):]); err != nil {
+		return Response{}, ErrShortFrame
 	}
-	if l == 0 {
-		return "", nil
+	if err := checkVersion(hdr[len(ResponseMagic)]); err != nil {
+		return Response{}, err
 	}
-	buf := make([]byte, l)
-	n, err := r.Read(buf)
-	if err != nil || uint32(n) != l {
-		return "", errors.New("short read")
+	n := binary.LittleEndian.Uint32(hdr[len(ResponseMagic)+1:])
+	if d.max > 0 && uint64(n) > uint64(d.max) {
+		return Response{}, fmt.Errorf("%w: %d bytes, limit %d", ErrResponseTooLarge, n, d.max)
 	}
-	return string(buf), nil
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(d.r, payload); err != nil {
+		return Response{}, ErrShortFrame
+	}
+	d.framed = true
+	return parsePayload(payload)
 }
 
-func readBytes(r *bytes.Reader) ([]byte, error) {
-	var l uint32
-	if err := binary.Read(r, binary.LittleEndian, &l); err != nil {
-		return nil, err
+// Framed reports whether the last Decode consumed a complete framed response. The stream is
+// then positioned at the next response and may carry another request; a bare response was
+// read to EOF.
+func (d *ResponseDecoder) Framed() bool { return d.framed }
+
+// decodeBare reads an unframed payload, whose first bytes were already consumed, until EOF.
+func (d *ResponseDecoder) decodeBare(head []byte) (Response, error) {
+	var b bytes.Buffer
+	b.Write(head)
+	src := d.r
+	if d.max > 0 {
+		src = io.LimitReader(d.r, int64(d.max)-int64(len(head))+1)
 	}
-	if l == 0 {
-		return nil, nil
+	if _, err := b.ReadFrom(src); err != nil {
+		return Response{}, err
 	}
-	buf := make([]byte, l)
-	n, err := r.Read(buf)
-	if err != nil || uint32(n) != l {
-		return nil, errors.New("short read")
+	if d.max > 0 && b.Len() > d.max {
+		return Response{}, fmt.Errorf("%w: limit %d", ErrResponseTooLarge, d.max)
 	}
-	return buf, nil
-}
\ No newline at end of file
+	return parsePayload(b.Bytes())
+}
@@ -0,0 +1,116 @@
+package wire
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"runtime"
+	"testing"
+)
+
+// futureFrame is a valid frame stamped with the next protocol version.
+func futureFrame() []byte {
+	frame := WriteResponse(200, "", []byte("from the future"), 0)
+	frame[len(ResponseMagic)] = ResponseVersion + 1
+	return frame
+}
+
+func TestFutureVersionIsRejected(t *testing.T) {
+	if _, err := ReadResponse(futureFrame()); !errors.Is(err, ErrResponseVersion) {
+		t.Errorf("ReadResponse: err = %v, want ErrResponseVersion", err)
+	}
+	d := NewResponseDecoder(bytes.NewReader(futureFrame()), 0)
+	if _, err := d.Decode(); !errors.Is(err, ErrResponseVersion) || d.Framed() {
+		t.Errorf("Decode: err = %v, framed %t", err, d.Framed())
+	}
+}
+
+func TestDecoderReadsLargeFramedResponse(t *testing.T) {
+	body := bytes.Repeat([]byte("0123456789abcdef"), 5<<20/16)
+	frame := WriteResponse(200, "Content-Type: application/octet-stream\r\n", body, 0)
+	// Handed out in MTU-sized chunks, as a socket would
+	d := NewResponseDecoder(&chunkedReader{p: frame, n: 1500}, 8<<20)
+	resp, err := d.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != 200 || !bytes.Equal(resp.Body, body) || !d.Framed() {
+		t.Errorf("status %d, %d body bytes, framed %t", resp.Status, len(resp.Body), d.Framed())
+	}
+}
+
+// chunkedReader returns at most n bytes per Read.
+type chunkedReader struct {
+	p []byte
+	n int
+}
+
+func (r *chunkedReader) Read(b []byte) (int, error) {
+	if len(r.p) == 0 {
+		return 0, io.EOF
+	}
+	if len(b) > r.n {
+		b = b[:r.n]
+	}
+	k := copy(b, r.p)
+	r.p = r.p[k:]
+	return k, nil
+}
+
+func TestDecoderSizesBufferFromFrame(t *testing.T) {
+	frame := WriteResponse(204, "", nil, 0)
+	readers := make([]*bytes.Reader, 100)
+	for i := range readers {
+		readers[i] = bytes.NewReader(frame)
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for _, r := range readers {
+		if resp, err := NewResponseDecoder(r, 64<<20).Decode(); err != nil || resp.Status != 204 {
+			t.Fatalf("status %d, %v", resp.Status, err)
+		}
+	}
+	runtime.ReadMemStats(&after)
+	if per := (after.TotalAlloc - before.TotalAlloc) / uint64(len(readers)); per > 1024 {
+		t.Errorf("tiny response allocated %d bytes per decode", per)
+	}
+}
+
+func TestDecoderStreamOfFramesAndLimits(t *testing.T) {
+	var stream bytes.Buffer
+	stream.Write(WriteResponse(200, "A: 1\r\n", []byte("first"), 0))
+	stream.Write(WriteResponseReason(404, "", nil, 1, "Gone Fishing"))
+	d := NewResponseDecoder(&stream, 1<<10)
+	first, err := d.Decode()
+	if err != nil || string(first.Body) != "first" || first.HeadersFlat != "A: 1\r\n" {
+		t.Fatalf("first: %+v, %v", first, err)
+	}
+	second, err := d.Decode()
+	if err != nil || second.Status != 404 || second.Reason != "Gone Fishing" || second.MetaFlags != 1 || !d.Framed() {
+		t.Fatalf("second: %+v, %v", second, err)
+	}
+	if _, err := d.Decode(); err != io.EOF {
+		t.Errorf("after the last frame: %v, want io.EOF", err)
+	}
+
+	big := WriteResponse(200, "", make([]byte, 2<<10), 0)
+	if _, err := NewResponseDecoder(bytes.NewReader(big), 1<<10).Decode(); !errors.Is(err, ErrResponseTooLarge) {
+		t.Errorf("framed over the limit: %v", err)
+	}
+	if _, err := NewResponseDecoder(bytes.NewReader(big[:len(big)-1]), 0).Decode(); !errors.Is(err, ErrShortFrame) {
+		t.Errorf("truncated frame: %v", err)
+	}
+}
+
+func TestDecoderReadsBareResponseToEOF(t *testing.T) {
+	frame := WriteResponse(200, "B: 2\r\n", []byte("legacy"), 0)
+	bare := frame[len(ResponseMagic)+5:]
+	d := NewResponseDecoder(&chunkedReader{p: bare, n: 3}, 1<<10)
+	resp, err := d.Decode()
+	if err != nil || string(resp.Body) != "legacy" || resp.HeadersFlat != "B: 2\r\n" || d.Framed() {
+		t.Errorf("bare: %+v, %v, framed %t", resp, err, d.Framed())
+	}
+	if _, err := NewResponseDecoder(bytes.NewReader(bare), len(bare)-1).Decode(); !errors.Is(err, ErrResponseTooLarge) {
+		t.Errorf("bare over the limit: %v", err)
+	}
+}
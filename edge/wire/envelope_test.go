@@ -0,0 +1,133 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+type envelope struct {
+	method, path, headers string
+	body                  []byte
+	traceID, spanID       uint64
+	hints                 uint32
+}
+
+// decodeEnvelope is the actor's side of WriteEnvelopeTo, kept here to pin the layout.
+func decodeEnvelope(t *testing.T, p []byte) envelope {
+	t.Helper()
+	next := func(n int) []byte {
+		if len(p) < n {
+			t.Fatalf("envelope truncated: need %d bytes, have %d", n, len(p))
+		}
+		v := p[:n]
+		p = p[n:]
+		return v
+	}
+	field := func() []byte { return next(int(binary.LittleEndian.Uint32(next(4)))) }
+	var e envelope
+	e.method, e.path, e.headers = string(field()), string(field()), string(field())
+	e.body = append([]byte(nil), field()...)
+	e.traceID = binary.LittleEndian.Uint64(next(8))
+	e.spanID = binary.LittleEndian.Uint64(next(8))
+	e.hints = binary.LittleEndian.Uint32(next(4))
+	if len(p) != 0 {
+		t.Fatalf("%d trailing bytes", len(p))
+	}
+	return e
+}
+
+func checkEnvelope(t *testing.T, name string, got, want envelope) {
+	t.Helper()
+	if got.method != want.method || got.path != want.path || got.headers != want.headers || !bytes.Equal(got.body, want.body) ||
+		got.traceID != want.traceID || got.spanID != want.spanID || got.hints != want.hints {
+		t.Errorf("%s: decoded %+v, want %+v", name, got, want)
+	}
+}
+
+func TestWriteEnvelopeToReusedBuffer(t *testing.T) {
+	envs := []envelope{
+		{"POST", "/upload", "Content-Type: application/octet-stream\r\n" + strings.Repeat("X-Pad: long value\r\n", 200),
+			bytes.Repeat([]byte{0xfe}, 64<<10), 1, 2, HintWAFBlocked},
+		{"GET", "/", "", nil, 0xffffffffffffffff, 0, 0}, // shorter than the previous one: no leftovers
+		{"HEAD", "/a?b=c", "Host: x\r\n", []byte("x"), 3, 4, HintHead | HintChallenged},
+	}
+	b := AcquireBuffer()
+	for i, e := range envs {
+		b.Reset()
+		WriteEnvelopeTo(b, e.method, e.path, e.headers, e.body, e.traceID, e.spanID, e.hints)
+		checkEnvelope(t, e.method, decodeEnvelope(t, b.Bytes()), e)
+		if fresh := WriteEnvelope(e.method, e.path, e.headers, e.body, e.traceID, e.spanID, e.hints); !bytes.Equal(fresh, b.Bytes()) {
+			t.Errorf("envelope %d: WriteEnvelope and WriteEnvelopeTo disagree", i)
+		}
+	}
+	ReleaseBuffer(b)
+
+	// A buffer comes back from the pool empty, whatever it held before
+	for i := 0; i < 4; i++ {
+		if b := AcquireBuffer(); b.Len() != 0 {
+			t.Fatalf("pooled buffer holds %d bytes", b.Len())
+		} else {
+			WriteEnvelopeTo(b, "GET", "/dirty", "", nil, 0, 0, 0)
+			ReleaseBuffer(b)
+		}
+	}
+}
+
+func TestWriteEnvelopeDoesNotAliasPool(t *testing.T) {
+	env := WriteEnvelope("GET", "/kept", "", nil, 7, 8, 0)
+	want := append([]byte(nil), env...)
+	for i := 0; i < 16; i++ {
+		b := AcquireBuffer()
+		WriteEnvelopeTo(b, "PUT", "/overwrite", strings.Repeat("z", 64), nil, 9, 9, 9)
+		ReleaseBuffer(b)
+	}
+	if !bytes.Equal(env, want) {
+		t.Error("WriteEnvelope result changed after pooled buffers were reused")
+	}
+}
+
+func TestReleaseBufferDropsHugeBuffers(t *testing.T) {
+	b := AcquireBuffer()
+	b.Grow(maxPooledBuffer + 1)
+	ReleaseBuffer(b)
+	for i := 0; i < 8; i++ {
+		if got := AcquireBuffer(); got.Cap() > maxPooledBuffer {
+			t.Fatalf("oversized buffer (%d bytes) came back from the pool", got.Cap())
+		}
+	}
+}
+
+func TestWriteEnvelopeToAllocations(t *testing.T) {
+	headers := strings.Repeat("X-Header: value\r\n", 24)
+	body := make([]byte, 512)
+	n := testing.AllocsPerRun(100, func() {
+		b := AcquireBuffer()
+		WriteEnvelopeTo(b, "GET", "/bench/path", headers, body, 1, 2, 0)
+		ReleaseBuffer(b)
+	})
+	if n != 0 {
+		t.Errorf("pooled envelope: %v allocs/op, want 0", n)
+	}
+}
+
+func BenchmarkWriteEnvelope(b *testing.B) {
+	headers := strings.Repeat("X-Header: value\r\n", 24)
+	body := make([]byte, 512)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		WriteEnvelope("GET", "/bench/path", headers, body, 1, 2, 0)
+	}
+}
+
+func BenchmarkWriteEnvelopeToPooled(b *testing.B) {
+	headers := strings.Repeat("X-Header: value\r\n", 24)
+	body := make([]byte, 512)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf := AcquireBuffer()
+		WriteEnvelopeTo(buf, "GET", "/bench/path", headers, body, 1, 2, 0)
+		ReleaseBuffer(buf)
+	}
+}
@@ -3,30 +3,98 @@ package wire
 import (
 	"bytes"
 	"encoding/binary"
+	"sync"
 )
 
+// WriteEnvelope returns a freshly allocated request envelope; the hot path uses WriteEnvelopeTo
+// with a pooled buffer instead.
 func WriteEnvelope(method, path, headers string, body []byte, traceID, spanID uint64, hints uint32) []byte {
 	var b bytes.Buffer
-	writeStr(&b, method)
-	writeStr(&b, path)
-	writeStr(&b, headers)
-	writeBytes(&b, body)
-	_ = binary.Write(&b, binary.LittleEndian, traceID)
-	_ = binary.Write(&b, binary.LittleEndian, spanID)
-	_ = binary.Write(&b, binary.LittleEndian, hints)
+	WriteEnvelopeTo(&b, method, path, headers, body, traceID, spanID, hints)
+	return b.Bytes()
+}
+
+// envelopeFixed is the length prefixes plus traceID, spanID and hints.
+const envelopeFixed = 4*4 + 8 + 8 + 4
+
+// WriteEnvelopeTo appends the request envelope to dst, growing it once.
+func WriteEnvelopeTo(dst *bytes.Buffer, method, path, headers string, body []byte, traceID, spanID uint64, hints uint32) {
+	dst.Grow(envelopeFixed + len(method) + len(path) + len(headers) + len(body))
+	writeStr(dst, method)
+	writeStr(dst, path)
+	writeStr(dst, headers)
+	writeBytes(dst, body)
+	writeUint64(dst, traceID)
+	writeUint64(dst, spanID)
+	writeUint32(dst, hints)
+}
+
+// maxPooledBuffer keeps buffers grown by a rare huge body out of the pool.
+const maxPooledBuffer = 1 << 20
+
+var envelopeBufs = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// AcquireBuffer returns an empty buffer from the envelope pool. Hand it back with
+// ReleaseBuffer once nothing references its bytes any more.
+func AcquireBuffer() *bytes.Buffer {
+	return envelopeBufs.Get().(*bytes.Buffer)
+}
+
+// ReleaseBuffer resets b and returns it to the pool; b and any slice of its bytes must not be
+// used afterwards.
+func ReleaseBuffer(b *bytes.Buffer) {
+	if b.Cap() > maxPooledBuffer {
+		return
+	}
+	b.Reset()
+	envelopeBufs.Put(b)
+}
+
+// WriteResponse encodes a framed actor response; it is the exact inverse of ReadResponse.
+func WriteResponse(status int32, headersFlat string, body []byte, meta uint32) []byte {
+	return WriteResponseReason(status, headersFlat, body, meta, "")
+}
+
+// WriteResponseReason is WriteResponse with the optional trailing reason phrase.
+func WriteResponseReason(status int32, headersFlat string, body []byte, meta uint32, reason string) []byte {
+	var p bytes.Buffer
+	_ = binary.Write(&p, binary.LittleEndian, status)
+	writeStr(&p, headersFlat)
+	writeBytes(&p, body)
+	_ = binary.Write(&p, binary.LittleEndian, meta)
+	if reason != "" {
+		writeStr(&p, reason)
+	}
+	var b bytes.Buffer
+	b.Grow(len(ResponseMagic) + 5 + p.Len())
+	b.WriteString(ResponseMagic)
+	b.WriteByte(ResponseVersion)
+	_ = binary.Write(&b, binary.LittleEndian, uint32(p.Len()))
+	b.Write(p.Bytes())
 	return b.Bytes()
 }
 
 func writeStr(b *bytes.Buffer, s string) {
-	l := uint32(len(s))
-	_ = binary.Write(b, binary.LittleEndian, l)
+	writeUint32(b, uint32(len(s)))
 	b.WriteString(s)
 }
 
 func writeBytes(b *bytes.Buffer, p []byte) {
-	l := uint32(len(p))
-	_ = binary.Write(b, binary.LittleEndian, l)
-	if l > 0 {
+	writeUint32(b, uint32(len(p)))
+	if len(p) > 0 {
 		b.Write(p)
 	}
+}
+
+// writeUint32 and writeUint64 encode little-endian without binary.Write's per-call allocation.
+func writeUint32(b *bytes.Buffer, v uint32) {
+	var s [4]byte
+	binary.LittleEndian.PutUint32(s[:], v)
+	b.Write(s[:])
+}
+
+func writeUint64(b *bytes.Buffer, v uint64) {
+	var s [8]byte
+	binary.LittleEndian.PutUint64(s[:], v)
+	b.Write(s[:])
 }
\ No newline at end of file
@@ -0,0 +1,85 @@
+package wire
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestWriteResponseRoundTrip(t *testing.T) {
+	bigHeaders := strings.Repeat("X-Padding: "+strings.Repeat("h", 100)+"\r\n", 2000)
+	for _, tc := range []struct {
+		name string
+		want Response
+	}{
+		{"empty body", Response{Status: 204, HeadersFlat: "X-A: 1\r\n"}},
+		{"no headers", Response{Status: 200, Body: []byte("ok")}},
+		{"large headers", Response{Status: 200, HeadersFlat: bigHeaders, Body: []byte("x")}},
+		{"binary body", Response{Status: 200, Body: []byte{0, 0xff, 0, 'O', 'L', 'W', 'X'}}},
+		{"high status", Response{Status: 599, MetaFlags: MetaFullResource | MetaCacheable}},
+		{"max status", Response{Status: math.MaxInt32, MetaFlags: math.MaxUint32}},
+		{"negative status", Response{Status: -1}},
+		{"reason", Response{Status: 299, Body: []byte("b"), Reason: "Mostly OK"}},
+	} {
+		frame := WriteResponseReason(tc.want.Status, tc.want.HeadersFlat, tc.want.Body, tc.want.MetaFlags, tc.want.Reason)
+		if !bytes.HasPrefix(frame, []byte(ResponseMagic)) || frame[len(ResponseMagic)] != ResponseVersion {
+			t.Fatalf("%s: frame header %q", tc.name, frame[:len(ResponseMagic)+1])
+		}
+		got, err := ReadResponse(frame)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		checkResponse(t, tc.name, got, tc.want)
+
+		// The stream decoder must agree, and leave a following frame intact
+		d := NewResponseDecoder(bytes.NewReader(append(frame, frame...)), 0)
+		for i := 0; i < 2; i++ {
+			got, err := d.Decode()
+			if err != nil || !d.Framed() {
+				t.Fatalf("%s: decode %d: %v (framed %t)", tc.name, i, err, d.Framed())
+			}
+			checkResponse(t, tc.name, got, tc.want)
+		}
+	}
+}
+
+func checkResponse(t *testing.T, name string, got, want Response) {
+	t.Helper()
+	if got.Status != want.Status || got.HeadersFlat != want.HeadersFlat || !bytes.Equal(got.Body, want.Body) ||
+		got.MetaFlags != want.MetaFlags || got.Reason != want.Reason {
+		t.Errorf("%s: got status=%d meta=%#x reason=%q headers=%d body=%q", name,
+			got.Status, got.MetaFlags, got.Reason, len(got.HeadersFlat), got.Body)
+	}
+}
+
+func TestReadResponseAcceptsBarePayload(t *testing.T) {
+	frame := WriteResponse(201, "Location: /x\r\n", []byte("made"), 0)
+	got, err := ReadResponse(frame[len(ResponseMagic)+5:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkResponse(t, "bare", got, Response{Status: 201, HeadersFlat: "Location: /x\r\n", Body: []byte("made")})
+}
+
+func TestReadResponseDoesNotAliasInput(t *testing.T) {
+	frame := WriteResponse(200, "", []byte("body"), 0)
+	got, err := ReadResponse(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(frame[len(frame)-8:], "XXXX")
+	if string(got.Body) != "body" {
+		t.Errorf("body changed with the input buffer: %q", got.Body)
+	}
+}
+
+func TestTruncatedFrameIsShort(t *testing.T) {
+	frame := WriteResponse(200, "X-A: 1\r\n", []byte("body"), 0)
+	for _, n := range []int{len(ResponseMagic) + 2, len(ResponseMagic) + 5, len(frame) - 1} {
+		if _, err := ReadResponse(frame[:n]); !errors.Is(err, ErrShortFrame) {
+			t.Errorf("%d of %d bytes: err = %v, want ErrShortFrame", n, len(frame), err)
+		}
+	}
+}
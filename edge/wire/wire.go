@@ -5,7 +5,29 @@ const (
 	HintRateLimited uint32 = 0x1
 	HintWAFBlocked  uint32 = 0x2
 	HintChallenged  uint32 = 0x4
+	// HintHead marks a HEAD request forwarded as GET; the edge discards the body it returns.
+	HintHead uint32 = 0x8
+)
+
+// MetaFlags bits set by Actor Manager on responses.
+const (
+	// MetaFullResource marks the body as the complete representation, so the edge may serve byte ranges.
+	MetaFullResource uint32 = 0x100
+	// MetaCacheable allows the edge to keep the response and serve it stale while the actor is unavailable.
+	MetaCacheable uint32 = 0x200
 )
 
 // Envelope binary layout (length-prefixed slices). Edge serializes requests to Actor Manager:
-// [len(method)][method][len(path)][path][len(headers)][headers][len(body)][body][traceID][spanID][hints]
\ No newline at end of file
+// [len(method)][method][len(path)][path][len(headers)][headers][len(body)][body][traceID][spanID][hints]
+//
+// Response layout returned by Actor Manager:
+// [status:int32][len(headers)][headers][len(body)][body][meta:uint32] optionally followed by [len(reason)][reason]
+//
+// Framed responses (WriteResponse) prepend [magic "OLWX"][version:uint8][len(payload):uint32] to that
+// layout; ReadResponse accepts both framed and bare payloads.
+
+// Response frame header.
+const (
+	ResponseMagic   = "OLWX"
+	ResponseVersion = 1
+)
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	edgehttp "olwsx/edge/http"
+)
+
+// WebSocket upgrade and SSE stream authentication (WSAuthRequired). A client is admitted with either
+//   - a token "<unix-expiry>.<hex hmac-sha256(WSAuthSecret, "ws:<unix-expiry>")>" sent as
+//     "Authorization: Bearer <token>" or, for browsers, the access_token query parameter; or
+//   - a challenge clearance cookie for its IP (WSAuthClearance).
+//
+// Tokens can be minted without the edge:
+//   printf 'ws:%s' "$exp" | openssl dgst -sha256 -hmac "$secret"
+// The accepted credential is removed before the request is forwarded to the actor.
+
+const wsTokenParam = "access_token"
+
+// wsAuthorizer returns the /ws and /sse gate for edgews.Options.Authorize; nil when auth is off.
+func wsAuthorizer(cfg *Config, trustedProxies []*net.IPNet) func(r *http.Request) bool {
+	if !cfg.WSAuthRequired {
+		return nil
+	}
+	secret := []byte(cfg.WSAuthSecret)
+	clearance := cfg.WSAuthClearance && cfg.EnableChallenge
+	return func(r *http.Request) bool {
+		now := time.Now()
+		if len(secret) > 0 {
+			if tok, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && wsTokenValid(secret, tok, now) {
+				r.Header.Del("Authorization")
+				return true
+			}
+			q := r.URL.Query()
+			if tok := q.Get(wsTokenParam); tok != "" && wsTokenValid(secret, tok, now) {
+				q.Del(wsTokenParam)
+				r.URL.RawQuery = q.Encode()
+				return true
+			}
+		}
+		return clearance && clearedAt(r, edgehttp.ClientIP(r, trustedProxies), now)
+	}
+}
+
+// wsTokenValid checks tok's signature and that its expiry is still ahead of now.
+func wsTokenValid(secret []byte, tok string, now time.Time) bool {
+	exp, sig, ok := strings.Cut(tok, ".")
+	if !ok {
+		return false
+	}
+	expiry, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || now.Unix() >= expiry {
+		return false
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	m := hmac.New(sha256.New, secret)
+	m.Write([]byte("ws:" + exp))
+	return hmac.Equal(got, m.Sum(nil))
+}
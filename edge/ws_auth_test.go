@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// wsToken mints a token the way the doc comment on wsAuthorizer describes.
+func wsToken(secret string, expiry time.Time) string {
+	exp := strconv.FormatInt(expiry.Unix(), 10)
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte("ws:" + exp))
+	return exp + "." + hex.EncodeToString(m.Sum(nil))
+}
+
+func TestWSTokenValid(t *testing.T) {
+	now := time.Now()
+	valid := wsToken("s3cret", now.Add(time.Minute))
+	if !wsTokenValid([]byte("s3cret"), valid, now) {
+		t.Fatal("fresh token rejected")
+	}
+	for name, tok := range map[string]string{
+		"expired":      wsToken("s3cret", now.Add(-time.Second)),
+		"wrong secret": wsToken("other", now.Add(time.Minute)),
+		"no signature": strconv.FormatInt(now.Add(time.Minute).Unix(), 10),
+		"bad expiry":   "soon." + valid[len(valid)-64:],
+		"not hex":      valid[:len(valid)-1] + "z",
+		"empty":        "",
+	} {
+		if wsTokenValid([]byte("s3cret"), tok, now) {
+			t.Errorf("%s token accepted", name)
+		}
+	}
+}
+
+func TestWSAuthorizerAdmitsTokensAndClearance(t *testing.T) {
+	cfg := DefaultConfig()
+	if wsAuthorizer(cfg, nil) != nil {
+		t.Fatal("gate installed with ws_auth_required off")
+	}
+	withConfig(t, func(c *Config) { c.EnableChallenge = true })
+	cfg.WSAuthRequired, cfg.WSAuthSecret, cfg.EnableChallenge = true, "s3cret", true
+	authorize := wsAuthorizer(cfg, nil)
+	tok := wsToken("s3cret", time.Now().Add(time.Minute))
+
+	r := httptest.NewRequest("GET", "/ws", nil)
+	r.Header.Set("Authorization", "Bearer "+tok)
+	if !authorize(r) || r.Header.Get("Authorization") != "" {
+		t.Errorf("bearer token: Authorization left as %q", r.Header.Get("Authorization"))
+	}
+	r = httptest.NewRequest("GET", "/ws?room=1&access_token="+tok, nil)
+	if !authorize(r) || r.URL.RawQuery != "room=1" {
+		t.Errorf("query token: forwarded query %q", r.URL.RawQuery)
+	}
+	r = httptest.NewRequest("GET", "/ws", nil)
+	r.AddCookie(&http.Cookie{Name: clearanceCookie, Value: clearance(time.Now(), "192.0.2.1")})
+	if !authorize(r) {
+		t.Error("challenge clearance rejected")
+	}
+
+	for name, r := range map[string]*http.Request{
+		"absent":       httptest.NewRequest("GET", "/ws", nil),
+		"wrong secret": httptest.NewRequest("GET", "/ws?access_token="+wsToken("other", time.Now().Add(time.Minute)), nil),
+		"expired":      httptest.NewRequest("GET", "/ws?access_token="+wsToken("s3cret", time.Now().Add(-time.Second)), nil),
+	} {
+		if authorize(r) {
+			t.Errorf("%s credential admitted", name)
+		}
+	}
+
+	// Without ws_auth_clearance only a token gets in
+	cfg.WSAuthClearance = false
+	r = httptest.NewRequest("GET", "/ws", nil)
+	r.AddCookie(&http.Cookie{Name: clearanceCookie, Value: clearance(time.Now(), "192.0.2.1")})
+	if wsAuthorizer(cfg, nil)(r) {
+		t.Error("clearance admitted with ws_auth_clearance off")
+	}
+}
@@ -15,6 +15,8 @@ package observability
 
 import (
 	"fmt"
+	"io"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -28,15 +30,106 @@ type Span struct {
 	Name      string
 	StartNano int64
 	EndNano   int64
-	Attrs     map[string]string
+
+	// Attributes live inline so starting and ending a span never allocates; only attributes
+	// beyond inlineAttrs spill into extra.
+	attrs  [inlineAttrs]Attr
+	nattrs int
+	extra  []Attr
+}
+
+// inlineAttrs covers the fixed HTTP span attributes with room to spare.
+const inlineAttrs = 8
+
+// AttrKind tells which Attr field holds the value.
+type AttrKind uint8
+
+const (
+	AttrString AttrKind = iota
+	AttrInt
+	AttrFloat
+)
+
+// Attr is one span attribute. Numbers are kept as numbers and only rendered on export.
+type Attr struct {
+	Key   string
+	Kind  AttrKind
+	Str   string
+	Int   int64
+	Float float64
 }
 
-// In-memory ring buffer exporter (lock-free-ish with a small mutex)
+// AppendValue appends the rendered value to dst.
+func (a Attr) AppendValue(dst []byte) []byte {
+	switch a.Kind {
+	case AttrInt:
+		return strconv.AppendInt(dst, a.Int, 10)
+	case AttrFloat:
+		return strconv.AppendFloat(dst, a.Float, 'f', 2, 64)
+	}
+	return append(dst, a.Str...)
+}
+
+// Value renders the attribute value as a string (allocates for numbers; export path only).
+func (a Attr) Value() string {
+	if a.Kind == AttrString {
+		return a.Str
+	}
+	return string(a.AppendValue(nil))
+}
+
+// set stores a, replacing an attribute with the same key.
+func (s *Span) set(a Attr) {
+	for i := 0; i < s.nattrs; i++ {
+		if s.attrs[i].Key == a.Key {
+			s.attrs[i] = a
+			return
+		}
+	}
+	for i := range s.extra {
+		if s.extra[i].Key == a.Key {
+			s.extra[i] = a
+			return
+		}
+	}
+	if s.nattrs < inlineAttrs {
+		s.attrs[s.nattrs] = a
+		s.nattrs++
+		return
+	}
+	s.extra = append(s.extra, a)
+}
+
+// Attrs returns the span's attributes in insertion order.
+func (s *Span) Attrs() []Attr {
+	if len(s.extra) == 0 {
+		return s.attrs[:s.nattrs:s.nattrs]
+	}
+	return append(append(make([]Attr, 0, s.nattrs+len(s.extra)), s.attrs[:s.nattrs]...), s.extra...)
+}
+
+// Attr looks up an attribute's rendered value by key.
+func (s *Span) Attr(key string) (string, bool) {
+	for _, a := range s.Attrs() {
+		if a.Key == key {
+			return a.Value(), true
+		}
+	}
+	return "", false
+}
+
+// In-memory ring buffer exporter (lock-free-ish with a small mutex).
+// Spans between the drain cursor and index are pending export; overwriting one counts as a drop.
 type Exporter struct {
 	mu    sync.Mutex
 	ring  []Span
 	size  int
 	index int
+	read  int // drain cursor (next span handed to Drain)
+
+	dropped    uint64
+	highWater  int                               // pending level that triggers onPressure; 0 disables
+	onPressure func(pending int, dropped uint64) // backpressure signal for the downstream exporter
 }
 
 func NewExporter(size int) *Exporter {
@@ -51,9 +144,70 @@ func NewExporter(size int) *Exporter {
 
 func (e *Exporter) Export(s Span) {
 	e.mu.Lock()
+	if e.index-e.read == e.size {
+		// Ring full: the oldest undrained span is overwritten
+		e.read++
+		e.dropped++
+	}
 	e.ring[e.index%e.size] = s
 	e.index++
+	pending, dropped, fn := e.index-e.read, e.dropped, e.onPressure
+	signal := fn != nil && e.highWater > 0 && pending >= e.highWater
 	e.mu.Unlock()
+	if signal {
+		fn(pending, dropped)
+	}
+}
+
+// SetHighWater installs a backpressure callback fired on Export while pending spans >= n.
+func (e *Exporter) SetHighWater(n int, fn func(pending int, dropped uint64)) {
+	e.mu.Lock()
+	e.highWater = n
+	e.onPressure = fn
+	e.mu.Unlock()
+}
+
+// Drain hands up to max pending spans to a downstream exporter (e.g. OTLP) and advances the cursor.
+func (e *Exporter) Drain(max int) []Span {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	n := e.index - e.read
+	if max > 0 && n > max {
+		n = max
+	}
+	out := make([]Span, 0, n)
+	for i := 0; i < n; i++ {
+		out = append(out, e.ring[(e.read+i)%e.size])
+	}
+	e.read += n
+	return out
+}
+
+// Dropped reports spans overwritten before they were drained.
+func (e *Exporter) Dropped() uint64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.dropped
+}
+
+// Pending reports spans waiting for Drain.
+func (e *Exporter) Pending() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.index - e.read
+}
+
+// WriteMetrics renders exporter health in Prometheus text format.
+func (e *Exporter) WriteMetrics(w io.Writer) {
+	e.mu.Lock()
+	dropped, pending := e.dropped, e.index-e.read
+	e.mu.Unlock()
+	fmt.Fprintln(w, "# HELP olwsx_tracing_spans_dropped_total spans overwritten before export")
+	fmt.Fprintln(w, "# TYPE olwsx_tracing_spans_dropped_total counter")
+	fmt.Fprintf(w, "olwsx_tracing_spans_dropped_total %d\n", dropped)
+	fmt.Fprintln(w, "# HELP olwsx_tracing_spans_pending spans waiting for export")
+	fmt.Fprintln(w, "# TYPE olwsx_tracing_spans_pending gauge")
+	fmt.Fprintf(w, "olwsx_tracing_spans_pending %d\n", pending)
 }
 
 // Deterministic ID generator (not cryptographic)
@@ -104,12 +258,15 @@ func (t *Tracer) Start(name string, parent uint64, actor uint64) SpanHandle {
 		Name:      name,
 		StartNano: now,
 		EndNano:   0,
-		Attrs:     make(map[string]string, 8),
 	}
 	return SpanHandle{span: s, tr: t}
 }
 
-func (h *SpanHandle) Set(k, v string) { h.span.Attrs[k] = v }
+func (h *SpanHandle) Set(k, v string) { h.span.set(Attr{Key: k, Kind: AttrString, Str: v}) }
+
+func (h *SpanHandle) SetInt(k string, v int64) { h.span.set(Attr{Key: k, Kind: AttrInt, Int: v}) }
+
+func (h *SpanHandle) SetFloat(k string, v float64) { h.span.set(Attr{Key: k, Kind: AttrFloat, Float: v}) }
 
 func (h *SpanHandle) End() {
 	h.span.EndNano = time.Now().UnixNano()
@@ -125,9 +282,9 @@ func (t *Tracer) StartHTTPSpan(method, path string, actor uint64) SpanHandle {
 }
 
 func (t *Tracer) EndHTTPSpan(h SpanHandle, status int, bytes int, latencyMs float64) {
-	h.Set("http.status_code", fmt.Sprintf("%d", status))
-	h.Set("net.response_bytes", fmt.Sprintf("%d", bytes))
-	h.Set("olwsx.latency_ms", fmt.Sprintf("%.2f", latencyMs))
+	h.SetInt("http.status_code", int64(status))
+	h.SetInt("net.response_bytes", int64(bytes))
+	h.SetFloat("olwsx.latency_ms", latencyMs)
 	h.End()
 }
 
@@ -159,7 +316,8 @@ func Example() {
 
 	// Dump recent spans
 	for _, s := range exp.DumpRecent(1) {
+		latency, _ := s.Attr("olwsx.latency_ms")
 		fmt.Printf("trace=%x span=%x name=%s latency_ms=%s\n",
-			s.TraceID, s.SpanID, s.Name, s.Attrs["olwsx.latency_ms"])
+			s.TraceID, s.SpanID, s.Name, latency)
 	}
 }
\ No newline at end of file
@@ -0,0 +1,152 @@
+package observability
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestExporterCountsOverwrittenSpans(t *testing.T) {
+	exp := NewExporter(4)
+	var signals []int
+	var lastDropped uint64
+	exp.SetHighWater(3, func(pending int, dropped uint64) {
+		signals = append(signals, pending)
+		lastDropped = dropped
+	})
+	for i := 1; i <= 6; i++ {
+		exp.Export(Span{SpanID: uint64(i)})
+	}
+	if d, p := exp.Dropped(), exp.Pending(); d != 2 || p != 4 {
+		t.Errorf("dropped %d, pending %d; want 2, 4", d, p)
+	}
+	if len(signals) != 4 || signals[0] != 3 || lastDropped != 2 {
+		t.Errorf("high-water signals %v (last dropped %d); want 4 signals from pending 3", signals, lastDropped)
+	}
+
+	// The oldest spans were the ones overwritten
+	got := exp.Drain(0)
+	if len(got) != 4 || got[0].SpanID != 3 || got[3].SpanID != 6 {
+		t.Fatalf("drained %v", got)
+	}
+	exp.Export(Span{SpanID: 7})
+	if d, p := exp.Dropped(), exp.Pending(); d != 2 || p != 1 {
+		t.Errorf("after drain: dropped %d, pending %d; want 2, 1", d, p)
+	}
+
+	var m strings.Builder
+	exp.WriteMetrics(&m)
+	for _, want := range []string{"olwsx_tracing_spans_dropped_total 2\n", "olwsx_tracing_spans_pending 1\n"} {
+		if !strings.Contains(m.String(), want) {
+			t.Errorf("metrics missing %q:\n%s", want, m.String())
+		}
+	}
+}
+
+func TestExporterDrainRespectsMax(t *testing.T) {
+	exp := NewExporter(8)
+	for i := 1; i <= 5; i++ {
+		exp.Export(Span{SpanID: uint64(i)})
+	}
+	if got := exp.Drain(2); len(got) != 2 || got[0].SpanID != 1 || got[1].SpanID != 2 {
+		t.Errorf("Drain(2) = %v", got)
+	}
+	if got := exp.Drain(0); len(got) != 3 || got[0].SpanID != 3 {
+		t.Errorf("Drain(0) = %v", got)
+	}
+	if exp.Dropped() != 0 {
+		t.Errorf("dropped %d without overflow", exp.Dropped())
+	}
+}
+
+func TestHTTPSpanAttributes(t *testing.T) {
+	exp := NewExporter(4)
+	tr := NewTracer(exp, NewIDGen(1))
+	h := tr.StartHTTPSpan("GET", "/hello", 42)
+	h.Set("http.method", "HEAD") // replaces rather than duplicates
+	tr.EndHTTPSpan(h, 200, 1234, 2.125)
+
+	spans := exp.Drain(0)
+	if len(spans) != 1 {
+		t.Fatalf("exported %d spans", len(spans))
+	}
+	s := spans[0]
+	want := [][2]string{
+		{"http.method", "HEAD"},
+		{"http.target", "/hello"},
+		{"http.status_code", "200"},
+		{"net.response_bytes", "1234"},
+		{"olwsx.latency_ms", "2.12"},
+	}
+	attrs := s.Attrs()
+	if len(attrs) != len(want) {
+		t.Fatalf("attrs %v", attrs)
+	}
+	for i, kv := range want {
+		if attrs[i].Key != kv[0] || attrs[i].Value() != kv[1] {
+			t.Errorf("attr %d = %s=%s, want %s=%s", i, attrs[i].Key, attrs[i].Value(), kv[0], kv[1])
+		}
+		if v, ok := s.Attr(kv[0]); !ok || v != kv[1] {
+			t.Errorf("Attr(%q) = %q, %v", kv[0], v, ok)
+		}
+	}
+	if attrs[2].Kind != AttrInt || attrs[4].Kind != AttrFloat {
+		t.Errorf("numeric attributes stored as %v, %v", attrs[2].Kind, attrs[4].Kind)
+	}
+	if s.ActorID != 42 || s.Name != "http.server" || s.EndNano < s.StartNano {
+		t.Errorf("span %+v", s)
+	}
+}
+
+func TestSpanAttributesOverflowInline(t *testing.T) {
+	tr := NewTracer(NewExporter(1), NewIDGen(1))
+	h := tr.Start("op", 0, 0)
+	n := inlineAttrs + 3
+	for i := 0; i < n; i++ {
+		h.SetInt("k"+strconv.Itoa(i), int64(i))
+	}
+	h.Set("k"+strconv.Itoa(n-1), "spilled") // an overflow attribute is replaced in place too
+	attrs := h.span.Attrs()
+	if len(attrs) != n {
+		t.Fatalf("%d attrs, want %d", len(attrs), n)
+	}
+	for i, a := range attrs[:n-1] {
+		if a.Key != "k"+strconv.Itoa(i) || a.Int != int64(i) {
+			t.Errorf("attr %d = %+v", i, a)
+		}
+	}
+	if v, _ := h.span.Attr("k" + strconv.Itoa(n-1)); v != "spilled" {
+		t.Errorf("overflow attr = %q", v)
+	}
+}
+
+func TestHTTPSpanHotPathAllocations(t *testing.T) {
+	tr := NewTracer(NewExporter(64), NewIDGen(1))
+	n := testing.AllocsPerRun(100, func() {
+		h := tr.StartHTTPSpan("GET", "/hello", 42)
+		tr.EndHTTPSpan(h, 200, 1234, 2.1)
+	})
+	if n != 0 {
+		t.Errorf("HTTP span: %v allocs/op, want 0", n)
+	}
+}
+
+func BenchmarkHTTPSpan(b *testing.B) {
+	tr := NewTracer(NewExporter(1024), NewIDGen(1))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		h := tr.StartHTTPSpan("GET", "/hello", 42)
+		tr.EndHTTPSpan(h, 200, 1234, 2.1)
+	}
+}
+
+func BenchmarkAttrAppendValue(b *testing.B) {
+	attrs := []Attr{{Kind: AttrString, Str: "/hello"}, {Kind: AttrInt, Int: 1234}, {Kind: AttrFloat, Float: 2.1}}
+	buf := make([]byte, 0, 64)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, a := range attrs {
+			buf = a.AppendValue(buf[:0])
+		}
+	}
+}